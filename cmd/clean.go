@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	units "github.com/docker/go-units"
+	"github.com/leopardslab/dunner/internal/logger"
+	"github.com/leopardslab/dunner/pkg/docker"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(cleanCmd)
+
+	cleanCmd.Flags().BoolP("force", "f", false, "Remove without asking for confirmation")
+	cleanCmd.Flags().Duration("older-than", 0, "Remove only the objects created before the given duration, like 24h")
+	cleanCmd.Flags().String("task", "", "Remove only the containers of the given task")
+	cleanCmd.Flags().String("larger-than", "", "Remove only the objects taking at least the given size on disk, like 500m or 1g")
+}
+
+var cleanCmd = &cobra.Command{
+	Use:   "clean",
+	Short: "Removes leftover containers and volumes created by dunner",
+	Long:  "This removes the containers and cache volumes created by dunner which are left behind, like the ones kept for debugging or from interrupted runs. It lists what would be removed and asks for confirmation, unless -f flag is passed.",
+	Run:   Clean,
+	Args:  cobra.NoArgs,
+}
+
+// Clean command invoked from command line removes the docker containers and volumes carrying dunner labels
+func Clean(cmd *cobra.Command, args []string) {
+	logger.InitColorOutput()
+	force, _ := cmd.Flags().GetBool("force")
+	olderThan, _ := cmd.Flags().GetDuration("older-than")
+	task, _ := cmd.Flags().GetString("task")
+	var largerThan int64
+	if size, _ := cmd.Flags().GetString("larger-than"); size != "" {
+		var err error
+		if largerThan, err = units.RAMInBytes(size); err != nil {
+			log.Fatalf("invalid size '%s' given with --larger-than: %s", size, err.Error())
+		}
+	}
+
+	ctx := context.Background()
+	cli, err := docker.NewClient(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	leftovers, err := docker.ListLeftovers(ctx, cli, docker.CleanFilter{OlderThan: olderThan, Task: task, LargerThan: largerThan})
+	if err != nil {
+		log.Fatal(err)
+	}
+	if leftovers.Empty() {
+		fmt.Println("Nothing to clean up")
+		return
+	}
+
+	fmt.Println("Following will be removed:")
+	for _, c := range leftovers.Containers {
+		fmt.Printf("  container %.12s  task: %s, step: %s, created %s ago\n", c.ID, c.Labels[docker.LabelTask],
+			c.Labels[docker.LabelStep], time.Since(time.Unix(c.Created, 0)).Round(time.Second))
+	}
+	for _, v := range leftovers.Volumes {
+		fmt.Printf("  volume %s  project: %s, cache: %s\n", v.Name, v.Labels[docker.LabelProject], v.Labels[docker.LabelCache])
+	}
+	if !force && !confirm("Do you want to continue?") {
+		return
+	}
+
+	errs := docker.RemoveLeftovers(ctx, cli, leftovers)
+	for _, err := range errs {
+		logger.ErrorOutput(err.Error())
+	}
+	if len(errs) != 0 {
+		os.Exit(1)
+	}
+	fmt.Println("Clean up successful!")
+}
+
+// confirm asks the user the given question on stdin, and returns true only if answered yes
+func confirm(question string) bool {
+	fmt.Printf("%s [y/N] ", question)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/leopardslab/dunner/pkg/config"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	rootCmd.AddCommand(completionCmd)
+}
+
+var completionCmd = &cobra.Command{
+	Use:   "completion [bash|zsh|fish]",
+	Short: "Generates shell completion script",
+	Long: `This generates the completion script for the given shell, which can be loaded as,
+
+Bash:
+  $ source <(dunner completion bash)
+
+Zsh:
+  $ dunner completion zsh > "${fpath[1]}/_dunner"
+
+Fish:
+  $ dunner completion fish > ~/.config/fish/completions/dunner.fish`,
+	Run:       Completion,
+	Args:      cobra.ExactValidArgs(1),
+	ValidArgs: []string{"bash", "zsh", "fish"},
+}
+
+// Completion command invoked from command line writes the completion script of the given shell to stdout
+func Completion(cmd *cobra.Command, args []string) {
+	var err error
+	switch args[0] {
+	case "bash":
+		err = rootCmd.GenBashCompletion(os.Stdout)
+	case "zsh":
+		err = rootCmd.GenZshCompletion(os.Stdout)
+	case "fish":
+		err = rootCmd.GenFishCompletion(os.Stdout, true)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// completeTaskNames lists the tasks defined in the dunner task file, to be used for dynamic completion of task names
+func completeTaskNames(_ *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) != 0 {
+		return nil, cobra.ShellCompDirectiveDefault
+	}
+	// Logs are written to stdout, which would otherwise be read as completions
+	log.SetOutput(ioutil.Discard)
+	configs, err := config.GetConfigs(viper.GetString("DunnerTaskFile"))
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+	var taskNames []string
+	for taskName := range configs.Tasks {
+		if strings.HasPrefix(taskName, toComplete) {
+			taskNames = append(taskNames, taskName)
+		}
+	}
+	sort.Strings(taskNames)
+	return taskNames, cobra.ShellCompDirectiveNoFileComp
+}
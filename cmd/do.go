@@ -1,6 +1,9 @@
 package cmd
 
 import (
+	"time"
+
+	"github.com/leopardslab/dunner/pkg/docker"
 	"github.com/leopardslab/dunner/pkg/dunner"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -21,18 +24,186 @@ func init() {
 		log.Fatal(err)
 	}
 
+	// Step filters
+	doCmd.Flags().StringSlice("only", nil, "Run only the steps of the task with given names")
+	if err := viper.BindPFlag("Only", doCmd.Flags().Lookup("only")); err != nil {
+		log.Fatal(err)
+	}
+	doCmd.Flags().StringSlice("skip", nil, "Skip the steps of the task with given names")
+	if err := viper.BindPFlag("Skip", doCmd.Flags().Lookup("skip")); err != nil {
+		log.Fatal(err)
+	}
+	doCmd.Flags().String("from", "", "Run the task from the step with given name, skipping the steps before it")
+	if err := viper.BindPFlag("From", doCmd.Flags().Lookup("from")); err != nil {
+		log.Fatal(err)
+	}
+
+	doCmd.Flags().Bool("explain", false, "Print for each step whether it is run or skipped, and why")
+	if err := viper.BindPFlag("Explain", doCmd.Flags().Lookup("explain")); err != nil {
+		log.Fatal(err)
+	}
+
+	// Keep containers for debugging
+	doCmd.Flags().String("keep-containers", "", "Do not remove containers of 'failed' or 'all' steps, for debugging")
+	doCmd.Flags().Lookup("keep-containers").NoOptDefVal = docker.KeepFailedContainers
+	if err := viper.BindPFlag("Keep-containers", doCmd.Flags().Lookup("keep-containers")); err != nil {
+		log.Fatal(err)
+	}
+
+	// Git metadata of the project
+	doCmd.Flags().String("mount-git", docker.MountGitReadOnly, "Mount the .git directory of the project read-only with 'ro', writable with 'rw', or hide it from steps with 'none'")
+	doCmd.Flags().Lookup("mount-git").NoOptDefVal = docker.MountGitWritable
+	if err := viper.BindPFlag("Mount-git", doCmd.Flags().Lookup("mount-git")); err != nil {
+		log.Fatal(err)
+	}
+
 	// Force-pull
 	doCmd.Flags().Bool("force-pull", false, "Force pulling of images from Docker Hub")
 	if err := viper.BindPFlag("Force-pull", doCmd.Flags().Lookup("force-pull")); err != nil {
 		log.Fatal(err)
 	}
 
+	// Pulled images
+	doCmd.Flags().Bool("rm-images", false, "Remove the images pulled during the run once it ends, keeping the images on the host before and those of kept containers")
+	if err := viper.BindPFlag("Rm-images", doCmd.Flags().Lookup("rm-images")); err != nil {
+		log.Fatal(err)
+	}
+
+	// Built images
+	doCmd.Flags().Bool("no-build-cache", false, "Build the images of steps again, without reusing images built earlier or the build cache of Docker")
+	if err := viper.BindPFlag("No-build-cache", doCmd.Flags().Lookup("no-build-cache")); err != nil {
+		log.Fatal(err)
+	}
+
+	// Retries of pulls
+	doCmd.Flags().Int("pull-attempts", 4, "Number of attempts to pull an image failing with a transient error, like a network error or a registry error 5xx")
+	if err := viper.BindPFlag("Pull-attempts", doCmd.Flags().Lookup("pull-attempts")); err != nil {
+		log.Fatal(err)
+	}
+	doCmd.Flags().Duration("pull-backoff-max", 30*time.Second, "Maximum wait before retrying a failed pull, the wait doubles from 1s after each attempt")
+	if err := viper.BindPFlag("Pull-backoff-max", doCmd.Flags().Lookup("pull-backoff-max")); err != nil {
+		log.Fatal(err)
+	}
+
+	// Image platform
+	doCmd.Flags().String("platform", "", "Platform of the images of steps not setting their own, like 'linux/amd64'")
+	if err := viper.BindPFlag("Platform", doCmd.Flags().Lookup("platform")); err != nil {
+		log.Fatal(err)
+	}
+
+	// Image overrides
+	doCmd.Flags().StringSlice("image-override", nil, "Replace images of steps, as 'name=image' where name is a step name or image")
+	if err := viper.BindPFlag("Image-override", doCmd.Flags().Lookup("image-override")); err != nil {
+		log.Fatal(err)
+	}
+
+	// Container names
+	doCmd.Flags().String("container-name", "", "Name containers of steps from the template, with {task}, {step} and {pid} replaced. Random names are used if empty")
+	doCmd.Flags().Lookup("container-name").NoOptDefVal = "dunner-{task}-{step}-{pid}"
+	if err := viper.BindPFlag("Container-name", doCmd.Flags().Lookup("container-name")); err != nil {
+		log.Fatal(err)
+	}
+
+	// Stop timeout
+	doCmd.Flags().Duration("stop-timeout", 10*time.Second, "Time given to services, and to containers of steps when Dunner is interrupted, to stop gracefully before they are killed")
+	if err := viper.BindPFlag("Stop-timeout", doCmd.Flags().Lookup("stop-timeout")); err != nil {
+		log.Fatal(err)
+	}
+
+	// Output prefix
+	doCmd.Flags().String("output-prefix", "[{task}/{step}] ", "Format of the prefix of output lines of steps, with {task} and {step} replaced by their names. Empty to not prefix output")
+	if err := viper.BindPFlag("Output-prefix", doCmd.Flags().Lookup("output-prefix")); err != nil {
+		log.Fatal(err)
+	}
+
+	// Maximum lines of output
+	doCmd.Flags().Int("max-log-lines", 0, "Show only the first and last N lines of output of each command, the output of failed commands and output files are kept in full. 0 shows all output")
+	if err := viper.BindPFlag("Max-log-lines", doCmd.Flags().Lookup("max-log-lines")); err != nil {
+		log.Fatal(err)
+	}
+
+	// Log files of steps
+	doCmd.Flags().String("log-dir", "", "Save the output of each step to <task>/<step>.log in the directory, relative to the project directory")
+	doCmd.Flags().Lookup("log-dir").NoOptDefVal = ".dunner/logs"
+	if err := viper.BindPFlag("Log-dir", doCmd.Flags().Lookup("log-dir")); err != nil {
+		log.Fatal(err)
+	}
+
+	// Events
+	doCmd.Flags().Bool("events", false, "Emit newline-delimited JSON events of the run to the standard output, logs are written to the standard error")
+	if err := viper.BindPFlag("Events", doCmd.Flags().Lookup("events")); err != nil {
+		log.Fatal(err)
+	}
+
+	// Summary of steps
+	doCmd.Flags().Bool("summary-only", false, "Print only a table of the steps run at the end, with the output of failed steps")
+	if err := viper.BindPFlag("Summary-only", doCmd.Flags().Lookup("summary-only")); err != nil {
+		log.Fatal(err)
+	}
+
+	// Image digests
+	doCmd.Flags().Bool("print-digests", false, "Print the digests of the images run, to be pinned as `locked_digests` of the task file")
+	if err := viper.BindPFlag("Print-digests", doCmd.Flags().Lookup("print-digests")); err != nil {
+		log.Fatal(err)
+	}
+
+	// Privileged steps
+	doCmd.Flags().Bool("allow-privileged", false, "Allow steps to run in privileged mode or with added capabilities")
+	if err := viper.BindPFlag("AllowPrivileged", doCmd.Flags().Lookup("allow-privileged")); err != nil {
+		log.Fatal(err)
+	}
+
+	// Parallel tasks
+	doCmd.Flags().Bool("parallel-tasks", false, "Run all the given tasks concurrently, with their output prefixed by task name")
+	if err := viper.BindPFlag("Parallel-tasks", doCmd.Flags().Lookup("parallel-tasks")); err != nil {
+		log.Fatal(err)
+	}
+	doCmd.Flags().Int("max-parallel", 0, "Maximum number of tasks to run concurrently with --parallel-tasks, unlimited if 0")
+	if err := viper.BindPFlag("Max-parallel", doCmd.Flags().Lookup("max-parallel")); err != nil {
+		log.Fatal(err)
+	}
+
+	// Parallel steps
+	doCmd.Flags().Int("max-parallel-steps", 0, "Maximum number of steps marked `parallel` to run concurrently, as many as CPUs if 0")
+	if err := viper.BindPFlag("Max-parallel-steps", doCmd.Flags().Lookup("max-parallel-steps")); err != nil {
+		log.Fatal(err)
+	}
+
+	// Concurrency
+	doCmd.Flags().Int("concurrency", 0, "Maximum number of step containers running at a time, across parallel tasks and steps, as many as GOMAXPROCS if 0")
+	if err := viper.BindPFlag("Concurrency", doCmd.Flags().Lookup("concurrency")); err != nil {
+		log.Fatal(err)
+	}
+
+	// Changed tasks
+	doCmd.Flags().String("since-commit", "", "Run only the tasks whose inputs changed since the given git commit")
+	if err := viper.BindPFlag("Since-commit", doCmd.Flags().Lookup("since-commit")); err != nil {
+		log.Fatal(err)
+	}
+
+	// Notification
+	doCmd.Flags().String("notify", "", "Post a JSON notification to the given webhook URL when the task completes")
+	if err := viper.BindPFlag("Notify", doCmd.Flags().Lookup("notify")); err != nil {
+		log.Fatal(err)
+	}
+
+	// Watch mode
+	doCmd.Flags().BoolP("watch", "w", false, "Re-run the task whenever files of the project change")
+	if err := viper.BindPFlag("Watch", doCmd.Flags().Lookup("watch")); err != nil {
+		log.Fatal(err)
+	}
+	doCmd.Flags().StringSlice("watch-pattern", nil, "Re-run the task only when files matching given glob patterns change")
+	if err := viper.BindPFlag("Watch-pattern", doCmd.Flags().Lookup("watch-pattern")); err != nil {
+		log.Fatal(err)
+	}
 }
 
 var doCmd = &cobra.Command{
 	Use:   "do [taskName]",
 	Short: "Do whatever you say",
-	Long:  `You can run any task defined on the '.dunner.yaml' with this command`,
+	Long:  `You can run any task defined on the '.dunner.yaml' with this command. The task name may be a glob pattern like 'test:*' to run all the matching tasks. With --parallel-tasks, all the arguments are names of tasks to be run concurrently`,
 	Run:   dunner.Do,
 	Args:  cobra.MinimumNArgs(1),
+
+	ValidArgsFunction: completeTaskNames,
 }
@@ -1,12 +1,14 @@
 package cmd
 
 import (
-	"context"
 	"fmt"
 	"os"
 
-	"github.com/docker/docker/client"
+	"github.com/leopardslab/dunner/internal"
 	"github.com/leopardslab/dunner/internal/logger"
+	"github.com/leopardslab/dunner/pkg/config"
+	"github.com/leopardslab/dunner/pkg/docker"
+	G "github.com/leopardslab/dunner/pkg/global"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
@@ -18,14 +20,22 @@ var rootCmd = &cobra.Command{
 	Short: "Dunner is a Docker based task-runner",
 	Long:  `You can define a set of commands and on what Docker images these commands should run as steps. A task has many steps. Then you can run these tasks with 'dunner do nameoftask'`,
 	Run: func(cmd *cobra.Command, args []string) {
-
-		cli, err := client.NewClientWithOpts(client.FromEnv)
-		if err != nil {
+		status := docker.CheckDaemon()
+		if err := status.Explain(); err != nil {
 			log.Fatal(err)
 		}
-		cli.NegotiateAPIVersion(context.Background())
-
 		fmt.Println("Dunner running!")
+		fmt.Println(status)
+	},
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		logger.InitLogLevel()
+		if err := logger.InitLogFormat(); err != nil {
+			log.Fatal(err)
+		}
+		// Not bound to viper, which splits values of array flags at commas
+		if defines, err := cmd.Flags().GetStringArray("define"); err == nil {
+			viper.Set("Define", defines)
+		}
 	},
 }
 
@@ -37,7 +47,7 @@ func init() {
 	}
 
 	// Dunner task file
-	rootCmd.PersistentFlags().StringP("task-file", "t", ".dunner.yaml", "Task file to be run")
+	rootCmd.PersistentFlags().StringP("task-file", "t", ".dunner.yaml", "Task file to be run, defaults to $"+internal.TaskFileEnv+" or else "+internal.DefaultDunnerTaskFileName+" of the current directory or its parents")
 	if err := rootCmd.MarkPersistentFlagFilename("task-file", "yaml", "yml"); err != nil {
 		log.Fatal(err)
 	}
@@ -45,8 +55,14 @@ func init() {
 		log.Fatal(err)
 	}
 
+	// Task file as template
+	rootCmd.PersistentFlags().Bool("template", false, "Render the task file as a Go template before parsing")
+	if err := viper.BindPFlag("Template", rootCmd.PersistentFlags().Lookup("template")); err != nil {
+		log.Fatal(err)
+	}
+
 	// Environment file
-	rootCmd.PersistentFlags().StringP("env-file", "e", ".env", "Environment file")
+	rootCmd.PersistentFlags().StringSliceP("env-file", "e", []string{".env"}, "Environment file, can be repeated to override variables of the earlier files")
 	if err := rootCmd.MarkPersistentFlagFilename("env-file", "env"); err != nil {
 		log.Fatal(err)
 	}
@@ -54,9 +70,24 @@ func init() {
 		log.Fatal(err)
 	}
 
+	// Variables
+	rootCmd.PersistentFlags().StringArrayP("define", "D", nil, "Define a variable as 'key=value' for the task file, referred as $key like environment variables or as {{ .Vars.key }} in templates. It overrides environment variables without being one")
+
+	// Profile
+	rootCmd.PersistentFlags().String("profile", "", "Profile of the task file to apply, overriding its environment variables")
+	if err := viper.BindPFlag("Profile", rootCmd.PersistentFlags().Lookup("profile")); err != nil {
+		log.Fatal(err)
+	}
+
+	// Secret backends
+	rootCmd.PersistentFlags().StringSlice("secret-backend", nil, fmt.Sprintf("Enable a backend resolving secrets in environment variables, one of %v", config.SecretBackends()))
+	if err := viper.BindPFlag("Secret-backends", rootCmd.PersistentFlags().Lookup("secret-backend")); err != nil {
+		log.Fatal(err)
+	}
+
 	// Working directory
-	rootCmd.PersistentFlags().StringP("context", "C", "./", "Working directory")
-	if err := rootCmd.MarkPersistentFlagDirname("env-file"); err != nil {
+	rootCmd.PersistentFlags().StringP("context", "C", "", "Project directory mounted on the containers, defaults to the directory of the task file")
+	if err := rootCmd.MarkPersistentFlagDirname("context"); err != nil {
 		log.Fatal(err)
 	}
 	if err := viper.BindPFlag("WorkingDirectory", rootCmd.PersistentFlags().Lookup("context")); err != nil {
@@ -69,10 +100,19 @@ func init() {
 		log.Fatal(err)
 	}
 
+	// Log format
+	rootCmd.PersistentFlags().String("log-format", logger.TextFormat, "Format of the logs, 'text' or 'json'")
+	if err := viper.BindPFlag("Log-format", rootCmd.PersistentFlags().Lookup("log-format")); err != nil {
+		log.Fatal(err)
+	}
+
 }
 
 // Execute method executes the 'Run' method of rootCmd.
 func Execute() {
+	// Set once the build metadata is known, `--version` is then handled by cobra
+	rootCmd.Version = orUnknown(G.VERSION)
+	rootCmd.SetVersionTemplate(versionInfo())
 	if err := rootCmd.Execute(); err != nil {
 		log.Fatal(err)
 		os.Exit(1)
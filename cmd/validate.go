@@ -12,19 +12,30 @@ import (
 
 func init() {
 	rootCmd.AddCommand(validateCmd)
+
+	// JSON schema of the task file
+	validateCmd.Flags().Bool("task-file-schema", false, "Print the JSON schema of the task file instead, for editors to complete and validate task files")
 }
 
 var validateCmd = &cobra.Command{
 	Use:     "validate",
 	Short:   "Validate the dunner task file `.dunner.yaml`",
-	Long:    "You can validate task file `.dunner.yaml` with this command to see if there are any parse errors",
+	Long:    "You can validate task file `.dunner.yaml` with this command to see if there are any parse errors. With `--task-file-schema`, the JSON schema of task files is printed instead, which editors can be pointed at",
 	Run:     Validate,
 	Args:    cobra.NoArgs,
 	Aliases: []string{"v"},
 }
 
 // Validate command invoked from command line, validates the dunner task file. If there are errors, it fails with non-zero exit code.
-func Validate(_ *cobra.Command, args []string) {
+func Validate(cmd *cobra.Command, args []string) {
+	if printSchema, _ := cmd.Flags().GetBool("task-file-schema"); printSchema {
+		schema, err := config.Schema()
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(string(schema))
+		return
+	}
 	logger.InitColorOutput()
 	var dunnerFile = viper.GetString("DunnerTaskFile")
 
@@ -41,5 +52,8 @@ func Validate(_ *cobra.Command, args []string) {
 		}
 		os.Exit(1)
 	}
+	for _, warning := range configs.Warnings() {
+		log.Warn(warning)
+	}
 	fmt.Println("Validation successful!")
 }
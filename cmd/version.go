@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"fmt"
+	"runtime"
 
 	G "github.com/leopardslab/dunner/pkg/global"
 	"github.com/spf13/cobra"
@@ -14,8 +15,22 @@ func init() {
 var versionCmd = &cobra.Command{
 	Use:   "version",
 	Short: "Print the version number of Dunner",
-	Long:  `All software has versions. This is Dunners's`,
+	Long:  `All software has versions. This is Dunners's, along with the git commit and date it is built from and at`,
 	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println(G.VERSION)
+		fmt.Print(versionInfo())
 	},
 }
+
+// versionInfo returns the version of Dunner along with the metadata of its build, for bug reports
+func versionInfo() string {
+	return fmt.Sprintf("Dunner %s\n  commit: %s\n  built:  %s\n  go:     %s %s/%s\n", orUnknown(G.VERSION),
+		orUnknown(G.COMMIT), orUnknown(G.DATE), runtime.Version(), runtime.GOOS, runtime.GOARCH)
+}
+
+// orUnknown returns the value of build metadata, or `unknown` if it is not set by the build
+func orUnknown(value string) string {
+	if value == "" {
+		return "unknown"
+	}
+	return value
+}
@@ -47,3 +47,7 @@ tasks:
 
 // DefaultDunnerTaskFileName is the default dunner task file name
 const DefaultDunnerTaskFileName = ".dunner.yaml"
+
+// TaskFileEnv is the environment variable giving the task file, unless given with `--task-file`. Without either, the
+// default task file is searched in the current directory and its parents
+const TaskFileEnv = "DUNNER_TASK_FILE"
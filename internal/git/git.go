@@ -0,0 +1,53 @@
+// Package git provides helpers to query the git repository of the project.
+package git
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// ErrNotRepository is returned when the directory is not in a git repository, or git is not installed
+var ErrNotRepository = errors.New("git: not a git repository, or git is not installed")
+
+// ChangedFiles returns the files changed in the working tree of `dir` since the given ref, including untracked files.
+// Paths are relative to `dir`, and only the files within `dir` are returned.
+func ChangedFiles(dir string, ref string) ([]string, error) {
+	if _, err := run(dir, "rev-parse", "--is-inside-work-tree"); err != nil {
+		return nil, ErrNotRepository
+	}
+
+	changed, err := run(dir, "diff", "--name-only", "--relative", ref, "--")
+	if err != nil {
+		return nil, fmt.Errorf("git: failed to find files changed since '%s': %s", ref, err.Error())
+	}
+	untracked, err := run(dir, "ls-files", "--others", "--exclude-standard")
+	if err != nil {
+		return nil, fmt.Errorf("git: failed to find untracked files: %s", err.Error())
+	}
+	return append(changed, untracked...), nil
+}
+
+// run runs the git command in `dir` and returns the lines of its output
+func run(dir string, args ...string) ([]string, error) {
+	var out, errOut bytes.Buffer
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Stdout = &out
+	cmd.Stderr = &errOut
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(errOut.String()); msg != "" {
+			return nil, errors.New(msg)
+		}
+		return nil, err
+	}
+	var lines []string
+	for _, line := range strings.Split(out.String(), "\n") {
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, nil
+}
@@ -0,0 +1,104 @@
+package git
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func initRepo(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "dunner-git")
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, "README.md"))
+	writeFile(t, filepath.Join(dir, "pkg", "main.go"))
+	gitCmd(t, dir, "init", "-q")
+	gitCmd(t, dir, "add", ".")
+	gitCmd(t, dir, "-c", "user.name=dunner", "-c", "user.email=dunner@example.com", "commit", "-q", "-m", "initial")
+	return dir
+}
+
+func writeFile(t *testing.T, file string) {
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(file, []byte(file), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func gitCmd(t *testing.T, dir string, args ...string) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git %v failed: %s: %s", args, err, out)
+	}
+}
+
+func TestChangedFiles(t *testing.T) {
+	dir := initRepo(t)
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "pkg", "main.go"), []byte("changed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, "pkg", "new.go"))
+
+	files, err := ChangedFiles(dir, "HEAD")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(files)
+	expected := []string{"pkg/main.go", "pkg/new.go"}
+	if !reflect.DeepEqual(files, expected) {
+		t.Fatalf("expected changed files: %v, got: %v", expected, files)
+	}
+}
+
+func TestChangedFilesRelativeToDir(t *testing.T) {
+	dir := initRepo(t)
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "pkg", "main.go"), []byte("changed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, "README.md"))
+
+	files, err := ChangedFiles(filepath.Join(dir, "pkg"), "HEAD")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(files, []string{"main.go"}) {
+		t.Fatalf("expected only changed files in directory, got: %v", files)
+	}
+}
+
+func TestChangedFilesWithInvalidRef(t *testing.T) {
+	dir := initRepo(t)
+	defer os.RemoveAll(dir)
+
+	_, err := ChangedFiles(dir, "no-such-ref")
+
+	if err == nil || err == ErrNotRepository {
+		t.Fatalf("expected error on invalid ref, got: %v", err)
+	}
+}
+
+func TestChangedFilesNotInRepository(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dunner-no-git")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	_, err = ChangedFiles(dir, "HEAD")
+
+	if err != ErrNotRepository {
+		t.Fatalf("expected error: %s, got: %v", ErrNotRepository, err)
+	}
+}
@@ -1,8 +1,14 @@
 package logger
 
 import (
+	"bytes"
 	"fmt"
+	"hash/fnv"
+	"io"
 	"os"
+	"path/filepath"
+	"sync"
+	"time"
 
 	"github.com/fatih/color"
 	"github.com/sirupsen/logrus"
@@ -12,14 +18,69 @@ import (
 // Log is a globally configured logger
 var Log = logrus.New()
 
+// Formats of the logs, as set by the `Log-format` setting
+const (
+	TextFormat = "text"
+	JSONFormat = "json"
+)
+
+const timestampFormat = "2006-01-02 15:04:05"
+
 func init() {
-	Log.Formatter = new(logrus.TextFormatter)                                     // Default
-	Log.Formatter.(*logrus.TextFormatter).FullTimestamp = true                    // Enable timestamp
-	Log.Formatter.(*logrus.TextFormatter).TimestampFormat = "2006-01-02 15:04:05" // Customize timestamp format
+	Log.Formatter = newTextFormatter() // Default
 	Log.Level = logrus.TraceLevel
 	Log.Out = os.Stdout
 }
 
+// textFormatter formats logs as text without their fields, as the messages name the task and step already
+type textFormatter struct {
+	logrus.TextFormatter
+}
+
+func newTextFormatter() *textFormatter {
+	return &textFormatter{logrus.TextFormatter{FullTimestamp: true, TimestampFormat: timestampFormat}}
+}
+
+func (f *textFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	withoutFields := *entry
+	withoutFields.Data = logrus.Fields{}
+	return f.TextFormatter.Format(&withoutFields)
+}
+
+// InitLogFormat sets the format of logs as given by the `Log-format` setting, text by default. JSON logs have the
+// level, time and message of every log, along with the task and step it is about, if any.
+func InitLogFormat() error {
+	switch format := viper.GetString("Log-format"); format {
+	case "", TextFormat:
+		Log.Formatter = newTextFormatter()
+	case JSONFormat:
+		Log.Formatter = &logrus.JSONFormatter{
+			TimestampFormat: time.RFC3339,
+			FieldMap:        logrus.FieldMap{logrus.FieldKeyMsg: "message"},
+		}
+	default:
+		return fmt.Errorf("logger: invalid log format '%s', must be '%s' or '%s'", format, TextFormat, JSONFormat)
+	}
+	return nil
+}
+
+// WithStep returns a logger attaching the task and step to the logs, as fields of JSON logs
+func WithStep(task string, step string) *logrus.Entry {
+	return Log.WithFields(logrus.Fields{"task": task, "step": step})
+}
+
+// WithStepTo returns a logger like WithStep, writing the logs to out instead of the output of Log with the same
+// format and level
+func WithStepTo(out io.Writer, task string, step string) *logrus.Entry {
+	to := &logrus.Logger{Out: out, Hooks: Log.Hooks, Formatter: Log.Formatter, Level: Log.Level, ExitFunc: Log.ExitFunc}
+	return to.WithFields(logrus.Fields{"task": task, "step": step})
+}
+
+// WithTask returns a logger attaching the task to the logs, as a field of JSON logs
+func WithTask(task string) *logrus.Entry {
+	return Log.WithField("task", task)
+}
+
 // InitColorOutput disables colorized output if no-color flag is passed
 func InitColorOutput() {
 	if viper.GetBool("No-color") {
@@ -27,6 +88,18 @@ func InitColorOutput() {
 	}
 }
 
+// InitLogLevel sets the level of logs to be shown, debug logs are shown only in verbose mode. Only warnings and
+// errors are shown with the `Summary-only` setting, unless in verbose mode.
+func InitLogLevel() {
+	if viper.GetBool("Verbose") {
+		Log.Level = logrus.DebugLevel
+	} else if viper.GetBool("Summary-only") {
+		Log.Level = logrus.WarnLevel
+	} else {
+		Log.Level = logrus.InfoLevel
+	}
+}
+
 // ErrorOutput prints the given message in red color
 func ErrorOutput(format string, a ...interface{}) {
 	color.Red(format, a...)
@@ -50,3 +123,196 @@ func (*ErrWriter) Write(b []byte) (n int, err error) {
 	_, e := color.New(color.FgRed).Fprintln(os.Stderr, string(b))
 	return len(b), e
 }
+
+// writeLock serializes the lines written by all PrefixWriters
+var writeLock sync.Mutex
+
+// PrefixWriter is an io.Writer that prefixes every line written to the underlying writer. Only whole lines are
+// written, so that output from concurrent writers sharing the same underlying writer does not interleave mid-line.
+// A carriage return, used by progress bars to rewrite a line, also ends a line so that the rewritten line is
+// prefixed as well.
+type PrefixWriter struct {
+	out       io.Writer
+	prefix    string
+	lineColor *color.Color
+	buf       []byte
+}
+
+// NewPrefixWriter returns a pointer to new PrefixWriter object writing to `out`
+func NewPrefixWriter(out io.Writer, prefix string) *PrefixWriter {
+	return &PrefixWriter{out: out, prefix: prefix}
+}
+
+// NewErrPrefixWriter returns a pointer to new PrefixWriter object writing lines to `out` in red color, like
+// ErrWriter does
+func NewErrPrefixWriter(out io.Writer, prefix string) *PrefixWriter {
+	return &PrefixWriter{out: out, prefix: prefix, lineColor: color.New(color.FgRed)}
+}
+
+// Write function to implement io.Writer interface. A partial line is buffered until it is completed or flushed.
+func (w *PrefixWriter) Write(b []byte) (n int, err error) {
+	w.buf = append(w.buf, b...)
+	for {
+		i := bytes.IndexAny(w.buf, "\r\n")
+		// A carriage return at the end of the buffer may be followed by a line feed in the next write
+		if i < 0 || (w.buf[i] == '\r' && i == len(w.buf)-1) {
+			break
+		}
+		if w.buf[i] == '\r' && w.buf[i+1] == '\n' {
+			i++
+		}
+		if err = w.writeLine(w.buf[:i+1]); err != nil {
+			return len(b), err
+		}
+		w.buf = w.buf[i+1:]
+	}
+	return len(b), nil
+}
+
+// Flush writes out the buffered partial line, if any
+func (w *PrefixWriter) Flush() error {
+	if len(w.buf) == 0 {
+		return nil
+	}
+	line := append(w.buf, '\n')
+	w.buf = nil
+	return w.writeLine(line)
+}
+
+func (w *PrefixWriter) writeLine(line []byte) error {
+	writeLock.Lock()
+	defer writeLock.Unlock()
+	if w.lineColor != nil {
+		content := bytes.TrimRight(line, "\r\n")
+		_, err := fmt.Fprintf(w.out, "%s%s%s", w.prefix, w.lineColor.Sprint(string(content)), line[len(content):])
+		return err
+	}
+	_, err := fmt.Fprintf(w.out, "%s%s", w.prefix, line)
+	return err
+}
+
+// LineLimitWriter is an io.Writer that writes only the first `max` lines to the underlying writer, and holds the
+// following ones until Finish is called. The held lines are then written in full, or only the last `max` of them
+// after a note telling how many lines were left out. It is wrapped by a PrefixWriter to prefix the lines, as the held
+// lines are written while holding the lock of PrefixWriters.
+type LineLimitWriter struct {
+	out   io.Writer
+	max   int
+	lines int
+	held  []byte
+}
+
+// NewLineLimitWriter returns a pointer to new LineLimitWriter object writing to `out`
+func NewLineLimitWriter(out io.Writer, max int) *LineLimitWriter {
+	return &LineLimitWriter{out: out, max: max}
+}
+
+// Write function to implement io.Writer interface. Lines past the first `max` lines are held.
+func (w *LineLimitWriter) Write(b []byte) (n int, err error) {
+	if w.lines >= w.max {
+		w.held = append(w.held, b...)
+		return len(b), nil
+	}
+	end := len(b)
+	for i, c := range b {
+		if c != '\n' {
+			continue
+		}
+		w.lines++
+		if w.lines == w.max {
+			end = i + 1
+			break
+		}
+	}
+	if _, err = w.out.Write(b[:end]); err != nil {
+		return len(b), err
+	}
+	w.held = append(w.held, b[end:]...)
+	return len(b), nil
+}
+
+// Finish writes out the held lines, all of them if `full` is set or if they are no more than `max`, otherwise only
+// the last `max` lines after a note on the truncated lines
+func (w *LineLimitWriter) Finish(full bool) error {
+	held := w.held
+	w.held = nil
+	if len(held) == 0 {
+		return nil
+	}
+
+	writeLock.Lock()
+	defer writeLock.Unlock()
+	start, lines := len(held), 0
+	for i := len(held) - 1; i >= 0; i-- {
+		// A partial last line counts as a line
+		if held[i] == '\n' && i != len(held)-1 {
+			lines++
+			if lines == w.max {
+				start = i + 1
+				break
+			}
+		}
+		start = i
+	}
+	if full || start == 0 {
+		_, err := w.out.Write(held)
+		return err
+	}
+	truncated := bytes.Count(held[:start], []byte("\n"))
+	if _, err := fmt.Fprintf(w.out, "... %d lines truncated ...\n", truncated); err != nil {
+		return err
+	}
+	_, err := w.out.Write(held[start:])
+	return err
+}
+
+// prefixColors are the colors of prefixes, picked for each key
+var prefixColors = []color.Attribute{color.FgCyan, color.FgMagenta, color.FgYellow, color.FgGreen, color.FgBlue}
+
+// ColorPrefix returns the prefix in a color picked for the key, so that prefixes of different keys can be told
+// apart. The prefix is not colored if colors are disabled or the output is not a terminal.
+func ColorPrefix(prefix string, key string) string {
+	if prefix == "" {
+		return ""
+	}
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return color.New(prefixColors[h.Sum32()%uint32(len(prefixColors))]).Sprint(prefix)
+}
+
+// FileWriter is an io.Writer that writes to a file, to keep a copy of output written elsewhere. A failed write does
+// not fail the writer, so that the output is still written to the other writers, the error is returned on Close.
+type FileWriter struct {
+	file *os.File
+	err  error
+}
+
+// NewFileWriter returns a pointer to new FileWriter object writing to the file, which is created along with its parent
+// directories, or truncated if it exists already
+func NewFileWriter(filename string) (*FileWriter, error) {
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return nil, err
+	}
+	file, err := os.Create(filename)
+	if err != nil {
+		return nil, err
+	}
+	return &FileWriter{file: file}, nil
+}
+
+// Write function to implement io.Writer interface. Nothing is written after a write fails.
+func (w *FileWriter) Write(b []byte) (n int, err error) {
+	if w.err == nil {
+		_, w.err = w.file.Write(b)
+	}
+	return len(b), nil
+}
+
+// Close closes the file, and returns the error of the first failed write if any
+func (w *FileWriter) Close() error {
+	err := w.file.Close()
+	if w.err != nil {
+		return w.err
+	}
+	return err
+}
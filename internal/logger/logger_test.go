@@ -2,10 +2,16 @@ package logger
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/fatih/color"
+	"github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 )
 
@@ -39,6 +45,95 @@ func TestInitColorOutput_True(t *testing.T) {
 	}
 }
 
+func TestInitLogLevel(t *testing.T) {
+	defer viper.Set("Verbose", false)
+	viper.Set("Verbose", true)
+
+	InitLogLevel()
+
+	if Log.Level != logrus.DebugLevel {
+		t.Fatalf("expected log level to be debug in verbose mode, got %s", Log.Level)
+	}
+
+	viper.Set("Verbose", false)
+
+	InitLogLevel()
+
+	if Log.Level != logrus.InfoLevel {
+		t.Fatalf("expected log level to be info, got %s", Log.Level)
+	}
+
+	defer viper.Set("Summary-only", false)
+	viper.Set("Summary-only", true)
+
+	InitLogLevel()
+
+	if Log.Level != logrus.WarnLevel {
+		t.Fatalf("expected log level to be warn with summary only, got %s", Log.Level)
+	}
+}
+
+func TestInitLogFormatJSON(t *testing.T) {
+	defer Log.SetOutput(Log.Out)
+	defer func() {
+		viper.Set("Log-format", TextFormat)
+		InitLogFormat()
+	}()
+	viper.Set("Log-format", JSONFormat)
+	defer Log.SetLevel(Log.Level)
+	Log.SetLevel(logrus.InfoLevel)
+	var buf bytes.Buffer
+	Log.SetOutput(&buf)
+
+	if err := InitLogFormat(); err != nil {
+		t.Fatal(err)
+	}
+	WithStep("build", "test").Info("Running tests")
+
+	var entry map[string]string
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("expected a JSON log, got: %s", buf.String())
+	}
+	for key, expected := range map[string]string{"level": "info", "message": "Running tests", "task": "build", "step": "test"} {
+		if entry[key] != expected {
+			t.Errorf("expected %s of log to be: %s, got: %s", key, expected, entry[key])
+		}
+	}
+	if entry["time"] == "" {
+		t.Errorf("expected time of log, got: %v", entry)
+	}
+}
+
+func TestInitLogFormatText(t *testing.T) {
+	defer Log.SetOutput(Log.Out)
+	viper.Set("Log-format", TextFormat)
+	defer Log.SetLevel(Log.Level)
+	Log.SetLevel(logrus.InfoLevel)
+	var buf bytes.Buffer
+	Log.SetOutput(&buf)
+
+	if err := InitLogFormat(); err != nil {
+		t.Fatal(err)
+	}
+	WithStep("build", "test").Info("Running tests")
+
+	if !strings.HasSuffix(buf.String(), " level=info msg=\"Running tests\"\n") {
+		t.Fatalf("expected text log without fields, got: %s", buf.String())
+	}
+}
+
+func TestInitLogFormatInvalid(t *testing.T) {
+	defer viper.Set("Log-format", TextFormat)
+	viper.Set("Log-format", "xml")
+
+	err := InitLogFormat()
+
+	expected := "logger: invalid log format 'xml', must be 'text' or 'json'"
+	if err == nil || err.Error() != expected {
+		t.Fatalf("expected error: %s, got: %v", expected, err)
+	}
+}
+
 func ExampleBullet() {
 	arg := "foobar"
 
@@ -46,3 +141,146 @@ func ExampleBullet() {
 
 	// Output: • setup foobar
 }
+
+func TestPrefixWriter(t *testing.T) {
+	buf := new(bytes.Buffer)
+	w := NewPrefixWriter(buf, "[test] ")
+
+	fmt.Fprint(w, "foo\nba")
+	fmt.Fprint(w, "r\nbaz")
+
+	expected := "[test] foo\n[test] bar\n"
+	if buf.String() != expected {
+		t.Fatalf("expected: %q, got: %q", expected, buf.String())
+	}
+
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected += "[test] baz\n"
+	if buf.String() != expected {
+		t.Fatalf("expected: %q, got: %q", expected, buf.String())
+	}
+}
+
+func TestPrefixWriterWithCarriageReturns(t *testing.T) {
+	buf := new(bytes.Buffer)
+	w := NewPrefixWriter(buf, "[test] ")
+
+	fmt.Fprint(w, "10%\r50%\r")
+	fmt.Fprint(w, "\ndone\r\n")
+
+	expected := "[test] 10%\r[test] 50%\r\n[test] done\r\n"
+	if buf.String() != expected {
+		t.Fatalf("expected: %q, got: %q", expected, buf.String())
+	}
+}
+
+func TestLineLimitWriter(t *testing.T) {
+	output := "1\n2\n3\n4\n5\n6\n7"
+	tests := []struct {
+		max      int
+		full     bool
+		expected string
+	}{
+		{max: 2, expected: "1\n2\n... 3 lines truncated ...\n6\n7"},
+		{max: 2, full: true, expected: output},
+		{max: 3, expected: "1\n2\n3\n... 1 lines truncated ...\n5\n6\n7"},
+		{max: 4, expected: output},
+		{max: 10, expected: output},
+	}
+	for _, test := range tests {
+		buf := new(bytes.Buffer)
+		w := NewLineLimitWriter(buf, test.max)
+		for _, line := range strings.SplitAfter(output, "\n") {
+			fmt.Fprint(w, line)
+		}
+		if err := w.Finish(test.full); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != test.expected {
+			t.Errorf("max %d: expected: %q, got: %q", test.max, test.expected, buf.String())
+		}
+	}
+}
+
+func TestLineLimitWriterWritesHeadAsItComes(t *testing.T) {
+	buf := new(bytes.Buffer)
+	w := NewLineLimitWriter(buf, 1)
+
+	fmt.Fprint(w, "1\n2\n")
+
+	if buf.String() != "1\n" {
+		t.Fatalf("expected first line to be written, got: %q", buf.String())
+	}
+}
+
+func TestColorPrefix(t *testing.T) {
+	defer func(noColor bool) { color.NoColor = noColor }(color.NoColor)
+
+	color.NoColor = false
+	colored := ColorPrefix("[build/test] ", "build")
+	if colored == "[build/test] " || !strings.Contains(colored, "[build/test] ") {
+		t.Errorf("expected colored prefix, got: %q", colored)
+	}
+	if ColorPrefix("[build/lint] ", "build") != strings.Replace(colored, "test", "lint", 1) {
+		t.Errorf("expected prefixes of the same task to have the same color")
+	}
+	if ColorPrefix("", "build") != "" {
+		t.Errorf("expected empty prefix not to be colored")
+	}
+
+	color.NoColor = true
+	if prefix := ColorPrefix("[build/test] ", "build"); prefix != "[build/test] " {
+		t.Errorf("expected prefix not to be colored, got: %q", prefix)
+	}
+}
+
+func TestFileWriterCreatesParentDirectories(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dunner-logger")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "logs", "build", "output.log")
+
+	w, err := NewFileWriter(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Fprint(w, "foo\n")
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "foo\n" {
+		t.Fatalf("expected: %q, got: %q", "foo\n", string(content))
+	}
+}
+
+func TestFileWriterReportsWriteErrorOnClose(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dunner-logger")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	w, err := NewFileWriter(filepath.Join(dir, "output.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.file.Close()
+
+	n, err := w.Write([]byte("foo"))
+
+	if n != 3 || err != nil {
+		t.Fatalf("expected write to succeed, got: %d, %v", n, err)
+	}
+	if err := w.Close(); err == nil {
+		t.Fatal("expected error on close after failed write")
+	}
+}
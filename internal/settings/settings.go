@@ -24,20 +24,47 @@ func Init() {
 
 	// Files
 	viper.SetDefault("DunnerTaskFile", internal.DefaultDunnerTaskFileName)
+	viper.BindEnv("DunnerTaskFile", internal.TaskFileEnv)
 	viper.SetDefault("DotenvFile", ".env")
 	viper.SetDefault("GlobalLogFile", "/var/log/dunner/logs/")
 	viper.SetDefault("LocalLogFile", nil)
 
 	// Working Directory
-	viper.SetDefault("WorkingDirectory", "./")
+	viper.SetDefault("WorkingDirectory", "")
 
 	// Modes
 	viper.SetDefault("Async", false)
 	viper.SetDefault("Verbose", false)
 	viper.SetDefault("Dry-run", false)
+	viper.SetDefault("Explain", false)
 	viper.SetDefault("No-color", false)
+	viper.SetDefault("Log-format", "text")
 	viper.SetDefault("Force-pull", false)
+	viper.SetDefault("No-build-cache", false)
+	viper.SetDefault("Rm-images", false)
+	viper.SetDefault("Template", false)
+	viper.SetDefault("Keep-containers", "")
+	viper.SetDefault("Mount-git", "ro")
+	viper.SetDefault("Watch", false)
+	viper.SetDefault("Parallel-tasks", false)
+	viper.SetDefault("Max-parallel", 0)
+	viper.SetDefault("Max-parallel-steps", 0)
+	viper.SetDefault("Concurrency", 0)
+	viper.SetDefault("Container-name", "")
+	viper.SetDefault("Pull-attempts", 4)
+	viper.SetDefault("Pull-backoff-max", "30s")
+	viper.SetDefault("Since-commit", "")
+	viper.SetDefault("Notify", "")
+	viper.SetDefault("Print-digests", false)
+	viper.SetDefault("Platform", "")
+	viper.SetDefault("Summary-only", false)
+	viper.SetDefault("Stop-timeout", "10s")
+	viper.SetDefault("Output-prefix", "[{task}/{step}] ")
+	viper.SetDefault("Max-log-lines", 0)
+	viper.SetDefault("Events", false)
+	viper.SetDefault("Log-dir", "")
+	viper.SetDefault("Profile", "")
 
-	// Constants
-	viper.SetDefault("DockerAPIVersion", "1.39")
+	// Security
+	viper.SetDefault("AllowPrivileged", false)
 }
@@ -2,10 +2,12 @@ package settings
 
 import (
 	"fmt"
+	"os"
 	"reflect"
 	"testing"
 
 	"github.com/leopardslab/dunner/internal"
+	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
 
@@ -13,19 +15,76 @@ func TestInit(t *testing.T) {
 	Init()
 	fmt.Print(viper.AllSettings())
 	defaultSettings := map[string]interface{}{
-		"dunnertaskfile":   internal.DefaultDunnerTaskFileName,
-		"dotenvfile":       ".env",
-		"globallogfile":    "/var/log/dunner/logs/",
-		"workingdirectory": "./",
-		"async":            false,
-		"verbose":          false,
-		"dry-run":          false,
-		"force-pull":       false,
-		"dockerapiversion": "1.39",
-		"no-color":         false,
+		"dunnertaskfile":     internal.DefaultDunnerTaskFileName,
+		"dotenvfile":         ".env",
+		"globallogfile":      "/var/log/dunner/logs/",
+		"workingdirectory":   "",
+		"async":              false,
+		"verbose":            false,
+		"dry-run":            false,
+		"explain":            false,
+		"force-pull":         false,
+		"no-build-cache":     false,
+		"rm-images":          false,
+		"template":           false,
+		"keep-containers":    "",
+		"mount-git":          "ro",
+		"watch":              false,
+		"parallel-tasks":     false,
+		"max-parallel":       0,
+		"max-parallel-steps": 0,
+		"concurrency":        0,
+		"container-name":     "",
+		"pull-attempts":      4,
+		"pull-backoff-max":   "30s",
+		"since-commit":       "",
+		"notify":             "",
+		"print-digests":      false,
+		"platform":           "",
+		"summary-only":       false,
+		"stop-timeout":       "10s",
+		"output-prefix":      "[{task}/{step}] ",
+		"max-log-lines":      0,
+		"events":             false,
+		"log-dir":            "",
+		"profile":            "",
+		"allowprivileged":    false,
+		"no-color":           false,
+		"log-format":         "text",
 	}
 
 	if !reflect.DeepEqual(viper.AllSettings(), defaultSettings) {
 		t.Fatal("Default not equal to as expected")
 	}
 }
+
+func TestInitWithTaskFileEnv(t *testing.T) {
+	defer viper.Reset()
+	defer os.Setenv(internal.TaskFileEnv, os.Getenv(internal.TaskFileEnv))
+
+	os.Unsetenv(internal.TaskFileEnv)
+	Init()
+	if file := viper.GetString("DunnerTaskFile"); file != internal.DefaultDunnerTaskFileName {
+		t.Errorf("expected default task file %s, got: %s", internal.DefaultDunnerTaskFileName, file)
+	}
+
+	os.Setenv(internal.TaskFileEnv, "ci/dunner.yaml")
+	if file := viper.GetString("DunnerTaskFile"); file != "ci/dunner.yaml" {
+		t.Errorf("expected task file of %s, got: %s", internal.TaskFileEnv, file)
+	}
+
+	flags := (&cobra.Command{}).Flags()
+	flags.String("task-file", internal.DefaultDunnerTaskFileName, "")
+	if err := viper.BindPFlag("DunnerTaskFile", flags.Lookup("task-file")); err != nil {
+		t.Fatal(err)
+	}
+	if file := viper.GetString("DunnerTaskFile"); file != "ci/dunner.yaml" {
+		t.Errorf("expected task file of %s over default flag, got: %s", internal.TaskFileEnv, file)
+	}
+	if err := flags.Set("task-file", "release.yaml"); err != nil {
+		t.Fatal(err)
+	}
+	if file := viper.GetString("DunnerTaskFile"); file != "release.yaml" {
+		t.Errorf("expected task file of the flag, got: %s", file)
+	}
+}
@@ -136,7 +136,7 @@ func getExecutableCommand(command ...string) *exec.Cmd {
 		cmd.Args = append([]string{command[0]}, command[1:]...)
 	} else {
 		cmd = exec.Command(command[0])
-		cmd.Args = append([]string{command[0]})
+		cmd.Args = []string{command[0]}
 	}
 	return cmd
 }
@@ -144,6 +144,12 @@ func getExecutableCommand(command ...string) *exec.Cmd {
 // ShowLoadingMessage is qn util function to show an inline loading message while the process is being carried out.
 // This MUST be run in a separate goroutine than the process.
 func ShowLoadingMessage(loadingMsg string, finalLog string, done *chan bool, show *chan bool) {
+	ShowLoadingProgress(loadingMsg, nil, finalLog, done, show)
+}
+
+// ShowLoadingProgress shows an inline loading message like ShowLoadingMessage, followed by the status returned by
+// `progress` if not nil. This MUST be run in a separate goroutine than the process.
+func ShowLoadingProgress(loadingMsg string, progress func() string, finalLog string, done *chan bool, show *chan bool) {
 	ticker := time.Tick(time.Second / 2)
 	busyChars := []string{`-`, `\`, `|`, `/`}
 	x := 0
@@ -158,9 +164,15 @@ loop:
 			if flag.Lookup("test.v") == nil {
 				x %= 4
 				<-ticker
-				fmt.Printf("\r%s... %s",
+				status := ""
+				if progress != nil {
+					// The status is followed by clearing the rest of the line, as it may be shorter than before
+					status = " " + progress() + "\033[K"
+				}
+				fmt.Printf("\r%s... %s%s",
 					loadingMsg,
 					busyChars[x],
+					status,
 				)
 				x++
 			}
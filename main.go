@@ -6,10 +6,17 @@ import (
 	G "github.com/leopardslab/dunner/pkg/global"
 )
 
-var version string
+// Build metadata, set with `-ldflags "-X main.version=<version> -X main.commit=<sha> -X main.date=<date>"`
+var (
+	version string
+	commit  string
+	date    string
+)
 
 func main() {
 	settings.Init()
 	G.VERSION = version
+	G.COMMIT = commit
+	G.DATE = date
 	cmd.Execute()
 }
@@ -0,0 +1,119 @@
+package config
+
+import (
+	"fmt"
+)
+
+// Command is the arguments of a command of a step. In the task file, it can instead refer to an alias, like
+// `{alias: build}`, which is left empty when it is decoded and replaced by the command of the alias once the task
+// file is loaded, see resolveAliases.
+type Command []string
+
+// UnmarshalYAML decodes the command, leaving it empty if it refers to an alias
+func (command *Command) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var args []string
+	err := unmarshal(&args)
+	if err == nil {
+		*command = args
+		return nil
+	}
+	var ref interface{}
+	if unmarshal(&ref) == nil {
+		if _, isAlias := aliasName(ref); isAlias {
+			return nil
+		}
+	}
+	return err
+}
+
+// Commands is a list of commands, any of which can refer to an alias like Command
+type Commands [][]string
+
+// UnmarshalYAML decodes the commands, leaving those referring to an alias empty
+func (commands *Commands) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var list []Command
+	if err := unmarshal(&list); err != nil {
+		return err
+	}
+	*commands = make(Commands, len(list))
+	for i := range list {
+		(*commands)[i] = list[i]
+	}
+	return nil
+}
+
+// aliasRefs are the aliases referred by the commands of a step, until they are resolved
+type aliasRefs struct {
+	command  string         // Alias referred by `command`
+	commands map[int]string // Aliases referred by `commands`, by index
+}
+
+// decodeAliasRefs returns the aliases referred by the `command` and `commands` of the fields of a step
+func decodeAliasRefs(fields map[string]interface{}) aliasRefs {
+	var refs aliasRefs
+	refs.command, _ = aliasName(fields["command"])
+	commands, _ := fields["commands"].([]interface{})
+	for i, command := range commands {
+		if name, isAlias := aliasName(command); isAlias {
+			if refs.commands == nil {
+				refs.commands = make(map[int]string)
+			}
+			refs.commands[i] = name
+		}
+	}
+	return refs
+}
+
+// resolveAliases replaces the references to aliases in the commands of the steps of the task file, like
+// `command: {alias: build}` or an item `{alias: build}` of `commands`, with the command defined for the alias in the
+// top-level `aliases` map. It fails if a referenced alias is not defined.
+func resolveAliases(configs *Configs) error {
+	for _, taskName := range configs.taskNames() {
+		steps := configs.Tasks[taskName].Steps
+		for i := range steps {
+			step := &steps[i]
+			stepName := step.Name
+			if stepName == "" {
+				stepName = DefaultStepName(i)
+			}
+			resolve := func(name string) ([]string, error) {
+				command, ok := configs.Aliases[name]
+				if !ok {
+					return nil, fmt.Errorf("config: task '%s': step '%s' refers to alias '%s' which is not defined in `aliases`", taskName, stepName, name)
+				}
+				return command, nil
+			}
+
+			if step.aliasRefs.command != "" {
+				command, err := resolve(step.aliasRefs.command)
+				if err != nil {
+					return err
+				}
+				step.Command = command
+			}
+			for j := range step.Commands {
+				name, ok := step.aliasRefs.commands[j]
+				if !ok {
+					continue
+				}
+				command, err := resolve(name)
+				if err != nil {
+					return err
+				}
+				step.Commands[j] = command
+			}
+			step.aliasRefs = aliasRefs{}
+		}
+	}
+	return nil
+}
+
+// aliasName returns the name of the alias referred by the command, if it is a reference like `{alias: build}`
+func aliasName(command interface{}) (string, bool) {
+	ref, ok := command.(map[interface{}]interface{})
+	if !ok || len(ref) != 1 {
+		return "", false
+	}
+	name, ok := ref["alias"].(string)
+	return name, ok
+}
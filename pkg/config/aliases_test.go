@@ -0,0 +1,108 @@
+package config
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestGetConfigsResolvesAliases(t *testing.T) {
+	var content = []byte(`
+aliases:
+  build: ["go", "build", "./..."]
+  test: ["go", "test", "./..."]
+tasks:
+  build:
+    steps:
+      - image: golang
+        command: {alias: build}
+  ci:
+    steps:
+      - image: golang
+        commands:
+          - {alias: build}
+          - ["go", "vet", "./..."]
+          - alias: test`)
+	tmpFile := createTempTaskFile(t, content)
+	defer os.Remove(tmpFile)
+
+	configs, err := GetConfigs(tmpFile)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if command := configs.Tasks["build"].Steps[0].Command; !reflect.DeepEqual(command, Command{"go", "build", "./..."}) {
+		t.Errorf("expected command of alias, got: %v", command)
+	}
+	expected := Commands{{"go", "build", "./..."}, {"go", "vet", "./..."}, {"go", "test", "./..."}}
+	if commands := configs.Tasks["ci"].Steps[0].Commands; !reflect.DeepEqual(commands, expected) {
+		t.Errorf("expected commands: %v, got: %v", expected, commands)
+	}
+}
+
+func TestGetConfigsWithUndefinedAlias(t *testing.T) {
+	var content = []byte(`
+aliases:
+  build: ["go", "build", "./..."]
+tasks:
+  ci:
+    steps:
+      - image: golang
+        commands:
+          - {alias: test}`)
+	tmpFile := createTempTaskFile(t, content)
+	defer os.Remove(tmpFile)
+
+	_, err := GetConfigs(tmpFile)
+
+	expected := "config: task 'ci': step 'step-1' refers to alias 'test' which is not defined in `aliases`"
+	if err == nil || err.Error() != expected {
+		t.Fatalf("expected error: %s, got: %v", expected, err)
+	}
+}
+
+func TestGetConfigsResolvesAliasesWithAnchors(t *testing.T) {
+	var content = []byte(`
+aliases:
+  build: ["go", "build", "./..."]
+x-go: &go
+  image: golang
+  envs: [CGO_ENABLED=0]
+tasks:
+  build:
+    steps:
+      - <<: *go
+        command: {alias: build}
+      - <<: *go
+        name: vet
+        commands:
+          - ["go", "vet", "./..."]`)
+	tmpFile := createTempTaskFile(t, content)
+	defer os.Remove(tmpFile)
+
+	configs, err := GetConfigs(tmpFile)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Step{
+		{Name: "step-1", Index: 1, Image: "golang", Envs: []string{"CGO_ENABLED=0"}, Command: Command{"go", "build", "./..."}},
+		{Name: "vet", Index: 2, Image: "golang", Envs: []string{"CGO_ENABLED=0"}, Commands: Commands{{"go", "vet", "./..."}}},
+	}
+	if steps := configs.Tasks["build"].Steps; !reflect.DeepEqual(steps, expected) {
+		t.Errorf("expected steps: %v, got: %v", expected, steps)
+	}
+}
+
+func TestValidateEmptyAlias(t *testing.T) {
+	configs := &Configs{
+		Aliases: map[string][]string{"build": {}},
+		Tasks:   map[string]Task{"test": {Steps: []Step{getSampleStep()}}},
+	}
+
+	errs := configs.Validate()
+
+	if len(errs) != 1 {
+		t.Fatalf("expected an error for empty alias, got: %v", errs)
+	}
+}
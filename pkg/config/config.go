@@ -22,21 +22,38 @@ You can use the library by creating a dunner task file. For example,
 
 Use `GetConfigs` method to parse the dunner task file, and `ParseEnvs` method to parse environment variables file, or
 the host environment variables. The environment variables are used by invoking in the task file using backticks(`$var`).
+
+Standard YAML anchors, aliases and merge keys can be used to share step definitions across tasks. Top-level keys
+that are not part of the task file format are ignored, so they can hold the anchored definitions. For example,
+	x-node: &node
+	  image: node
+	tasks:
+	  test:
+	    steps:
+	      - <<: *node
+	        command: ["npm", "test"]
 */
 package config
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"os"
 	"path"
 	"path/filepath"
 	"reflect"
 	"regexp"
 	"strings"
+	"text/template"
+	"time"
 
+	"github.com/docker/distribution/reference"
 	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/go-connections/nat"
+	units "github.com/docker/go-units"
 	"github.com/go-playground/locales/en"
 	ut "github.com/go-playground/universal-translator"
 	"github.com/joho/godotenv"
@@ -44,6 +61,7 @@ import (
 	"github.com/leopardslab/dunner/internal/logger"
 	"github.com/leopardslab/dunner/internal/util"
 	"github.com/leopardslab/dunner/pkg/docker"
+	digest "github.com/opencontainers/go-digest"
 	"github.com/spf13/viper"
 	validator "gopkg.in/go-playground/validator.v9"
 	en_translations "gopkg.in/go-playground/validator.v9/translations/en"
@@ -52,8 +70,12 @@ import (
 
 var log = logger.Log
 var dotEnv map[string]string
+var defines map[string]string
 var hostDirpattern = "`\\$(?P<name>[^`]+)`"
 var hostDirRegex = regexp.MustCompile(hostDirpattern)
+var cacheKeyRegex = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+var passEnvRegex = regexp.MustCompile(`^[a-zA-Z_*?][a-zA-Z0-9_*?]*!?$`)
+var hostNameRegex = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9.-]*[a-zA-Z0-9])?$`)
 
 var (
 	uni                     *ut.UniversalTranslator
@@ -61,6 +83,21 @@ var (
 	trans                   ut.Translator
 	defaultPermissionMode   = "r"
 	validDirPermissionModes = []string{defaultPermissionMode, "wr", "rw", "w"}
+	validNetworkModes       = []string{"host", "none", "bridge"}
+	daemonSocket            = docker.SocketSource
+	validCapabilities       = []string{
+		"ALL", "AUDIT_CONTROL", "AUDIT_READ", "AUDIT_WRITE", "BLOCK_SUSPEND", "BPF", "CHECKPOINT_RESTORE", "CHOWN",
+		"DAC_OVERRIDE", "DAC_READ_SEARCH", "FOWNER", "FSETID", "IPC_LOCK", "IPC_OWNER", "KILL", "LEASE",
+		"LINUX_IMMUTABLE", "MAC_ADMIN", "MAC_OVERRIDE", "MKNOD", "NET_ADMIN", "NET_BIND_SERVICE", "NET_BROADCAST",
+		"NET_RAW", "PERFMON", "SETFCAP", "SETGID", "SETPCAP", "SETUID", "SYS_ADMIN", "SYS_BOOT", "SYS_CHROOT",
+		"SYS_MODULE", "SYS_NICE", "SYS_PACCT", "SYS_PTRACE", "SYS_RAWIO", "SYS_RESOURCE", "SYS_TIME",
+		"SYS_TTY_CONFIG", "SYSLOG", "WAKE_ALARM",
+	}
+	networkNameRegex = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+	validPlatforms   = []string{
+		"linux/amd64", "linux/386", "linux/arm64", "linux/arm64/v8", "linux/arm/v7", "linux/arm/v6",
+		"linux/ppc64le", "linux/s390x", "windows/amd64",
+	}
 )
 
 type contextKey string
@@ -79,6 +116,16 @@ var customValidations = []customValidation{
 		translation:  "mount directory '{0}' is invalid. Check format is '<valid_src_dir>:<valid_dest_dir>:<optional_mode>' and has right permission level",
 		validationFn: ValidateMountDir,
 	},
+	{
+		tag:          "mounttarget",
+		translation:  "mount directory '{0}' is invalid. Destination directory must be an absolute path in the container",
+		validationFn: ValidateMountTarget,
+	},
+	{
+		tag:          "projectdir",
+		translation:  "project directory '{0}' is invalid. It must be an absolute path in the container, other than '/'",
+		validationFn: ValidateProjectDir,
+	},
 	{
 		tag:          "follow_exist",
 		translation:  "follow task '{0}' does not exist",
@@ -90,8 +137,68 @@ var customValidations = []customValidation{
 		validationFn: ParseMountDir,
 	},
 	{
-		tag:         "required_without",
-		translation: "image is required, unless the task has a `follow` field",
+		tag:          "memory",
+		translation:  "memory '{0}' is invalid. It must be a size like '512m' or '2g'",
+		validationFn: ValidateMemory,
+	},
+	{
+		tag:          "gpus",
+		translation:  "gpus '{0}' is invalid. It must be 'all', a positive number of GPUs or 'device=<id>[,<id>...]', without mixing `all` with device IDs",
+		validationFn: ValidateGPUs,
+	},
+	{
+		tag:          "port",
+		translation:  "port '{0}' is invalid. Check format is '<host_port>:<container_port>[/<protocol>]' with ports from 1 to 65535",
+		validationFn: ValidatePort,
+	},
+	{
+		tag:          "network",
+		translation:  fmt.Sprintf("network '{0}' is invalid. It must be one of %s, or the name of a Docker network", strings.Join(validNetworkModes, ", ")),
+		validationFn: ValidateNetwork,
+	},
+	{
+		tag:          "duration",
+		translation:  "duration '{0}' is invalid. It must be a duration like '5s' or '1m30s'",
+		validationFn: ValidateDuration,
+	},
+	{
+		tag:          "capability",
+		translation:  "capability '{0}' is invalid. It must be a Linux capability like 'NET_ADMIN' or 'SYS_ADMIN', or 'ALL'",
+		validationFn: ValidateCapability,
+	},
+	{
+		tag:          "digest",
+		translation:  "digest '{0}' is invalid. It must be of the form 'sha256:<hex>'",
+		validationFn: ValidateDigest,
+	},
+	{
+		tag:          "platform",
+		translation:  fmt.Sprintf("platform '{0}' is invalid. Valid platforms are: %s", strings.Join(validPlatforms, ", ")),
+		validationFn: ValidatePlatform,
+	},
+	{
+		tag:          "cachekey",
+		translation:  "cache key '{0}' is invalid. It must start with a letter or digit, followed by letters, digits, '_', '.' or '-'",
+		validationFn: ValidateCacheKey,
+	},
+	{
+		tag:          "cachepath",
+		translation:  "cache path '{0}' is invalid. It must be an absolute path in the container",
+		validationFn: ValidateProjectDir,
+	},
+	{
+		tag:          "passenv",
+		translation:  "pass_env '{0}' is invalid. It must be the name of an environment variable, which may have '*' and '?' wildcards, followed by '!' if it is required",
+		validationFn: ValidatePassEnv,
+	},
+	{
+		tag:          "extrahost",
+		translation:  "extra host '{0}' is invalid. Check format is '<name>:<ip>', where ip may be '" + docker.HostGateway + "'",
+		validationFn: ValidateExtraHost,
+	},
+	{
+		tag:         "required_without_all",
+		translation: "image is required, unless the step has a `follow`, `build` or `images` field or is `local`",
 	},
 }
 
@@ -104,17 +211,190 @@ func (configs *Configs) Validate() []error {
 	valErrs := govalidator.Struct(configs)
 	errs := formatErrors(valErrs, "")
 	ctx := context.WithValue(context.Background(), configsKey, configs)
+	for _, key := range duplicateEnvKeys(configs.Envs) {
+		errs = append(errs, fmt.Errorf("environment variable '%s' is defined more than once in global `envs`", key))
+	}
 
-	// Each step is validated separately so that task name can be added in error messages
-	for taskName, task := range configs.Tasks {
+	// Each step is validated separately so that task name can be added in error messages, tasks are validated in the
+	// order of their names so that errors are always reported in the same order
+	for _, taskName := range configs.taskNames() {
+		task := configs.Tasks[taskName]
+		for _, key := range duplicateEnvKeys(task.Envs) {
+			errs = append(errs, fmt.Errorf("task '%s': environment variable '%s' is defined more than once in `envs`", taskName, key))
+		}
+		root := task.Root(viper.GetString("WorkingDirectory"))
+		if task.WorkdirRoot != "" && !util.DirExists(root) {
+			errs = append(errs, fmt.Errorf("task '%s': `workdir_root` '%s' is not a directory", taskName, task.WorkdirRoot))
+		}
+		taskCtx := context.WithValue(ctx, rootKey, root)
+		stepNames := make(map[string]struct{})
+		var sharedImage string
 		for _, steps := range task.Steps {
-			taskValErrs := govalidator.VarCtx(ctx, steps, "dive")
+			for _, key := range duplicateEnvKeys(steps.Envs) {
+				errs = append(errs, fmt.Errorf("task '%s': step '%s' has environment variable '%s' defined more than once in `envs`", taskName, steps.Name, key))
+			}
+			taskValErrs := govalidator.VarCtx(taskCtx, steps, "dive")
 			errs = append(errs, formatErrors(taskValErrs, taskName)...)
+			if steps.Local && steps.Image != "" {
+				errs = append(errs, fmt.Errorf("task '%s': step '%s' cannot have both `image` and `local`", taskName, steps.Name))
+			}
+			if steps.Build != nil && steps.Image != "" {
+				errs = append(errs, fmt.Errorf("task '%s': step '%s' cannot have both `image` and `build`", taskName, steps.Name))
+			}
+			if len(steps.Images) != 0 {
+				if steps.Image != "" {
+					errs = append(errs, fmt.Errorf("task '%s': step '%s' cannot have both `image` and `images`", taskName, steps.Name))
+				}
+				if steps.Local || steps.Build != nil || steps.Follow != "" {
+					errs = append(errs, fmt.Errorf("task '%s': step '%s' cannot have `images` along with `local`, `build` or `follow`", taskName, steps.Name))
+				}
+			}
+			if steps.Privileged && dropsAllCapabilities(steps) {
+				errs = append(errs, fmt.Errorf("task '%s': step '%s' cannot be `privileged` and drop all capabilities with `cap_drop`", taskName, steps.Name))
+			}
+			if !task.MountsProject(steps) {
+				// Directories starting with an environment variable are only known once it is replaced
+				if steps.Dir != "" && !path.IsAbs(steps.Dir) && !strings.HasPrefix(steps.Dir, "`$") {
+					errs = append(errs, fmt.Errorf("task '%s': step '%s' must have an absolute `dir` as `mount_project` is false", taskName, steps.Name))
+				}
+				if steps.CreateDir {
+					errs = append(errs, fmt.Errorf("task '%s': step '%s' cannot have `create_dir` as `mount_project` is false", taskName, steps.Name))
+				}
+			}
+			if steps.Local && steps.MountsDockerSock() {
+				errs = append(errs, fmt.Errorf("task '%s': step '%s' cannot have `mount_docker_sock` as it is `local`", taskName, steps.Name))
+			}
+			if steps.Local && steps.InheritEnv {
+				errs = append(errs, fmt.Errorf("task '%s': step '%s' cannot have `inherit_env` as it is `local`, it already runs with the environment of the host", taskName, steps.Name))
+			}
+			if steps.Local && steps.GPUs != "" {
+				errs = append(errs, fmt.Errorf("task '%s': step '%s' cannot have `gpus` as it is `local`", taskName, steps.Name))
+			}
+			if steps.Local && len(steps.Caches) != 0 {
+				errs = append(errs, fmt.Errorf("task '%s': step '%s' cannot have `caches` as it is `local`", taskName, steps.Name))
+			}
+			if steps.Interactive && steps.ContainerPerCommand {
+				errs = append(errs, fmt.Errorf("task '%s': step '%s' cannot have both `interactive` and `container_per_command`", taskName, steps.Name))
+			}
+			if steps.Interactive && steps.Parallel {
+				errs = append(errs, fmt.Errorf("task '%s': step '%s' cannot have both `interactive` and `parallel`", taskName, steps.Name))
+			}
+			if task.SharedContainer && !steps.Local && steps.Follow == "" {
+				if steps.Build != nil {
+					errs = append(errs, fmt.Errorf("task '%s': step '%s' cannot have `build` as the task has `shared_container`", taskName, steps.Name))
+				}
+				if steps.ContainerPerCommand {
+					errs = append(errs, fmt.Errorf("task '%s': step '%s' cannot have `container_per_command` as the task has `shared_container`", taskName, steps.Name))
+				}
+				if len(steps.Images) != 0 {
+					errs = append(errs, fmt.Errorf("task '%s': step '%s' cannot have `images` as the task has `shared_container`", taskName, steps.Name))
+				} else if sharedImage == "" {
+					sharedImage = steps.Image
+				} else if steps.Image != sharedImage {
+					errs = append(errs, fmt.Errorf("task '%s': step '%s' must have image '%s' of the previous steps as the task has `shared_container`", taskName, steps.Name, sharedImage))
+				}
+			}
+			if steps.MountsDockerSock() && !steps.Local {
+				if socket, err := daemonSocket(); err != nil {
+					errs = append(errs, fmt.Errorf("task '%s': step '%s' has `mount_docker_sock` but %s", taskName, steps.Name, err.Error()))
+				} else if _, err := os.Stat(socket); err != nil {
+					errs = append(errs, fmt.Errorf("task '%s': step '%s' has `mount_docker_sock` but Docker socket %s is not found on the host", taskName, steps.Name, socket))
+				}
+			}
+
+			if steps.Name == "" {
+				continue
+			}
+			if _, exists := stepNames[steps.Name]; exists {
+				errs = append(errs, fmt.Errorf("task '%s': step name '%s' is not unique", taskName, steps.Name))
+			}
+			stepNames[steps.Name] = struct{}{}
+		}
+		for name, service := range task.Services {
+			if !networkNameRegex.MatchString(name) {
+				errs = append(errs, fmt.Errorf("task '%s': service name '%s' is invalid. It must be a valid hostname", taskName, name))
+			}
+			serviceValErrs := govalidator.StructCtx(ctx, service)
+			errs = append(errs, formatErrors(serviceValErrs, taskName)...)
+			for _, key := range duplicateEnvKeys(service.Envs) {
+				errs = append(errs, fmt.Errorf("task '%s': service '%s' has environment variable '%s' defined more than once in `envs`", taskName, name, key))
+			}
 		}
 	}
 	return errs
 }
 
+// duplicateEnvKeys returns the keys of the environment variables defined more than once in envs, where the last
+// definition would silently win
+func duplicateEnvKeys(envs []string) []string {
+	var duplicates []string
+	counts := make(map[string]int)
+	for _, env := range envs {
+		key := strings.SplitN(env, "=", 2)[0]
+		counts[key]++
+		if counts[key] == 2 {
+			duplicates = append(duplicates, key)
+		}
+	}
+	return duplicates
+}
+
+// dropsAllCapabilities returns true if the step drops all capabilities of the container
+func dropsAllCapabilities(step Step) bool {
+	for _, c := range step.CapDrop {
+		if strings.EqualFold(c, "ALL") {
+			return true
+		}
+	}
+	return false
+}
+
+// NeedsPrivileges returns true if the step runs in privileged mode or adds capabilities to the container
+func (step *Step) NeedsPrivileges() bool {
+	return step.Privileged || len(step.CapAdd) != 0
+}
+
+// MountsDockerSock returns true if the socket of the Docker daemon is mounted on the container of the step, as per
+// its `mount_docker_sock` or `docker_access`
+func (step *Step) MountsDockerSock() bool {
+	return step.MountDockerSock || step.DockerAccess
+}
+
+// MemoryBytes returns the memory limit of the step in bytes, or 0 if there is no limit
+func (step *Step) MemoryBytes() (int64, error) {
+	if step.Memory == "" {
+		return 0, nil
+	}
+	bytes, err := units.RAMInBytes(step.Memory)
+	if err != nil {
+		return 0, fmt.Errorf("config: invalid memory '%s' of step '%s': %s", step.Memory, step.Name, err.Error())
+	}
+	return bytes, nil
+}
+
+// NanoCPUs returns the CPU limit of the step in units of 10^-9 CPUs, or 0 if there is no limit
+func (step *Step) NanoCPUs() int64 {
+	return int64(step.CPUs * 1e9)
+}
+
+// DefaultStepName is the name given to a step of a task that does not have a name, `index` is its position in the task
+func DefaultStepName(index int) string {
+	return fmt.Sprintf("step-%d", index+1)
+}
+
+// setStepDefaults records the position of all the steps in their task, and gives a default name to those that are
+// not named in the task file
+func setStepDefaults(configs *Configs) {
+	for _, task := range configs.Tasks {
+		for i := range task.Steps {
+			task.Steps[i].Index = i + 1
+			if task.Steps[i].Name == "" {
+				task.Steps[i].Name = DefaultStepName(i)
+			}
+		}
+	}
+}
+
 func formatErrors(valErrs error, taskName string) []error {
 	var errs []error
 	if valErrs != nil {
@@ -191,6 +471,122 @@ func ValidateMountDir(ctx context.Context, fl validator.FieldLevel) bool {
 	return validPerm
 }
 
+// ValidateMountTarget verifies that the destination of a mount is an absolute path, mounts without a destination
+// at all are reported by `ValidateMountDir`
+func ValidateMountTarget(ctx context.Context, fl validator.FieldLevel) bool {
+	mountValues := strings.Split(fl.Field().String(), ":")
+	if len(mountValues) < 2 {
+		return true
+	}
+	return strings.HasPrefix(mountValues[1], "/")
+}
+
+// ValidateMemory verifies that the memory limit is a positive size
+func ValidateMemory(ctx context.Context, fl validator.FieldLevel) bool {
+	bytes, err := units.RAMInBytes(fl.Field().String())
+	return err == nil && bytes > 0
+}
+
+// ValidatePort verifies that the port to be published is in the format `<host_port>:<container_port>[/<protocol>]`,
+// optionally with the host IP, and ports are within range
+func ValidatePort(ctx context.Context, fl validator.FieldLevel) bool {
+	spec := fl.Field().String()
+	if !strings.Contains(spec, ":") {
+		return false
+	}
+	mappings, err := nat.ParsePortSpec(spec)
+	if err != nil {
+		return false
+	}
+	for _, m := range mappings {
+		if m.Port.Int() == 0 || m.Binding.HostPort == "" || m.Binding.HostPort == "0" {
+			return false
+		}
+	}
+	return true
+}
+
+// ValidateProjectDir verifies that the directory the project is mounted on is an absolute path, other than the root
+// directory which would hide the filesystem of the image
+func ValidateProjectDir(ctx context.Context, fl validator.FieldLevel) bool {
+	dir := fl.Field().String()
+	return path.IsAbs(dir) && path.Clean(dir) != "/"
+}
+
+// ValidateCacheKey verifies that the key of a cache is safe to be part of the name of its Docker volume
+func ValidateCacheKey(ctx context.Context, fl validator.FieldLevel) bool {
+	return cacheKeyRegex.MatchString(fl.Field().String())
+}
+
+// ValidatePassEnv verifies that the variable passed from the host is a name or a glob pattern of names
+func ValidatePassEnv(ctx context.Context, fl validator.FieldLevel) bool {
+	return passEnvRegex.MatchString(fl.Field().String())
+}
+
+// ValidateExtraHost verifies that the extra host is in the format `<name>:<ip>`, where the IP may be `host-gateway`
+func ValidateExtraHost(ctx context.Context, fl validator.FieldLevel) bool {
+	parts := strings.SplitN(fl.Field().String(), ":", 2)
+	if len(parts) != 2 || !hostNameRegex.MatchString(parts[0]) {
+		return false
+	}
+	return parts[1] == docker.HostGateway || net.ParseIP(parts[1]) != nil
+}
+
+// ValidateNetwork verifies that the network is one of the network modes, or a valid name of a Docker network.
+// Existence of the network is checked only when the step is run.
+func ValidateNetwork(ctx context.Context, fl validator.FieldLevel) bool {
+	network := fl.Field().String()
+	for _, mode := range validNetworkModes {
+		if network == mode {
+			return true
+		}
+	}
+	return networkNameRegex.MatchString(network)
+}
+
+// ValidateDuration verifies that the value is a duration which is not negative
+func ValidateDuration(ctx context.Context, fl validator.FieldLevel) bool {
+	d, err := time.ParseDuration(fl.Field().String())
+	return err == nil && d >= 0
+}
+
+// ValidateCapability verifies that the value is the name of a Linux capability, with or without the `CAP_` prefix
+func ValidateCapability(ctx context.Context, fl validator.FieldLevel) bool {
+	capability := strings.TrimPrefix(strings.ToUpper(fl.Field().String()), "CAP_")
+	for _, c := range validCapabilities {
+		if capability == c {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateDigest verifies that the value is a valid image digest
+func ValidateDigest(ctx context.Context, fl validator.FieldLevel) bool {
+	_, err := digest.Parse(fl.Field().String())
+	return err == nil
+}
+
+// ValidatePlatform verifies that the image platform is one of the known `os/arch[/variant]` combinations
+func ValidatePlatform(ctx context.Context, fl validator.FieldLevel) bool {
+	return IsValidPlatform(fl.Field().String())
+}
+
+// IsValidPlatform returns true if the platform is one of the known `os/arch[/variant]` combinations
+func IsValidPlatform(platform string) bool {
+	for _, p := range validPlatforms {
+		if platform == p {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidPlatforms returns the known `os/arch[/variant]` combinations of image platforms
+func ValidPlatforms() []string {
+	return append([]string{}, validPlatforms...)
+}
+
 // ValidateFollowTaskPresent verifies that referenceed task exists
 func ValidateFollowTaskPresent(ctx context.Context, fl validator.FieldLevel) bool {
 	followTask := strings.TrimSpace(fl.Field().String())
@@ -215,7 +611,7 @@ func ParseMountDir(ctx context.Context, fl validator.FieldLevel) bool {
 	if err != nil {
 		return false
 	}
-	return util.DirExists(parsedDir)
+	return util.DirExists(hostPath(ctx, joinPathRelToHome(parsedDir)))
 }
 
 // GetConfigs reads and parses tasks from the dunner task file.
@@ -228,24 +624,92 @@ func GetConfigs(filename string) (*Configs, error) {
 		return nil, err
 	}
 
+	loadDotEnv(viper.GetStringSlice("DotenvFile"))
+	if err := loadDefines(viper.GetStringSlice("Define")); err != nil {
+		return nil, err
+	}
+
+	configs, err := loadTaskFile(taskFile, nil, make(map[string]struct{}), make(map[string]string))
+	if err != nil {
+		return nil, err
+	}
+	if err := resolveAliases(configs); err != nil {
+		return nil, err
+	}
+	setStepDefaults(configs)
+	if err := applyProfile(configs, viper.GetString("Profile")); err != nil {
+		return nil, err
+	}
+
+	if err := ParseEnvs(configs); err != nil {
+		return nil, err
+	}
+
+	return configs, nil
+}
+
+// parseTaskFile reads and parses the task file, rendering it as a template if enabled and merging its environment
+// variables scoped to the operating system. The files it includes are not loaded, and its aliases are resolved once
+// they are merged into it, so that its steps can refer to the aliases of the files it includes.
+func parseTaskFile(taskFile string) (*Configs, error) {
 	fileContents, err := ioutil.ReadFile(taskFile)
 	if err != nil {
 		return nil, err
 	}
+	if viper.GetBool("Template") {
+		if fileContents, err = renderTemplate(taskFile, fileContents); err != nil {
+			return nil, err
+		}
+	}
 
 	var configs Configs
 	if err := yaml.Unmarshal(fileContents, &configs); err != nil {
 		return nil, err
 	}
-
-	loadDotEnv()
-	if err := ParseEnvs(&configs); err != nil {
+	if err := mergeOSEnvs(&configs); err != nil {
 		return nil, err
 	}
-
 	return &configs, nil
 }
 
+// templateData is the data available while rendering the task file as a template
+type templateData struct {
+	Env  map[string]string // Host environment variables, overridden by the ones defined in environment files
+	Vars map[string]string // Variables defined with `--define`
+}
+
+var templateFuncs = template.FuncMap{
+	"split":  strings.Split,
+	"join":   strings.Join,
+	"fields": strings.Fields,
+}
+
+// renderTemplate renders the task file contents as a Go template, before it is parsed as YAML.
+// Environment variables are available as `{{ .Env.NAME }}` and variables defined with `--define` as
+// `{{ .Vars.NAME }}`, referring an undefined variable is an error.
+func renderTemplate(taskFile string, contents []byte) ([]byte, error) {
+	tmpl, err := template.New(filepath.Base(taskFile)).Funcs(templateFuncs).Option("missingkey=error").Parse(string(contents))
+	if err != nil {
+		return nil, fmt.Errorf("config: failed to parse task file template: %s", err.Error())
+	}
+
+	data := templateData{Env: make(map[string]string), Vars: defines}
+	for _, env := range os.Environ() {
+		if kv := strings.SplitN(env, "=", 2); len(kv) == 2 {
+			data.Env[kv[0]] = kv[1]
+		}
+	}
+	for k, v := range dotEnv {
+		data.Env[k] = v
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("config: failed to render task file template: %s", err.Error())
+	}
+	return buf.Bytes(), nil
+}
+
 // getDunnerTaskFile returns the dunner task file path.
 // If `filename` is not default task file, it returns as-is.
 // It returns task file in current directory if exists
@@ -276,20 +740,46 @@ func getDunnerTaskFile(filename string) (string, error) {
 	}
 }
 
-func loadDotEnv() {
-	file := viper.GetString("DotenvFile")
-	var err error
-	dotEnv, err = godotenv.Read(file)
-	if err != nil {
-		log.Infof("No environment loaded from %s file: Not found", file)
+// loadDotEnv reads the environment files in the given order, a variable defined in a later file
+// overrides the value from the earlier ones.
+func loadDotEnv(files []string) {
+	dotEnv = make(map[string]string)
+	for _, file := range files {
+		envs, err := godotenv.Read(file)
+		if err != nil {
+			log.Infof("No environment loaded from %s file: Not found", file)
+			continue
+		}
+		for k, v := range envs {
+			dotEnv[k] = v
+		}
 	}
 }
 
+// loadDefines reads the variables defined with `--define` as `key=value`, a later definition of a variable overrides
+// the earlier ones. They are not environment variables, and are only used to render and substitute the task file.
+func loadDefines(definitions []string) error {
+	defines = make(map[string]string)
+	for _, definition := range definitions {
+		kv := strings.SplitN(definition, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return fmt.Errorf("config: invalid variable definition '%s', it must be 'key=value'", definition)
+		}
+		defines[kv[0]] = kv[1]
+	}
+	return nil
+}
+
 // ParseEnvs parses the `.env` file as well as the host environment variables.
 // If the same variable is defined in both the `.env` file and in the host environment,
 // priority is given to the .env file.
 //
+// A value referring to a secret, like `vault://secret/data/app#password`, is replaced by the secret fetched with
+// the SecretResolver of its scheme. See RegisterSecretResolver.
+//
 // Note: You can change the filename of environment file (default: `.env`) using `--env-file/-e` flag in the CLI.
+// The flag can be repeated to layer multiple environment files, in which case a variable defined in a later
+// file overrides the value defined in the earlier files.
 func ParseEnvs(configs *Configs) error {
 
 	// Parse envs that are global to all
@@ -322,13 +812,25 @@ func ParseEnvs(configs *Configs) error {
 				(*configs).Tasks[k].Steps[j].Envs[i] = newEnv
 			}
 		}
+
+		// Parse envs that are defined for a service of the task
+		for _, service := range tasks.Services {
+			for i, envVar := range service.Envs {
+				newEnv, err := obtainEnv(envVar)
+				if err != nil {
+					return err
+				}
+				service.Envs[i] = newEnv
+			}
+		}
 	}
 
 	return nil
 }
 
 func obtainEnv(envVar string) (string, error) {
-	var str = strings.Split(envVar, "=")
+	// Only the first '=' separates the key, values may contain '=' themselves
+	var str = strings.SplitN(envVar, "=", 2)
 	if len(str) != 2 {
 		return "", fmt.Errorf(
 			`config: invalid format of environment variable: %v`,
@@ -341,41 +843,51 @@ func obtainEnv(envVar string) (string, error) {
 		log.Fatal(err)
 	}
 	if check {
-		var key = strings.Replace(
-			strings.Replace(
-				str[1],
-				"`",
-				"",
-				-1,
-			),
-			"$",
-			"",
-			1,
-		)
-		var val string
-		// Value of variable defined in environment file (default '.env') overrides
-		// the value defined in host's environment variables.
-		if v, isSet := os.LookupEnv(key); isSet {
-			val = v
-		}
-		if v, isSet := dotEnv[key]; isSet {
-			val = v
-		}
-		if val == "" {
+		key, val, found := lookupEnv(strings.TrimPrefix(strings.Trim(str[1], "`"), "$"))
+		if !found {
 			return "", fmt.Errorf(
 				`config: could not find environment variable '%v' in %s file or among host environment variables`,
 				key,
-				viper.GetString("DotenvFile"),
+				strings.Join(viper.GetStringSlice("DotenvFile"), ", "),
 			)
 		}
 		var newEnv = str[0] + "=" + val
 		return newEnv, nil
 	}
+	secret, isSecret, err := resolveSecret(str[1])
+	if err != nil {
+		return "", err
+	}
+	if isSecret {
+		return str[0] + "=" + secret, nil
+	}
 	return envVar, nil
 }
 
-// ParseStepEnv parses Dir, Mounts, User fields of Step by replacing environment variables with their values
+// ParseStepEnv parses Image, Images, Dir, Mounts, User, build context and OutputFile fields of Step by replacing environment variables with their values.
+// The image is verified to be a valid image reference after replacement.
 func (step *Step) ParseStepEnv() error {
+	if step.Image != "" {
+		parsedImage, err := lookupDirectory(step.Image)
+		if err != nil {
+			return err
+		}
+		if _, err := reference.ParseNormalizedNamed(parsedImage); err != nil {
+			return fmt.Errorf("config: invalid image name '%s' of step '%s': %s", parsedImage, step.Name, err.Error())
+		}
+		step.Image = parsedImage
+	}
+	for i, image := range step.Images {
+		parsedImage, err := lookupDirectory(image)
+		if err != nil {
+			return err
+		}
+		if _, err := reference.ParseNormalizedNamed(parsedImage); err != nil {
+			return fmt.Errorf("config: invalid image name '%s' of step '%s': %s", parsedImage, step.Name, err.Error())
+		}
+		step.Images[i] = parsedImage
+	}
+
 	parsedDir, err := lookupDirectory(step.Dir)
 	if err != nil {
 		return err
@@ -395,6 +907,20 @@ func (step *Step) ParseStepEnv() error {
 		return err
 	}
 	step.User = parsedUser
+
+	if step.Build != nil {
+		parsedContext, err := lookupDirectory(step.Build.Context)
+		if err != nil {
+			return err
+		}
+		step.Build.Context = parsedContext
+	}
+
+	parsedOutputFile, err := lookupDirectory(step.OutputFile)
+	if err != nil {
+		return err
+	}
+	step.OutputFile = parsedOutputFile
 	return nil
 }
 
@@ -410,11 +936,15 @@ func DecodeMount(mounts []string, step *docker.Step) error {
 		)
 		var readOnly = true
 		if len(arr) == 3 {
-			if arr[2] == "wr" || arr[2] == "w" {
+			if arr[2] == "wr" || arr[2] == "rw" || arr[2] == "w" {
 				readOnly = false
 			}
 		}
-		src, err := filepath.Abs(joinPathRelToHome(arr[0]))
+		src := joinPathRelToHome(arr[0])
+		if !filepath.IsAbs(src) && step.HostDir != "" {
+			src = filepath.Join(step.HostDir, src)
+		}
+		src, err := filepath.Abs(src)
 		if err != nil {
 			return err
 		}
@@ -435,22 +965,45 @@ func lookupDirectory(dir string) (string, error) {
 
 	parsedDir := dir
 	for _, matchArr := range matches {
-		envKey := matchArr[1]
-		var val string
-		if v, isSet := os.LookupEnv(envKey); isSet {
-			val = v
-		}
-		if v, isSet := dotEnv[envKey]; isSet {
-			val = v
-		}
-		if val == "" {
+		envKey, val, found := lookupEnv(matchArr[1])
+		if !found {
 			return dir, fmt.Errorf("could not find environment variable '%v'", envKey)
 		}
-		parsedDir = strings.Replace(parsedDir, fmt.Sprintf("`$%s`", envKey), val, -1)
+		parsedDir = strings.Replace(parsedDir, matchArr[0], val, -1)
 	}
 	return parsedDir, nil
 }
 
+// lookupEnv returns the name and value of the environment variable referred by `expr`, which is either `ENV_NAME`
+// or `{ENV_NAME}`, optionally followed by `:-default` to fall back to a default value when the variable is not set
+// or empty. Value of variable defined in environment file (default '.env') overrides the value defined in host's
+// environment variables, and a variable defined with `--define` overrides both. It reports whether a value was
+// found, a default value counting as one.
+func lookupEnv(expr string) (string, string, bool) {
+	if strings.HasPrefix(expr, "{") && strings.HasSuffix(expr, "}") {
+		expr = expr[1 : len(expr)-1]
+	}
+	key, def, hasDefault := expr, "", false
+	if i := strings.Index(expr, ":-"); i >= 0 {
+		key, def, hasDefault = expr[:i], expr[i+2:], true
+	}
+
+	var val string
+	if v, isSet := os.LookupEnv(key); isSet {
+		val = v
+	}
+	if v, isSet := dotEnv[key]; isSet {
+		val = v
+	}
+	if v, isSet := defines[key]; isSet {
+		val = v
+	}
+	if val == "" && hasDefault {
+		return key, def, true
+	}
+	return key, val, val != ""
+}
+
 func joinPathRelToHome(p string) string {
 	if p[0] == '~' {
 		return path.Join(util.HomeDir, strings.Trim(p, "~"))
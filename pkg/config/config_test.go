@@ -5,7 +5,9 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"reflect"
+	"sort"
 	"strings"
 	"testing"
 
@@ -63,7 +65,8 @@ tasks:
 	}
 
 	var step = Step{
-		Name:     "",
+		Name:     "step-1",
+		Index:    1,
 		Image:    "node:10.15.0",
 		Commands: [][]string{{"node", "--version"}, {"npm", "--version"}},
 		User:     "20",
@@ -85,10 +88,188 @@ tasks:
 
 }
 
+func TestGetConfigsWithTemplate(t *testing.T) {
+	os.Setenv("DUNNER_TEST_VERSIONS", "10 12")
+	defer os.Unsetenv("DUNNER_TEST_VERSIONS")
+	viper.Set("Template", true)
+	defer viper.Set("Template", false)
+	var content = []byte(`
+tasks:
+  test:
+    steps:
+{{- range fields .Env.DUNNER_TEST_VERSIONS }}
+      - image: node:{{ . }}
+        command: ["node", "--version"]
+{{- end }}`)
+	tmpFile := createTempTaskFile(t, content)
+	defer os.Remove(tmpFile)
+
+	configs, err := GetConfigs(tmpFile)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	steps := configs.Tasks["test"].Steps
+	if len(steps) != 2 {
+		t.Fatalf("expected 2 steps, got %d: %v", len(steps), steps)
+	}
+	if steps[0].Image != "node:10" || steps[1].Image != "node:12" {
+		t.Errorf("expected images node:10 and node:12, got %s and %s", steps[0].Image, steps[1].Image)
+	}
+}
+
+func TestGetConfigsWithTemplateMissingVariable(t *testing.T) {
+	viper.Set("Template", true)
+	defer viper.Set("Template", false)
+	tmpFile := createTempTaskFile(t, []byte(`image: {{ .Env.DUNNER_UNDEFINED_VARIABLE }}`))
+	defer os.Remove(tmpFile)
+
+	_, err := GetConfigs(tmpFile)
+
+	if err == nil || !strings.HasPrefix(err.Error(), "config: failed to render task file template:") {
+		t.Fatalf("expected template render error, got %s", err)
+	}
+}
+
+func TestGetConfigsWithDefines(t *testing.T) {
+	os.Setenv("DUNNER_TEST_NODE_VERSION", "10")
+	defer os.Unsetenv("DUNNER_TEST_NODE_VERSION")
+	viper.Set("Template", true)
+	defer viper.Set("Template", false)
+	viper.Set("Define", []string{"DUNNER_TEST_NODE_VERSION=12", "TARGETS=web,api"})
+	defer viper.Set("Define", nil)
+	tmpFile := createTempTaskFile(t, []byte(`
+tasks:
+  test:
+    steps:
+      - image: node:`+"`$DUNNER_TEST_NODE_VERSION`"+`
+        envs: ["TARGETS=`+"`$TARGETS`"+`"]
+        command: ["echo", "{{ .Vars.TARGETS }}"]`))
+	defer os.Remove(tmpFile)
+
+	configs, err := GetConfigs(tmpFile)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	step := configs.Tasks["test"].Steps[0]
+	if err := step.ParseStepEnv(); err != nil {
+		t.Fatal(err)
+	}
+	if step.Image != "node:12" {
+		t.Errorf("expected image of defined version node:12, got %s", step.Image)
+	}
+	if !reflect.DeepEqual(step.Envs, []string{"TARGETS=web,api"}) {
+		t.Errorf("expected defined variable in envs, got %v", step.Envs)
+	}
+	if step.Command[1] != "web,api" {
+		t.Errorf("expected defined variable in template, got %s", step.Command[1])
+	}
+}
+
+func TestGetConfigsWithInvalidDefine(t *testing.T) {
+	viper.Set("Define", []string{"TARGETS"})
+	defer viper.Set("Define", nil)
+	tmpFile := createTempTaskFile(t, []byte(`tasks: {}`))
+	defer os.Remove(tmpFile)
+
+	_, err := GetConfigs(tmpFile)
+
+	expectedErr := "config: invalid variable definition 'TARGETS', it must be 'key=value'"
+	if err == nil || err.Error() != expectedErr {
+		t.Fatalf("expected error: %s, got: %v", expectedErr, err)
+	}
+}
+
+func TestGetConfigsWithBracesWithoutTemplate(t *testing.T) {
+	tmpFile := createTempTaskFile(t, []byte(`
+tasks:
+  test:
+    steps:
+      - image: alpine
+        command: ["echo", "{{ literal }}"]`))
+	defer os.Remove(tmpFile)
+
+	configs, err := GetConfigs(tmpFile)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := configs.Tasks["test"].Steps[0].Command[1]; got != "{{ literal }}" {
+		t.Errorf("expected braces to be preserved, got %s", got)
+	}
+}
+
+func TestGetConfigsWithEntrypoint(t *testing.T) {
+	tmpFile := createTempTaskFile(t, []byte(`
+tasks:
+  test:
+    steps:
+      - name: unset
+        image: alpine
+        command: ["ls"]
+      - name: cleared
+        image: docker/compose:1.24.0
+        entrypoint: []
+        command: ["docker-compose", "version"]
+      - name: wrapped
+        image: alpine
+        entrypoint: ["tini", "--"]
+        command: ["ls"]`))
+	defer os.Remove(tmpFile)
+
+	configs, err := GetConfigs(tmpFile)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	steps := configs.Tasks["test"].Steps
+	if steps[0].Entrypoint != nil {
+		t.Errorf("expected unset entrypoint to be nil, got: %#v", steps[0].Entrypoint)
+	}
+	if steps[1].Entrypoint == nil || len(steps[1].Entrypoint) != 0 {
+		t.Errorf("expected cleared entrypoint to be empty, got: %#v", steps[1].Entrypoint)
+	}
+	if !reflect.DeepEqual(steps[2].Entrypoint, []string{"tini", "--"}) {
+		t.Errorf("expected entrypoint [tini --], got: %#v", steps[2].Entrypoint)
+	}
+}
+
+func TestGetConfigsWithScalarEntrypoint(t *testing.T) {
+	tmpFile := createTempTaskFile(t, []byte(`
+tasks:
+  test:
+    steps:
+      - image: alpine
+        entrypoint: sh
+        command: ["ls"]`))
+	defer os.Remove(tmpFile)
+
+	_, err := GetConfigs(tmpFile)
+
+	if err == nil || !strings.Contains(err.Error(), "cannot unmarshal !!str `sh` into []string") {
+		t.Fatalf("expected error on scalar entrypoint, got: %v", err)
+	}
+}
+
+func createTempTaskFile(t *testing.T, content []byte) string {
+	tmpFile, err := ioutil.TempFile("", ".testdunner.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tmpFile.Write(content); err != nil {
+		t.Fatal(err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return tmpFile.Name()
+}
+
 func TestParseEnv_InvalidEnv(t *testing.T) {
 	step := getSampleStep()
 	step.Image = "node:10.15.0"
-	step.Envs = []string{"MYVAR=MYVAL", "MYUSR=dunner=invalid"}
+	step.Envs = []string{"MYVAR=MYVAL", "MYUSR"}
 	var tasks = make(map[string]Task)
 	tasks["test"] = Task{Steps: []Step{step}}
 	var configs = &Configs{
@@ -97,7 +278,7 @@ func TestParseEnv_InvalidEnv(t *testing.T) {
 
 	expectedErr := fmt.Errorf(
 		`config: invalid format of environment variable: %s`,
-		"MYUSR=dunner=invalid",
+		"MYUSR",
 	)
 
 	if err := ParseEnvs(configs); err.Error() != expectedErr.Error() {
@@ -105,6 +286,39 @@ func TestParseEnv_InvalidEnv(t *testing.T) {
 	}
 }
 
+func TestParseEnv_ValuesArePreserved(t *testing.T) {
+	step := getSampleStep()
+	envs := []string{"OPTS=--level=debug --name=x", "GREETING=hello world", "MULTILINE=line 1\nline 2"}
+	step.Envs = append([]string{}, envs...)
+	var tasks = make(map[string]Task)
+	tasks["test"] = Task{Steps: []Step{step}}
+	var configs = &Configs{
+		Tasks: tasks,
+	}
+
+	if err := ParseEnvs(configs); err != nil {
+		t.Fatal(err)
+	}
+	if parsed := configs.Tasks["test"].Steps[0].Envs; !reflect.DeepEqual(parsed, envs) {
+		t.Fatalf("expected envs: %q, got: %q", envs, parsed)
+	}
+}
+
+func TestParseEnv_ServiceEnvs(t *testing.T) {
+	service := Service{Image: "postgres", Envs: []string{"POSTGRES_USER=`$USER`"}}
+	var configs = &Configs{
+		Tasks: map[string]Task{"test": {Steps: []Step{getSampleStep()}, Services: map[string]Service{"db": service}}},
+	}
+
+	if err := ParseEnvs(configs); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"POSTGRES_USER=" + os.Getenv("USER")}
+	if parsed := configs.Tasks["test"].Services["db"].Envs; !reflect.DeepEqual(parsed, expected) {
+		t.Fatalf("expected envs: %q, got: %q", expected, parsed)
+	}
+}
+
 func TestParseEnv_EnvNotExist(t *testing.T) {
 	step := getSampleStep()
 	step.Image = "node:10.15.0"
@@ -118,7 +332,7 @@ func TestParseEnv_EnvNotExist(t *testing.T) {
 	expectedErr := fmt.Errorf(
 		`config: could not find environment variable '%v' in %s file or among host environment variables`,
 		"MYDUNNER",
-		viper.GetString("DotenvFile"),
+		strings.Join(viper.GetStringSlice("DotenvFile"), ", "),
 	)
 
 	if err := ParseEnvs(configs); err.Error() != expectedErr.Error() {
@@ -126,236 +340,994 @@ func TestParseEnv_EnvNotExist(t *testing.T) {
 	}
 }
 
-func TestConfigs_Validate(t *testing.T) {
-	var tasks = make(map[string]Task)
-	tasks["test"] = Task{Steps: []Step{getSampleStep()}}
-	var configs = &Configs{
-		Tasks: tasks,
+func TestParseEnv_DefaultValue(t *testing.T) {
+	step := getSampleStep()
+	step.Envs = []string{"MYUSR=`$MYDUNNER:-dunner`", "MYHOME=`${HOME:-/tmp}`"}
+	var configs = &Configs{Tasks: map[string]Task{"test": {Steps: []Step{step}}}}
+
+	if err := ParseEnvs(configs); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"MYUSR=dunner", "MYHOME=" + os.Getenv("HOME")}
+	if parsed := configs.Tasks["test"].Steps[0].Envs; !reflect.DeepEqual(parsed, expected) {
+		t.Fatalf("expected envs: %q, got: %q", expected, parsed)
+	}
+}
+
+func TestLoadDotEnvLayersFilesInOrder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dunner-env")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	base := filepath.Join(dir, "base.env")
+	override := filepath.Join(dir, "override.env")
+	if err := ioutil.WriteFile(base, []byte("FOO=base\nBAR=base\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(override, []byte("BAR=override\nBAZ=override\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer loadDotEnv(nil)
+
+	loadDotEnv([]string{base, filepath.Join(dir, "missing.env"), override})
+
+	expected := map[string]string{"FOO": "base", "BAR": "override", "BAZ": "override"}
+	if !reflect.DeepEqual(expected, dotEnv) {
+		t.Fatalf("expected: %v, got: %v", expected, dotEnv)
+	}
+
+	loadDotEnv([]string{override, base})
+
+	if dotEnv["BAR"] != "base" {
+		t.Fatalf("expected BAR to be overridden by later file, got: %s", dotEnv["BAR"])
+	}
+}
+
+func TestConfigs_Validate(t *testing.T) {
+	var tasks = make(map[string]Task)
+	tasks["test"] = Task{Steps: []Step{getSampleStep()}}
+	var configs = &Configs{
+		Tasks: tasks,
+	}
+
+	errs := configs.Validate()
+
+	if len(errs) != 0 {
+		t.Fatalf("Configs Validation failed, expected to pass. got: %s", errs)
+	}
+}
+
+func TestConfigs_ValidateWithNoTasks(t *testing.T) {
+	tasks := make(map[string]Task, 0)
+	configs := &Configs{Tasks: tasks}
+
+	errs := configs.Validate()
+
+	if len(errs) != 0 {
+		t.Fatalf("Configs validation failed, expected no error, got %s", errs)
+	}
+}
+
+func TestConfigs_ValidateWithEmptyImageAndCommand(t *testing.T) {
+	tasks := make(map[string]Task, 0)
+	step := Step{Image: "", Command: []string{""}}
+	tasks["stats"] = Task{Steps: []Step{step}}
+	configs := &Configs{Tasks: tasks}
+
+	errs := configs.Validate()
+
+	if len(errs) != 2 {
+		t.Fatalf("expected 2 errors, got %d : %s", len(errs), errs)
+	}
+
+	expected1 := "task 'stats': image is required, unless the step has a `follow`, `build` or `images` field or is `local`"
+	expected2 := "task 'stats': command[0] is a required field"
+	if errs[0].Error() != expected1 {
+		t.Fatalf("expected: %s, got: %s", expected1, errs[0].Error())
+	}
+	if errs[1].Error() != expected2 {
+		t.Fatalf("expected: %s, got: %s", expected2, errs[1].Error())
+	}
+}
+
+func TestConfigs_ValidateLocalStep(t *testing.T) {
+	tasks := make(map[string]Task, 0)
+	tasks["stats"] = Task{Steps: []Step{{Name: "status", Local: true, Command: []string{"git", "status"}}}}
+	configs := &Configs{Tasks: tasks}
+
+	errs := configs.Validate()
+
+	if len(errs) != 0 {
+		t.Fatalf("expected no errors, got %d : %s", len(errs), errs)
+	}
+}
+
+func TestConfigs_ValidateProjectDir(t *testing.T) {
+	tasks := map[string]Task{"stats": {Steps: []Step{getSampleStep()}}}
+
+	configs := &Configs{ProjectDir: "/go/src/app", Tasks: tasks}
+	if errs := configs.Validate(); len(errs) != 0 {
+		t.Fatalf("expected no errors, got %d : %s", len(errs), errs)
+	}
+
+	for _, dir := range []string{"src/app", "/", "//"} {
+		configs = &Configs{ProjectDir: dir, Tasks: tasks}
+		errs := configs.Validate()
+		expected := fmt.Sprintf("project directory '%s' is invalid. It must be an absolute path in the container, other than '/'", dir)
+		if len(errs) != 1 || errs[0].Error() != expected {
+			t.Fatalf("expected error: %s, got: %s", expected, errs)
+		}
+	}
+}
+
+func TestConfigs_ValidateTaskProjectDir(t *testing.T) {
+	configs := &Configs{Tasks: map[string]Task{
+		"build": {ProjectDir: "/go/src/app", Steps: []Step{getSampleStep()}},
+		"test":  {ProjectDir: "app", Steps: []Step{getSampleStep()}},
+	}}
+
+	errs := configs.Validate()
+
+	expected := "project directory 'app' is invalid. It must be an absolute path in the container, other than '/'"
+	if len(errs) != 1 || errs[0].Error() != expected {
+		t.Fatalf("expected error: %s, got: %s", expected, errs)
+	}
+}
+
+func TestConfigs_ValidateLockedDigests(t *testing.T) {
+	tasks := map[string]Task{"stats": {Steps: []Step{getSampleStep()}}}
+	digest := "sha256:" + strings.Repeat("ab", 32)
+
+	configs := &Configs{LockedDigests: map[string]string{"golang:1.13": digest}, Tasks: tasks}
+	if errs := configs.Validate(); len(errs) != 0 {
+		t.Fatalf("expected no errors, got %d : %s", len(errs), errs)
+	}
+
+	configs = &Configs{LockedDigests: map[string]string{"golang:1.13": "abcd"}, Tasks: tasks}
+	errs := configs.Validate()
+	expected := "digest 'abcd' is invalid. It must be of the form 'sha256:<hex>'"
+	if len(errs) != 1 || errs[0].Error() != expected {
+		t.Fatalf("expected error: %s, got: %s", expected, errs)
+	}
+}
+
+func TestConfigs_ValidateBuildStep(t *testing.T) {
+	tasks := make(map[string]Task, 0)
+	tasks["test"] = Task{Steps: []Step{{Name: "test", Build: &Build{Context: "."}, Command: []string{"make", "test"}}}}
+	configs := &Configs{Tasks: tasks}
+
+	errs := configs.Validate()
+
+	if len(errs) != 0 {
+		t.Fatalf("expected no errors, got %d : %s", len(errs), errs)
+	}
+}
+
+func TestConfigs_ValidateBuildStepWithImage(t *testing.T) {
+	tasks := make(map[string]Task, 0)
+	tasks["test"] = Task{Steps: []Step{{Name: "test", Image: "golang", Build: &Build{}, Command: []string{"make", "test"}}}}
+	configs := &Configs{Tasks: tasks}
+
+	errs := configs.Validate()
+
+	expected := []string{
+		"task 'test': context is a required field",
+		"task 'test': step 'test' cannot have both `image` and `build`",
+	}
+	if len(errs) != len(expected) {
+		t.Fatalf("expected errors: %v, got: %s", expected, errs)
+	}
+	for i, err := range errs {
+		if err.Error() != expected[i] {
+			t.Errorf("expected error: %s, got: %s", expected[i], err)
+		}
+	}
+}
+
+func TestConfigs_ValidateWithoutProjectMount(t *testing.T) {
+	mountProject := false
+	step := getSampleStep()
+	step.MountProject, step.Dir, step.CreateDir = &mountProject, "src", true
+	absolute := getSampleStep()
+	absolute.Name, absolute.MountProject, absolute.Dir = "absolute", &mountProject, "/tmp"
+	configs := &Configs{Tasks: map[string]Task{"test": {Steps: []Step{step, absolute}}}}
+
+	errs := configs.Validate()
+
+	expected := []string{
+		"task 'test': step '" + step.Name + "' must have an absolute `dir` as `mount_project` is false",
+		"task 'test': step '" + step.Name + "' cannot have `create_dir` as `mount_project` is false",
+	}
+	if len(errs) != len(expected) {
+		t.Fatalf("expected errors: %v, got: %s", expected, errs)
+	}
+	for i, err := range errs {
+		if err.Error() != expected[i] {
+			t.Errorf("expected error: %s, got: %s", expected[i], err)
+		}
+	}
+}
+
+func TestConfigs_ValidateInteractiveContainerPerCommand(t *testing.T) {
+	step := getSampleStep()
+	step.Interactive, step.ContainerPerCommand = true, true
+	configs := &Configs{Tasks: map[string]Task{"test": {Steps: []Step{step}}}}
+
+	errs := configs.Validate()
+
+	expected := "task 'test': step '" + step.Name + "' cannot have both `interactive` and `container_per_command`"
+	if len(errs) != 1 || errs[0].Error() != expected {
+		t.Fatalf("expected error: %s, got: %s", expected, errs)
+	}
+}
+
+func TestConfigs_ValidateInteractiveParallel(t *testing.T) {
+	step := getSampleStep()
+	step.Interactive, step.Parallel = true, true
+	configs := &Configs{Tasks: map[string]Task{"test": {Steps: []Step{step}}}}
+
+	errs := configs.Validate()
+
+	expected := "task 'test': step '" + step.Name + "' cannot have both `interactive` and `parallel`"
+	if len(errs) != 1 || errs[0].Error() != expected {
+		t.Fatalf("expected error: %s, got: %s", expected, errs)
+	}
+}
+
+func TestConfigs_ValidateCaches(t *testing.T) {
+	step := getSampleStep()
+	step.Caches = map[string]string{"npm": "/root/.npm", "pip-3.8": "/root/.cache/pip"}
+	configs := &Configs{Tasks: map[string]Task{"test": {Steps: []Step{step}}}}
+
+	if errs := configs.Validate(); len(errs) != 0 {
+		t.Fatalf("expected no errors, got: %s", errs)
+	}
+}
+
+func TestConfigs_ValidateInvalidCaches(t *testing.T) {
+	step := getSampleStep()
+	step.Caches = map[string]string{"../npm": "/root/.npm", "m2": "root/.m2"}
+	configs := &Configs{Tasks: map[string]Task{"test": {Steps: []Step{step}}}}
+
+	errs := configs.Validate()
+
+	var messages []string
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+	sort.Strings(messages)
+	expected := []string{
+		"task 'test': cache key '../npm' is invalid. It must start with a letter or digit, followed by letters, digits, '_', '.' or '-'",
+		"task 'test': cache path 'root/.m2' is invalid. It must be an absolute path in the container",
+	}
+	if !reflect.DeepEqual(messages, expected) {
+		t.Fatalf("expected errors: %q, got: %q", expected, messages)
+	}
+}
+
+func TestConfigs_ValidateLocalStepWithCaches(t *testing.T) {
+	step := Step{Name: "local", Local: true, Command: []string{"ls"}, Caches: map[string]string{"npm": "/root/.npm"}}
+	configs := &Configs{Tasks: map[string]Task{"test": {Steps: []Step{step}}}}
+
+	errs := configs.Validate()
+
+	expected := "task 'test': step 'local' cannot have `caches` as it is `local`"
+	if len(errs) != 1 || errs[0].Error() != expected {
+		t.Fatalf("expected error: %s, got: %s", expected, errs)
+	}
+}
+
+func TestConfigs_ValidateMountDockerSock(t *testing.T) {
+	socket, err := ioutil.TempFile("", "docker.sock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(socket.Name())
+	defer func(f func() (string, error)) { daemonSocket = f }(daemonSocket)
+	daemonSocket = func() (string, error) { return socket.Name(), nil }
+	tasks := make(map[string]Task, 0)
+	tasks["build"] = Task{Steps: []Step{{Name: "image", Image: "docker", Command: []string{"docker", "build", "."}, MountDockerSock: true}}}
+	configs := &Configs{Tasks: tasks}
+
+	errs := configs.Validate()
+
+	if len(errs) != 0 {
+		t.Fatalf("expected no errors, got %d : %s", len(errs), errs)
+	}
+}
+
+func TestConfigs_ValidateMountDockerSockNotFound(t *testing.T) {
+	defer func(f func() (string, error)) { daemonSocket = f }(daemonSocket)
+	daemonSocket = func() (string, error) { return "/non/existent/docker.sock", nil }
+	tasks := make(map[string]Task, 0)
+	tasks["build"] = Task{Steps: []Step{{Name: "image", Image: "docker", Command: []string{"docker", "build", "."}, MountDockerSock: true}}}
+	configs := &Configs{Tasks: tasks}
+
+	errs := configs.Validate()
+
+	expected := "task 'build': step 'image' has `mount_docker_sock` but Docker socket /non/existent/docker.sock is not found on the host"
+	if len(errs) != 1 || errs[0].Error() != expected {
+		t.Fatalf("expected error: %s, got: %v", expected, errs)
+	}
+}
+
+func TestConfigs_ValidateLocalStepWithImage(t *testing.T) {
+	tasks := make(map[string]Task, 0)
+	tasks["stats"] = Task{Steps: []Step{{Name: "status", Local: true, Image: "alpine/git", Command: []string{"git", "status"}}}}
+	configs := &Configs{Tasks: tasks}
+
+	errs := configs.Validate()
+
+	expected := "task 'stats': step 'status' cannot have both `image` and `local`"
+	if len(errs) != 1 || errs[0].Error() != expected {
+		t.Fatalf("expected error: %s, got: %s", expected, errs)
+	}
+}
+
+func TestConfigs_ValidateForAliasTask(t *testing.T) {
+	tasks := make(map[string]Task, 0)
+	tasks["foo"] = Task{Steps: []Step{{Image: "golang", Command: []string{"go", "version"}}}}
+	tasks["stats"] = Task{Steps: []Step{{Follow: "foo"}}}
+	configs := &Configs{Tasks: tasks}
+
+	errs := configs.Validate()
+
+	if len(errs) != 0 {
+		t.Fatalf("expected no errors, got %d : %s", len(errs), errs)
+	}
+}
+
+func TestConfigs_ValidateWithInvalidMountFormat(t *testing.T) {
+	step := getSampleStep()
+	step.Mounts = []string{"invalid_dir"}
+	var tasks = make(map[string]Task)
+	tasks["stats"] = Task{Steps: []Step{step}}
+	var configs = &Configs{
+		Tasks: tasks,
+	}
+
+	errs := configs.Validate()
+
+	if len(errs) != 1 {
+		t.Fatalf("expected 1 error, got %d : %s", len(errs), errs)
+	}
+
+	expected := "task 'stats': mount directory 'invalid_dir' is invalid. Check format is '<valid_src_dir>:<valid_dest_dir>:<optional_mode>' and has right permission level"
+	if errs[0].Error() != expected {
+		t.Fatalf("expected: %s, got: %s", expected, errs[0].Error())
+	}
+}
+
+func TestConfigs_ValidateWithRelativeMountTarget(t *testing.T) {
+	for _, m := range []string{"/tmp:relative", "/tmp:./relative:r", "/tmp::wr"} {
+		step := getSampleStep()
+		step.Mounts = []string{m}
+		configs := &Configs{Tasks: map[string]Task{"stats": {Steps: []Step{step}}}}
+
+		errs := configs.Validate()
+
+		expected := fmt.Sprintf("task 'stats': mount directory '%s' is invalid. Destination directory must be an absolute path in the container", m)
+		if len(errs) != 1 || errs[0].Error() != expected {
+			t.Errorf("expected error: %s, got: %s", expected, errs)
+		}
+	}
+}
+
+func TestConfigs_ValidateWithValidMountDirectory(t *testing.T) {
+	step := getSampleStep()
+	wd, _ := os.Getwd()
+	step.Mounts = []string{fmt.Sprintf("%s:%s:w", wd, wd)}
+	var tasks = make(map[string]Task)
+	tasks["stats"] = Task{Steps: []Step{step}}
+	var configs = &Configs{
+		Tasks: tasks,
+	}
+
+	errs := configs.Validate()
+
+	if errs != nil {
+		t.Fatalf("expected no errors, got %s", errs)
+	}
+}
+
+func TestConfigs_ValidateWithMountDirFromEnv(t *testing.T) {
+	step := getSampleStep()
+	wd, _ := os.Getwd()
+	step.Mounts = []string{fmt.Sprintf("%s:%s:w", wd, wd)}
+	var tasks = make(map[string]Task)
+	tasks["stats"] = Task{Steps: []Step{step}}
+	var configs = &Configs{
+		Tasks: tasks,
+	}
+
+	errs := configs.Validate()
+
+	if errs != nil {
+		t.Fatalf("expected no errors, got %s", errs)
+	}
+}
+
+func TestConfigs_ValidateWithNoModeGiven(t *testing.T) {
+	step := getSampleStep()
+	wd, _ := os.Getwd()
+	step.Mounts = []string{fmt.Sprintf("%s:%s", wd, wd)}
+	var tasks = make(map[string]Task)
+	tasks["stats"] = Task{Steps: []Step{step}}
+	var configs = &Configs{
+		Tasks: tasks,
+	}
+
+	errs := configs.Validate()
+
+	if errs != nil {
+		t.Fatalf("expected no errors, got %s", errs)
+	}
+}
+
+func TestConfigs_ValidateWithInvalidMode(t *testing.T) {
+	step := getSampleStep()
+	wd, _ := os.Getwd()
+	step.Mounts = []string{fmt.Sprintf("%s:%s:ab", wd, wd)}
+	var tasks = make(map[string]Task)
+	tasks["stats"] = Task{Steps: []Step{step}}
+	var configs = &Configs{
+		Tasks: tasks,
+	}
+
+	errs := configs.Validate()
+
+	expected := fmt.Sprintf("task 'stats': mount directory '%s' is invalid. Check format is '<valid_src_dir>:<valid_dest_dir>:<optional_mode>' and has right permission level", step.Mounts[0])
+	if errs[0].Error() != expected {
+		t.Fatalf("expected: %s, got: %s", expected, errs[0].Error())
+	}
+}
+
+func TestConfigs_ValidateWithInvalidMountDirectory(t *testing.T) {
+	step := getSampleStep()
+	step.Mounts = []string{"blah:/foo:w"}
+	var tasks = make(map[string]Task)
+	tasks["stats"] = Task{Steps: []Step{step}}
+	var configs = &Configs{
+		Tasks: tasks,
+	}
+
+	errs := configs.Validate()
+
+	if len(errs) != 1 {
+		t.Fatalf("expected 1 error, got %d : %s", len(errs), errs)
+	}
+
+	expected := "task 'stats': mount directory 'blah:/foo:w' is invalid. Check if source directory path exists."
+	if errs[0].Error() != expected {
+		t.Fatalf("expected: %s, got: %s", expected, errs[0].Error())
+	}
+}
+
+func TestConfigs_ValidateWithValidEnvInMountDir(t *testing.T) {
+	os.Setenv("TEST_DIR", util.HomeDir)
+	defer os.Setenv("TEST_DIR", "")
+	step := getSampleStep()
+	step.Mounts = []string{"`$TEST_DIR`:/foo:w"}
+	var tasks = make(map[string]Task)
+	tasks["stats"] = Task{Steps: []Step{step}}
+	var configs = &Configs{
+		Tasks: tasks,
+	}
+
+	errs := configs.Validate()
+
+	if len(errs) != 0 {
+		t.Fatalf("expected 0 errors, got %d : %s", len(errs), errs)
+	}
+}
+
+func TestConfigs_ValidateWithEnvInMountDir_Invalid(t *testing.T) {
+	os.Setenv("TEST_DIR", "/test_invalid")
+	defer os.Setenv("TEST_DIR", "")
+	step := getSampleStep()
+	step.Mounts = []string{"`$TEST_DIR`:/foo:w"}
+	var tasks = make(map[string]Task)
+	tasks["stats"] = Task{Steps: []Step{step}}
+	var configs = &Configs{
+		Tasks: tasks,
+	}
+
+	errs := configs.Validate()
+
+	if len(errs) != 1 {
+		t.Fatalf("expected 1 error, got %d : %s", len(errs), errs)
+	}
+
+	expected := "task 'stats': mount directory '`$TEST_DIR`:/foo:w' is invalid. Check if source directory path exists."
+	if errs[0].Error() != expected {
+		t.Fatalf("expected: %s, got: %s", expected, errs[0].Error())
+	}
+}
+
+func TestConfigs_ValidateWithNonExistingEnvInMountDir(t *testing.T) {
+	step := getSampleStep()
+	step.Mounts = []string{"`$TEST_DIR_DUNNER`:/foo:w"}
+	var tasks = make(map[string]Task)
+	tasks["stats"] = Task{Steps: []Step{step}}
+	var configs = &Configs{
+		Tasks: tasks,
+	}
+
+	errs := configs.Validate()
+
+	if len(errs) != 1 {
+		t.Fatalf("expected 1 error, got %d : %s", len(errs), errs)
+	}
+
+	expected := "task 'stats': mount directory '`$TEST_DIR_DUNNER`:/foo:w' is invalid. Check if source directory path exists."
+	if errs[0].Error() != expected {
+		t.Fatalf("expected: %s, got: %s", expected, errs[0].Error())
+	}
+}
+
+func TestGetConfigsWithDefaultStepNames(t *testing.T) {
+	tmpFile := createTempTaskFile(t, []byte(`
+tasks:
+  test:
+    steps:
+      - image: alpine
+        command: ["ls"]
+      - name: lint
+        image: alpine
+        command: ["ls"]
+      - image: alpine
+        command: ["ls"]`))
+	defer os.Remove(tmpFile)
+
+	configs, err := GetConfigs(tmpFile)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	var indexes []int
+	for _, step := range configs.Tasks["test"].Steps {
+		names = append(names, step.Name)
+		indexes = append(indexes, step.Index)
+	}
+	expected := []string{"step-1", "lint", "step-3"}
+	if !reflect.DeepEqual(expected, names) {
+		t.Fatalf("expected step names: %v, got: %v", expected, names)
+	}
+	if expectedIndexes := []int{1, 2, 3}; !reflect.DeepEqual(expectedIndexes, indexes) {
+		t.Fatalf("expected step indexes: %v, got: %v", expectedIndexes, indexes)
+	}
+}
+
+func TestConfigs_ValidateWithDuplicateStepNames(t *testing.T) {
+	step := getSampleStep()
+	step.Name = "lint"
+	tasks := map[string]Task{"stats": {Steps: []Step{step, step}}}
+	configs := &Configs{Tasks: tasks}
+
+	errs := configs.Validate()
+
+	if len(errs) != 1 {
+		t.Fatalf("expected 1 error, got %d : %s", len(errs), errs)
+	}
+	expected := "task 'stats': step name 'lint' is not unique"
+	if errs[0].Error() != expected {
+		t.Fatalf("expected: %s, got: %s", expected, errs[0].Error())
+	}
+}
+
+func TestConfigs_ValidateWithPlatform(t *testing.T) {
+	step := getSampleStep()
+	step.Platform = "linux/amd64"
+	tasks := map[string]Task{"stats": {Steps: []Step{step}}}
+	configs := &Configs{Tasks: tasks}
+
+	errs := configs.Validate()
+
+	if len(errs) != 0 {
+		t.Fatalf("expected no errors, got %s", errs)
+	}
+}
+
+func TestConfigs_ValidateWithInvalidPlatform(t *testing.T) {
+	step := getSampleStep()
+	step.Platform = "linux/foo"
+	tasks := map[string]Task{"stats": {Steps: []Step{step}}}
+	configs := &Configs{Tasks: tasks}
+
+	errs := configs.Validate()
+
+	if len(errs) != 1 {
+		t.Fatalf("expected 1 error, got %d : %s", len(errs), errs)
+	}
+	expected := "task 'stats': platform 'linux/foo' is invalid. Valid platforms are: " + strings.Join(validPlatforms, ", ")
+	if errs[0].Error() != expected {
+		t.Fatalf("expected: %s, got: %s", expected, errs[0].Error())
+	}
+}
+
+func TestIsValidPlatform(t *testing.T) {
+	for platform, expected := range map[string]bool{"linux/arm64": true, "windows/amd64": true, "linux/foo": false, "": false} {
+		if IsValidPlatform(platform) != expected {
+			t.Errorf("expected platform '%s' to be valid: %t", platform, expected)
+		}
+	}
+}
+
+func TestConfigs_ValidateWithNetwork(t *testing.T) {
+	for _, network := range []string{"host", "none", "bridge", "my-network_1.0"} {
+		step := getSampleStep()
+		step.Network = network
+		configs := &Configs{Tasks: map[string]Task{"stats": {Steps: []Step{step}}}}
+
+		if errs := configs.Validate(); len(errs) != 0 {
+			t.Errorf("expected no errors for network '%s', got: %s", network, errs)
+		}
+	}
+}
+
+func TestConfigs_ValidateWithInvalidNetwork(t *testing.T) {
+	step := getSampleStep()
+	step.Network = "my network"
+	configs := &Configs{Tasks: map[string]Task{"stats": {Steps: []Step{step}}}}
+
+	errs := configs.Validate()
+
+	expected := "task 'stats': network 'my network' is invalid. It must be one of host, none, bridge, or the name of a Docker network"
+	if len(errs) != 1 || errs[0].Error() != expected {
+		t.Fatalf("expected error: %s, got: %s", expected, errs)
+	}
+}
+
+func TestConfigs_ValidateWithCapabilities(t *testing.T) {
+	step := getSampleStep()
+	step.Privileged = true
+	step.CapAdd = []string{"NET_ADMIN", "cap_sys_admin"}
+	step.CapDrop = []string{"MKNOD"}
+	configs := &Configs{Tasks: map[string]Task{"stats": {Steps: []Step{step}}}}
+
+	if errs := configs.Validate(); len(errs) != 0 {
+		t.Fatalf("expected no errors, got: %s", errs)
+	}
+}
+
+func TestConfigs_ValidateWithInvalidCapability(t *testing.T) {
+	step := getSampleStep()
+	step.CapAdd = []string{"SUPERPOWERS"}
+	configs := &Configs{Tasks: map[string]Task{"stats": {Steps: []Step{step}}}}
+
+	errs := configs.Validate()
+
+	expected := "task 'stats': capability 'SUPERPOWERS' is invalid. It must be a Linux capability like 'NET_ADMIN' or 'SYS_ADMIN', or 'ALL'"
+	if len(errs) != 1 || errs[0].Error() != expected {
+		t.Fatalf("expected error: %s, got: %s", expected, errs)
+	}
+}
+
+func TestConfigs_ValidatePrivilegedWithAllCapabilitiesDropped(t *testing.T) {
+	step := getSampleStep()
+	step.Privileged = true
+	step.CapDrop = []string{"all"}
+	configs := &Configs{Tasks: map[string]Task{"stats": {Steps: []Step{step}}}}
+
+	errs := configs.Validate()
+
+	expected := fmt.Sprintf("task 'stats': step '%s' cannot be `privileged` and drop all capabilities with `cap_drop`", step.Name)
+	if len(errs) != 1 || errs[0].Error() != expected {
+		t.Fatalf("expected error: %s, got: %s", expected, errs)
+	}
+}
+
+func TestConfigs_ValidateWithServices(t *testing.T) {
+	services := map[string]Service{
+		"db":    {Image: "postgres:12", Ports: []string{"5432:5432"}, Healthcheck: []string{"pg_isready"}, HealthTimeout: "30s", StopTimeout: "1m"},
+		"redis": {Image: "redis"},
+	}
+	configs := &Configs{Tasks: map[string]Task{"stats": {Steps: []Step{getSampleStep()}, Services: services}}}
+
+	if errs := configs.Validate(); len(errs) != 0 {
+		t.Fatalf("expected no errors, got: %s", errs)
 	}
+}
+
+func TestConfigs_ValidateWithInvalidServices(t *testing.T) {
+	services := map[string]Service{"my db": {HealthTimeout: "soon"}}
+	configs := &Configs{Tasks: map[string]Task{"stats": {Steps: []Step{getSampleStep()}, Services: services}}}
 
 	errs := configs.Validate()
 
-	if len(errs) != 0 {
-		t.Fatalf("Configs Validation failed, expected to pass. got: %s", errs)
+	expected := []string{
+		"task 'stats': service name 'my db' is invalid. It must be a valid hostname",
+		"task 'stats': image is a required field",
+		"task 'stats': duration 'soon' is invalid. It must be a duration like '5s' or '1m30s'",
+	}
+	if len(errs) != len(expected) {
+		t.Fatalf("expected errors: %v, got: %s", expected, errs)
+	}
+	for i, err := range errs {
+		if err.Error() != expected[i] {
+			t.Errorf("expected error: %s, got: %s", expected[i], err)
+		}
 	}
 }
 
-func TestConfigs_ValidateWithNoTasks(t *testing.T) {
-	tasks := make(map[string]Task, 0)
-	configs := &Configs{Tasks: tasks}
+func TestConfigs_ValidateWithInvalidServiceStopTimeout(t *testing.T) {
+	services := map[string]Service{"db": {Image: "postgres:12", StopTimeout: "30"}}
+	configs := &Configs{Tasks: map[string]Task{"stats": {Steps: []Step{getSampleStep()}, Services: services}}}
 
 	errs := configs.Validate()
 
-	if len(errs) != 0 {
-		t.Fatalf("Configs validation failed, expected no error, got %s", errs)
+	expected := "task 'stats': duration '30' is invalid. It must be a duration like '5s' or '1m30s'"
+	if len(errs) != 1 || errs[0].Error() != expected {
+		t.Fatalf("expected error: %s, got: %s", expected, errs)
 	}
 }
 
-func TestConfigs_ValidateWithEmptyImageAndCommand(t *testing.T) {
-	tasks := make(map[string]Task, 0)
-	step := Step{Image: "", Command: []string{""}}
-	tasks["stats"] = Task{Steps: []Step{step}}
-	configs := &Configs{Tasks: tasks}
+func TestConfigs_ValidateWithInvalidStopTimeout(t *testing.T) {
+	for _, timeout := range []string{"30", "-5s"} {
+		step := getSampleStep()
+		step.StopTimeout = timeout
+		configs := &Configs{Tasks: map[string]Task{"stats": {Steps: []Step{step}}}}
+
+		errs := configs.Validate()
+
+		expected := fmt.Sprintf("task 'stats': duration '%s' is invalid. It must be a duration like '5s' or '1m30s'", timeout)
+		if len(errs) != 1 || errs[0].Error() != expected {
+			t.Errorf("expected error: %s, got: %s", expected, errs)
+		}
+	}
+}
+
+func TestConfigs_ValidateWithInvalidRetries(t *testing.T) {
+	step := getSampleStep()
+	step.Retries = -1
+	step.RetryDelay = "5 seconds"
+	configs := &Configs{Tasks: map[string]Task{"stats": {Steps: []Step{step}}}}
 
 	errs := configs.Validate()
 
 	if len(errs) != 2 {
 		t.Fatalf("expected 2 errors, got %d : %s", len(errs), errs)
 	}
-
-	expected1 := "task 'stats': image is required, unless the task has a `follow` field"
-	expected2 := "task 'stats': command[0] is a required field"
-	if errs[0].Error() != expected1 {
-		t.Fatalf("expected: %s, got: %s", expected1, errs[0].Error())
+	expected := []string{
+		"task 'stats': retries must be 0 or greater",
+		"task 'stats': duration '5 seconds' is invalid. It must be a duration like '5s' or '1m30s'",
 	}
-	if errs[1].Error() != expected2 {
-		t.Fatalf("expected: %s, got: %s", expected2, errs[1].Error())
+	for i, err := range errs {
+		if err.Error() != expected[i] {
+			t.Errorf("expected: %s, got: %s", expected[i], err.Error())
+		}
 	}
 }
 
-func TestConfigs_ValidateForAliasTask(t *testing.T) {
-	tasks := make(map[string]Task, 0)
-	tasks["foo"] = Task{Steps: []Step{{Image: "golang", Command: []string{"go", "version"}}}}
-	tasks["stats"] = Task{Steps: []Step{{Follow: "foo"}}}
-	configs := &Configs{Tasks: tasks}
+func TestConfigs_ValidateWithPorts(t *testing.T) {
+	step := getSampleStep()
+	step.Ports = []string{"8080:80", "5353:53/udp", "127.0.0.1:3000:3000", "9000-9001:9000-9001"}
+	configs := &Configs{Tasks: map[string]Task{"stats": {Steps: []Step{step}}}}
 
-	errs := configs.Validate()
+	if errs := configs.Validate(); len(errs) != 0 {
+		t.Fatalf("expected no errors, got: %s", errs)
+	}
+}
 
-	if len(errs) != 0 {
-		t.Fatalf("expected no errors, got %d : %s", len(errs), errs)
+func TestConfigs_ValidateWithInvalidPorts(t *testing.T) {
+	for _, port := range []string{"80", "70000:80", "8080:70000", "0:80", ":80", "8080:80/foo", "http:80"} {
+		step := getSampleStep()
+		step.Ports = []string{port}
+		configs := &Configs{Tasks: map[string]Task{"stats": {Steps: []Step{step}}}}
+
+		errs := configs.Validate()
+
+		expected := fmt.Sprintf("task 'stats': port '%s' is invalid. Check format is '<host_port>:<container_port>[/<protocol>]' with ports from 1 to 65535", port)
+		if len(errs) != 1 || errs[0].Error() != expected {
+			t.Errorf("expected error: %s, got: %s", expected, errs)
+		}
 	}
 }
 
-func TestConfigs_ValidateWithInvalidMountFormat(t *testing.T) {
+func TestConfigs_ValidateWithInvalidPassEnv(t *testing.T) {
 	step := getSampleStep()
-	step.Mounts = []string{"invalid_dir"}
-	var tasks = make(map[string]Task)
-	tasks["stats"] = Task{Steps: []Step{step}}
-	var configs = &Configs{
-		Tasks: tasks,
-	}
+	step.PassEnv = []string{"AWS_*", "TOKEN!", "HOME=/root"}
+	configs := &Configs{Tasks: map[string]Task{"stats": {Steps: []Step{step}, PassEnv: []string{"1PASSWORD"}}}}
 
 	errs := configs.Validate()
 
-	if len(errs) != 1 {
-		t.Fatalf("expected 1 error, got %d : %s", len(errs), errs)
+	expected := []string{
+		"pass_env '1PASSWORD' is invalid. It must be the name of an environment variable, which may have '*' and '?' wildcards, followed by '!' if it is required",
+		"task 'stats': pass_env 'HOME=/root' is invalid. It must be the name of an environment variable, which may have '*' and '?' wildcards, followed by '!' if it is required",
 	}
-
-	expected := "task 'stats': mount directory 'invalid_dir' is invalid. Check format is '<valid_src_dir>:<valid_dest_dir>:<optional_mode>' and has right permission level"
-	if errs[0].Error() != expected {
-		t.Fatalf("expected: %s, got: %s", expected, errs[0].Error())
+	if len(errs) != len(expected) {
+		t.Fatalf("expected errors: %q, got: %s", expected, errs)
+	}
+	for i, err := range errs {
+		if err.Error() != expected[i] {
+			t.Errorf("expected error: %s, got: %s", expected[i], err)
+		}
 	}
 }
 
-func TestConfigs_ValidateWithValidMountDirectory(t *testing.T) {
+func TestConfigs_ValidateWithDuplicateEnvs(t *testing.T) {
 	step := getSampleStep()
-	wd, _ := os.Getwd()
-	step.Mounts = []string{fmt.Sprintf("%s:%s:w", wd, wd)}
-	var tasks = make(map[string]Task)
-	tasks["stats"] = Task{Steps: []Step{step}}
-	var configs = &Configs{
-		Tasks: tasks,
+	step.Name = "hello_world"
+	step.Envs = []string{"FOO=1", "BAR=2", "FOO=3", "FOO=4"}
+	services := map[string]Service{"db": {Image: "postgres:12", Envs: []string{"USER=a", "USER=b"}}}
+	configs := &Configs{
+		Envs:  []string{"GLB=1", "GLB=2"},
+		Tasks: map[string]Task{"stats": {Steps: []Step{step}, Envs: []string{"TASK=1", "OTHER=1", "TASK=1"}, Services: services}},
 	}
 
 	errs := configs.Validate()
 
-	if errs != nil {
-		t.Fatalf("expected no errors, got %s", errs)
+	expected := []string{
+		"environment variable 'GLB' is defined more than once in global `envs`",
+		"task 'stats': environment variable 'TASK' is defined more than once in `envs`",
+		"task 'stats': step 'hello_world' has environment variable 'FOO' defined more than once in `envs`",
+		"task 'stats': service 'db' has environment variable 'USER' defined more than once in `envs`",
+	}
+	if len(errs) != len(expected) {
+		t.Fatalf("expected errors: %q, got: %s", expected, errs)
+	}
+	for i, err := range errs {
+		if err.Error() != expected[i] {
+			t.Errorf("expected error: %s, got: %s", expected[i], err)
+		}
 	}
 }
 
-func TestConfigs_ValidateWithMountDirFromEnv(t *testing.T) {
+func TestConfigs_ValidateWithDockerAccess(t *testing.T) {
 	step := getSampleStep()
-	wd, _ := os.Getwd()
-	step.Mounts = []string{fmt.Sprintf("%s:%s:w", wd, wd)}
-	var tasks = make(map[string]Task)
-	tasks["stats"] = Task{Steps: []Step{step}}
-	var configs = &Configs{
-		Tasks: tasks,
-	}
+	step.Name = "push"
+	step.DockerAccess = true
+	local := Step{Name: "deploy", Local: true, DockerAccess: true}
+	defer func(f func() (string, error)) { daemonSocket = f }(daemonSocket)
+	daemonSocket = func() (string, error) { return os.Args[0], nil }
+	configs := &Configs{Tasks: map[string]Task{"release": {Steps: []Step{step, local}}}}
 
 	errs := configs.Validate()
 
-	if errs != nil {
-		t.Fatalf("expected no errors, got %s", errs)
+	expected := "task 'release': step 'deploy' cannot have `mount_docker_sock` as it is `local`"
+	if len(errs) != 1 || errs[0].Error() != expected {
+		t.Fatalf("expected error: %s, got: %v", expected, errs)
 	}
 }
 
-func TestConfigs_ValidateWithNoModeGiven(t *testing.T) {
-	step := getSampleStep()
-	wd, _ := os.Getwd()
-	step.Mounts = []string{fmt.Sprintf("%s:%s", wd, wd)}
-	var tasks = make(map[string]Task)
-	tasks["stats"] = Task{Steps: []Step{step}}
-	var configs = &Configs{
-		Tasks: tasks,
+func TestConfigs_ValidateMountDockerSockWithRemoteDaemon(t *testing.T) {
+	defer func(f func() (string, error)) { daemonSocket = f }(daemonSocket)
+	daemonSocket = func() (string, error) {
+		return "", fmt.Errorf("the Docker daemon at tcp://docker.example.com:2376 is remote, its socket cannot be mounted on the container")
 	}
+	tasks := map[string]Task{"build": {Steps: []Step{{Name: "image", Image: "docker", Command: []string{"docker", "build", "."}, MountDockerSock: true}}}}
+	configs := &Configs{Tasks: tasks}
 
 	errs := configs.Validate()
 
-	if errs != nil {
-		t.Fatalf("expected no errors, got %s", errs)
+	expected := "task 'build': step 'image' has `mount_docker_sock` but the Docker daemon at tcp://docker.example.com:2376 is remote, its socket cannot be mounted on the container"
+	if len(errs) != 1 || errs[0].Error() != expected {
+		t.Fatalf("expected error: %s, got: %v", expected, errs)
 	}
 }
 
-func TestConfigs_ValidateWithInvalidMode(t *testing.T) {
-	step := getSampleStep()
-	wd, _ := os.Getwd()
-	step.Mounts = []string{fmt.Sprintf("%s:%s:ab", wd, wd)}
-	var tasks = make(map[string]Task)
-	tasks["stats"] = Task{Steps: []Step{step}}
-	var configs = &Configs{
-		Tasks: tasks,
-	}
+func TestConfigs_ValidateWithLocalInheritEnv(t *testing.T) {
+	local := Step{Name: "notify", Local: true, InheritEnv: true, Command: []string{"echo", "done"}}
+	configs := &Configs{Tasks: map[string]Task{"ci": {Steps: []Step{local}}}}
 
 	errs := configs.Validate()
 
-	expected := fmt.Sprintf("task 'stats': mount directory '%s' is invalid. Check format is '<valid_src_dir>:<valid_dest_dir>:<optional_mode>' and has right permission level", step.Mounts[0])
-	if errs[0].Error() != expected {
-		t.Fatalf("expected: %s, got: %s", expected, errs[0].Error())
+	expected := "task 'ci': step 'notify' cannot have `inherit_env` as it is `local`, it already runs with the environment of the host"
+	if len(errs) != 1 || errs[0].Error() != expected {
+		t.Fatalf("expected error: %s, got: %s", expected, errs)
 	}
 }
 
-func TestConfigs_ValidateWithInvalidMountDirectory(t *testing.T) {
-	step := getSampleStep()
-	step.Mounts = []string{"blah:foo:w"}
-	var tasks = make(map[string]Task)
-	tasks["stats"] = Task{Steps: []Step{step}}
-	var configs = &Configs{
-		Tasks: tasks,
-	}
+func TestConfigs_ValidateWithSharedContainer(t *testing.T) {
+	install := getSampleStep()
+	install.Name = "install"
+	test := getSampleStep()
+	test.Name = "test"
+	test.ContainerPerCommand = true
+	lint := Step{Name: "lint", Image: "golang", Command: []string{"go", "vet"}}
+	build := Step{Name: "build", Build: &Build{Context: "."}, Command: []string{"make"}}
+	local := Step{Name: "notify", Local: true, Command: []string{"echo", "done"}}
+	configs := &Configs{Tasks: map[string]Task{"ci": {SharedContainer: true, Steps: []Step{install, test, lint, build, local}}}}
 
 	errs := configs.Validate()
 
-	if len(errs) != 1 {
-		t.Fatalf("expected 1 error, got %d : %s", len(errs), errs)
+	expected := []string{
+		"task 'ci': step 'test' cannot have `container_per_command` as the task has `shared_container`",
+		"task 'ci': step 'lint' must have image 'image_name' of the previous steps as the task has `shared_container`",
+		"task 'ci': step 'build' cannot have `build` as the task has `shared_container`",
+		"task 'ci': step 'build' must have image 'image_name' of the previous steps as the task has `shared_container`",
 	}
-
-	expected := "task 'stats': mount directory 'blah:foo:w' is invalid. Check if source directory path exists."
-	if errs[0].Error() != expected {
-		t.Fatalf("expected: %s, got: %s", expected, errs[0].Error())
+	if len(errs) != len(expected) {
+		t.Fatalf("expected errors: %q, got: %s", expected, errs)
+	}
+	for i, err := range errs {
+		if err.Error() != expected[i] {
+			t.Errorf("expected error: %s, got: %s", expected[i], err)
+		}
 	}
 }
 
-func TestConfigs_ValidateWithValidEnvInMountDir(t *testing.T) {
-	os.Setenv("TEST_DIR", util.HomeDir)
-	defer os.Setenv("TEST_DIR", "")
+func TestConfigs_ValidateWithExtraHosts(t *testing.T) {
 	step := getSampleStep()
-	step.Mounts = []string{"`$TEST_DIR`:foo:w"}
-	var tasks = make(map[string]Task)
-	tasks["stats"] = Task{Steps: []Step{step}}
-	var configs = &Configs{
-		Tasks: tasks,
+	step.ExtraHosts = []string{"db:host-gateway", "registry.local:10.0.0.5", "api:::1"}
+	configs := &Configs{
+		Tasks:      map[string]Task{"stats": {Steps: []Step{step}}},
+		ExtraHosts: []string{"host.docker.internal:host-gateway"},
 	}
 
-	errs := configs.Validate()
-
-	if len(errs) != 0 {
-		t.Fatalf("expected 0 errors, got %d : %s", len(errs), errs)
+	if errs := configs.Validate(); len(errs) != 0 {
+		t.Fatalf("expected no errors, got: %s", errs)
 	}
 }
 
-func TestConfigs_ValidateWithEnvInMountDir_Invalid(t *testing.T) {
-	os.Setenv("TEST_DIR", "/test_invalid")
-	defer os.Setenv("TEST_DIR", "")
-	step := getSampleStep()
-	step.Mounts = []string{"`$TEST_DIR`:foo:w"}
-	var tasks = make(map[string]Task)
-	tasks["stats"] = Task{Steps: []Step{step}}
-	var configs = &Configs{
-		Tasks: tasks,
-	}
+func TestConfigs_ValidateWithInvalidExtraHosts(t *testing.T) {
+	for _, host := range []string{"db", "db:", ":10.0.0.5", "db:localhost", "-db:10.0.0.5", "db:10.0.0.256"} {
+		step := getSampleStep()
+		step.ExtraHosts = []string{host}
+		configs := &Configs{Tasks: map[string]Task{"stats": {Steps: []Step{step}}}}
 
-	errs := configs.Validate()
+		errs := configs.Validate()
 
-	if len(errs) != 1 {
-		t.Fatalf("expected 1 error, got %d : %s", len(errs), errs)
+		expected := fmt.Sprintf("task 'stats': extra host '%s' is invalid. Check format is '<name>:<ip>', where ip may be 'host-gateway'", host)
+		if len(errs) != 1 || errs[0].Error() != expected {
+			t.Errorf("expected error: %s, got: %s", expected, errs)
+		}
 	}
 
-	expected := "task 'stats': mount directory '`$TEST_DIR`:foo:w' is invalid. Check if source directory path exists."
-	if errs[0].Error() != expected {
-		t.Fatalf("expected: %s, got: %s", expected, errs[0].Error())
+	configs := &Configs{Tasks: map[string]Task{"stats": {Steps: []Step{getSampleStep()}}}, ExtraHosts: []string{"db"}}
+	expected := "extra host 'db' is invalid. Check format is '<name>:<ip>', where ip may be 'host-gateway'"
+	if errs := configs.Validate(); len(errs) != 1 || errs[0].Error() != expected {
+		t.Errorf("expected error: %s, got: %s", expected, errs)
 	}
 }
 
-func TestConfigs_ValidateWithNonExistingEnvInMountDir(t *testing.T) {
+func TestConfigs_ValidateWithInvalidLimits(t *testing.T) {
 	step := getSampleStep()
-	step.Mounts = []string{"`$TEST_DIR_DUNNER`:foo:w"}
-	var tasks = make(map[string]Task)
-	tasks["stats"] = Task{Steps: []Step{step}}
-	var configs = &Configs{
-		Tasks: tasks,
-	}
+	step.Memory = "512 megs"
+	step.CPUs = -1
+	configs := &Configs{Tasks: map[string]Task{"stats": {Steps: []Step{step}}}}
 
 	errs := configs.Validate()
 
-	if len(errs) != 1 {
-		t.Fatalf("expected 1 error, got %d : %s", len(errs), errs)
+	expected := []string{
+		"task 'stats': memory '512 megs' is invalid. It must be a size like '512m' or '2g'",
+		"task 'stats': cpus must be 0 or greater",
 	}
+	if len(errs) != len(expected) {
+		t.Fatalf("expected %d errors, got %d : %s", len(expected), len(errs), errs)
+	}
+	for i, err := range errs {
+		if err.Error() != expected[i] {
+			t.Errorf("expected: %s, got: %s", expected[i], err.Error())
+		}
+	}
+}
 
-	expected := "task 'stats': mount directory '`$TEST_DIR_DUNNER`:foo:w' is invalid. Check if source directory path exists."
-	if errs[0].Error() != expected {
-		t.Fatalf("expected: %s, got: %s", expected, errs[0].Error())
+func TestStepLimits(t *testing.T) {
+	step := Step{Memory: "512m", CPUs: 1.5}
+
+	memory, err := step.MemoryBytes()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if memory != 512*1024*1024 {
+		t.Errorf("expected memory of 512MiB, got: %d", memory)
+	}
+	if step.NanoCPUs() != 1500000000 {
+		t.Errorf("expected 1.5 CPUs, got: %d nano CPUs", step.NanoCPUs())
+	}
+}
+
+func TestStepWithoutLimits(t *testing.T) {
+	step := Step{}
+
+	memory, err := step.MemoryBytes()
+
+	if err != nil || memory != 0 || step.NanoCPUs() != 0 {
+		t.Fatalf("expected no limits, got memory: %d, nano CPUs: %d, error: %v", memory, step.NanoCPUs(), err)
 	}
 }
 
@@ -402,6 +1374,12 @@ var lookupEnvtests = []struct {
 	{"`$HOME`/foo", util.HomeDir + "/foo", nil},
 	{"`$HOME`/foo/`$HOME`", util.HomeDir + "/foo/" + util.HomeDir, nil},
 	{"`$INVALID_TEST`/foo", "`$INVALID_TEST`/foo", fmt.Errorf("could not find environment variable 'INVALID_TEST'")},
+	{"`${HOME}`/foo", util.HomeDir + "/foo", nil},
+	{"`$HOME:-/tmp`/foo", util.HomeDir + "/foo", nil},
+	{"`$INVALID_TEST:-/tmp`/foo", "/tmp/foo", nil},
+	{"`${INVALID_TEST:-/tmp}`/foo", "/tmp/foo", nil},
+	{"/foo`$INVALID_TEST:-`", "/foo", nil},
+	{"`${INVALID_TEST}`/foo", "`${INVALID_TEST}`/foo", fmt.Errorf("could not find environment variable 'INVALID_TEST'")},
 }
 
 func TestLookUpDirectory(t *testing.T) {
@@ -438,6 +1416,34 @@ func TestDecodeMount(t *testing.T) {
 	}
 }
 
+func TestDecodeMountRelativeToHostDir(t *testing.T) {
+	step := &docker.Step{HostDir: "/project"}
+
+	if err := DecodeMount([]string{"data:/data", "/tmp:/tmp"}, step); err != nil {
+		t.Fatalf("expected no error, got %s", err.Error())
+	}
+
+	if step.ExtMounts[0].Source != "/project/data" || step.ExtMounts[1].Source != "/tmp" {
+		t.Errorf("expected sources /project/data and /tmp, got: %s and %s", step.ExtMounts[0].Source, step.ExtMounts[1].Source)
+	}
+}
+
+func TestDecodeMountReadOnlyModes(t *testing.T) {
+	step := &docker.Step{}
+	mounts := []string{"/tmp:/a", "/tmp:/b:r", "/tmp:/c:w", "/tmp:/d:wr", "/tmp:/e:rw"}
+
+	if err := DecodeMount(mounts, step); err != nil {
+		t.Fatalf("expected no error, got %s", err.Error())
+	}
+
+	expected := []bool{true, true, false, false, false}
+	for i, m := range step.ExtMounts {
+		if m.ReadOnly != expected[i] {
+			t.Errorf("expected read-only of mount '%s' to be %v, got %v", mounts[i], expected[i], m.ReadOnly)
+		}
+	}
+}
+
 func TestDecodeMountWithEnvironmentVariable(t *testing.T) {
 	step := &docker.Step{}
 	mounts := []string{"/tmp:/app"}
@@ -518,7 +1524,7 @@ func TestGetConfigsWhenNotPresentTillRoot(t *testing.T) {
 	got, err := GetConfigs(taskFile)
 
 	if got != nil {
-		t.Errorf("expected Configs to be nil, got %s", got)
+		t.Errorf("expected Configs to be nil, got %v", got)
 	}
 	if err == nil {
 		t.Fatalf("expected error, got nil")
@@ -662,3 +1668,127 @@ func TestParseStepEnvToReplaceUserSuccess(t *testing.T) {
 		t.Errorf("expected step dir: %s, got: %s", os.Getenv("USER"), step.User)
 	}
 }
+
+func TestParseStepEnvToReplaceImageTag(t *testing.T) {
+	os.Setenv("DUNNER_TEST_TAG", "10.15.0")
+	defer os.Unsetenv("DUNNER_TEST_TAG")
+	step := &Step{Image: "myregistry.io/node:`$DUNNER_TEST_TAG`"}
+
+	err := step.ParseStepEnv()
+
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if expected := "myregistry.io/node:10.15.0"; step.Image != expected {
+		t.Errorf("expected step image: %s, got: %s", expected, step.Image)
+	}
+}
+
+func TestParseStepEnvWithInvalidImage(t *testing.T) {
+	os.Setenv("DUNNER_TEST_TAG", "not a tag")
+	defer os.Unsetenv("DUNNER_TEST_TAG")
+	step := &Step{Name: "build", Image: "node:`$DUNNER_TEST_TAG`"}
+
+	err := step.ParseStepEnv()
+
+	expected := "config: invalid image name 'node:not a tag' of step 'build': invalid reference format"
+	if err == nil || err.Error() != expected {
+		t.Fatalf("expected error: %s, got: %v", expected, err)
+	}
+}
+
+func TestParseStepEnvToReplaceOutputFile(t *testing.T) {
+	os.Setenv("DUNNER_TEST_LOG_DIR", "logs")
+	defer os.Unsetenv("DUNNER_TEST_LOG_DIR")
+	step := &Step{Image: "node", OutputFile: "`$DUNNER_TEST_LOG_DIR`/build.log"}
+
+	err := step.ParseStepEnv()
+
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if expected := "logs/build.log"; step.OutputFile != expected {
+		t.Errorf("expected step output file: %s, got: %s", expected, step.OutputFile)
+	}
+}
+
+func TestGetConfigsWithYAMLAnchors(t *testing.T) {
+	var content = []byte(`
+x-node-step: &node_step
+  image: node:10.15.0
+  user: 20
+  envs:
+    - MYVAR=MYVAL
+tasks:
+  test:
+    steps:
+      - *node_step
+  build:
+    steps:
+      - <<: *node_step
+        name: build
+        commands:
+          - ["npm", "install"]`)
+
+	tmpFile, err := ioutil.TempFile("", ".testdunner.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmpFile.Name())
+	if _, err := tmpFile.Write(content); err != nil {
+		t.Fatal(err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	configs, err := GetConfigs(tmpFile.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	anchored := Step{Name: "step-1", Index: 1, Image: "node:10.15.0", User: "20", Envs: []string{"MYVAR=MYVAL"}}
+	if got := configs.Tasks["test"].Steps[0]; !reflect.DeepEqual(anchored, got) {
+		t.Errorf("expected aliased step: %v, got: %v", anchored, got)
+	}
+
+	merged := Step{
+		Name:     "build",
+		Index:    1,
+		Image:    "node:10.15.0",
+		User:     "20",
+		Envs:     []string{"MYVAR=MYVAL"},
+		Commands: [][]string{{"npm", "install"}},
+	}
+	if got := configs.Tasks["build"].Steps[0]; !reflect.DeepEqual(merged, got) {
+		t.Errorf("expected merged step: %v, got: %v", merged, got)
+	}
+}
+
+func TestConfigs_ValidateWithImages(t *testing.T) {
+	test := Step{Name: "test", Images: []string{"node:16", "node:18"}, Command: []string{"npm", "test"}}
+	both := Step{Name: "both", Image: "node:20", Images: []string{"node:16"}, Command: []string{"npm", "test"}}
+	local := Step{Name: "local", Local: true, Images: []string{"node:16"}, Command: []string{"npm", "test"}}
+	empty := Step{Name: "empty", Images: []string{"node:16", ""}, Command: []string{"npm", "test"}}
+	configs := &Configs{Tasks: map[string]Task{
+		"matrix": {Steps: []Step{test, both, local, empty}},
+		"shared": {SharedContainer: true, Steps: []Step{test}},
+	}}
+
+	errs := configs.Validate()
+
+	expected := []string{
+		"task 'matrix': step 'both' cannot have both `image` and `images`",
+		"task 'matrix': step 'local' cannot have `images` along with `local`, `build` or `follow`",
+		"task 'matrix': images[1] is a required field",
+		"task 'shared': step 'test' cannot have `images` as the task has `shared_container`",
+	}
+	if len(errs) != len(expected) {
+		t.Fatalf("expected errors: %q, got: %s", expected, errs)
+	}
+	for i, err := range errs {
+		if err.Error() != expected[i] {
+			t.Errorf("expected error: %s, got: %s", expected[i], err)
+		}
+	}
+}
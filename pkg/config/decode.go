@@ -0,0 +1,45 @@
+package config
+
+// UnmarshalYAML decodes the step, along with the aliases referred by its commands and its environment variables
+// scoped to an operating system, which are resolved once the task file is decoded
+func (step *Step) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain Step
+	if err := unmarshal((*plain)(step)); err != nil {
+		return err
+	}
+	var fields map[string]interface{}
+	if err := unmarshal(&fields); err != nil {
+		return err
+	}
+	step.aliasRefs = decodeAliasRefs(fields)
+	step.osEnvs = decodeOSEnvs(fields)
+	return nil
+}
+
+// UnmarshalYAML decodes the task, along with its environment variables scoped to an operating system
+func (task *Task) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain Task
+	if err := unmarshal((*plain)(task)); err != nil {
+		return err
+	}
+	var fields map[string]interface{}
+	if err := unmarshal(&fields); err != nil {
+		return err
+	}
+	task.osEnvs = decodeOSEnvs(fields)
+	return nil
+}
+
+// UnmarshalYAML decodes the task file, along with its global environment variables scoped to an operating system
+func (configs *Configs) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain Configs
+	if err := unmarshal((*plain)(configs)); err != nil {
+		return err
+	}
+	var fields map[string]interface{}
+	if err := unmarshal(&fields); err != nil {
+		return err
+	}
+	configs.osEnvs = decodeOSEnvs(fields)
+	return nil
+}
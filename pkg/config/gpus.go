@@ -0,0 +1,67 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/api/types/container"
+	validator "gopkg.in/go-playground/validator.v9"
+)
+
+// AllGPUs is the value of `gpus` requesting all the GPUs of the host
+const AllGPUs = "all"
+
+// gpuDevicesPrefix prefixes the IDs of the GPUs requested in `gpus`, like `device=0,1`
+const gpuDevicesPrefix = "device="
+
+// GPURequest returns the request of the GPUs of the step for the NVIDIA driver, or nil if it requests none. Like
+// `--gpus` of `docker run`, `gpus` is `all`, a number of GPUs or `device=<id>[,<id>...]` for given GPUs.
+func (step *Step) GPURequest() (*container.DeviceRequest, error) {
+	if step.GPUs == "" {
+		return nil, nil
+	}
+	request, err := parseGPUs(step.GPUs)
+	if err != nil {
+		return nil, fmt.Errorf("config: invalid gpus '%s' of step '%s': %s", step.GPUs, step.Name, err.Error())
+	}
+	return request, nil
+}
+
+// ValidateGPUs verifies that the GPUs requested are `all`, a positive number or IDs of devices
+func ValidateGPUs(ctx context.Context, fl validator.FieldLevel) bool {
+	_, err := parseGPUs(fl.Field().String())
+	return err == nil
+}
+
+func parseGPUs(gpus string) (*container.DeviceRequest, error) {
+	request := &container.DeviceRequest{Driver: "nvidia", Capabilities: [][]string{{"gpu"}}}
+	switch {
+	case gpus == AllGPUs:
+		request.Count = -1
+	case strings.HasPrefix(gpus, AllGPUs+","):
+		return nil, errors.New("`all` cannot be mixed with device IDs")
+	case strings.HasPrefix(gpus, gpuDevicesPrefix):
+		for _, id := range strings.Split(strings.TrimPrefix(gpus, gpuDevicesPrefix), ",") {
+			switch id = strings.TrimSpace(id); id {
+			case "":
+				return nil, errors.New("device IDs cannot be empty")
+			case AllGPUs:
+				return nil, errors.New("`all` cannot be mixed with device IDs")
+			}
+			request.DeviceIDs = append(request.DeviceIDs, id)
+		}
+	default:
+		count, err := strconv.Atoi(gpus)
+		if err != nil {
+			return nil, fmt.Errorf("it must be '%s', a number of GPUs or '%s<id>[,<id>...]'", AllGPUs, gpuDevicesPrefix)
+		}
+		if count < 1 {
+			return nil, errors.New("number of GPUs must be positive")
+		}
+		request.Count = count
+	}
+	return request, nil
+}
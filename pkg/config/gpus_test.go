@@ -0,0 +1,57 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+func TestStepGPURequest(t *testing.T) {
+	tests := map[string]*container.DeviceRequest{
+		"":             nil,
+		"all":          {Driver: "nvidia", Count: -1, Capabilities: [][]string{{"gpu"}}},
+		"2":            {Driver: "nvidia", Count: 2, Capabilities: [][]string{{"gpu"}}},
+		"device=0, 2":  {Driver: "nvidia", DeviceIDs: []string{"0", "2"}, Capabilities: [][]string{{"gpu"}}},
+		"device=GPU-1": {Driver: "nvidia", DeviceIDs: []string{"GPU-1"}, Capabilities: [][]string{{"gpu"}}},
+	}
+	for gpus, expected := range tests {
+		step := Step{Name: "train", GPUs: gpus}
+
+		request, err := step.GPURequest()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(request, expected) {
+			t.Errorf("expected request of '%s': %+v, got: %+v", gpus, expected, request)
+		}
+	}
+}
+
+func TestConfigs_ValidateWithInvalidGPUs(t *testing.T) {
+	for _, gpus := range []string{"-1", "0", "all,device=0", "device=all,1", "device=", "many"} {
+		step := getSampleStep()
+		step.GPUs = gpus
+		configs := &Configs{Tasks: map[string]Task{"train": {Steps: []Step{step}}}}
+
+		errs := configs.Validate()
+
+		expected := fmt.Sprintf("task 'train': gpus '%s' is invalid. It must be 'all', a positive number of GPUs or 'device=<id>[,<id>...]', without mixing `all` with device IDs", gpus)
+		if len(errs) != 1 || errs[0].Error() != expected {
+			t.Errorf("expected error: %s, got: %s", expected, errs)
+		}
+	}
+}
+
+func TestStepGPURequestWithInvalidGPUs(t *testing.T) {
+	step := Step{Name: "train", GPUs: "all,device=0"}
+
+	_, err := step.GPURequest()
+
+	expectedErr := "config: invalid gpus 'all,device=0' of step 'train': `all` cannot be mixed with device IDs"
+	if err == nil || err.Error() != expectedErr {
+		t.Fatalf("expected error: %s, got: %v", expectedErr, err)
+	}
+}
@@ -0,0 +1,100 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// loadTaskFile parses the task file and merges the files it includes into it, recursively. Paths of included files
+// are relative to the file including them. chain holds the files including this one, to detect cycles, included
+// the files already loaded, which are merged once, and origins the file defining each task. It fails if a task is
+// defined by more than one file.
+func loadTaskFile(taskFile string, chain []string, included map[string]struct{}, origins map[string]string) (*Configs, error) {
+	path, err := filepath.Abs(taskFile)
+	if err != nil {
+		return nil, err
+	}
+	included[path] = struct{}{}
+	configs, err := parseTaskFile(taskFile)
+	if err != nil {
+		if len(chain) == 0 {
+			return nil, err
+		}
+		return nil, fmt.Errorf("config: failed to include %s in %s: %s", path, chain[len(chain)-1], err.Error())
+	}
+	for name := range configs.Tasks {
+		if file, exists := origins[name]; exists {
+			return nil, fmt.Errorf("config: task '%s' of %s is already defined in %s", name, path, file)
+		}
+		origins[name] = path
+	}
+
+	chain = append(chain, path)
+	for _, include := range configs.Include {
+		includePath := include
+		if !filepath.IsAbs(includePath) {
+			includePath = filepath.Join(filepath.Dir(path), includePath)
+		}
+		for i, file := range chain {
+			if file == includePath {
+				return nil, fmt.Errorf("config: task files include each other: %s", strings.Join(append(chain[i:], includePath), " -> "))
+			}
+		}
+		if _, loaded := included[includePath]; loaded {
+			continue
+		}
+		base, err := loadTaskFile(includePath, chain, included, origins)
+		if err != nil {
+			return nil, err
+		}
+		mergeIncluded(configs, base)
+	}
+	return configs, nil
+}
+
+// mergeIncluded merges the included configs into configs. Tasks, mounts and extra hosts are added, while the
+// environment variables, user, project directory, digests, aliases and profiles of configs override those of
+// included.
+func mergeIncluded(configs *Configs, included *Configs) {
+	configs.Envs = mergeEnvs(included.Envs, configs.Envs)
+	configs.Mounts = append(included.Mounts, configs.Mounts...)
+	configs.ExtraHosts = append(included.ExtraHosts, configs.ExtraHosts...)
+	if configs.User == "" {
+		configs.User = included.User
+	}
+	if configs.ProjectDir == "" {
+		configs.ProjectDir = included.ProjectDir
+	}
+
+	if configs.Tasks == nil && len(included.Tasks) != 0 {
+		configs.Tasks = make(map[string]Task)
+	}
+	for name, task := range included.Tasks {
+		configs.Tasks[name] = task
+	}
+	if configs.LockedDigests == nil && len(included.LockedDigests) != 0 {
+		configs.LockedDigests = make(map[string]string)
+	}
+	for image, digest := range included.LockedDigests {
+		if _, exists := configs.LockedDigests[image]; !exists {
+			configs.LockedDigests[image] = digest
+		}
+	}
+	if configs.Aliases == nil && len(included.Aliases) != 0 {
+		configs.Aliases = make(map[string][]string)
+	}
+	for name, command := range included.Aliases {
+		if _, exists := configs.Aliases[name]; !exists {
+			configs.Aliases[name] = command
+		}
+	}
+	if configs.Profiles == nil && len(included.Profiles) != 0 {
+		configs.Profiles = make(map[string]Profile)
+	}
+	for name, profile := range included.Profiles {
+		if _, exists := configs.Profiles[name]; !exists {
+			configs.Profiles[name] = profile
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeTaskFiles writes the task files, by path relative to a new temporary directory, and returns the directory
+func writeTaskFiles(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "dunner-include")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, contents := range files {
+		file := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(file, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestGetConfigsWithInclude(t *testing.T) {
+	dir := writeTaskFiles(t, map[string]string{
+		".dunner.yaml": `
+include: [ci/common.yaml]
+envs: ["STAGE=dev"]
+tasks:
+  build:
+    steps:
+      - image: golang
+        command: ["go", "build"]`,
+		"ci/common.yaml": `
+include: [../base.yaml]
+envs: ["STAGE=ci", "REGISTRY=registry.local"]
+user: builder
+tasks:
+  lint:
+    steps:
+      - image: golang
+        command: ["go", "vet"]`,
+		"base.yaml": `
+mounts: ["/tmp:/cache"]
+tasks:
+  clean:
+    steps:
+      - image: alpine
+        command: ["rm", "-rf", "bin"]`,
+	})
+	defer os.RemoveAll(dir)
+
+	configs, err := GetConfigs(filepath.Join(dir, ".dunner.yaml"))
+
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	for _, task := range []string{"build", "lint", "clean"} {
+		if _, exists := configs.Tasks[task]; !exists {
+			t.Errorf("expected task '%s' to be merged, got: %v", task, configs.Tasks)
+		}
+	}
+	if expected := []string{"STAGE=dev", "REGISTRY=registry.local"}; !reflect.DeepEqual(configs.Envs, expected) {
+		t.Errorf("expected envs: %v, got: %v", expected, configs.Envs)
+	}
+	if configs.User != "builder" || !reflect.DeepEqual(configs.Mounts, []string{"/tmp:/cache"}) {
+		t.Errorf("expected user and mounts of included files, got: %s and %v", configs.User, configs.Mounts)
+	}
+}
+
+func TestGetConfigsWithAliasesOfIncludedFile(t *testing.T) {
+	dir := writeTaskFiles(t, map[string]string{
+		".dunner.yaml": `
+include: [common.yaml]
+aliases:
+  test: ["go", "test", "-race", "./..."]
+tasks:
+  build:
+    steps:
+      - image: golang
+        commands:
+          - {alias: build}
+          - {alias: test}`,
+		"common.yaml": `
+aliases:
+  build: ["go", "build", "./..."]
+  test: ["go", "test", "./..."]
+tasks:
+  ci:
+    steps:
+      - image: golang
+        command: {alias: build}`,
+	})
+	defer os.RemoveAll(dir)
+
+	configs, err := GetConfigs(filepath.Join(dir, ".dunner.yaml"))
+
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	expected := Commands{{"go", "build", "./..."}, {"go", "test", "-race", "./..."}}
+	if commands := configs.Tasks["build"].Steps[0].Commands; !reflect.DeepEqual(commands, expected) {
+		t.Errorf("expected commands: %v, got: %v", expected, commands)
+	}
+	if command := configs.Tasks["ci"].Steps[0].Command; !reflect.DeepEqual(command, Command{"go", "build", "./..."}) {
+		t.Errorf("expected command of included alias, got: %v", command)
+	}
+}
+
+func TestGetConfigsWithIncludeCycle(t *testing.T) {
+	dir := writeTaskFiles(t, map[string]string{
+		".dunner.yaml": "include: [a.yaml]\ntasks: {}",
+		"a.yaml":       "include: [b.yaml]\ntasks: {}",
+		"b.yaml":       "include: [a.yaml]\ntasks: {}",
+	})
+	defer os.RemoveAll(dir)
+
+	_, err := GetConfigs(filepath.Join(dir, ".dunner.yaml"))
+
+	expected := "config: task files include each other: " + strings.Join([]string{
+		filepath.Join(dir, "a.yaml"), filepath.Join(dir, "b.yaml"), filepath.Join(dir, "a.yaml"),
+	}, " -> ")
+	if err == nil || err.Error() != expected {
+		t.Fatalf("expected error: %s, got: %v", expected, err)
+	}
+}
+
+func TestGetConfigsWithDuplicateIncludedTask(t *testing.T) {
+	task := "\ntasks:\n  build:\n    steps:\n      - image: golang\n        command: [\"go\", \"build\"]"
+	dir := writeTaskFiles(t, map[string]string{
+		".dunner.yaml": "include: [common.yaml]" + task,
+		"common.yaml":  task,
+	})
+	defer os.RemoveAll(dir)
+
+	_, err := GetConfigs(filepath.Join(dir, ".dunner.yaml"))
+
+	expected := "config: task 'build' of " + filepath.Join(dir, "common.yaml") + " is already defined in " + filepath.Join(dir, ".dunner.yaml")
+	if err == nil || err.Error() != expected {
+		t.Fatalf("expected error: %s, got: %v", expected, err)
+	}
+}
+
+func TestGetConfigsWithMissingInclude(t *testing.T) {
+	dir := writeTaskFiles(t, map[string]string{".dunner.yaml": "include: [missing.yaml]\ntasks: {}"})
+	defer os.RemoveAll(dir)
+
+	_, err := GetConfigs(filepath.Join(dir, ".dunner.yaml"))
+
+	expected := "config: failed to include " + filepath.Join(dir, "missing.yaml") + " in " + filepath.Join(dir, ".dunner.yaml")
+	if err == nil || !strings.HasPrefix(err.Error(), expected) {
+		t.Fatalf("expected error starting with: %s, got: %v", expected, err)
+	}
+}
@@ -0,0 +1,115 @@
+package config
+
+import (
+	"fmt"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// osEnvsPrefix is the prefix of the keys of environment variables scoped to an operating system, like `envs_linux`
+const osEnvsPrefix = "envs_"
+
+// knownOSes are the operating systems environment variables can be scoped to
+var knownOSes = []string{"darwin", "freebsd", "linux", "windows"}
+
+// targetOS is the operating system whose environment variables are merged, it is replaced in tests
+var targetOS = runtime.GOOS
+
+// decodeOSEnvs returns the environment variables scoped to an operating system of the decoded fields of a scope,
+// by key like `envs_linux`. It returns nil if the scope has none.
+func decodeOSEnvs(fields map[string]interface{}) map[string][]string {
+	var osEnvs map[string][]string
+	for key, value := range fields {
+		if !strings.HasPrefix(key, osEnvsPrefix) {
+			continue
+		}
+		if osEnvs == nil {
+			osEnvs = make(map[string][]string)
+		}
+		envs, _ := value.([]interface{})
+		osEnvs[key] = make([]string, 0, len(envs))
+		for _, env := range envs {
+			osEnvs[key] = append(osEnvs[key], fmt.Sprint(env))
+		}
+	}
+	return osEnvs
+}
+
+// mergeOSEnvs merges the environment variables scoped to the operating system Dunner runs on into `envs`, globally,
+// in tasks and in steps. They are given next to `envs` as `envs_<os>`, like `envs_linux` or `envs_darwin`, and
+// override the variables of `envs` of the same name. It fails if `<os>` is not a known operating system.
+func mergeOSEnvs(configs *Configs) error {
+	var err error
+	if configs.Envs, err = mergeScopeOSEnvs(configs.Envs, configs.osEnvs, ""); err != nil {
+		return err
+	}
+	configs.osEnvs = nil
+	for _, taskName := range configs.taskNames() {
+		task := configs.Tasks[taskName]
+		for i := range task.Steps {
+			step := &task.Steps[i]
+			stepName := step.Name
+			if stepName == "" {
+				stepName = DefaultStepName(i)
+			}
+			if step.Envs, err = mergeScopeOSEnvs(step.Envs, step.osEnvs, fmt.Sprintf("task '%s': step '%s': ", taskName, stepName)); err != nil {
+				return err
+			}
+			step.osEnvs = nil
+		}
+		if task.Envs, err = mergeScopeOSEnvs(task.Envs, task.osEnvs, fmt.Sprintf("task '%s': ", taskName)); err != nil {
+			return err
+		}
+		task.osEnvs = nil
+		configs.Tasks[taskName] = task
+	}
+	return nil
+}
+
+// mergeScopeOSEnvs returns the envs of a scope with the variables of its osEnvs scoped to the target OS merged, scope
+// describes the scope in errors.
+func mergeScopeOSEnvs(envs []string, osEnvs map[string][]string, scope string) ([]string, error) {
+	keys := make([]string, 0, len(osEnvs))
+	for key := range osEnvs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		osName := strings.TrimPrefix(key, osEnvsPrefix)
+		if !isKnownOS(osName) {
+			return nil, fmt.Errorf("config: %s`%s` is scoped to unknown operating system '%s', it must be one of %s", scope, key, osName, strings.Join(knownOSes, ", "))
+		}
+	}
+	if overrides := osEnvs[osEnvsPrefix+targetOS]; len(overrides) != 0 {
+		envs = overrideEnvs(envs, overrides)
+	}
+	return envs, nil
+}
+
+// overrideEnvs replaces the variables of envs by those of overrides of the same name, and appends the others
+func overrideEnvs(envs []string, overrides []string) []string {
+	index := make(map[string]int)
+	for i, env := range envs {
+		index[strings.SplitN(env, "=", 2)[0]] = i
+	}
+	for _, env := range overrides {
+		name := strings.SplitN(env, "=", 2)[0]
+		if i, exists := index[name]; exists {
+			envs[i] = env
+			continue
+		}
+		index[name] = len(envs)
+		envs = append(envs, env)
+	}
+	return envs
+}
+
+func isKnownOS(name string) bool {
+	for _, known := range knownOSes {
+		if name == known {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,99 @@
+package config
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+var osEnvsTaskFile = []byte(`
+envs: ["SHELL_CMD=sh", "TMP=/tmp"]
+envs_windows: ["SHELL_CMD=cmd", "TMP=C:\\Temp"]
+tasks:
+  build:
+    envs_darwin: ["CC=clang"]
+    steps:
+      - image: golang
+        envs: ["GOOS=linux", "OUT=bin"]
+        envs_darwin: ["GOOS=darwin"]
+        envs_linux: ["CGO_ENABLED=0"]`)
+
+func TestGetConfigsMergesOSEnvs(t *testing.T) {
+	defer func(previous string) { targetOS = previous }(targetOS)
+	tmpFile := createTempTaskFile(t, osEnvsTaskFile)
+	defer os.Remove(tmpFile)
+
+	tests := []struct {
+		os     string
+		global []string
+		task   []string
+		step   []string
+	}{
+		{"linux", []string{"SHELL_CMD=sh", "TMP=/tmp"}, nil, []string{"GOOS=linux", "OUT=bin", "CGO_ENABLED=0"}},
+		{"darwin", []string{"SHELL_CMD=sh", "TMP=/tmp"}, []string{"CC=clang"}, []string{"GOOS=darwin", "OUT=bin"}},
+		{"windows", []string{"SHELL_CMD=cmd", `TMP=C:\Temp`}, nil, []string{"GOOS=linux", "OUT=bin"}},
+	}
+	for _, test := range tests {
+		targetOS = test.os
+
+		configs, err := GetConfigs(tmpFile)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+		task := configs.Tasks["build"]
+		if !reflect.DeepEqual(configs.Envs, test.global) || !reflect.DeepEqual(task.Envs, test.task) || !reflect.DeepEqual(task.Steps[0].Envs, test.step) {
+			t.Errorf("expected envs on %s: %v, %v and %v, got: %v, %v and %v", test.os, test.global, test.task, test.step,
+				configs.Envs, task.Envs, task.Steps[0].Envs)
+		}
+	}
+}
+
+func TestGetConfigsWithEnvsOfUnknownOS(t *testing.T) {
+	tmpFile := createTempTaskFile(t, []byte(`
+tasks:
+  build:
+    steps:
+      - name: compile
+        image: golang
+        envs_macos: ["GOOS=darwin"]`))
+	defer os.Remove(tmpFile)
+
+	_, err := GetConfigs(tmpFile)
+
+	expectedErr := "config: task 'build': step 'compile': `envs_macos` is scoped to unknown operating system 'macos', it must be one of darwin, freebsd, linux, windows"
+	if err == nil || err.Error() != expectedErr {
+		t.Fatalf("expected error: %s, got: %v", expectedErr, err)
+	}
+}
+
+func TestGetConfigsMergesOSEnvsWithAnchors(t *testing.T) {
+	defer func(previous string) { targetOS = previous }(targetOS)
+	targetOS = "linux"
+	tmpFile := createTempTaskFile(t, []byte(`
+x-go: &go
+  image: golang
+  envs: ["GOOS=linux"]
+tasks:
+  build:
+    steps:
+      - <<: *go
+        name: compile
+        envs_linux: ["CGO_ENABLED=0"]
+      - <<: *go
+        name: test`))
+	defer os.Remove(tmpFile)
+
+	configs, err := GetConfigs(tmpFile)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Step{
+		{Name: "compile", Index: 1, Image: "golang", Envs: []string{"GOOS=linux", "CGO_ENABLED=0"}},
+		{Name: "test", Index: 2, Image: "golang", Envs: []string{"GOOS=linux"}},
+	}
+	if steps := configs.Tasks["build"].Steps; !reflect.DeepEqual(steps, expected) {
+		t.Errorf("expected steps: %v, got: %v", expected, steps)
+	}
+}
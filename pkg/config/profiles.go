@@ -0,0 +1,60 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// applyProfile applies the overrides of the profile with the given name to the configs, nothing is done if the name
+// is empty. It fails if the task file does not define the profile.
+func applyProfile(configs *Configs, name string) error {
+	if name == "" {
+		return nil
+	}
+	profile, ok := configs.Profiles[name]
+	if !ok {
+		var names []string
+		for n := range configs.Profiles {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		if len(names) == 0 {
+			return fmt.Errorf("config: profile '%s' is not defined, the task file defines no `profiles`", name)
+		}
+		return fmt.Errorf("config: profile '%s' is not defined, defined profiles are: %s", name, strings.Join(names, ", "))
+	}
+
+	configs.Envs = mergeEnvs(configs.Envs, profile.Envs)
+	if profile.ForcePull {
+		for taskName, task := range configs.Tasks {
+			for i := range task.Steps {
+				configs.Tasks[taskName].Steps[i].ForcePull = true
+			}
+		}
+	}
+	return nil
+}
+
+// mergeEnvs returns the environment variables of `base` with the ones of `overrides` replacing those of the same
+// name, in place, and the rest of `overrides` appended
+func mergeEnvs(base []string, overrides []string) []string {
+	merged := append([]string{}, base...)
+	for _, override := range overrides {
+		name := envName(override)
+		replaced := false
+		for i, env := range merged {
+			if envName(env) == name {
+				merged[i], replaced = override, true
+			}
+		}
+		if !replaced {
+			merged = append(merged, override)
+		}
+	}
+	return merged
+}
+
+func envName(env string) string {
+	return strings.SplitN(env, "=", 2)[0]
+}
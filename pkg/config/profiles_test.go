@@ -0,0 +1,71 @@
+package config
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestGetConfigsAppliesProfile(t *testing.T) {
+	defer viper.Set("Profile", "")
+	viper.Set("Profile", "staging")
+	os.Setenv("DUNNER_STAGING_URL", "https://staging.example.com")
+	defer os.Unsetenv("DUNNER_STAGING_URL")
+	var content = []byte(`
+envs:
+  - API_URL=http://localhost
+  - LOG_LEVEL=debug
+profiles:
+  staging:
+    envs:
+      - API_URL=` + "`$DUNNER_STAGING_URL`" + `
+      - REPLICAS=2
+    force_pull: true
+  prod:
+    envs:
+      - API_URL=https://example.com
+tasks:
+  deploy:
+    steps:
+      - image: alpine
+        command: ["env"]`)
+	tmpFile := createTempTaskFile(t, content)
+	defer os.Remove(tmpFile)
+
+	configs, err := GetConfigs(tmpFile)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"API_URL=https://staging.example.com", "LOG_LEVEL=debug", "REPLICAS=2"}
+	if !reflect.DeepEqual(configs.Envs, expected) {
+		t.Errorf("expected envs: %v, got: %v", expected, configs.Envs)
+	}
+	if !configs.Tasks["deploy"].Steps[0].ForcePull {
+		t.Errorf("expected images to be pulled with the profile")
+	}
+}
+
+func TestApplyProfileNotDefined(t *testing.T) {
+	configs := &Configs{Profiles: map[string]Profile{"prod": {}, "dev": {}}}
+
+	err := applyProfile(configs, "staging")
+
+	expected := "config: profile 'staging' is not defined, defined profiles are: dev, prod"
+	if err == nil || err.Error() != expected {
+		t.Fatalf("expected error: %s, got: %v", expected, err)
+	}
+}
+
+func TestApplyNoProfile(t *testing.T) {
+	configs := &Configs{Envs: []string{"FOO=bar"}}
+
+	if err := applyProfile(configs, ""); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(configs.Envs, []string{"FOO=bar"}) {
+		t.Errorf("expected envs to be kept, got: %v", configs.Envs)
+	}
+}
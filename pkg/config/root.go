@@ -0,0 +1,104 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/leopardslab/dunner/pkg/docker"
+)
+
+// rootKey is the key of the context of validation holding the project directory of the task being validated
+var rootKey = contextKey("dunnerRoot")
+
+// ProjectRoot returns the absolute path of the project directory on the host, mounted on the containers of the
+// steps. It is dir if given, like with `--context`, or the directory of the task file found from filename otherwise.
+// The current directory is used if the task file is not found, for loading it to report the error.
+func ProjectRoot(filename string, dir string) (string, error) {
+	if dir == "" {
+		dir = "."
+		if taskFile, err := getDunnerTaskFile(filename); err == nil {
+			dir = filepath.Dir(taskFile)
+		}
+	}
+	return filepath.Abs(dir)
+}
+
+// Root returns the project directory of the steps of the task, its `workdir_root` relative to projectRoot, or
+// projectRoot itself if it has none
+func (task Task) Root(projectRoot string) string {
+	if task.WorkdirRoot == "" {
+		return projectRoot
+	}
+	if filepath.IsAbs(task.WorkdirRoot) {
+		return filepath.Clean(task.WorkdirRoot)
+	}
+	return filepath.Join(projectRoot, task.WorkdirRoot)
+}
+
+// hostPath returns the path of the directory on the host, relative to the project directory of the task being
+// validated in ctx if it is not absolute
+func hostPath(ctx context.Context, dir string) string {
+	root, _ := ctx.Value(rootKey).(string)
+	if root == "" || filepath.IsAbs(dir) {
+		return dir
+	}
+	return filepath.Join(root, dir)
+}
+
+// MountsProject returns true if the project directory is mounted on the containers of the step, as per its
+// `mount_project` or else the one of the task
+func (task Task) MountsProject(step Step) bool {
+	if step.MountProject != nil {
+		return *step.MountProject
+	}
+	return task.MountProject == nil || *task.MountProject
+}
+
+// taskNames returns the names of the tasks, sorted
+func (configs *Configs) taskNames() []string {
+	names := make([]string, 0, len(configs.Tasks))
+	for name := range configs.Tasks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Warnings returns the mistakes of the task file that do not prevent running it but are likely unintended, like
+// commands of a step referring to the project directory while it is not mounted.
+func (configs *Configs) Warnings() []string {
+	var warnings []string
+	for _, taskName := range configs.taskNames() {
+		task := configs.Tasks[taskName]
+		projectDir := docker.DefaultProjectDir
+		if task.ProjectDir != "" {
+			projectDir = task.ProjectDir
+		} else if configs.ProjectDir != "" {
+			projectDir = configs.ProjectDir
+		}
+		for _, step := range task.Steps {
+			if step.Local || step.Follow != "" || task.MountsProject(step) {
+				continue
+			}
+			if refersTo(step, projectDir) {
+				warnings = append(warnings, fmt.Sprintf("task '%s': step '%s' does not mount the project directory but its commands refer to %s", taskName, step.Name, projectDir))
+			}
+		}
+	}
+	return warnings
+}
+
+// refersTo returns true if an argument of the commands of the step contains the path
+func refersTo(step Step, path string) bool {
+	for _, command := range append([][]string{step.Command}, step.Commands...) {
+		for _, arg := range command {
+			if strings.Contains(arg, path) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,109 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestProjectRoot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dunner-root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	taskFile := filepath.Join(dir, "ci.yaml")
+
+	for _, tc := range []struct{ filename, dir, expected string }{
+		{filename: taskFile, expected: dir},
+		{filename: taskFile, dir: "/project", expected: "/project"},
+	} {
+		root, err := ProjectRoot(tc.filename, tc.dir)
+
+		if err != nil || root != tc.expected {
+			t.Errorf("expected root of %s with dir '%s' to be %s, got: %s (%v)", tc.filename, tc.dir, tc.expected, root, err)
+		}
+	}
+}
+
+func TestTaskRoot(t *testing.T) {
+	for workdirRoot, expected := range map[string]string{
+		"":             "/project",
+		"services/api": "/project/services/api",
+		"../shared":    "/shared",
+		"/opt/app":     "/opt/app",
+	} {
+		task := Task{WorkdirRoot: workdirRoot}
+
+		if root := task.Root("/project"); root != expected {
+			t.Errorf("expected root of task with workdir_root '%s' to be %s, got: %s", workdirRoot, expected, root)
+		}
+	}
+}
+
+func TestConfigs_ValidateWithWorkdirRoot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dunner-root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.MkdirAll(filepath.Join(dir, "api", "data"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	defer viper.Set("WorkingDirectory", viper.GetString("WorkingDirectory"))
+	viper.Set("WorkingDirectory", dir)
+	step := getSampleStep()
+	step.Mounts = []string{"data:/data"}
+	configs := &Configs{Tasks: map[string]Task{
+		"api":     {WorkdirRoot: "api", Steps: []Step{step}},
+		"missing": {WorkdirRoot: "web", Steps: []Step{getSampleStep()}},
+	}}
+
+	errs := configs.Validate()
+
+	expected := "task 'missing': `workdir_root` 'web' is not a directory"
+	if len(errs) != 1 || errs[0].Error() != expected {
+		t.Fatalf("expected error: %s, got: %s", expected, errs)
+	}
+}
+
+func TestTaskMountsProject(t *testing.T) {
+	yes, no := true, false
+	for _, tc := range []struct {
+		task, step *bool
+		expected   bool
+	}{
+		{expected: true},
+		{task: &no, expected: false},
+		{task: &no, step: &yes, expected: true},
+		{task: &yes, step: &no, expected: false},
+	} {
+		task := Task{MountProject: tc.task}
+
+		if mounts := task.MountsProject(Step{MountProject: tc.step}); mounts != tc.expected {
+			t.Errorf("expected project to be mounted: %t with mount_project %v of task and %v of step, got: %t", tc.expected, tc.task, tc.step, mounts)
+		}
+	}
+}
+
+func TestConfigs_Warnings(t *testing.T) {
+	no := false
+	lint := Step{Name: "lint", Image: "hadolint/hadolint", Command: []string{"hadolint", "/dunner/Dockerfile"}}
+	scan := Step{Name: "scan", Image: "trivy", Commands: [][]string{{"trivy", "fs", "/src"}}}
+	test := Step{Name: "test", Image: "golang", Command: []string{"go", "test", "/dunner/..."}, MountProject: &no}
+	configs := &Configs{Tasks: map[string]Task{
+		"lint": {MountProject: &no, Steps: []Step{lint, scan}},
+		"test": {ProjectDir: "/go/src/app", Steps: []Step{test}},
+	}}
+
+	warnings := configs.Warnings()
+
+	expected := []string{"task 'lint': step 'lint' does not mount the project directory but its commands refer to /dunner"}
+	if !reflect.DeepEqual(warnings, expected) {
+		t.Fatalf("expected warnings: %q, got: %q", expected, warnings)
+	}
+}
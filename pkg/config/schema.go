@@ -0,0 +1,120 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// schemaDraft is the version of JSON schema the schema of the task file is written in
+const schemaDraft = "http://json-schema.org/draft-07/schema#"
+
+// jsonSchema is the subset of JSON schema needed to describe the task file
+type jsonSchema struct {
+	Schema               string                 `json:"$schema,omitempty"`
+	Title                string                 `json:"title,omitempty"`
+	Ref                  string                 `json:"$ref,omitempty"`
+	Type                 string                 `json:"type,omitempty"`
+	Properties           map[string]*jsonSchema `json:"properties,omitempty"`
+	Required             []string               `json:"required,omitempty"`
+	AdditionalProperties interface{}            `json:"additionalProperties,omitempty"`
+	Items                *jsonSchema            `json:"items,omitempty"`
+	OneOf                []*jsonSchema          `json:"oneOf,omitempty"`
+	Minimum              *float64               `json:"minimum,omitempty"`
+	Definitions          map[string]*jsonSchema `json:"definitions,omitempty"`
+}
+
+// Schema returns the JSON schema of the task file, for editors to complete and validate task files. It is generated
+// from the types of the task file so that it follows them. Fields are checked for their types only, see Validate for
+// the validation of their values.
+func Schema() ([]byte, error) {
+	definitions := make(map[string]*jsonSchema)
+	root := structSchema(reflect.TypeOf(Configs{}), definitions)
+	root.Schema = schemaDraft
+	root.Title = "Dunner task file"
+	root.Definitions = definitions
+	return json.MarshalIndent(root, "", "  ")
+}
+
+// typeSchema returns the schema of values of type t, struct types are added to definitions and referred
+func typeSchema(t reflect.Type, definitions map[string]*jsonSchema) *jsonSchema {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return typeSchema(t.Elem(), definitions)
+	case reflect.String:
+		return &jsonSchema{Type: "string"}
+	case reflect.Bool:
+		return &jsonSchema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &jsonSchema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &jsonSchema{Type: "number"}
+	case reflect.Slice:
+		return &jsonSchema{Type: "array", Items: typeSchema(t.Elem(), definitions)}
+	case reflect.Map:
+		return &jsonSchema{Type: "object", AdditionalProperties: typeSchema(t.Elem(), definitions)}
+	case reflect.Struct:
+		if _, defined := definitions[t.Name()]; !defined {
+			// Registered before its fields, for types referring to themselves
+			definitions[t.Name()] = nil
+			definitions[t.Name()] = structSchema(t, definitions)
+		}
+		return &jsonSchema{Ref: "#/definitions/" + t.Name()}
+	}
+	return &jsonSchema{}
+}
+
+// structSchema returns the schema of the struct type t, with its fields as properties named by their yaml tags
+func structSchema(t reflect.Type, definitions map[string]*jsonSchema) *jsonSchema {
+	s := &jsonSchema{Type: "object", Properties: make(map[string]*jsonSchema), AdditionalProperties: false}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("yaml"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		property := typeSchema(field.Type, definitions)
+		for _, rule := range strings.Split(field.Tag.Get("validate"), ",") {
+			if rule == "dive" {
+				break
+			}
+			if rule == "required" {
+				s.Required = append(s.Required, name)
+			}
+			if bound := strings.TrimPrefix(strings.TrimPrefix(rule, "gte="), "min="); bound != rule && property.Type != "array" {
+				if minimum, err := strconv.ParseFloat(bound, 64); err == nil {
+					property.Minimum = &minimum
+				}
+			}
+		}
+		if t == reflect.TypeOf(Step{}) {
+			// Commands may refer to aliases instead, see resolveAliases
+			switch name {
+			case "command":
+				property = aliasableCommand(property)
+			case "commands":
+				property.Items = aliasableCommand(property.Items)
+			}
+		}
+		s.Properties[name] = property
+	}
+	if t == reflect.TypeOf(Configs{}) || t == reflect.TypeOf(Task{}) || t == reflect.TypeOf(Step{}) {
+		// Environment variables scoped to an operating system, see mergeOSEnvs
+		for _, osName := range knownOSes {
+			s.Properties[osEnvsPrefix+osName] = s.Properties["envs"]
+		}
+	}
+	return s
+}
+
+// aliasableCommand returns the schema of a command given either as is or as a reference like `{alias: build}`
+func aliasableCommand(command *jsonSchema) *jsonSchema {
+	alias := &jsonSchema{
+		Type:                 "object",
+		Properties:           map[string]*jsonSchema{"alias": {Type: "string"}},
+		Required:             []string{"alias"},
+		AdditionalProperties: false,
+	}
+	return &jsonSchema{OneOf: []*jsonSchema{command, alias}}
+}
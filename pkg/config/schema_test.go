@@ -0,0 +1,40 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestSchema(t *testing.T) {
+	contents, err := Schema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var schema jsonSchema
+	if err := json.Unmarshal(contents, &schema); err != nil {
+		t.Fatalf("expected schema to be JSON, got: %s", err)
+	}
+
+	if schema.Schema != schemaDraft || schema.Properties["tasks"].AdditionalProperties.(map[string]interface{})["$ref"] != "#/definitions/Task" {
+		t.Fatalf("expected schema of tasks by name, got: %s", contents)
+	}
+	for _, name := range []string{"Task", "Step", "Build", "Service", "Profile"} {
+		if schema.Definitions[name] == nil {
+			t.Errorf("expected definition of %s, got: %v", name, schema.Definitions)
+		}
+	}
+	step := schema.Definitions["Step"]
+	if field, _ := reflect.TypeOf(Step{}).FieldByName("ExtraHosts"); step.Properties[field.Tag.Get("yaml")] == nil {
+		t.Errorf("expected properties of step named as in task file, got: %v", step.Properties)
+	}
+	if step.Properties["cpus"].Type != "number" || step.Properties["cpus"].Minimum == nil || *step.Properties["cpus"].Minimum != 0 {
+		t.Errorf("expected cpus to be a positive number, got: %+v", step.Properties["cpus"])
+	}
+	if len(step.Properties["command"].OneOf) != 2 || len(step.Properties["commands"].Items.OneOf) != 2 {
+		t.Errorf("expected commands to be given as is or as aliases, got: %+v", step.Properties["command"])
+	}
+	if required := schema.Definitions["Service"].Required; !reflect.DeepEqual(required, []string{"image"}) {
+		t.Errorf("expected image of services to be required, got: %v", required)
+	}
+}
@@ -0,0 +1,240 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// SecretResolver fetches the value of a secret referred by an environment variable value like
+// `<scheme>://<reference>`, for example `vault://secret/data/app#password`
+type SecretResolver interface {
+	// Scheme is the scheme of the references resolved, like `vault`
+	Scheme() string
+	// Resolve returns the value of the secret referred by `ref`, the reference without its scheme
+	Resolve(ref string) (string, error)
+}
+
+// secretResolvers are the registered resolvers by scheme, builtinSecretSchemes are always enabled while the others
+// are enabled with the `Secret-backends` setting
+var (
+	secretResolvers      = make(map[string]SecretResolver)
+	builtinSecretSchemes = []string{"env", "dotenv"}
+)
+
+func init() {
+	RegisterSecretResolver(envResolver{})
+	RegisterSecretResolver(dotEnvResolver{})
+	RegisterSecretResolver(&vaultResolver{client: &http.Client{Timeout: 30 * time.Second}})
+	RegisterSecretResolver(awsResolver{})
+}
+
+// RegisterSecretResolver registers a resolver of secrets, replacing the resolver of the same scheme if any. Resolvers
+// other than the built-in `env` and `dotenv` ones are used only when enabled with the `Secret-backends` setting.
+func RegisterSecretResolver(resolver SecretResolver) {
+	secretResolvers[resolver.Scheme()] = resolver
+}
+
+// SecretBackends returns the schemes of the registered resolvers that can be enabled, in sorted order
+func SecretBackends() []string {
+	var schemes []string
+	for scheme := range secretResolvers {
+		if !isBuiltinSecretScheme(scheme) {
+			schemes = append(schemes, scheme)
+		}
+	}
+	sort.Strings(schemes)
+	return schemes
+}
+
+func isBuiltinSecretScheme(scheme string) bool {
+	for _, builtin := range builtinSecretSchemes {
+		if scheme == builtin {
+			return true
+		}
+	}
+	return false
+}
+
+func isSecretBackendEnabled(scheme string) bool {
+	if isBuiltinSecretScheme(scheme) {
+		return true
+	}
+	for _, backend := range viper.GetStringSlice("Secret-backends") {
+		if backend == scheme {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveSecret resolves the value if it refers to a secret with the scheme of a registered resolver, it reports
+// whether it did. Values with other schemes, like URLs, are left as they are.
+func resolveSecret(value string) (string, bool, error) {
+	i := strings.Index(value, "://")
+	if i <= 0 {
+		return value, false, nil
+	}
+	scheme, ref := value[:i], value[i+3:]
+	resolver, ok := secretResolvers[scheme]
+	if !ok {
+		return value, false, nil
+	}
+	if !isSecretBackendEnabled(scheme) {
+		return "", true, fmt.Errorf(
+			"config: secret backend '%s' is not enabled to resolve '%s', enable it with `--secret-backend %s`",
+			scheme,
+			value,
+			scheme,
+		)
+	}
+	secret, err := resolver.Resolve(ref)
+	if err != nil {
+		return "", true, fmt.Errorf("config: failed to resolve secret '%s': %s", value, err.Error())
+	}
+	return secret, true, nil
+}
+
+// splitSecretField splits a reference like `path#field` into the path and the field, which is empty if not given
+func splitSecretField(ref string) (string, string) {
+	if i := strings.LastIndex(ref, "#"); i >= 0 {
+		return ref[:i], ref[i+1:]
+	}
+	return ref, ""
+}
+
+// envResolver resolves `env://NAME` to the value of the environment variable of the host
+type envResolver struct{}
+
+func (envResolver) Scheme() string { return "env" }
+
+func (envResolver) Resolve(ref string) (string, error) {
+	val, isSet := os.LookupEnv(ref)
+	if !isSet {
+		return "", fmt.Errorf("environment variable '%s' is not set", ref)
+	}
+	return val, nil
+}
+
+// dotEnvResolver resolves `dotenv://NAME` to the value of the variable in the environment files
+type dotEnvResolver struct{}
+
+func (dotEnvResolver) Scheme() string { return "dotenv" }
+
+func (dotEnvResolver) Resolve(ref string) (string, error) {
+	val, isSet := dotEnv[ref]
+	if !isSet {
+		return "", fmt.Errorf(
+			"variable '%s' is not defined in %s file",
+			ref,
+			strings.Join(viper.GetStringSlice("DotenvFile"), ", "),
+		)
+	}
+	return val, nil
+}
+
+// vaultResolver resolves `vault://<path>#<field>` to the field of the secret read from the HTTP API of Vault at
+// `/v1/<path>`, using the `VAULT_ADDR` and `VAULT_TOKEN` variables. Secrets of KV version 2 engines are read from
+// their `data` path, like `vault://secret/data/app#password`.
+type vaultResolver struct {
+	client *http.Client
+}
+
+func (*vaultResolver) Scheme() string { return "vault" }
+
+func (r *vaultResolver) Resolve(ref string) (string, error) {
+	path, field := splitSecretField(ref)
+	if field == "" {
+		return "", fmt.Errorf("field of the secret is not given, as in `vault://%s#<field>`", path)
+	}
+	_, addr, found := lookupEnv("VAULT_ADDR")
+	if !found {
+		return "", fmt.Errorf("VAULT_ADDR is not set")
+	}
+	_, token, _ := lookupEnv("VAULT_TOKEN")
+
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(addr, "/")+"/v1/"+strings.TrimPrefix(path, "/"), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("vault responded with status %s", resp.Status)
+	}
+
+	var secret struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&secret); err != nil {
+		return "", fmt.Errorf("invalid response from vault: %s", err.Error())
+	}
+	data := secret.Data
+	// KV version 2 nests the secret in `data`, along with its `metadata`
+	if nested, ok := data["data"].(map[string]interface{}); ok {
+		if _, hasMetadata := data["metadata"]; hasMetadata {
+			data = nested
+		}
+	}
+	return secretField(data, field)
+}
+
+// runAWS runs the AWS CLI with the arguments and returns its output, it is replaced in tests
+var runAWS = func(args ...string) ([]byte, error) {
+	out, err := exec.Command("aws", args...).Output()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return nil, fmt.Errorf("%s: %s", err.Error(), strings.TrimSpace(string(exitErr.Stderr)))
+	}
+	return out, err
+}
+
+// awsResolver resolves `aws://<secret-id>[#<field>]` to the value of the secret from AWS Secrets Manager, or its
+// field if the value is a JSON object. It runs the AWS CLI, which uses the credentials and region configured on the
+// host.
+type awsResolver struct{}
+
+func (awsResolver) Scheme() string { return "aws" }
+
+func (awsResolver) Resolve(ref string) (string, error) {
+	id, field := splitSecretField(ref)
+	out, err := runAWS("secretsmanager", "get-secret-value", "--secret-id", id, "--query", "SecretString", "--output", "text")
+	if err != nil {
+		return "", err
+	}
+	value := strings.TrimSuffix(string(out), "\n")
+	if field == "" {
+		return value, nil
+	}
+	var data map[string]interface{}
+	if err := json.Unmarshal([]byte(value), &data); err != nil {
+		return "", fmt.Errorf("secret '%s' is not a JSON object to get field '%s' from", id, field)
+	}
+	return secretField(data, field)
+}
+
+// secretField returns the field of the secret as a string
+func secretField(data map[string]interface{}, field string) (string, error) {
+	val, ok := data[field]
+	if !ok {
+		return "", fmt.Errorf("field '%s' not found in secret", field)
+	}
+	if s, ok := val.(string); ok {
+		return s, nil
+	}
+	b, err := json.Marshal(val)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
@@ -0,0 +1,163 @@
+package config
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+type fakeResolver struct{}
+
+func (fakeResolver) Scheme() string { return "fake" }
+
+func (fakeResolver) Resolve(ref string) (string, error) {
+	if ref == "missing" {
+		return "", fmt.Errorf("not found")
+	}
+	return "secret-" + ref, nil
+}
+
+func withSecretBackends(backends ...string) func() {
+	RegisterSecretResolver(fakeResolver{})
+	viper.Set("Secret-backends", backends)
+	return func() {
+		delete(secretResolvers, "fake")
+		viper.Set("Secret-backends", nil)
+	}
+}
+
+func TestObtainEnvResolvesSecret(t *testing.T) {
+	defer withSecretBackends("fake")()
+
+	env, err := obtainEnv("PASSWORD=fake://app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if env != "PASSWORD=secret-app" {
+		t.Errorf("expected secret to be resolved, got: %s", env)
+	}
+
+	if _, err := obtainEnv("PASSWORD=fake://missing"); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("expected error of resolver, got: %v", err)
+	}
+}
+
+func TestObtainEnvRequiresSecretBackendEnabled(t *testing.T) {
+	defer withSecretBackends()()
+
+	_, err := obtainEnv("PASSWORD=fake://app")
+
+	expected := "config: secret backend 'fake' is not enabled to resolve 'fake://app', enable it with `--secret-backend fake`"
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected error: %s, got: %v", expected, err)
+	}
+}
+
+func TestObtainEnvKeepsValuesOfOtherSchemes(t *testing.T) {
+	env, err := obtainEnv("URL=https://example.com#top")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if env != "URL=https://example.com#top" {
+		t.Errorf("expected value to be kept, got: %s", env)
+	}
+}
+
+func TestBuiltinSecretResolvers(t *testing.T) {
+	os.Setenv("DUNNER_SECRET_TEST", "from-host")
+	defer os.Unsetenv("DUNNER_SECRET_TEST")
+	defer loadDotEnv(nil)
+	dotEnv = map[string]string{"DUNNER_SECRET_TEST": "from-dotenv"}
+
+	tests := map[string]string{
+		"env://DUNNER_SECRET_TEST":    "from-host",
+		"dotenv://DUNNER_SECRET_TEST": "from-dotenv",
+	}
+	for value, expected := range tests {
+		secret, _, err := resolveSecret(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if secret != expected {
+			t.Errorf("%s: expected: %s, got: %s", value, expected, secret)
+		}
+	}
+
+	if _, _, err := resolveSecret("dotenv://DUNNER_UNDEFINED"); err == nil {
+		t.Errorf("expected error for undefined variable")
+	}
+}
+
+func TestVaultResolver(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/secret/data/app":
+			fmt.Fprint(w, `{"data": {"data": {"password": "kv2"}, "metadata": {"version": 1}}}`)
+		case "/v1/kv/app":
+			fmt.Fprint(w, `{"data": {"password": "kv1", "port": 5432}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	os.Setenv("VAULT_ADDR", server.URL)
+	os.Setenv("VAULT_TOKEN", "token")
+	defer os.Unsetenv("VAULT_ADDR")
+	defer os.Unsetenv("VAULT_TOKEN")
+	resolver := &vaultResolver{client: server.Client()}
+
+	tests := map[string]string{
+		"secret/data/app#password": "kv2",
+		"kv/app#password":          "kv1",
+		"kv/app#port":              "5432",
+	}
+	for ref, expected := range tests {
+		secret, err := resolver.Resolve(ref)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if secret != expected {
+			t.Errorf("%s: expected: %s, got: %s", ref, expected, secret)
+		}
+	}
+
+	for _, ref := range []string{"kv/app", "kv/app#user", "kv/missing#password"} {
+		if _, err := resolver.Resolve(ref); err == nil {
+			t.Errorf("%s: expected error", ref)
+		}
+	}
+}
+
+func TestAWSResolver(t *testing.T) {
+	defer func(run func(...string) ([]byte, error)) { runAWS = run }(runAWS)
+	var secretID string
+	runAWS = func(args ...string) ([]byte, error) {
+		secretID = args[3]
+		return []byte(`{"password": "aws"}` + "\n"), nil
+	}
+
+	secret, err := awsResolver{}.Resolve("prod/app#password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secretID != "prod/app" || secret != "aws" {
+		t.Errorf("expected field of secret 'prod/app', got: %s from %s", secret, secretID)
+	}
+
+	secret, err = awsResolver{}.Resolve("prod/app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secret != `{"password": "aws"}` {
+		t.Errorf("expected whole secret, got: %s", secret)
+	}
+}
@@ -2,26 +2,64 @@ package config
 
 // Step defines a single step for a task
 type Step struct {
-	// Name given as string to identify the task
+	// Name given as string to identify the step, unique within a task. Defaults to `step-<n>` for the nth step
 	Name string `yaml:"name"`
 
+	// Index is the position of the step in its task, from 1, set when the task file is loaded. It is kept when only
+	// some steps of the task are run, like with `--only`
+	Index int `yaml:"-"`
+
 	// Image is the repo name on which Docker containers are built
-	Image string `yaml:"image" validate:"required_without=Follow"`
+	Image string `yaml:"image" validate:"required_without_all=Follow Local Build Images"`
+
+	// Images runs the step once on each of the images instead of `image`, like `[node:16, node:18]` to test on
+	// several versions. All the images are run even if some fail, the step failing if any of them does
+	Images []string `yaml:"images" validate:"omitempty,dive,required"`
+
+	// Local runs the command(s) directly on the host instead of a container, for lightweight steps like `echo`.
+	// It cannot be set along with `image`
+	Local bool `yaml:"local"`
 
-	// Dir is the primary directory on which task is to be run
+	// Dir is the primary directory on which task is to be run. Relative directories are relative to the project
+	// directory mounted on the container
 	Dir string `yaml:"dir"`
 
+	// Create the directory given in `dir` before the container starts, if it does not exist
+	CreateDir bool `yaml:"create_dir"`
+
+	// MountProject mounts the project directory on the container, which is the default. If false, `dir` must be
+	// absolute and commands run in the working directory of the image if `dir` is not given
+	MountProject *bool `yaml:"mount_project"`
+
+	// Caches mounts named volumes kept across runs on paths of the container, by cache key, like `npm: /root/.npm`
+	// for package manager caches. The volume of a key is shared by the steps of all tasks of the project, and is
+	// removed by `dunner clean`
+	Caches map[string]string `yaml:"caches" validate:"dive,keys,cachekey,endkeys,cachepath"`
+
+	// Entrypoint overrides the entrypoint of the image, an empty list `[]` clears it. Commands are run using
+	// `docker exec` which bypasses the entrypoint, so it only wraps the command keeping the container running
+	// and must run its arguments, like `["tini", "--"]`
+	Entrypoint []string `yaml:"entrypoint"`
+
 	// The command which runs on the container and exits
-	Command []string `yaml:"command" validate:"omitempty,dive,required"`
+	Command Command `yaml:"command" validate:"omitempty,dive,required"`
 
 	// The list of commands that are to be run in sequence
-	Commands [][]string `yaml:"commands" validate:"omitempty,dive,omitempty,dive,required"`
+	Commands Commands `yaml:"commands" validate:"omitempty,dive,omitempty,dive,required"`
 
 	// The list of environment variables to be exported inside the container
 	Envs []string `yaml:"envs"`
 
+	// Names of host environment variables passed to the container with their values, like `AWS_*`. A variable not
+	// set on the host is skipped, unless its name is followed by `!`. Variables of `envs` win over passed ones
+	PassEnv []string `yaml:"pass_env" validate:"omitempty,dive,passenv"`
+
+	// InheritEnv passes all the environment variables of the host to the container, except those specific to the
+	// host like `PATH` or `HOME`, unless named in `pass_env`. Variables of `envs` win over inherited ones
+	InheritEnv bool `yaml:"inherit_env"`
+
 	// The directories to be mounted on the container as bind volumes
-	Mounts []string `yaml:"mounts" validate:"omitempty,dive,min=1,mountdir,parsedir"`
+	Mounts []string `yaml:"mounts" validate:"omitempty,dive,min=1,mounttarget,mountdir,parsedir"`
 
 	// The next task that must be executed if this does go successfully
 	Follow string `yaml:"follow" validate:"omitempty,follow_exist"`
@@ -29,21 +67,187 @@ type Step struct {
 	// The list of arguments that are to be passed
 	Args []string `yaml:"args"`
 
-	// User that will run the command(s) inside the container, also support user:group
+	// User that will run the command(s) inside the container as `name`, `uid` or `uid:gid`. Defaults to the user of
+	// the task, or the global user. The value `host` runs as the user and group of the host user, it is ignored with
+	// a warning on Windows
 	User string `yaml:"user"`
+
+	// Run the command(s) as the user and group of the host user, so that files created on mounts are owned by them.
+	// Ignored if `user` is set, and on platforms without user IDs
+	RunAsHostUser bool `yaml:"run_as_host_user"`
+
+	// Continue with the task even if a command of this step exits with a non-zero code
+	AllowFailure bool `yaml:"allow_failure"`
+
+	// Number of times the step is run again if it fails, each time on a new container
+	Retries int `yaml:"retries" validate:"min=0"`
+
+	// Time to wait before running a failed step again, like `5s`
+	RetryDelay string `yaml:"retry_delay" validate:"omitempty,duration"`
+
+	// Time given to the container to stop gracefully before it is killed when Dunner is interrupted, like `30s`.
+	// Defaults to the `--stop-timeout` of the run, 10s unless set. Once its commands end, the container is removed
+	// at once
+	StopTimeout string `yaml:"stop_timeout" validate:"omitempty,duration"`
+
+	// Always pull the image, even if it is present on the host. Useful for mutable tags like `latest`
+	ForcePull bool `yaml:"force_pull"`
+
+	// Memory limit of the container, with a size suffix like `512m` or `2g`
+	Memory string `yaml:"memory" validate:"omitempty,memory"`
+
+	// Number of CPUs the container can use, like `1.5`
+	CPUs float64 `yaml:"cpus" validate:"gte=0"`
+
+	// GPUs of the host the container can use, like `--gpus` of `docker run`: `all`, a number of GPUs, or given GPUs
+	// as `device=<id>[,<id>...]`. It needs the NVIDIA container toolkit on the host
+	GPUs string `yaml:"gpus" validate:"omitempty,gpus"`
+
+	// Ports of the container published on the host, as `<host_port>:<container_port>[/<protocol>]`
+	Ports []string `yaml:"ports" validate:"omitempty,dive,port"`
+
+	// Network of the container, `host`, `none`, `bridge` or the name of an existing Docker network
+	Network string `yaml:"network" validate:"omitempty,network"`
+
+	// ExtraHosts are added to `/etc/hosts` of the container, as `<name>:<ip>`. The IP `host-gateway` stands for the
+	// IP of the host, to reach services running on it
+	ExtraHosts []string `yaml:"extra_hosts" validate:"omitempty,dive,extrahost"`
+
+	// Platform of the image in the form `os/arch[/variant]`, defaults to the platform of the Docker host
+	Platform string `yaml:"platform" validate:"omitempty,platform"`
+
+	// OutputFile is the file, relative to the project directory, the output of the commands is saved to. It is
+	// overwritten on every run, and its parent directories are created if they do not exist
+	OutputFile string `yaml:"output_file"`
+
+	// MountDockerSock lets the commands use the Docker daemon Dunner uses, to build or push images. Its socket is
+	// mounted on the container, `DOCKER_HOST` is set to it unless set by `envs`, and a non-root `user` is added to
+	// the group owning the socket. It cannot be used with a daemon reached over the network. Note that this gives
+	// the container full control of the Docker daemon of the host
+	MountDockerSock bool `yaml:"mount_docker_sock"`
+
+	// DockerAccess is another name of `mount_docker_sock`, which it sets
+	DockerAccess bool `yaml:"docker_access"`
+
+	// Privileged runs the container in privileged mode, and CapAdd and CapDrop add and drop Linux capabilities of the
+	// container. Privileged mode and added capabilities are honored only if the `AllowPrivileged` setting is enabled
+	Privileged bool     `yaml:"privileged"`
+	CapAdd     []string `yaml:"cap_add" validate:"omitempty,dive,capability"`
+	CapDrop    []string `yaml:"cap_drop" validate:"omitempty,dive,capability"`
+
+	// ContainerPerCommand runs each command on a new container, with the command as the command of the container.
+	// By default all the commands run on one container, which needs the image to have `tail` to keep it running
+	ContainerPerCommand bool `yaml:"container_per_command"`
+
+	// Interactive attaches the standard input of the host to the commands on a terminal, for commands prompting the
+	// user. It needs Dunner to be run from a terminal, and cannot be used in asynchronous mode
+	Interactive bool `yaml:"interactive"`
+
+	// Parallel runs the step concurrently with the consecutive steps of the task also marked `parallel`, the next step
+	// not marked runs once all of them end. If one of them fails, the others are cancelled
+	Parallel bool `yaml:"parallel"`
+
+	// TTY runs the commands on a terminal, so that tools display colors and progress. If not set, a terminal is used
+	// when the output of Dunner is a terminal, except in asynchronous mode or when running tasks in parallel
+	TTY *bool `yaml:"tty"`
+
+	// Build builds the image of the step from a Dockerfile, instead of pulling `image`
+	Build *Build `yaml:"build"`
+
+	aliasRefs aliasRefs           // Aliases referred by the commands, until they are resolved
+	osEnvs    map[string][]string // Environment variables scoped to an operating system, until they are merged
+}
+
+// Build describes an image built from a Dockerfile. The image is built again only if the build context, the
+// Dockerfile or the build arguments change.
+type Build struct {
+	// Context is the directory sent as build context, relative to the project directory
+	Context string `yaml:"context" validate:"required"`
+	// Dockerfile is the path of the Dockerfile relative to the context, defaults to `Dockerfile`
+	Dockerfile string            `yaml:"dockerfile"`
+	Args       map[string]string `yaml:"args"`
 }
 
 // Task describes a single task composed of multiple steps to be run in a docker container
 type Task struct {
 	Envs   []string `yaml:"envs"`   // Environment variables common to all steps
 	Mounts []string `yaml:"mounts"` // Directory mounts common to all steps
+	User   string   `yaml:"user"`   // User running the commands of all steps, unless set by the step
 	Steps  []Step   `yaml:"steps"`
+	// PassEnv are names of host environment variables passed to all steps, like `pass_env` of steps
+	PassEnv []string `yaml:"pass_env" validate:"omitempty,dive,passenv"`
+	// InheritEnv passes all the environment variables of the host to all steps, like `inherit_env` of steps
+	InheritEnv bool `yaml:"inherit_env"`
+	// MountProject is the default `mount_project` of the steps, which mount the project directory unless false
+	MountProject *bool `yaml:"mount_project"`
+	// ProjectDir is the directory of the containers of the steps the project directory is mounted on, overriding the
+	// global `project_dir`. Relative `dir` of steps are relative to it
+	ProjectDir string `yaml:"project_dir" validate:"omitempty,projectdir"`
+	// WorkdirRoot is the directory mounted as project directory on the containers of the steps instead of the
+	// project root, the directory of the task file unless given with `--context`. Relative to the project root
+	WorkdirRoot string `yaml:"workdir_root"`
+	// Inputs are glob patterns of the files the task depends on, relative to the project directory. A pattern
+	// matching a directory matches all files in it
+	Inputs []string `yaml:"inputs"`
+	// Services are containers started before the steps and running alongside them, like databases used by tests.
+	// The steps reach a service with its name as hostname.
+	Services map[string]Service `yaml:"services"`
+	// SharedContainer runs the commands of all steps in one container, started by the first step and kept until the
+	// task ends, so that the steps share its filesystem and environment. The steps must use the same image.
+	SharedContainer bool `yaml:"shared_container"`
+
+	osEnvs map[string][]string // Environment variables scoped to an operating system, until they are merged
+}
+
+// Service describes a container running alongside the steps of a task, until the task ends
+type Service struct {
+	Image string   `yaml:"image" validate:"required"`
+	Envs  []string `yaml:"envs"`
+	// Ports of the service published on the host, as `<host_port>:<container_port>[/<protocol>]`
+	Ports []string `yaml:"ports" validate:"omitempty,dive,port"`
+	// Healthcheck is a command run on the service until it succeeds, before the steps start. The steps do not
+	// wait for the service if it is not given
+	Healthcheck []string `yaml:"healthcheck"`
+	// HealthTimeout is how long to wait for the healthcheck to succeed, defaults to 1m
+	HealthTimeout string `yaml:"health_timeout" validate:"omitempty,duration"`
+	// StopTimeout is the time given to the service to stop gracefully once the task ends, like `stop_timeout` of
+	// steps. Databases may need it to flush their data
+	StopTimeout string `yaml:"stop_timeout" validate:"omitempty,duration"`
 }
 
 // Configs describes the parsed information from the dunner file.
 // It is a map of task name as keys and the list of tasks associated with it.
 type Configs struct {
-	Envs   []string        `yaml:"envs"`   // Environment variables common to all tasks
-	Mounts []string        `yaml:"mounts"` // Directory mounts common to all tasks
-	Tasks  map[string]Task `yaml:"tasks" validate:"dive,keys,required,endkeys,required,min=1,required"`
+	Envs   []string `yaml:"envs"`   // Environment variables common to all tasks
+	Mounts []string `yaml:"mounts"` // Directory mounts common to all tasks
+	User   string   `yaml:"user"`   // User running the commands of all tasks, unless set by the task or step
+	// ProjectDir is the absolute path of the directory of the containers the project directory is mounted on, which
+	// is the default working directory of the steps. Defaults to `/dunner`
+	ProjectDir string `yaml:"project_dir" validate:"omitempty,projectdir"`
+	// LockedDigests pins images, as given in the steps, to their digest. Steps fail if their image does not match
+	LockedDigests map[string]string `yaml:"locked_digests" validate:"dive,keys,required,endkeys,digest"`
+	// ExtraHosts are added to `/etc/hosts` of the containers of all steps, like `extra_hosts` of steps. A step
+	// can add its own, which override those of the same name
+	ExtraHosts []string `yaml:"extra_hosts" validate:"omitempty,dive,extrahost"`
+	// Aliases are commands defined once and referred by steps as `command: {alias: <name>}`, or as an item
+	// `{alias: <name>}` of `commands`. References are replaced by the commands when the task file is loaded, once
+	// the files it includes are merged, so that steps can refer to the aliases of any of them
+	Aliases map[string][]string `yaml:"aliases" validate:"dive,keys,required,endkeys,min=1,dive,required"`
+	Tasks   map[string]Task     `yaml:"tasks" validate:"dive,keys,required,endkeys,required,min=1,required"`
+	// Profiles are named sets of overrides, one of which can be selected with `--profile`
+	Profiles map[string]Profile `yaml:"profiles" validate:"dive,keys,required,endkeys"`
+	// Include are task files merged into this one when it is loaded, relative to it, like a base file shared by
+	// projects. Their tasks are added, and the settings of this file override theirs
+	Include []string `yaml:"include"`
+
+	osEnvs map[string][]string // Environment variables scoped to an operating system, until they are merged
+}
+
+// Profile describes overrides of the task file applied when the profile is selected, like for `dev` and `prod`
+type Profile struct {
+	// Envs override the environment variables common to all tasks with the same name, or are added to them. They are
+	// merged before environment variables are replaced with their values. Tasks and steps can still override them
+	Envs []string `yaml:"envs"`
+	// ForcePull always pulls the images of all steps, even if they are present on the host
+	ForcePull bool `yaml:"force_pull"`
 }
@@ -0,0 +1,71 @@
+package docker
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/client"
+)
+
+// SocketSource returns the path on the host of the socket of the Docker daemon Dunner uses, to be mounted at Socket
+// on containers. It is the socket of `DOCKER_HOST` if it is a unix socket, except on macOS and Windows where the
+// daemon runs in a virtual machine exposing its socket at Socket. It fails for daemons reached over the network,
+// whose socket cannot be mounted.
+func SocketSource() (string, error) {
+	host := os.Getenv("DOCKER_HOST")
+	if host == "" {
+		host = client.DefaultDockerHost
+	}
+	switch {
+	case strings.HasPrefix(host, "unix://"):
+		if runtime.GOOS == "linux" {
+			return strings.TrimPrefix(host, "unix://"), nil
+		}
+		return Socket, nil
+	case strings.HasPrefix(host, "npipe://"):
+		return Socket, nil
+	default:
+		return "", fmt.Errorf("the Docker daemon at %s is remote, its socket cannot be mounted on the container", host)
+	}
+}
+
+// dockerAccess returns the mount of the socket of the Docker daemon on the container of a step with
+// MountDockerSock, see SocketSource, along with the group its user needs to use the socket, if any.
+func (step Step) dockerAccess() (mount.Mount, string, error) {
+	source, err := SocketSource()
+	if err != nil {
+		return mount.Mount{}, "", fmt.Errorf("docker: step '%s' of '%s' task has `mount_docker_sock` but %s", step.Name, step.Task, err.Error())
+	}
+	socket := mount.Mount{Type: mount.TypeBind, Source: source, Target: Socket}
+
+	// The socket is owned by the group allowed to use the daemon, only known on Linux hosts running the daemon
+	if runtime.GOOS != "linux" || isRootUser(step.User) {
+		return socket, "", nil
+	}
+	group, err := socketGroup(source)
+	if err != nil {
+		return mount.Mount{}, "", fmt.Errorf("docker: socket %s of the Docker daemon for `mount_docker_sock` of step "+
+			"'%s' of '%s' task is not found: %s", source, step.Name, step.Task, err.Error())
+	}
+	return socket, group, nil
+}
+
+// dockerAccessEnv returns the environment of the container with `DOCKER_HOST` set to the mounted socket, unless the
+// step sets it
+func dockerAccessEnv(env []string) []string {
+	for _, e := range env {
+		if strings.HasPrefix(e, "DOCKER_HOST=") {
+			return env
+		}
+	}
+	return append(env, "DOCKER_HOST=unix://"+Socket)
+}
+
+// isRootUser returns true if user, as `name`, `uid` or `uid:gid`, is root or the default user of the image
+func isRootUser(user string) bool {
+	name := strings.SplitN(user, ":", 2)[0]
+	return name == "" || name == "root" || name == "0"
+}
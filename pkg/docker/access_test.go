@@ -0,0 +1,63 @@
+package docker
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strconv"
+	"testing"
+
+	"github.com/docker/docker/api/types/mount"
+)
+
+func TestStepDockerAccess(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("the socket of DOCKER_HOST is mounted on Linux only")
+	}
+	dir, err := ioutil.TempDir("", "dunner-access")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "docker.sock")
+	if err := ioutil.WriteFile(socket, nil, 0660); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Setenv("DOCKER_HOST", os.Getenv("DOCKER_HOST"))
+	os.Setenv("DOCKER_HOST", "unix://"+socket)
+
+	for user, expectedGroup := range map[string]string{"": "", "root": "", "0:0": "", "1000:1000": strconv.Itoa(os.Getgid())} {
+		m, group, err := Step{User: user}.dockerAccess()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := mount.Mount{Type: mount.TypeBind, Source: socket, Target: Socket}
+		if !reflect.DeepEqual(m, expected) || group != expectedGroup {
+			t.Errorf("expected mount %v with group '%s' for user '%s', got: %v with group '%s'", expected, expectedGroup, user, m, group)
+		}
+	}
+}
+
+func TestStepDockerAccessWithRemoteDaemon(t *testing.T) {
+	defer os.Setenv("DOCKER_HOST", os.Getenv("DOCKER_HOST"))
+	os.Setenv("DOCKER_HOST", "tcp://docker.example.com:2376")
+
+	_, _, err := Step{Task: "release", Name: "push"}.dockerAccess()
+
+	expectedErr := "docker: step 'push' of 'release' task has `mount_docker_sock` but the Docker daemon at tcp://docker.example.com:2376 is remote, its socket cannot be mounted on the container"
+	if err == nil || err.Error() != expectedErr {
+		t.Fatalf("expected error: %s, got: %v", expectedErr, err)
+	}
+}
+
+func TestDockerAccessEnv(t *testing.T) {
+	if env := dockerAccessEnv([]string{"A=1"}); !reflect.DeepEqual(env, []string{"A=1", "DOCKER_HOST=unix://" + Socket}) {
+		t.Errorf("expected DOCKER_HOST to be set to the mounted socket, got: %v", env)
+	}
+	if env := dockerAccessEnv([]string{"DOCKER_HOST=tcp://dind:2375"}); !reflect.DeepEqual(env, []string{"DOCKER_HOST=tcp://dind:2375"}) {
+		t.Errorf("expected DOCKER_HOST of the step to be kept, got: %v", env)
+	}
+}
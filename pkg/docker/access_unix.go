@@ -0,0 +1,22 @@
+//go:build !windows
+// +build !windows
+
+package docker
+
+import (
+	"os"
+	"strconv"
+	"syscall"
+)
+
+// socketGroup returns the ID of the group owning the socket
+func socketGroup(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		return strconv.FormatUint(uint64(stat.Gid), 10), nil
+	}
+	return "", nil
+}
@@ -0,0 +1,154 @@
+package docker
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/distribution/reference"
+	"github.com/docker/docker/api/types"
+	"github.com/leopardslab/dunner/internal/util"
+	"github.com/spf13/viper"
+)
+
+// dockerHubRegistry is the key under which Docker Hub credentials are stored in the docker config file
+const dockerHubRegistry = "https://index.docker.io/v1/"
+
+// dockerConfigFile holds the registry credentials configured for the docker CLI, in `~/.docker/config.json`
+type dockerConfigFile struct {
+	Auths       map[string]types.AuthConfig `json:"auths"`
+	CredsStore  string                      `json:"credsStore"`
+	CredHelpers map[string]string           `json:"credHelpers"`
+}
+
+// registryOf returns the registry hosting the given image, as the key used in the docker config file
+func registryOf(image string) (string, error) {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return "", err
+	}
+	domain := reference.Domain(named)
+	if domain == "docker.io" {
+		return dockerHubRegistry, nil
+	}
+	return domain, nil
+}
+
+// getRegistryAuth returns the base64 encoded credentials to pull the given image, and the registry it belongs to.
+// Credentials are read from `DUNNER_REGISTRY_USER`/`DUNNER_REGISTRY_PASS` environment variables if set, otherwise
+// from the docker config file the same way as docker CLI does, including credential helpers.
+// An empty string is returned if no credentials are found.
+func getRegistryAuth(image string) (string, string, error) {
+	registry, err := registryOf(image)
+	if err != nil {
+		return "", "", err
+	}
+
+	authConfig, err := lookupAuthConfig(registry)
+	if err != nil || authConfig == nil {
+		return "", registry, err
+	}
+	authConfig.ServerAddress = registry
+
+	buf, err := json.Marshal(authConfig)
+	if err != nil {
+		return "", registry, err
+	}
+	return base64.URLEncoding.EncodeToString(buf), registry, nil
+}
+
+func lookupAuthConfig(registry string) (*types.AuthConfig, error) {
+	if user := viper.GetString("Registry_User"); user != "" {
+		return &types.AuthConfig{Username: user, Password: viper.GetString("Registry_Pass")}, nil
+	}
+
+	configFile, err := loadDockerConfig()
+	if err != nil || configFile == nil {
+		return nil, err
+	}
+
+	if helper, ok := configFile.CredHelpers[registry]; ok {
+		return credentialsFromHelper(helper, registry)
+	}
+	if configFile.CredsStore != "" {
+		return credentialsFromHelper(configFile.CredsStore, registry)
+	}
+
+	for key, authConfig := range configFile.Auths {
+		if key != registry && convertToHostname(key) != convertToHostname(registry) {
+			continue
+		}
+		if authConfig.Auth != "" {
+			decoded, err := base64.StdEncoding.DecodeString(authConfig.Auth)
+			if err != nil {
+				return nil, fmt.Errorf("docker: invalid credentials for registry %s in docker config: %s", registry, err.Error())
+			}
+			userPass := strings.SplitN(string(decoded), ":", 2)
+			if len(userPass) != 2 {
+				return nil, fmt.Errorf("docker: invalid credentials for registry %s in docker config", registry)
+			}
+			authConfig.Username, authConfig.Password, authConfig.Auth = userPass[0], userPass[1], ""
+		}
+		return &authConfig, nil
+	}
+	return nil, nil
+}
+
+// loadDockerConfig reads the docker config file from `DOCKER_CONFIG` directory, or `~/.docker` by default.
+// It returns nil if there is no config file.
+func loadDockerConfig() (*dockerConfigFile, error) {
+	configDir := os.Getenv("DOCKER_CONFIG")
+	if configDir == "" {
+		configDir = filepath.Join(util.HomeDir, ".docker")
+	}
+	contents, err := ioutil.ReadFile(filepath.Join(configDir, "config.json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var configFile dockerConfigFile
+	if err := json.Unmarshal(contents, &configFile); err != nil {
+		return nil, fmt.Errorf("docker: failed to parse docker config file: %s", err.Error())
+	}
+	return &configFile, nil
+}
+
+// credentialsFromHelper gets the credentials of the registry from the `docker-credential-<helper>` program
+func credentialsFromHelper(helper string, registry string) (*types.AuthConfig, error) {
+	var out bytes.Buffer
+	cmd := exec.Command("docker-credential-"+helper, "get")
+	cmd.Stdin = strings.NewReader(registry)
+	cmd.Stdout = &out
+	if err := cmd.Run(); err != nil {
+		if strings.Contains(out.String(), "credentials not found") {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("docker: failed to get credentials for registry %s from helper '%s': %s", registry, helper, err.Error())
+	}
+
+	var creds struct {
+		Username string
+		Secret   string
+	}
+	if err := json.Unmarshal(out.Bytes(), &creds); err != nil {
+		return nil, fmt.Errorf("docker: invalid credentials for registry %s from helper '%s': %s", registry, helper, err.Error())
+	}
+	if creds.Username == "<token>" {
+		return &types.AuthConfig{IdentityToken: creds.Secret}, nil
+	}
+	return &types.AuthConfig{Username: creds.Username, Password: creds.Secret}, nil
+}
+
+// convertToHostname strips the scheme and path of a registry address
+func convertToHostname(url string) string {
+	stripped := strings.TrimPrefix(strings.TrimPrefix(url, "http://"), "https://")
+	return strings.SplitN(stripped, "/", 2)[0]
+}
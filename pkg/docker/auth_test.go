@@ -0,0 +1,144 @@
+package docker
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/spf13/viper"
+)
+
+func TestRegistryOf(t *testing.T) {
+	var tests = []struct {
+		image    string
+		registry string
+	}{
+		{"busybox", dockerHubRegistry},
+		{"leopardslab/dunner:latest", dockerHubRegistry},
+		{"registry.example.com:5000/app:1.0", "registry.example.com:5000"},
+		{"gcr.io/project/image", "gcr.io"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.image, func(t *testing.T) {
+			got, err := registryOf(tt.image)
+			if err != nil {
+				t.Fatalf("expected no error, got %s", err)
+			}
+			if got != tt.registry {
+				t.Errorf("expected registry: %s, got: %s", tt.registry, got)
+			}
+		})
+	}
+}
+
+func TestGetRegistryAuthFromDockerConfig(t *testing.T) {
+	revert := setupDockerConfig(t, `{"auths": {"https://registry.example.com": {"auth": "`+
+		base64.StdEncoding.EncodeToString([]byte("foo:bar"))+`"}}}`)
+	defer revert()
+
+	encoded, registry, err := getRegistryAuth("registry.example.com/app")
+
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if registry != "registry.example.com" {
+		t.Errorf("expected registry: registry.example.com, got: %s", registry)
+	}
+	authConfig := decodeAuth(t, encoded)
+	if authConfig.Username != "foo" || authConfig.Password != "bar" {
+		t.Errorf("expected credentials foo:bar, got: %s:%s", authConfig.Username, authConfig.Password)
+	}
+}
+
+func TestGetRegistryAuthWithNoCredentials(t *testing.T) {
+	revert := setupDockerConfig(t, `{"auths": {"https://registry.example.com": {"auth": "Zm9vOmJhcg=="}}}`)
+	defer revert()
+
+	encoded, registry, err := getRegistryAuth("busybox")
+
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	if encoded != "" {
+		t.Errorf("expected no credentials, got: %s", encoded)
+	}
+	if registry != dockerHubRegistry {
+		t.Errorf("expected registry: %s, got: %s", dockerHubRegistry, registry)
+	}
+}
+
+func TestGetRegistryAuthFromCredentialHelper(t *testing.T) {
+	revert := setupDockerConfig(t, `{"credHelpers": {"registry.example.com": "dunnertest"}}`)
+	defer revert()
+	binDir, err := ioutil.TempDir("", "dunner-bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(binDir)
+	helper := "#!/bin/sh\necho '{\"Username\": \"helper\", \"Secret\": \"s3cret\"}'\n"
+	if err := ioutil.WriteFile(filepath.Join(binDir, "docker-credential-dunnertest"), []byte(helper), 0755); err != nil {
+		t.Fatal(err)
+	}
+	oldPath := os.Getenv("PATH")
+	os.Setenv("PATH", binDir+string(os.PathListSeparator)+oldPath)
+	defer os.Setenv("PATH", oldPath)
+
+	encoded, _, err := getRegistryAuth("registry.example.com/app")
+
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	authConfig := decodeAuth(t, encoded)
+	if authConfig.Username != "helper" || authConfig.Password != "s3cret" {
+		t.Errorf("expected credentials helper:s3cret, got: %s:%s", authConfig.Username, authConfig.Password)
+	}
+}
+
+func TestGetRegistryAuthFromEnv(t *testing.T) {
+	viper.Set("Registry_User", "ci")
+	viper.Set("Registry_Pass", "token")
+	defer viper.Set("Registry_User", "")
+	defer viper.Set("Registry_Pass", "")
+
+	encoded, _, err := getRegistryAuth("registry.example.com/app")
+
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+	authConfig := decodeAuth(t, encoded)
+	if authConfig.Username != "ci" || authConfig.Password != "token" {
+		t.Errorf("expected credentials ci:token, got: %s:%s", authConfig.Username, authConfig.Password)
+	}
+}
+
+func setupDockerConfig(t *testing.T, content string) func() {
+	dir, err := ioutil.TempDir("", "dunner-docker-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "config.json"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	old := os.Getenv("DOCKER_CONFIG")
+	os.Setenv("DOCKER_CONFIG", dir)
+	return func() {
+		os.Setenv("DOCKER_CONFIG", old)
+		os.RemoveAll(dir)
+	}
+}
+
+func decodeAuth(t *testing.T, encoded string) types.AuthConfig {
+	var authConfig types.AuthConfig
+	buf, err := base64.URLEncoding.DecodeString(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(buf, &authConfig); err != nil {
+		t.Fatal(err)
+	}
+	return authConfig
+}
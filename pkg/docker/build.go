@@ -0,0 +1,229 @@
+package docker
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/builder/dockerignore"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/fileutils"
+	"github.com/docker/docker/pkg/jsonmessage"
+	"github.com/docker/docker/pkg/term"
+	"github.com/leopardslab/dunner/internal/util"
+	"github.com/spf13/viper"
+)
+
+// BuildRepository is the repository of the images built for steps, they are tagged with the hash of their build
+const BuildRepository = "dunner-build"
+
+// defaultDockerfile is the Dockerfile used to build an image if none is given
+const defaultDockerfile = "Dockerfile"
+
+// buildLogLines is the number of last lines of the build output reported when a build fails
+const buildLogLines = 10
+
+// Build describes an image built from a Dockerfile for a step, instead of being pulled
+type Build struct {
+	Context    string            // Directory on the host sent as build context
+	Dockerfile string            // Path of the Dockerfile relative to the context, `Dockerfile` if empty
+	Args       map[string]string // Build arguments passed to the Dockerfile
+}
+
+// buildImage builds the image of the step from its Dockerfile and returns its tag. The tag is derived from the
+// content of the build context along with the Dockerfile and build arguments, so that an image built earlier from
+// the same build is reused instead of being built again, unless `force` or the `No-build-cache` setting is set. The
+// latter also builds without the build cache of Docker.
+func (step Step) buildImage(ctx context.Context, cli *client.Client, force bool) (string, error) {
+	var (
+		async   = step.concurrentOutput() || CaptureOutput()
+		verbose = viper.GetBool("Verbose")
+		noCache = viper.GetBool("No-build-cache")
+	)
+
+	buildContext, hash, err := step.Build.archive()
+	if err != nil {
+		return "", fmt.Errorf("docker: failed to read build context of step '%s': %s", step.Name, err.Error())
+	}
+	tag := fmt.Sprintf("%s:%s", BuildRepository, hash[:16])
+	if !force && !noCache && imageExistsLocally(ctx, cli, tag, "") {
+		step.logger().Infof("Using image '%s' built earlier, as the build of step '%s' did not change", tag, step.Name)
+		return tag, nil
+	}
+
+	loadingMsg := fmt.Sprintf("Building image of step '%s' from %s", step.Name, step.Build.Context)
+	if !async && !verbose {
+		done := make(chan bool)
+		go util.ShowLoadingMessage(loadingMsg, fmt.Sprintf("Built image: '%s'", tag), &done, nil)
+		defer func() { done <- true }()
+	} else {
+		step.logger().Info(loadingMsg)
+	}
+
+	buildArgs := make(map[string]*string)
+	for k := range step.Build.Args {
+		v := step.Build.Args[k]
+		buildArgs[k] = &v
+	}
+	resp, err := cli.ImageBuild(ctx, buildContext, types.ImageBuildOptions{
+		Tags:        []string{tag},
+		Dockerfile:  step.Build.dockerfile(),
+		BuildArgs:   buildArgs,
+		NoCache:     noCache,
+		Remove:      true,
+		ForceRemove: true,
+		PullParent:  force,
+		Labels:      map[string]string{LabelTask: step.Task, LabelStep: step.Name},
+	})
+	if err != nil {
+		return "", fmt.Errorf("docker: failed to build image of step '%s': %s", step.Name, err.Error())
+	}
+	defer resp.Body.Close()
+
+	if verbose {
+		termFd, isTerm := term.GetFdInfo(os.Stderr)
+		if err := jsonmessage.DisplayJSONMessagesStream(resp.Body, os.Stderr, termFd, isTerm, nil); err != nil {
+			return "", fmt.Errorf("docker: failed to build image of step '%s': %s", step.Name, err.Error())
+		}
+		return tag, nil
+	}
+	if lines, err := followBuild(resp.Body); err != nil {
+		return "", fmt.Errorf("docker: failed to build image of step '%s': %s. Last lines of the build output:\n%s",
+			step.Name, err.Error(), strings.Join(lines, "\n"))
+	}
+	return tag, nil
+}
+
+// followBuild reads the build output till the end, and returns the error of the build along with the last lines of
+// its output if it fails
+func followBuild(in io.Reader) ([]string, error) {
+	var lines []string
+	dec := json.NewDecoder(in)
+	for {
+		var msg jsonmessage.JSONMessage
+		if err := dec.Decode(&msg); err != nil {
+			if err == io.EOF {
+				return lines, nil
+			}
+			return lines, err
+		}
+		if msg.Error != nil {
+			return lines, msg.Error
+		}
+		for _, line := range strings.Split(strings.TrimRight(msg.Stream, "\n"), "\n") {
+			if line == "" {
+				continue
+			}
+			lines = append(lines, line)
+			if len(lines) > buildLogLines {
+				lines = lines[1:]
+			}
+		}
+	}
+}
+
+func (build Build) dockerfile() string {
+	if build.Dockerfile == "" {
+		return defaultDockerfile
+	}
+	return filepath.ToSlash(build.Dockerfile)
+}
+
+// archive returns the tar archive of the build context, leaving out the files matching `.dockerignore` of the
+// context, along with a hash of the build. The archive does not carry modification times or owners of the files,
+// so that the hash changes only if the content of the build does.
+func (build Build) archive() (io.Reader, string, error) {
+	var patterns []string
+	if f, err := os.Open(filepath.Join(build.Context, ".dockerignore")); err == nil {
+		patterns, err = dockerignore.ReadAll(f)
+		f.Close()
+		if err != nil {
+			return nil, "", err
+		}
+	}
+	ignored, err := fileutils.NewPatternMatcher(patterns)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var buf bytes.Buffer
+	hash := sha256.New()
+	tw := tar.NewWriter(io.MultiWriter(&buf, hash))
+	err = filepath.Walk(build.Context, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(build.Context, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel != build.dockerfile() && rel != ".dockerignore" {
+			if skip, err := ignored.Matches(rel); err != nil || skip {
+				if err == nil && info.IsDir() && !ignored.Exclusions() {
+					return filepath.SkipDir
+				}
+				return err
+			}
+		}
+		return addToArchive(tw, path, rel, info)
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	if err := tw.Close(); err != nil {
+		return nil, "", err
+	}
+
+	fmt.Fprintf(hash, "dockerfile=%s\n", build.dockerfile())
+	var args []string
+	for k, v := range build.Args {
+		args = append(args, k+"="+v)
+	}
+	sort.Strings(args)
+	fmt.Fprintf(hash, "args=%s\n", strings.Join(args, "\n"))
+	return &buf, hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// addToArchive writes the file to the archive with the name `rel`
+func addToArchive(tw *tar.Writer, path string, rel string, info os.FileInfo) error {
+	var link string
+	if info.Mode()&os.ModeSymlink != 0 {
+		var err error
+		if link, err = os.Readlink(path); err != nil {
+			return err
+		}
+	}
+	header, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return err
+	}
+	header.Name = rel
+	header.ModTime = time.Unix(0, 0)
+	header.AccessTime, header.ChangeTime = time.Time{}, time.Time{}
+	header.Uid, header.Gid, header.Uname, header.Gname = 0, 0, "", ""
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(tw, f)
+	return err
+}
@@ -0,0 +1,114 @@
+package docker
+
+import (
+	"archive/tar"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func createBuildContext(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "dunner-build")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func archivedNames(t *testing.T, r io.Reader) []string {
+	var names []string
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return names
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, header.Name)
+	}
+}
+
+func TestBuildArchiveIgnoresFiles(t *testing.T) {
+	dir := createBuildContext(t, map[string]string{
+		"Dockerfile":          "FROM alpine",
+		".dockerignore":       "node_modules\n*.log\nDockerfile",
+		"main.go":             "package main",
+		"debug.log":           "log",
+		"node_modules/dep.js": "dep",
+	})
+	defer os.RemoveAll(dir)
+
+	r, _, err := Build{Context: dir}.archive()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{".dockerignore", "Dockerfile", "main.go"}
+	if names := archivedNames(t, r); !reflect.DeepEqual(names, expected) {
+		t.Fatalf("expected archived files: %v, got: %v", expected, names)
+	}
+}
+
+func TestBuildArchiveHash(t *testing.T) {
+	dir := createBuildContext(t, map[string]string{"Dockerfile": "FROM alpine", "main.go": "package main"})
+	defer os.RemoveAll(dir)
+	build := Build{Context: dir, Args: map[string]string{"VERSION": "1"}}
+	_, hash, err := build.archive()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(filepath.Join(dir, "main.go"), later, later); err != nil {
+		t.Fatal(err)
+	}
+	if _, touched, _ := build.archive(); touched != hash {
+		t.Errorf("expected hash not to change with modification time")
+	}
+
+	build.Args["VERSION"] = "2"
+	if _, changedArgs, _ := build.archive(); changedArgs == hash {
+		t.Errorf("expected hash to change with build arguments")
+	}
+	build.Args["VERSION"] = "1"
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "main.go"), []byte("package app"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, changedContent, _ := build.archive(); changedContent == hash {
+		t.Errorf("expected hash to change with content of the context")
+	}
+}
+
+func TestFollowBuildWithError(t *testing.T) {
+	var output strings.Builder
+	for i := 1; i <= buildLogLines+2; i++ {
+		output.WriteString(`{"stream":"Step ` + strings.Repeat("I", i) + `\n"}`)
+	}
+	output.WriteString(`{"errorDetail":{"message":"failed"},"error":"failed"}`)
+
+	lines, err := followBuild(strings.NewReader(output.String()))
+
+	if err == nil || err.Error() != "failed" {
+		t.Fatalf("expected build error, got: %v", err)
+	}
+	if len(lines) != buildLogLines || lines[len(lines)-1] != "Step "+strings.Repeat("I", buildLogLines+2) {
+		t.Fatalf("expected last %d lines of output, got: %v", buildLogLines, lines)
+	}
+}
@@ -0,0 +1,58 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/client"
+	"github.com/spf13/viper"
+)
+
+// invalidNameChars matches the characters not allowed in the names of Docker volumes, containers and networks
+var invalidNameChars = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+
+// CacheVolumeName returns the name of the volume of the cache with the given key, `dunner-cache-<project>-<key>`
+// where the project is the name of the project directory. Steps of all tasks of the project share the volume.
+func CacheVolumeName(key string) string {
+	return fmt.Sprintf("dunner-cache-%s-%s", projectName(), key)
+}
+
+// projectName returns the name of the project directory, with the characters not allowed in volume names replaced
+func projectName() string {
+	dir, err := filepath.Abs(viper.GetString("WorkingDirectory"))
+	if err != nil {
+		dir = viper.GetString("WorkingDirectory")
+	}
+	name := strings.Trim(invalidNameChars.ReplaceAllString(filepath.Base(dir), "-"), "-.")
+	if name == "" {
+		return "root"
+	}
+	return strings.ToLower(name)
+}
+
+// cacheMounts creates the volumes of the caches of the step if they do not exist, and returns their mounts on the
+// container. Volumes are kept after the run, so that the next runs reuse the cached data.
+func (step Step) cacheMounts(ctx context.Context, cli *client.Client) ([]mount.Mount, error) {
+	keys := make([]string, 0, len(step.Caches))
+	for key := range step.Caches {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var mounts []mount.Mount
+	for _, key := range keys {
+		name := CacheVolumeName(key)
+		labels := map[string]string{LabelCache: key, LabelProject: projectName()}
+		if err := EnsureVolume(ctx, cli, name, labels); err != nil {
+			return nil, err
+		}
+		step.logger().Debugf("Using volume %s as cache '%s' on %s", name, key, step.Caches[key])
+		mounts = append(mounts, mount.Mount{Type: mount.TypeVolume, Source: name, Target: step.Caches[key]})
+	}
+	return mounts, nil
+}
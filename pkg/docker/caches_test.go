@@ -0,0 +1,22 @@
+package docker
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestCacheVolumeName(t *testing.T) {
+	defer viper.Set("WorkingDirectory", viper.GetString("WorkingDirectory"))
+
+	for dir, expected := range map[string]string{
+		"/home/user/webapp":     "dunner-cache-webapp-npm",
+		"/home/user/My Project": "dunner-cache-my-project-npm",
+		"/":                     "dunner-cache-root-npm",
+	} {
+		viper.Set("WorkingDirectory", dir)
+		if name := CacheVolumeName("npm"); name != expected {
+			t.Errorf("%s: expected volume name: %s, got: %s", dir, expected, name)
+		}
+	}
+}
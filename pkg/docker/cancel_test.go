@@ -0,0 +1,141 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+)
+
+// fakeDaemon serves the requests of the Docker API made to run a step whose commands never end, and records the
+// containers removed
+type fakeDaemon struct {
+	*httptest.Server
+	waiting chan struct{} // Receives once the output of a command is streamed
+	removed chan string   // Receives the IDs of removed containers
+}
+
+var apiVersionPrefix = regexp.MustCompile(`^/v[0-9.]+`)
+
+func newFakeDaemon() *fakeDaemon {
+	d := &fakeDaemon{waiting: make(chan struct{}, 1), removed: make(chan string, 1)}
+	d.Server = httptest.NewServer(http.HandlerFunc(d.serve))
+	return d
+}
+
+func (d *fakeDaemon) serve(w http.ResponseWriter, r *http.Request) {
+	path := apiVersionPrefix.ReplaceAllString(r.URL.Path, "")
+	w.Header().Set("API-Version", "1.39")
+	switch {
+	case path == "/_ping":
+		w.Write([]byte("OK"))
+	case strings.HasPrefix(path, "/images/") && strings.HasSuffix(path, "/json"):
+		json.NewEncoder(w).Encode(types.ImageInspect{ID: "sha256:busybox", Os: "linux", Architecture: "amd64"})
+	case path == "/containers/create":
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(container.ContainerCreateCreatedBody{ID: "step"})
+	case path == "/containers/step/start" || path == "/containers/step/stop":
+		w.WriteHeader(http.StatusNoContent)
+	case path == "/containers/step/exec":
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(types.IDResponse{ID: "command"})
+	case path == "/exec/command/start":
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.Write([]byte("HTTP/1.1 101 UPGRADED\r\nContent-Type: application/vnd.docker.raw-stream\r\nConnection: Upgrade\r\nUpgrade: tcp\r\n\r\n"))
+		d.waiting <- struct{}{}
+		// The command never ends, the stream is open until the client closes it
+		ioutil.ReadAll(conn)
+	case path == "/containers/step/logs":
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		d.waiting <- struct{}{}
+		<-r.Context().Done()
+	case r.Method == http.MethodDelete && path == "/containers/step":
+		d.removed <- "step"
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(types.ErrorResponse{Message: "not found: " + r.Method + " " + path})
+	}
+}
+
+func TestStepExecStopsWaitingOnceCancelled(t *testing.T) {
+	defer os.Setenv("DOCKER_HOST", os.Getenv("DOCKER_HOST"))
+
+	for _, containerPerCommand := range []bool{false, true} {
+		daemon := newFakeDaemon()
+		os.Setenv("DOCKER_HOST", "tcp://"+daemon.Listener.Addr().String())
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			<-daemon.waiting
+			cancel()
+		}()
+		step := Step{
+			Task:                "test",
+			Name:                "wait",
+			Image:               "busybox:latest",
+			Command:             []string{"sleep", "60"},
+			ContainerPerCommand: containerPerCommand,
+		}
+
+		done := make(chan error, 1)
+		go func() {
+			_, err := step.Exec(ctx)
+			done <- err
+		}()
+
+		select {
+		case err := <-done:
+			if err == nil {
+				t.Errorf("container per command %t: expected error once cancelled, got none", containerPerCommand)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("container per command %t: expected step to stop waiting once cancelled", containerPerCommand)
+		}
+		select {
+		case <-daemon.removed:
+		default:
+			t.Errorf("container per command %t: expected container to be removed once cancelled", containerPerCommand)
+		}
+		cancel()
+		daemon.Close()
+	}
+}
+
+func TestReleaseContainerRemovesAtOnce(t *testing.T) {
+	var requests []string
+	daemon := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+apiVersionPrefix.ReplaceAllString(r.URL.Path, ""))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer daemon.Close()
+	cli, err := client.NewClientWithOpts(client.WithHost("tcp://"+daemon.Listener.Addr().String()), client.WithVersion("1.40"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	trackContainer("step", 0)
+
+	Step{Task: "test", Name: "build"}.releaseContainer(cli, "step", "", false)
+
+	expected := "DELETE /containers/step"
+	if len(requests) != 1 || requests[0] != expected {
+		t.Fatalf("expected only request: %s, got: %v", expected, requests)
+	}
+	if ids, _ := runningResources(); len(ids) != 0 {
+		t.Fatalf("expected container to be untracked, got: %v", ids)
+	}
+}
@@ -0,0 +1,110 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+)
+
+// LabelCache is set on the named volumes created by Dunner to cache data across runs, with the key of the cache
+const LabelCache = "dunner.cache"
+
+// CleanFilter selects the Dunner objects to be cleaned up
+type CleanFilter struct {
+	// OlderThan selects only the objects created at least this long ago, all objects if zero
+	OlderThan time.Duration
+	// Task selects only the containers of the given task, all tasks if empty. Volumes are shared
+	// between tasks, so they are not selected when a task is given.
+	Task string
+	// LargerThan selects only the containers and volumes taking at least this many bytes on disk, all if zero
+	LargerThan int64
+}
+
+// Leftovers are the Docker objects created by Dunner that still exist
+type Leftovers struct {
+	Containers []types.Container
+	Volumes    []*types.Volume
+}
+
+// Empty returns true if there is nothing to clean up
+func (l *Leftovers) Empty() bool {
+	return len(l.Containers) == 0 && len(l.Volumes) == 0
+}
+
+// ListLeftovers lists the containers and volumes carrying Dunner labels which match the filter
+func ListLeftovers(ctx context.Context, cli client.APIClient, filter CleanFilter) (*Leftovers, error) {
+	var leftovers Leftovers
+	createdBefore := time.Now().Add(-filter.OlderThan)
+
+	containerFilters := filters.NewArgs(filters.Arg("label", LabelRunID))
+	if filter.Task != "" {
+		containerFilters.Add("label", fmt.Sprintf("%s=%s", LabelTask, filter.Task))
+	}
+	containers, err := cli.ContainerList(ctx, types.ContainerListOptions{
+		All:     true,
+		Size:    filter.LargerThan != 0,
+		Filters: containerFilters,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("docker: failed to list containers: %s", err.Error())
+	}
+	for _, c := range containers {
+		if filter.OlderThan != 0 && !time.Unix(c.Created, 0).Before(createdBefore) {
+			continue
+		}
+		if c.SizeRw < filter.LargerThan {
+			continue
+		}
+		leftovers.Containers = append(leftovers.Containers, c)
+	}
+
+	if filter.Task != "" {
+		return &leftovers, nil
+	}
+	volumes, err := ListDunnerVolumes(ctx, cli)
+	if err != nil {
+		return nil, err
+	}
+	var sizes map[string]int64
+	if filter.LargerThan != 0 {
+		if sizes, err = volumeSizes(ctx, cli); err != nil {
+			return nil, err
+		}
+	}
+	for _, v := range volumes {
+		if filter.OlderThan != 0 {
+			createdAt, err := time.Parse(time.RFC3339, v.CreatedAt)
+			if err != nil || !createdAt.Before(createdBefore) {
+				continue
+			}
+		}
+		if sizes[v.Name] < filter.LargerThan {
+			continue
+		}
+		leftovers.Volumes = append(leftovers.Volumes, v)
+	}
+	return &leftovers, nil
+}
+
+// RemoveLeftovers force removes the given containers and volumes. It goes on removing the rest
+// when one fails, and returns all the errors.
+func RemoveLeftovers(ctx context.Context, cli client.APIClient, leftovers *Leftovers) []error {
+	var errs []error
+	for _, c := range leftovers.Containers {
+		err := cli.ContainerRemove(ctx, c.ID, types.ContainerRemoveOptions{Force: true})
+		if err != nil && !client.IsErrNotFound(err) {
+			errs = append(errs, fmt.Errorf("docker: failed to remove container %s: %s", c.ID, err.Error()))
+		}
+	}
+	for _, v := range leftovers.Volumes {
+		err := cli.VolumeRemove(ctx, v.Name, true)
+		if err != nil && !client.IsErrNotFound(err) {
+			errs = append(errs, fmt.Errorf("docker: failed to remove volume %s: %s", v.Name, err.Error()))
+		}
+	}
+	return errs
+}
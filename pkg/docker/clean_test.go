@@ -0,0 +1,194 @@
+package docker
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	volumetypes "github.com/docker/docker/api/types/volume"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
+)
+
+// fakeClient serves the containers and volumes it holds, the methods not overridden panic if called
+type fakeClient struct {
+	client.APIClient
+	containers       []types.Container
+	volumes          []*types.Volume
+	containerFilters filters.Args
+	removed          []string
+	removeErr        error
+	createErr        error
+	sizes            map[string]int64
+	images           map[string]types.ImageInspect
+}
+
+func (f *fakeClient) ContainerList(_ context.Context, options types.ContainerListOptions) ([]types.Container, error) {
+	f.containerFilters = options.Filters
+	return f.containers, nil
+}
+
+func (f *fakeClient) ContainerRemove(_ context.Context, id string, _ types.ContainerRemoveOptions) error {
+	f.removed = append(f.removed, id)
+	return f.removeErr
+}
+
+func (f *fakeClient) VolumeList(_ context.Context, _ filters.Args) (volumetypes.VolumeListOKBody, error) {
+	return volumetypes.VolumeListOKBody{Volumes: f.volumes}, nil
+}
+
+func (f *fakeClient) VolumeRemove(_ context.Context, name string, _ bool) error {
+	f.removed = append(f.removed, name)
+	return f.removeErr
+}
+
+func (f *fakeClient) VolumeCreate(_ context.Context, options volumetypes.VolumeCreateBody) (types.Volume, error) {
+	if f.createErr != nil {
+		return types.Volume{}, f.createErr
+	}
+	for _, v := range f.volumes {
+		if v.Name == options.Name {
+			return *v, nil
+		}
+	}
+	v := &types.Volume{Name: options.Name, Labels: options.Labels}
+	f.volumes = append(f.volumes, v)
+	return *v, nil
+}
+
+func (f *fakeClient) DiskUsage(_ context.Context) (types.DiskUsage, error) {
+	var usage types.DiskUsage
+	for _, v := range f.volumes {
+		usage.Volumes = append(usage.Volumes, &types.Volume{Name: v.Name, UsageData: &types.VolumeUsageData{Size: f.sizes[v.Name]}})
+	}
+	return usage, nil
+}
+
+func (f *fakeClient) ImageInspectWithRaw(_ context.Context, image string) (types.ImageInspect, []byte, error) {
+	inspect, ok := f.images[image]
+	if !ok {
+		return types.ImageInspect{}, nil, errdefs.NotFound(errors.New("no such image: " + image))
+	}
+	return inspect, nil, nil
+}
+
+func (f *fakeClient) ImageRemove(_ context.Context, image string, _ types.ImageRemoveOptions) ([]types.ImageDeleteResponseItem, error) {
+	f.removed = append(f.removed, image)
+	if f.removeErr != nil {
+		return nil, f.removeErr
+	}
+	return []types.ImageDeleteResponseItem{{Untagged: image}, {Deleted: f.images[image].ID}}, nil
+}
+
+func newFakeClient() *fakeClient {
+	now := time.Now()
+	return &fakeClient{
+		containers: []types.Container{
+			{ID: "old", Created: now.Add(-48 * time.Hour).Unix()},
+			{ID: "new", Created: now.Add(-time.Hour).Unix()},
+		},
+		volumes: []*types.Volume{
+			{Name: "old-cache", CreatedAt: now.Add(-48 * time.Hour).Format(time.RFC3339)},
+			{Name: "new-cache", CreatedAt: now.Add(-time.Hour).Format(time.RFC3339)},
+		},
+	}
+}
+
+func TestListLeftovers(t *testing.T) {
+	cli := newFakeClient()
+
+	leftovers, err := ListLeftovers(context.Background(), cli, CleanFilter{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(leftovers.Containers) != 2 || len(leftovers.Volumes) != 2 {
+		t.Fatalf("expected all containers and volumes, got: %+v", leftovers)
+	}
+	if !cli.containerFilters.ExactMatch("label", LabelRunID) {
+		t.Fatalf("expected containers to be filtered by label %s, got: %+v", LabelRunID, cli.containerFilters)
+	}
+}
+
+func TestListLeftoversOlderThan(t *testing.T) {
+	leftovers, err := ListLeftovers(context.Background(), newFakeClient(), CleanFilter{OlderThan: 24 * time.Hour})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(leftovers.Containers) != 1 || leftovers.Containers[0].ID != "old" {
+		t.Fatalf("expected only old container, got: %+v", leftovers.Containers)
+	}
+	if len(leftovers.Volumes) != 1 || leftovers.Volumes[0].Name != "old-cache" {
+		t.Fatalf("expected only old volume, got: %+v", leftovers.Volumes)
+	}
+}
+
+func TestListLeftoversLargerThan(t *testing.T) {
+	cli := newFakeClient()
+	cli.containers[0].SizeRw = 1 << 20
+	cli.sizes = map[string]int64{"old-cache": 1 << 10, "new-cache": 1 << 30}
+
+	leftovers, err := ListLeftovers(context.Background(), cli, CleanFilter{LargerThan: 1 << 20})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(leftovers.Containers) != 1 || leftovers.Containers[0].ID != "old" {
+		t.Fatalf("expected only old container, got: %+v", leftovers.Containers)
+	}
+	if len(leftovers.Volumes) != 1 || leftovers.Volumes[0].Name != "new-cache" {
+		t.Fatalf("expected only new volume, got: %+v", leftovers.Volumes)
+	}
+}
+
+func TestListLeftoversOfTask(t *testing.T) {
+	cli := newFakeClient()
+
+	leftovers, err := ListLeftovers(context.Background(), cli, CleanFilter{Task: "build"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cli.containerFilters.ExactMatch("label", LabelTask+"=build") {
+		t.Fatalf("expected containers to be filtered by task label, got: %+v", cli.containerFilters)
+	}
+	if len(leftovers.Volumes) != 0 {
+		t.Fatalf("expected no volumes when filtering by task, got: %+v", leftovers.Volumes)
+	}
+}
+
+func TestRemoveLeftovers(t *testing.T) {
+	cli := newFakeClient()
+	leftovers := &Leftovers{Containers: cli.containers, Volumes: cli.volumes}
+
+	errs := RemoveLeftovers(context.Background(), cli, leftovers)
+
+	if len(errs) != 0 {
+		t.Fatalf("expected no errors, got: %v", errs)
+	}
+	expected := []string{"old", "new", "old-cache", "new-cache"}
+	if !reflect.DeepEqual(cli.removed, expected) {
+		t.Fatalf("expected removed: %v, got: %v", expected, cli.removed)
+	}
+}
+
+func TestRemoveLeftoversContinuesOnError(t *testing.T) {
+	cli := newFakeClient()
+	cli.removeErr = errors.New("in use")
+	leftovers := &Leftovers{Containers: cli.containers, Volumes: cli.volumes}
+
+	errs := RemoveLeftovers(context.Background(), cli, leftovers)
+
+	if len(errs) != 4 || len(cli.removed) != 4 {
+		t.Fatalf("expected removal of all objects to be attempted, got errors: %v", errs)
+	}
+	expectedErr := "docker: failed to remove container old: in use"
+	if errs[0].Error() != expectedErr {
+		t.Fatalf("expected error: %s, got: %s", expectedErr, errs[0])
+	}
+}
@@ -0,0 +1,58 @@
+package docker
+
+import (
+	"context"
+	"os"
+	"sync"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+)
+
+// negotiated caches the ping of each Docker daemon used in the run, to negotiate the API version of clients without
+// pinging the daemon again
+var negotiated = struct {
+	sync.Mutex
+	pings map[string]types.Ping
+}{pings: make(map[string]types.Ping)}
+
+// NewClient returns a client of the Docker daemon configured from the environment, using the highest API version
+// supported by both the client and the daemon. The daemon is pinged by the first client of the run only, later
+// clients reuse its API version. Setting `DOCKER_API_VERSION` fixes the version instead.
+func NewClient(ctx context.Context) (*client.Client, error) {
+	cli, err := client.NewClientWithOpts(client.FromEnv)
+	if err != nil {
+		return nil, err
+	}
+	if os.Getenv("DOCKER_API_VERSION") != "" {
+		return cli, nil
+	}
+
+	negotiated.Lock()
+	defer negotiated.Unlock()
+	if ping, ok := negotiated.pings[cli.DaemonHost()]; ok {
+		cli.NegotiateAPIVersionPing(ping)
+		return cli, nil
+	}
+	ping, err := cli.Ping(ctx)
+	if err != nil {
+		// Not cached, so that the version is negotiated once the daemon is reachable. Requests fail meanwhile.
+		log.Debugf("docker: failed to negotiate API version with the daemon at %s: %s", cli.DaemonHost(), err.Error())
+		return cli, nil
+	}
+	cli.NegotiateAPIVersionPing(ping)
+	negotiated.pings[cli.DaemonHost()] = ping
+	logDaemonVersion(ctx, cli)
+	return cli, nil
+}
+
+// logDaemonVersion logs the negotiated API version, along with the version and platform of the daemon
+func logDaemonVersion(ctx context.Context, cli *client.Client) {
+	version, err := cli.ServerVersion(ctx)
+	if err != nil {
+		log.Debugf("Using Docker API version %s with the daemon at %s", cli.ClientVersion(), cli.DaemonHost())
+		return
+	}
+	log.Debugf("Using Docker API version %s with the daemon at %s, Docker %s on %s/%s supporting API up to %s",
+		cli.ClientVersion(), cli.DaemonHost(), version.Version, version.Os, version.Arch, version.APIVersion)
+}
@@ -0,0 +1,78 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+)
+
+// oldDaemon serves the requests to ping a daemon supporting at most API version 1.30, and counts the pings
+func oldDaemon(pings *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("API-Version", "1.30")
+		switch apiVersionPrefix.ReplaceAllString(r.URL.Path, "") {
+		case "/_ping":
+			atomic.AddInt32(pings, 1)
+			w.Write([]byte("OK"))
+		case "/version":
+			json.NewEncoder(w).Encode(types.Version{Version: "17.06.0-ce", APIVersion: "1.30", Os: "linux", Arch: "amd64"})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestNewClientNegotiatesOlderVersionOnce(t *testing.T) {
+	var pings int32
+	daemon := oldDaemon(&pings)
+	defer daemon.Close()
+	defer os.Setenv("DOCKER_HOST", os.Getenv("DOCKER_HOST"))
+	os.Setenv("DOCKER_HOST", "tcp://"+daemon.Listener.Addr().String())
+	defer os.Setenv("DOCKER_API_VERSION", os.Getenv("DOCKER_API_VERSION"))
+	os.Unsetenv("DOCKER_API_VERSION")
+
+	for i := 0; i < 2; i++ {
+		cli, err := NewClient(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if version := cli.ClientVersion(); version != "1.30" {
+			t.Errorf("expected client to downgrade to API version 1.30, got: %s", version)
+		}
+	}
+	if pings != 1 {
+		t.Errorf("expected daemon to be pinged once, got %d pings", pings)
+	}
+
+	status := CheckDaemon()
+
+	expected := "Docker 17.06.0-ce on linux/amd64 at " + os.Getenv("DOCKER_HOST") + ", using API version 1.30 of up to 1.30"
+	if status.Err != nil || status.String() != expected {
+		t.Errorf("expected status: %s, got: %s (%v)", expected, status, status.Err)
+	}
+}
+
+func TestNewClientWithFixedVersion(t *testing.T) {
+	var pings int32
+	daemon := oldDaemon(&pings)
+	defer daemon.Close()
+	defer os.Setenv("DOCKER_HOST", os.Getenv("DOCKER_HOST"))
+	os.Setenv("DOCKER_HOST", "tcp://"+daemon.Listener.Addr().String())
+	defer os.Setenv("DOCKER_API_VERSION", os.Getenv("DOCKER_API_VERSION"))
+	os.Setenv("DOCKER_API_VERSION", "1.25")
+
+	cli, err := NewClient(context.Background())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version := cli.ClientVersion(); version != "1.25" || pings != 0 {
+		t.Errorf("expected fixed API version 1.25 without ping, got: %s after %d pings", version, pings)
+	}
+}
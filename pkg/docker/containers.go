@@ -0,0 +1,268 @@
+package docker
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	G "github.com/leopardslab/dunner/pkg/global"
+	"github.com/spf13/viper"
+)
+
+// Labels set on every container created by Dunner, to identify them later. Containers of steps are labelled with
+// the step and its position in the task, and those of services with LabelService. LabelCreateID is unique to the
+// request creating the container, to find it if the response of the daemon is lost.
+const (
+	LabelTask      = "dunner.task"
+	LabelStep      = "dunner.step"
+	LabelStepIndex = "dunner.step-index"
+	LabelRunID     = "dunner.run"
+	LabelVersion   = "dunner.version"
+	LabelTaskFile  = "dunner.task-file"
+	LabelCreateID  = "dunner.create-id"
+)
+
+// Values of `Keep-containers` setting, to skip removal of containers for debugging
+const (
+	KeepFailedContainers = "failed"
+	KeepAllContainers    = "all"
+)
+
+// RunID identifies the containers created by this run of Dunner, it is a random UUID
+var RunID = newRunID()
+
+// defaultStopTimeout is the time given to a service, or to a container of a step when the run is interrupted, to
+// stop gracefully before it is killed, unless the `Stop-timeout` setting is set
+const defaultStopTimeout = 10 * time.Second
+
+// runCtx is the context of the requests of running steps to the Docker daemon, it is cancelled when the run is
+// interrupted so that steps stop waiting on their containers
+var runCtx, cancelRun = context.WithCancel(context.Background())
+
+// RunContext returns the context of the run, which steps derive their context from
+func RunContext() context.Context {
+	return runCtx
+}
+
+// CancelRun cancels the requests of the running steps to the Docker daemon, when the run is interrupted. The steps
+// then fail and release their containers.
+func CancelRun() {
+	cancelRun()
+}
+
+// stopTimeout returns the time given to containers to stop gracefully before they are killed, when they are
+// stopped rather than removed at once, see removeContainer
+func stopTimeout() time.Duration {
+	if timeout := viper.GetDuration("Stop-timeout"); timeout > 0 {
+		return timeout
+	}
+	return defaultStopTimeout
+}
+
+// containerStopTimeout returns the time given to the container to stop gracefully, its own stop timeout if it has
+// one or the stop timeout of the run otherwise
+func containerStopTimeout(id string) time.Duration {
+	running.Lock()
+	timeout := running.ids[id]
+	running.Unlock()
+	if timeout > 0 {
+		return timeout
+	}
+	return stopTimeout()
+}
+
+// running tracks the containers, along with their own stop timeouts, and networks created by Dunner that are yet
+// to be removed
+var running = struct {
+	sync.Mutex
+	ids      map[string]time.Duration
+	networks map[string]struct{}
+}{ids: make(map[string]time.Duration), networks: make(map[string]struct{})}
+
+// newRunID returns a random UUID of version 4, falling back to the current time if randomness is not available
+func newRunID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		binary.BigEndian.PutUint64(b, uint64(time.Now().UnixNano()))
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// runLabels returns the labels identifying the run, set on all the containers and networks created by Dunner: the
+// run ID, the version of Dunner and a hash of the path of the task file
+func runLabels() map[string]string {
+	return map[string]string{
+		LabelRunID:    RunID,
+		LabelVersion:  G.VERSION,
+		LabelTaskFile: taskFileHash(),
+	}
+}
+
+// taskFileHash returns a short hash of the absolute path of the task file, identifying the project of a container
+// without disclosing its path
+func taskFileHash() string {
+	file := viper.GetString("DunnerTaskFile")
+	if abs, err := filepath.Abs(file); err == nil {
+		file = abs
+	}
+	sum := sha256.Sum256([]byte(file))
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+// labels returns the labels identifying the container of the step
+func (step Step) labels() map[string]string {
+	labels := runLabels()
+	labels[LabelTask] = step.Task
+	labels[LabelStep] = step.Name
+	labels[LabelStepIndex] = strconv.Itoa(step.Index)
+	return labels
+}
+
+// trackContainer tracks the container until it is removed, with the time given to it to stop gracefully. The stop
+// timeout of the run is used if timeout is not positive.
+func trackContainer(id string, timeout time.Duration) {
+	running.Lock()
+	defer running.Unlock()
+	running.ids[id] = timeout
+}
+
+func untrackContainer(id string) {
+	running.Lock()
+	defer running.Unlock()
+	delete(running.ids, id)
+}
+
+func trackNetwork(id string) {
+	running.Lock()
+	defer running.Unlock()
+	running.networks[id] = struct{}{}
+}
+
+func untrackNetwork(id string) {
+	running.Lock()
+	defer running.Unlock()
+	delete(running.networks, id)
+}
+
+// StopContainers stops and removes all the containers created by Dunner that are still running, and then the
+// networks created for them. It is used to clean up when a run is interrupted, errors are logged and do not stop
+// the clean up. Containers are given the stop timeout to stop gracefully, unless KillContainers is called meanwhile.
+func StopContainers() {
+	ids, networks := runningResources()
+	if len(ids) == 0 && len(networks) == 0 {
+		return
+	}
+
+	ctx := context.Background()
+	cli, err := NewClient(ctx)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	for _, id := range ids {
+		log.Infof("Stopping container %s", id)
+		stopAndRemove(ctx, cli, id)
+		untrackContainer(id)
+	}
+	for _, id := range networks {
+		if err := cli.NetworkRemove(ctx, id); err != nil && !client.IsErrNotFound(err) {
+			log.Errorf("docker: failed to remove network %s: %s", id, err.Error())
+		}
+		untrackNetwork(id)
+	}
+}
+
+// KillContainers kills all the containers created by Dunner that are still running, without waiting for them to
+// stop gracefully. It is used when Dunner is interrupted again while stopping containers, which are then removed
+// by StopContainers.
+func KillContainers() {
+	ids, _ := runningResources()
+	ctx := context.Background()
+	cli, err := NewClient(ctx)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	for _, id := range ids {
+		log.Infof("Killing container %s", id)
+		if err := cli.ContainerKill(ctx, id, "SIGKILL"); err != nil && !client.IsErrNotFound(err) {
+			log.Debugf("docker: failed to kill container %s: %s", id, err.Error())
+		}
+	}
+}
+
+// wasKilled returns true if the container stopped in elapsed time was killed as it did not stop gracefully within
+// the timeout, that is it exited on SIGKILL once the timeout expired
+func wasKilled(ctx context.Context, cli *client.Client, id string, elapsed, timeout time.Duration) bool {
+	if elapsed < timeout {
+		return false
+	}
+	info, err := cli.ContainerInspect(ctx, id)
+	if err != nil {
+		return false
+	}
+	return info.State != nil && info.State.ExitCode == 128+int(syscall.SIGKILL)
+}
+
+// runningResources returns the IDs of the containers and networks yet to be removed
+func runningResources() ([]string, []string) {
+	running.Lock()
+	defer running.Unlock()
+	var ids, networks []string
+	for id := range running.ids {
+		ids = append(ids, id)
+	}
+	for id := range running.networks {
+		networks = append(networks, id)
+	}
+	return ids, networks
+}
+
+// removeContainer stops and removes the container, giving it its stop timeout to stop gracefully. It is used for
+// services, and for the containers of steps when the run is interrupted while their commands may still be running.
+func removeContainer(cli *client.Client, id string) {
+	defer untrackContainer(id)
+	stopAndRemove(context.Background(), cli, id)
+}
+
+// discardContainer kills and removes the container of a step at once, once its commands ended, as only the command
+// keeping it running is left
+func discardContainer(cli *client.Client, id string) {
+	defer untrackContainer(id)
+	err := cli.ContainerRemove(context.Background(), id, types.ContainerRemoveOptions{Force: true})
+	if err != nil && !client.IsErrNotFound(err) {
+		log.Errorf("docker: failed to remove container %s: %s", id, err.Error())
+	}
+}
+
+// stopAndRemove stops the container, killing it if it does not stop within the stop timeout, and removes it. It is
+// only used for services and for containers of steps of an interrupted run, whose processes may need the time to
+// shut down cleanly, so being killed is warned about. Errors are logged so that they do not mask the error of the
+// step itself.
+func stopAndRemove(ctx context.Context, cli *client.Client, id string) {
+	timeout := containerStopTimeout(id)
+	start := time.Now()
+	if err := cli.ContainerStop(ctx, id, &timeout); err != nil && !client.IsErrNotFound(err) {
+		log.Errorf("docker: failed to stop container %s: %s", id, err.Error())
+	} else if err == nil && wasKilled(ctx, cli, id, time.Since(start), timeout) {
+		log.Warnf("Container %s did not stop within %s and was killed, raise `stop_timeout` of its step or service to give it more time", id, timeout)
+	}
+	err := cli.ContainerRemove(ctx, id, types.ContainerRemoveOptions{Force: true})
+	if err != nil && !client.IsErrNotFound(err) {
+		log.Errorf("docker: failed to remove container %s: %s", id, err.Error())
+	}
+}
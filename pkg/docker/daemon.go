@@ -0,0 +1,131 @@
+package docker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// daemonTimeout is the time given to the Docker daemon to respond when checking that it is reachable
+const daemonTimeout = 5 * time.Second
+
+// DaemonStatus is the outcome of checking the connection to the Docker daemon
+type DaemonStatus struct {
+	Host         string // Endpoint of the daemon used, as set by `DOCKER_HOST` or the default one
+	SocketPath   string // Path of the socket of the endpoint on the host, empty if it is not a unix socket
+	SocketExists bool   // True if the socket of the endpoint exists on the host
+	APIVersion   string // Version of the API of the daemon, empty if it is not reachable
+	Err          error  // Error connecting to the daemon, nil if it is reachable
+
+	// Version of Docker, operating system and architecture of the daemon, and the API version negotiated with it
+	ServerVersion     string
+	OS                string
+	Arch              string
+	NegotiatedVersion string
+}
+
+// CheckDaemon verifies that the Docker daemon can be reached, with a short timeout, and reports how it was reached
+func CheckDaemon() *DaemonStatus {
+	status := &DaemonStatus{}
+	ctx, cancel := context.WithTimeout(context.Background(), daemonTimeout)
+	defer cancel()
+	cli, err := NewClient(ctx)
+	if err != nil {
+		status.Err = err
+		return status
+	}
+	defer cli.Close()
+
+	status.Host = cli.DaemonHost()
+	if strings.HasPrefix(status.Host, "unix://") {
+		status.SocketPath = strings.TrimPrefix(status.Host, "unix://")
+		_, err := os.Stat(status.SocketPath)
+		status.SocketExists = err == nil
+	}
+
+	version, err := cli.ServerVersion(ctx)
+	if err != nil {
+		status.Err = err
+		return status
+	}
+	status.APIVersion = version.APIVersion
+	status.ServerVersion, status.OS, status.Arch = version.Version, version.Os, version.Arch
+	status.NegotiatedVersion = cli.ClientVersion()
+	return status
+}
+
+// String describes the daemon reached, for diagnostics
+func (status *DaemonStatus) String() string {
+	return fmt.Sprintf("Docker %s on %s/%s at %s, using API version %s of up to %s", status.ServerVersion, status.OS,
+		status.Arch, status.Host, status.NegotiatedVersion, status.APIVersion)
+}
+
+// Explain returns an error explaining why the daemon is unreachable along with hints to fix it, or nil if it is
+// reachable
+func (status *DaemonStatus) Explain() error {
+	if status.Err == nil {
+		return nil
+	}
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "docker: cannot connect to the Docker daemon at %s: %s", status.Host, status.Err.Error())
+	if status.SocketPath != "" {
+		if status.SocketExists {
+			fmt.Fprintf(&msg, "\nThe socket %s exists on the host.", status.SocketPath)
+		} else {
+			fmt.Fprintf(&msg, "\nThe socket %s does not exist on the host.", status.SocketPath)
+		}
+	}
+	hints := status.hints()
+	if len(hints) != 0 {
+		msg.WriteString("\nHints:")
+		for _, hint := range hints {
+			msg.WriteString("\n  - " + hint)
+		}
+	}
+	return errors.New(msg.String())
+}
+
+// hints returns the likely fixes for the daemon being unreachable, for the common setups of Docker
+func (status *DaemonStatus) hints() []string {
+	var hints []string
+	if status.SocketExists && isPermissionDenied(status.Err) {
+		hints = append(hints, "Your user is not allowed to use the socket, add it to the `docker` group with "+
+			"`sudo usermod -aG docker $USER` and log in again")
+	} else {
+		if runtime.GOOS == "darwin" || runtime.GOOS == "windows" {
+			hints = append(hints, "Start Docker Desktop and wait for it to be running")
+		} else {
+			hints = append(hints, "Start the Docker daemon, for example with `sudo systemctl start docker`")
+		}
+	}
+	if runtimeDir := os.Getenv("XDG_RUNTIME_DIR"); runtimeDir != "" {
+		if socket := filepath.Join(runtimeDir, "docker.sock"); socket != status.SocketPath && exists(socket) {
+			hints = append(hints, fmt.Sprintf("Docker runs rootless, set `DOCKER_HOST=unix://%s`", socket))
+		}
+		if socket := filepath.Join(runtimeDir, "podman", "podman.sock"); socket != status.SocketPath && exists(socket) {
+			hints = append(hints, fmt.Sprintf("Podman is running, set `DOCKER_HOST=unix://%s` to use it", socket))
+		}
+	}
+	if socket := "/run/podman/podman.sock"; socket != status.SocketPath && exists(socket) {
+		hints = append(hints, fmt.Sprintf("Podman is running, set `DOCKER_HOST=unix://%s` to use it", socket))
+	}
+	if os.Getenv("DOCKER_HOST") != "" {
+		hints = append(hints, "Check that `DOCKER_HOST` points to a running Docker daemon, or unset it to use the default one")
+	}
+	return hints
+}
+
+// isPermissionDenied returns true if connecting to the daemon failed as the user is not allowed to use its socket
+func isPermissionDenied(err error) bool {
+	return strings.Contains(err.Error(), "permission denied")
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,90 @@
+package docker
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckDaemonUnreachable(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dunner-daemon")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "docker.sock")
+	defer os.Setenv("DOCKER_HOST", os.Getenv("DOCKER_HOST"))
+	os.Setenv("DOCKER_HOST", "unix://"+socket)
+
+	status := CheckDaemon()
+
+	if status.Err == nil {
+		t.Fatal("expected daemon to be unreachable")
+	}
+	if status.Host != "unix://"+socket || status.SocketPath != socket || status.SocketExists {
+		t.Errorf("expected status of missing socket %s, got: %+v", socket, status)
+	}
+	explained := status.Explain().Error()
+	for _, expected := range []string{
+		"docker: cannot connect to the Docker daemon at unix://" + socket,
+		"The socket " + socket + " does not exist on the host.",
+		"Check that `DOCKER_HOST` points to a running Docker daemon",
+	} {
+		if !strings.Contains(explained, expected) {
+			t.Errorf("expected error to contain: %s, got: %s", expected, explained)
+		}
+	}
+}
+
+func TestDaemonStatusHints(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dunner-daemon")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.MkdirAll(filepath.Join(dir, "podman"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, socket := range []string{"docker.sock", "podman/podman.sock"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, socket), nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer os.Setenv("XDG_RUNTIME_DIR", os.Getenv("XDG_RUNTIME_DIR"))
+	os.Setenv("XDG_RUNTIME_DIR", dir)
+	defer os.Setenv("DOCKER_HOST", os.Getenv("DOCKER_HOST"))
+	os.Unsetenv("DOCKER_HOST")
+
+	status := &DaemonStatus{
+		Host:         "unix://" + Socket,
+		SocketPath:   Socket,
+		SocketExists: true,
+		Err:          errors.New("dial unix /var/run/docker.sock: connect: permission denied"),
+	}
+	hints := status.hints()
+
+	expected := []string{
+		"Your user is not allowed to use the socket, add it to the `docker` group with `sudo usermod -aG docker $USER` and log in again",
+		"Docker runs rootless, set `DOCKER_HOST=unix://" + filepath.Join(dir, "docker.sock") + "`",
+		"Podman is running, set `DOCKER_HOST=unix://" + filepath.Join(dir, "podman", "podman.sock") + "` to use it",
+	}
+	if len(hints) < len(expected) {
+		t.Fatalf("expected hints: %q, got: %q", expected, hints)
+	}
+	for i := range expected {
+		if hints[i] != expected[i] {
+			t.Errorf("expected hint: %s, got: %s", expected[i], hints[i])
+		}
+	}
+}
+
+func TestDaemonStatusExplainReachable(t *testing.T) {
+	status := &DaemonStatus{Host: "unix://" + Socket, APIVersion: "1.40"}
+
+	if err := status.Explain(); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+}
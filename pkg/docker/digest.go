@@ -0,0 +1,76 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/docker/distribution/reference"
+	"github.com/docker/docker/client"
+)
+
+// resolvedDigests records the digests of the images run, by image as given in the steps
+var resolvedDigests = struct {
+	sync.Mutex
+	digests map[string]string
+}{digests: make(map[string]string)}
+
+// ImageDigest returns the digest pinned in the image reference, like `golang@sha256:...`, or "" if it has none
+func ImageDigest(image string) string {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return ""
+	}
+	if canonical, ok := named.(reference.Canonical); ok {
+		return canonical.Digest().String()
+	}
+	return ""
+}
+
+// ResolvedDigests returns the digests of the images of the steps run so far, by image as given in the steps. Images
+// pinned by digest in their reference are left out.
+func ResolvedDigests() map[string]string {
+	resolvedDigests.Lock()
+	defer resolvedDigests.Unlock()
+	digests := make(map[string]string, len(resolvedDigests.digests))
+	for image, digest := range resolvedDigests.digests {
+		digests[image] = digest
+	}
+	return digests
+}
+
+// verifyDigest checks that the image of the step on the host has the digest the step is pinned to, if any, and
+// records the digest of the image.
+func (step Step) verifyDigest(ctx context.Context, cli *client.Client) error {
+	inspect, _, err := cli.ImageInspectWithRaw(ctx, step.Image)
+	if err != nil {
+		if step.Digest == "" {
+			return nil
+		}
+		return fmt.Errorf("docker: failed to verify digest of image '%s' of step '%s': %s", step.Image, step.Name, err.Error())
+	}
+
+	var digests []string
+	for _, repoDigest := range inspect.RepoDigests {
+		digests = append(digests, repoDigest[strings.LastIndex(repoDigest, "@")+1:])
+	}
+	sort.Strings(digests)
+	if len(digests) != 0 && ImageDigest(step.Image) == "" {
+		resolvedDigests.Lock()
+		resolvedDigests.digests[step.Image] = digests[0]
+		resolvedDigests.Unlock()
+	}
+
+	if step.Digest == "" {
+		return nil
+	}
+	for _, digest := range digests {
+		if digest == step.Digest {
+			return nil
+		}
+	}
+	return fmt.Errorf("docker: image '%s' of step '%s' does not match the pinned digest %s, found digests: [%s]",
+		step.Image, step.Name, step.Digest, strings.Join(digests, ", "))
+}
@@ -0,0 +1,19 @@
+package docker
+
+import "testing"
+
+func TestImageDigest(t *testing.T) {
+	digest := "sha256:" + "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+	cases := map[string]string{
+		"golang":                              "",
+		"golang:1.13":                         "",
+		"golang@" + digest:                    digest,
+		"myregistry.io/golang:1.13@" + digest: digest,
+		"not a reference":                     "",
+	}
+	for image, expected := range cases {
+		if got := ImageDigest(image); got != expected {
+			t.Errorf("expected digest of '%s': %q, got: %q", image, expected, got)
+		}
+	}
+}
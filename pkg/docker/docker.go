@@ -7,10 +7,12 @@ package docker
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 	"time"
@@ -22,170 +24,351 @@ import (
 	"github.com/docker/docker/pkg/jsonmessage"
 	"github.com/docker/docker/pkg/stdcopy"
 	"github.com/docker/docker/pkg/term"
+	"github.com/docker/go-connections/nat"
+	units "github.com/docker/go-units"
 	"github.com/leopardslab/dunner/internal/logger"
 	"github.com/leopardslab/dunner/internal/util"
+	"github.com/leopardslab/dunner/pkg/events"
+	"github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 )
 
 var log = logger.Log
 
+// DefaultProjectDir is the directory of the container the project directory is mounted on, unless set otherwise
+const DefaultProjectDir = "/dunner"
+
+// Socket is the path of the Docker socket, on the host as well as in the containers it is mounted on
+const Socket = "/var/run/docker.sock"
+
 // Step describes the information required to run one task in docker container. It is very similar to the concept
 // of docker build of a 'Dockerfile' and then a sequence of commands to be executed in `docker run`.
 type Step struct {
 	Task      string            // The name of the task that the step corresponds to
 	Name      string            // Name given to this step for identification purpose
+	Index     int               // Position of the step in the task, from 1
 	Image     string            // Image is the repo name on which Docker containers are built
 	Command   []string          // The command which runs on the container and exits
 	Commands  [][]string        // The list of commands that are to be run in sequence
 	Env       []string          // The list of environment variables to be exported inside the container
+	PassEnv   []string          // Names or glob patterns of host variables passed to the container, `!` if required
 	WorkDir   string            // The primary directory on which task is to be run
 	Volumes   map[string]string // Volumes that are to be attached to the container
 	ExtMounts []mount.Mount     // The directories to be mounted on the container as bind volumes
 	Follow    string            // The next task that must be executed if this does go successfully
 	Args      []string          // The list of arguments that are to be passed
 	User      string            // User that will run the command(s) inside the container, also support user:group
+	// AllowFailure lets the task continue even if a command of the step exits with a non-zero code
+	AllowFailure bool
+	// ForcePull pulls the image even if it is already present on the host, useful for mutable tags like `latest`
+	ForcePull bool
+	// Platform of the image to be pulled, in the form `os/arch[/variant]`. Defaults to the platform of the host
+	Platform string
+	// CreateDir creates the working directory of the step before the container starts, if it does not exist
+	CreateDir bool
+	// Local steps run their commands directly on the host instead of a container
+	Local bool
+	// Entrypoint overrides the entrypoint of the image if not nil, an empty entrypoint clears it
+	Entrypoint []string
+	// Memory limit of the container in bytes, no limit if 0
+	Memory int64
+	// GPUs requested for the container, none if nil
+	GPUs *container.DeviceRequest
+	// CPU limit of the container in units of 10^-9 CPUs, no limit if 0
+	NanoCPUs int64
+	// Ports of the container published on the host, as `<host_port>:<container_port>[/<protocol>]`
+	Ports []string
+	// Network mode of the container, or name of the network to connect it to. Docker's default is used if empty
+	Network string
+	// ExtraHosts are added to `/etc/hosts` of the container as `<name>:<ip>`, the IP may be HostGateway
+	ExtraHosts []string
+	// Retries is the number of times the step is run again if it fails, waiting for RetryDelay before each
+	Retries    int
+	RetryDelay time.Duration
+	// StopTimeout is the time given to the containers of the step to stop gracefully before they are killed, when
+	// the run is interrupted. The `Stop-timeout` setting is used if not positive
+	StopTimeout time.Duration
+	// OutputFile is the file the output of the commands is saved to, besides being displayed
+	OutputFile string
+	// LogFile is the file the output of the commands is saved to for the run, as set by the `Log-dir` setting
+	LogFile string
+	// Caches are the paths of the container, by cache key, on which the named volumes of the caches are mounted
+	Caches map[string]string
+	// Concurrent is set if the step runs along with other steps, its output is then line buffered and prefixed
+	Concurrent bool
+	// MountDockerSock mounts the socket of the Docker daemon used by Dunner on the container, sets `DOCKER_HOST` to
+	// it and lets the user of the step use it
+	MountDockerSock bool
+	// Shared is the container of the task the commands run in, if the steps of the task share one. The container
+	// is started with the settings of the first step run
+	Shared *SharedContainer
+	// HostDir is the project directory on the host mounted on the container, the `WorkingDirectory` setting if empty
+	HostDir string
+	// InheritEnv passes all the environment variables of the host to the container, except hostOnlyEnvs
+	InheritEnv bool
+	// Privileged runs the container in privileged mode
+	Privileged bool
+	// Linux capabilities to add to and drop from the container
+	CapAdd  []string
+	CapDrop []string
+	// ContainerPerCommand runs each command as the command of a new container, instead of running all the commands
+	// on one container. This is needed for images that cannot keep a container running, like images with no shell
+	ContainerPerCommand bool
+	// Digest the image is pinned to, the step fails before its container starts if the image does not match it
+	Digest string
+	// ProjectDir is the directory of the container the project directory is mounted on and commands are run in,
+	// DefaultProjectDir if empty
+	ProjectDir string
+	// Build builds the image of the step from a Dockerfile if not nil, instead of pulling `Image`
+	Build *Build
+	// Interactive attaches the standard input of the host to the commands, on a terminal. It is not supported along
+	// with ContainerPerCommand
+	Interactive bool
+	// SkipProjectMount does not mount the project directory on the container, the commands then run in the working
+	// directory of the image unless WorkDir is set
+	SkipProjectMount bool
+	// TTY runs the commands on a terminal, so that they display colors and progress as they would on the host. Standard
+	// output and error of the commands are then read as one
+	TTY bool
+	// BeforePull is called before the image is pulled if not nil, it is not called if the image is present on the host
+	BeforePull func(step Step)
 }
 
-// Result stores the output of commands run using `docker exec`
+// Result stores the outcome of running a step, and the output of commands run using `docker exec`
 type Result struct {
-	Output string
-	Error  string
+	ContainerID string        // ID of the container the commands were run on
+	ExitCode    int           // Exit code of the last command run, non-zero if it failed
+	ExitCodes   []int         // Exit codes of the commands run, in order
+	Duration    time.Duration // Time taken to run the step, including pulling of the image
+	Output      string        // Standard output of the commands, captured only when output is concurrent or captured
+	Error       string        // Standard error of the commands, captured only when output is concurrent or captured
+}
+
+// logger returns the logger of the step, attaching its task and name to the logs
+func (step Step) logger() *logrus.Entry {
+	return logger.WithStep(step.Task, step.Name)
+}
+
+// ConcurrentOutput returns true if steps may produce output at the same time, that is in asynchronous mode or when
+// running tasks in parallel. Output is then line buffered and prefixed, and spinners are not shown.
+func ConcurrentOutput() bool {
+	return viper.GetBool("Async") || viper.GetBool("Parallel-tasks")
+}
+
+// concurrentOutput returns true if the step may produce output at the same time as other steps
+func (step Step) concurrentOutput() bool {
+	return ConcurrentOutput() || step.Concurrent
+}
+
+// OutputPrefix returns the prefix of the lines of output of the commands of the step, as given by the format of the
+// `Output-prefix` setting where `{task}` and `{step}` are replaced with the names of the task and step. The prefix is
+// colored per task when the output is a terminal. Output is not prefixed if the format is empty.
+func (step Step) OutputPrefix() string {
+	prefix := strings.NewReplacer("{task}", step.Task, "{step}", step.Name).Replace(viper.GetString("Output-prefix"))
+	return logger.ColorPrefix(prefix, step.Task)
+}
+
+// CaptureOutput returns true if the output of commands is captured into their result instead of being displayed,
+// with the `Summary-only` setting, or emitted as log events with the `Events` setting. Spinners are not shown either.
+func CaptureOutput() bool {
+	return viper.GetBool("Summary-only") || events.Enabled()
+}
+
+// OutputLimit limits the displayed output of a command to its first and last lines, as given by the `Max-log-lines`
+// setting. The output of a failed command is displayed in full. A nil OutputLimit does not limit output.
+type OutputLimit struct {
+	max     int
+	writers []*logger.LineLimitWriter
+}
+
+// NewOutputLimit returns the limit of the displayed output of a command, nil if the `Max-log-lines` setting is not
+// positive or if output is captured
+func NewOutputLimit() *OutputLimit {
+	max := viper.GetInt("Max-log-lines")
+	if max <= 0 || CaptureOutput() {
+		return nil
+	}
+	return &OutputLimit{max: max}
+}
+
+// Wrap returns a writer displaying output to `out` within the limit
+func (l *OutputLimit) Wrap(out io.Writer) io.Writer {
+	if l == nil {
+		return out
+	}
+	w := logger.NewLineLimitWriter(out, l.max)
+	l.writers = append(l.writers, w)
+	return w
+}
+
+// Finish displays the last lines of the output once the command exits, or the whole output if it failed
+func (l *OutputLimit) Finish(failed bool) {
+	if l == nil {
+		return
+	}
+	for _, w := range l.writers {
+		if err := w.Finish(failed); err != nil {
+			log.Errorf("docker: failed to write output: %s", err.Error())
+		}
+	}
 }
 
 // Exec method is used to execute the task described in the corresponding step. It returns an object of the
-// struct `Result` with the corresponding output and/or error.
+// struct `Result` with the exit code, container ID and duration of the run, along with the corresponding output
+// and/or error. A command exiting with a non-zero code stops the step and is reported as an error.
+//
+// All the commands are run on one container kept running for the step, so that state is shared between commands,
+// unless `ContainerPerCommand` is set, in which case each command is run as the command of a new container.
+//
+// Requests to the Docker daemon are made with ctx. Once it is cancelled the step stops waiting on its commands and
+// fails, and its containers are stopped and removed.
 //
 // Note: A working internet connection is mandatory for the Docker container to contact Docker Hub to find the image and/or
 // corresponding updates.
-func (step Step) Exec() error {
+func (step Step) Exec(ctx context.Context) (_ *Result, err error) {
 	var (
-		async     = viper.GetBool("Async")
-		dryRun    = viper.GetBool("Dry-run")
-		verbose   = viper.GetBool("Verbose")
-		forcePull = viper.GetBool("Force-pull")
+		async          = step.concurrentOutput()
+		dryRun         = viper.GetBool("Dry-run")
+		forcePull      = viper.GetBool("Force-pull")
+		keepContainers = viper.GetString("Keep-containers")
 	)
 
 	var (
-		hostMountFilepath          = viper.GetString("WorkingDirectory")
-		containerDefaultWorkingDir = "/dunner"
-		hostMountTarget            = "/dunner"
+		hostMountFilepath          = step.hostDir()
+		containerDefaultWorkingDir = step.projectDir()
+		hostMountTarget            = step.projectDir()
 		defaultCommand             = []string{"tail", "-f", "/dev/null"}
 	)
 
-	ctx := context.Background()
-	cli, err := client.NewClientWithOpts(client.FromEnv)
+	var result = Result{}
+	start := time.Now()
+	defer func() { result.Duration = time.Since(start) }()
+
+	cli, err := NewClient(ctx)
 	if err != nil {
 		log.Fatal(err)
 	}
-	cli.NegotiateAPIVersion(ctx)
 
 	path, err := filepath.Abs(hostMountFilepath)
 	if err != nil {
 		log.Fatal(err)
 	}
-
-	check, err := CheckImageExist(ctx, cli, step.Image, false)
+	env, err := step.Environment()
 	if err != nil {
-		log.Fatal(err)
+		return &result, err
 	}
-	if forcePull || !check {
-		loadingMsg := fmt.Sprintf("Pulling image: '%s'", step.Image)
-		var done chan bool
-		if !async {
-			done = make(chan bool)
-			go util.ShowLoadingMessage(
-				loadingMsg,
-				fmt.Sprintf("Pulled image: '%s'", step.Image),
-				&done,
-				nil,
-			)
-		} else {
-			log.Info(loadingMsg)
-		}
-
-		out, err := cli.ImagePull(ctx, step.Image, types.ImagePullOptions{})
-		if err != nil {
-			log.Debug(err)
-			log.Infoln("Failed to fetch docker image from Docker Hub, checking in the host...")
-			if check, _ = CheckImageExist(ctx, cli, step.Image, true); !check {
-				return fmt.Errorf(`docker: failed to pull image %s: %s`, step.Image, err.Error())
-			}
-		}
-
-		if out != nil {
-			termFd, isTerm := term.GetFdInfo(os.Stdout)
-			if verbose {
-				if err = jsonmessage.DisplayJSONMessagesStream(out, os.Stdout, termFd, isTerm, nil); err != nil {
-					log.Fatal(err)
-				}
-			} else {
-				if err = jsonmessage.DisplayJSONMessagesStream(out, ioutil.Discard, termFd, isTerm, nil); err != nil {
-					log.Fatal(err)
-				}
-			}
-
-			if err = out.Close(); err != nil {
-				log.Fatal(err)
-			}
-		}
 
-		if !async {
-			done <- true
-		}
-		if err = out.Close(); err != nil {
-			log.Fatal(err)
+	if step.Build != nil {
+		if step.Image, err = step.buildImage(ctx, cli, forcePull || step.ForcePull); err != nil {
+			return &result, err
 		}
+	} else if err = step.pullImage(ctx, cli, forcePull || step.ForcePull); err != nil {
+		return &result, err
+	} else if err = step.verifyDigest(ctx, cli); err != nil {
+		return &result, err
 	}
 
 	var containerWorkingDir = containerDefaultWorkingDir
+	if step.SkipProjectMount {
+		containerWorkingDir = ""
+	}
 	if step.WorkDir != "" {
-		if step.WorkDir[0] == '/' {
-			containerWorkingDir = step.WorkDir
-		} else {
-			containerWorkingDir = filepath.Join(hostMountTarget, step.WorkDir)
+		containerWorkingDir = resolveWorkDir(step.WorkDir, hostMountTarget)
+		if step.CreateDir {
+			if err = createHostWorkDir(path, hostMountTarget, containerWorkingDir); err != nil {
+				return &result, err
+			}
 		}
 	}
 
-	resp, err := cli.ContainerCreate(
-		ctx,
-		&container.Config{
-			Image:      step.Image,
-			Cmd:        defaultCommand,
-			Env:        step.Env,
-			WorkingDir: containerWorkingDir,
-			User:       step.User,
-		},
-		&container.HostConfig{
-			Mounts: append(step.ExtMounts, mount.Mount{
-				Type:   mount.TypeBind,
-				Source: path,
-				Target: hostMountTarget,
-			}),
-			AutoRemove: true,
-		},
-		nil, "")
+	mounts := step.mounts(path, hostMountTarget)
+	cacheMounts, err := step.cacheMounts(ctx, cli)
 	if err != nil {
-		log.Fatal(err)
+		return &result, err
 	}
-
-	if len(resp.Warnings) > 0 {
-		for warning := range resp.Warnings {
-			log.Warn(warning)
+	mounts = append(mounts, cacheMounts...)
+	exposedPorts, portBindings, err := nat.ParsePortSpecs(step.Ports)
+	if err != nil {
+		return &result, fmt.Errorf("docker: invalid ports %v of step '%s': %s", step.Ports, step.Name, err.Error())
+	}
+	extraHosts, err := step.extraHosts(ctx, cli)
+	if err != nil {
+		return &result, err
+	}
+	deviceRequests, err := step.deviceRequests(cli)
+	if err != nil {
+		return &result, err
+	}
+	var groups []string
+	if step.MountDockerSock {
+		socket, group, err := step.dockerAccess()
+		if err != nil {
+			return &result, err
+		}
+		mounts = append(mounts, socket)
+		env = dockerAccessEnv(env)
+		if group != "" {
+			groups = append(groups, group)
 		}
 	}
-
-	if err = cli.ContainerStart(ctx, resp.ID, types.ContainerStartOptions{}); err != nil {
-		log.Fatal(err)
+	containerConfig := &container.Config{
+		Image:        step.Image,
+		Entrypoint:   step.Entrypoint,
+		Cmd:          defaultCommand,
+		Env:          env,
+		WorkingDir:   containerWorkingDir,
+		User:         step.User,
+		Labels:       step.labels(),
+		ExposedPorts: exposedPorts,
+		Tty:          step.TTY,
+	}
+	// An init process forwards signals to the commands of the step, which `tail` run as PID 1 would ignore
+	useInit := true
+	hostConfig := &container.HostConfig{
+		Init:         &useInit,
+		Mounts:       mounts,
+		NetworkMode:  container.NetworkMode(step.Network),
+		PortBindings: portBindings,
+		ExtraHosts:   extraHosts,
+		GroupAdd:     groups,
+		Privileged:   step.Privileged,
+		CapAdd:       step.CapAdd,
+		CapDrop:      step.CapDrop,
+		Resources: container.Resources{
+			Memory:         step.Memory,
+			NanoCPUs:       step.NanoCPUs,
+			DeviceRequests: deviceRequests,
+		},
 	}
-	defer func() {
-		dur, err := time.ParseDuration("-1ns") // Negative duration means no force termination
+
+	var containerID string
+	var execConfig types.ExecConfig
+	if step.Shared != nil {
+		containerID, err = step.Shared.container(cli, step, func() (string, error) {
+			return step.startContainer(ctx, cli, containerConfig, hostConfig)
+		})
+		result.ContainerID = containerID
 		if err != nil {
-			log.Fatal(err)
+			return &result, err
 		}
-		if err = cli.ContainerStop(ctx, resp.ID, &dur); err != nil {
-			log.Fatal(err)
+		// The container has the settings of the step that started it
+		execConfig = types.ExecConfig{Env: env, WorkingDir: containerWorkingDir, User: step.User}
+	} else if !step.ContainerPerCommand {
+		containerID, err = step.startContainer(ctx, cli, containerConfig, hostConfig)
+		if containerID != "" {
+			result.ContainerID = containerID
+			defer func() { step.releaseContainer(cli, containerID, keepContainers, err != nil) }()
 		}
-	}()
+		if err != nil {
+			return &result, err
+		}
+	}
+
+	outputFile, closeOutputFile, err := step.OpenOutputFile()
+	if err != nil {
+		return &result, err
+	}
+	defer closeOutputFile()
 
 	commands := step.Commands
 	if len(commands) == 0 {
@@ -198,64 +381,502 @@ func (step Step) Exec() error {
 		}
 
 		if !async {
-			log.Infof(
-				"Running command '%s' of '%s' task on a container of '%s' image",
+			step.logger().Infof(
+				"Running command '%s' of step '%s' of '%s' task on a container of '%s' image",
 				strings.Join(cmd, " "),
+				step.Name,
 				step.Task,
 				step.Image,
 			)
 		}
 
-		r, err := runCmd(ctx, cli, resp.ID, cmd)
-
-		if async {
-			if async {
-				log.Infof(
-					"Finished running command '%s' on '%s' docker",
-					strings.Join(cmd, " "),
-					step.Image,
-				)
-			}
-			if r != nil && r.Output != "" {
-				fmt.Printf(`OUT: %s`, r.Output)
+		var r *Result
+		prefix := step.OutputPrefix()
+		if step.ContainerPerCommand {
+			r, err = step.runContainer(ctx, cli, containerConfig, hostConfig, cmd, keepContainers, prefix, outputFile)
+		} else if step.Interactive {
+			r, err = runInteractive(ctx, cli, containerID, execConfig, cmd, outputFile)
+		} else {
+			r, err = runCmd(ctx, cli, containerID, execConfig, cmd, step.TTY, step.concurrentOutput(), prefix, outputFile, events.NewLogs(step.Task, step.Name))
+		}
+		if err != nil {
+			if platformErr := step.platformError(ctx, cli, err); platformErr != nil {
+				err = platformErr
 			}
-			if r != nil && r.Error != "" {
-				logger.ErrorOutput(`ERR: %s`, r.Error)
+		}
+		if r != nil {
+			result.ExitCode = r.ExitCode
+			result.ExitCodes = append(result.ExitCodes, r.ExitCode)
+			result.Output += r.Output
+			result.Error += r.Error
+			if r.ContainerID != "" {
+				result.ContainerID = r.ContainerID
 			}
 		}
+
+		if async {
+			step.logger().Infof(
+				"Finished running command '%s' of step '%s' of '%s' task on '%s' docker",
+				strings.Join(cmd, " "),
+				step.Name,
+				step.Task,
+				step.Image,
+			)
+		}
 		if err != nil {
+			return &result, err
+		}
+	}
+	return &result, nil
+}
+
+// startContainer creates and starts a container of the step with the given configuration, returning its ID. The
+// container is tracked so that it is stopped if dunner is interrupted. The ID is returned even if the container
+// fails to start, so that it can be released.
+func (step Step) startContainer(ctx context.Context, cli *client.Client, config *container.Config, hostConfig *container.HostConfig) (string, error) {
+	resp, err := step.createContainer(ctx, cli, config, hostConfig)
+	if err != nil {
+		if step.Network != "" && client.IsErrNotFound(err) && strings.Contains(err.Error(), "network") {
+			return "", fmt.Errorf(
+				"docker: network '%s' of step '%s' does not exist. Create it with `docker network create %s`, "+
+					"or use one of host, none, bridge", step.Network, step.Name, step.Network)
+		}
+		if limitsErr := step.limitsError(err); limitsErr != nil {
+			return "", limitsErr
+		}
+		if m := offendingMount(err, hostConfig.Mounts); m != nil {
+			return "", fmt.Errorf("docker: failed to mount '%s:%s' on container of image %s: %s", m.Source, m.Target, step.Image, err.Error())
+		}
+		return "", fmt.Errorf("docker: failed to create container of image %s: %s", step.Image, err.Error())
+	}
+
+	trackContainer(resp.ID, step.StopTimeout)
+	for _, warning := range resp.Warnings {
+		step.logger().Warnf("Step '%s' of '%s' task: %s", step.Name, step.Task, warning)
+	}
+
+	err = retryRequest(ctx, step.logger(), fmt.Sprintf("start container of step '%s'", step.Name), func() error {
+		return cli.ContainerStart(ctx, resp.ID, types.ContainerStartOptions{})
+	})
+	if err != nil {
+		if limitsErr := step.limitsError(err); limitsErr != nil {
+			return resp.ID, limitsErr
+		}
+		if platformErr := step.platformError(ctx, cli, err); platformErr != nil {
+			return resp.ID, platformErr
+		}
+		if step.GPUs != nil && isGPUUnsupported(err) {
+			return resp.ID, fmt.Errorf("docker: step '%s' of '%s' task requests GPUs but the daemon does not support "+
+				"GPU requests, install the NVIDIA container toolkit on the host: %s", step.Name, step.Task, err.Error())
+		}
+		if len(step.Ports) != 0 && isPortInUse(err) {
+			return resp.ID, fmt.Errorf(
+				"docker: failed to publish ports %s of step '%s' of '%s' task, a port is already in use: %s",
+				strings.Join(step.Ports, ", "), step.Name, step.Task, err.Error())
+		}
+		if step.WorkDir != "" && !step.CreateDir {
+			return resp.ID, fmt.Errorf(
+				"docker: failed to start container of image %s: %s. Check that the directory '%s' given as `dir` of "+
+					"the step exists, or set `create_dir: true` to create it", step.Image, err.Error(), config.WorkingDir)
+		}
+		return resp.ID, fmt.Errorf("docker: failed to start container of image %s: %s", step.Image, err.Error())
+	}
+	return resp.ID, nil
+}
+
+// releaseContainer removes the container once the step is done with it, unless it is to be kept for debugging
+// according to `keepContainers`. The container is killed at once, unless the run is interrupted and its commands
+// may still be running, which are then given the stop timeout to stop gracefully.
+func (step Step) releaseContainer(cli *client.Client, id string, keepContainers string, failed bool) {
+	if keepContainers == KeepAllContainers || (keepContainers == KeepFailedContainers && failed) {
+		untrackContainer(id)
+		step.logger().Infof(
+			"Container %s of step '%s' of '%s' task is kept for debugging. Inspect it with `docker exec -it %s sh`, "+
+				"or save its state with `docker commit %s`",
+			id, step.Name, step.Task, id, id,
+		)
+		return
+	}
+	if runCtx.Err() != nil {
+		removeContainer(cli, id)
+		return
+	}
+	discardContainer(cli, id)
+}
+
+// runContainer runs the command as the command of a new container, for steps running each command on its own
+// container. The output of the container is streamed until it exits.
+func (step Step) runContainer(
+	ctx context.Context,
+	cli *client.Client,
+	config *container.Config,
+	hostConfig *container.HostConfig,
+	command []string,
+	keepContainers string,
+	prefix string,
+	tee io.Writer,
+) (_ *Result, err error) {
+	if len(command) == 0 {
+		return nil, fmt.Errorf(`config: Command cannot be empty`)
+	}
+
+	cmdConfig := *config
+	cmdConfig.Cmd = command
+	id, err := step.startContainer(ctx, cli, &cmdConfig, hostConfig)
+	if id != "" {
+		defer func() { step.releaseContainer(cli, id, keepContainers, err != nil) }()
+	}
+	if err != nil {
+		return &Result{ContainerID: id}, err
+	}
+
+	if step.TTY {
+		defer followTerminalSize(ctx, os.Stdout, cli.ContainerResize, id)()
+	}
+	var logs io.ReadCloser
+	err = retryRequest(ctx, step.logger(), fmt.Sprintf("attach to logs of container of step '%s'", step.Name), func() (err error) {
+		logs, err = cli.ContainerLogs(ctx, id, types.ContainerLogsOptions{ShowStdout: true, ShowStderr: true, Follow: true})
+		return err
+	})
+	if err != nil {
+		return &Result{ContainerID: id}, err
+	}
+	defer logs.Close()
+	limit := NewOutputLimit()
+	defer func() { limit.Finish(err != nil) }()
+	result, err := extractResult(logs, step.TTY, step.concurrentOutput(), prefix, tee, limit, events.NewLogs(step.Task, step.Name))
+	result.ContainerID = id
+	if err != nil {
+		return result, err
+	}
+
+	err = retryRequest(ctx, step.logger(), fmt.Sprintf("wait for container of step '%s'", step.Name), func() error {
+		statusCh, errCh := cli.ContainerWait(ctx, id, container.WaitConditionNotRunning)
+		select {
+		case err := <-errCh:
+			return err
+		case status := <-statusCh:
+			result.ExitCode = int(status.StatusCode)
+			return nil
+		}
+	})
+	if err != nil {
+		return result, err
+	}
+	if result.ExitCode != 0 {
+		return result, fmt.Errorf("docker: command execution failed with exit code %d", result.ExitCode)
+	}
+	return result, nil
+}
+
+// hostDir returns the project directory on the host mounted on the container
+func (step Step) hostDir() string {
+	if step.HostDir == "" {
+		return viper.GetString("WorkingDirectory")
+	}
+	return step.HostDir
+}
+
+// projectDir returns the directory of the container the project directory is mounted on
+func (step Step) projectDir() string {
+	if step.ProjectDir == "" {
+		return DefaultProjectDir
+	}
+	return path.Clean(step.ProjectDir)
+}
+
+// mounts returns the mounts of the container, the directories mounted by the user along with the project directory
+// mounted on `mountTarget`. If the user mounts a directory on `mountTarget` itself, it replaces the project directory.
+// The git metadata of the project is mounted read-only or hidden, unless `Mount-git` setting includes it writable or
+// the user mounts it.
+func (step Step) mounts(hostMountPath string, mountTarget string) []mount.Mount {
+	mounts := append([]mount.Mount{}, step.ExtMounts...)
+	if step.SkipProjectMount {
+		return mounts
+	}
+	gitMount := gitMount(hostMountPath, mountTarget)
+	for _, m := range step.ExtMounts {
+		if path.Clean(m.Target) == mountTarget {
+			return mounts
+		}
+		if gitMount != nil && path.Clean(m.Target) == gitMount.Target {
+			gitMount = nil
+		}
+	}
+	mounts = append(mounts, mount.Mount{
+		Type:   mount.TypeBind,
+		Source: hostMountPath,
+		Target: mountTarget,
+	})
+	if gitMount != nil {
+		mounts = append(mounts, *gitMount)
+	}
+	return mounts
+}
+
+// offendingMount returns the mount that the error of container creation refers to, if it is a mount error.
+// The longest matching source is taken, as sources may be nested in one another.
+func offendingMount(err error, mounts []mount.Mount) *mount.Mount {
+	if !strings.Contains(err.Error(), "mount") {
+		return nil
+	}
+	var offending *mount.Mount
+	for i := range mounts {
+		if strings.Contains(err.Error(), mounts[i].Source) && (offending == nil || len(mounts[i].Source) > len(offending.Source)) {
+			offending = &mounts[i]
+		}
+	}
+	return offending
+}
+
+// platformError returns an explicit error if the error is due to the image being for a platform the Docker host
+// cannot run, like an amd64 image on an arm64 host without emulation. It returns nil for any other error.
+func (step Step) platformError(ctx context.Context, cli *client.Client, err error) error {
+	if !strings.Contains(err.Error(), "exec format error") {
+		return nil
+	}
+	platform := step.Platform
+	if inspect, _, inspectErr := cli.ImageInspectWithRaw(ctx, step.Image); inspectErr == nil {
+		platform = inspect.Os + "/" + inspect.Architecture
+	}
+	return fmt.Errorf(
+		"docker: image %s of step '%s' is for platform %s, which the Docker host cannot run. Set `platform` of the "+
+			"step to a platform of the host, or install emulation of the platform on the host (QEMU with binfmt_misc): %s",
+		step.Image, step.Name, platform, err.Error())
+}
+
+// limitsError returns an error naming the step and its limits, if the error is due to the daemon rejecting the
+// memory or CPU limits of the step. It returns nil otherwise.
+func (step Step) limitsError(err error) error {
+	if step.Memory == 0 && step.NanoCPUs == 0 {
+		return nil
+	}
+	msg := strings.ToLower(err.Error())
+	for _, keyword := range []string{"memory", "cpu", "cgroup"} {
+		if strings.Contains(msg, keyword) {
+			return fmt.Errorf(
+				"docker: failed to apply limits of step '%s' (memory: %s, cpus: %g): %s",
+				step.Name, units.BytesSize(float64(step.Memory)), float64(step.NanoCPUs)/1e9, err.Error())
+		}
+	}
+	return nil
+}
+
+// isPortInUse returns true if the error is due to a host port to be published being used already
+func isPortInUse(err error) bool {
+	return strings.Contains(err.Error(), "port is already allocated") || strings.Contains(err.Error(), "address already in use")
+}
+
+// resolveWorkDir returns the working directory of the container for the `dir` of a step. Relative directories are
+// relative to the target where the project directory is mounted.
+func resolveWorkDir(workDir string, mountTarget string) string {
+	if strings.HasPrefix(workDir, "/") {
+		return path.Clean(workDir)
+	}
+	return path.Join(mountTarget, workDir)
+}
+
+// createHostWorkDir creates the working directory on the host, if it lies within the mounted project directory.
+// Other directories are created by Docker itself when the container starts.
+func createHostWorkDir(hostMountPath string, mountTarget string, workDir string) error {
+	rel, err := filepath.Rel(mountTarget, workDir)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, "../") {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Join(hostMountPath, rel), 0755); err != nil {
+		return fmt.Errorf("docker: failed to create directory '%s': %s", workDir, err.Error())
+	}
+	return nil
+}
+
+// pullImage pulls the image of the step, unless the exact image reference is already present on the host and
+// `force` is not set. If the image is present on the host, failing to reach the registry does not fail the step.
+// Images which were not on the host before are recorded, see PulledImages.
+func (step Step) pullImage(ctx context.Context, cli *client.Client, force bool) error {
+	var (
+		async   = step.concurrentOutput() || CaptureOutput()
+		verbose = viper.GetBool("Verbose")
+	)
+
+	if !force && imageExistsLocally(ctx, cli, step.Image, step.Platform) {
+		step.logger().Infof("Using cached image: '%s'", step.Image)
+		return nil
+	}
+	if step.BeforePull != nil {
+		step.BeforePull(step)
+	}
+	// Images on the host before, pulled again as forced or for another platform, are not recorded as pulled
+	preexisting := imageTagged(ctx, cli, step.Image)
+
+	loadingMsg := fmt.Sprintf("Pulling image: '%s'", step.Image)
+	progress := newPullProgress()
+	if !async && StdoutIsTerminal() {
+		done := make(chan bool)
+		go util.ShowLoadingProgress(
+			loadingMsg,
+			progress.String,
+			fmt.Sprintf("Pulled image: '%s'", step.Image),
+			&done,
+			nil,
+		)
+		defer func() { done <- true }()
+	} else {
+		step.logger().Info(loadingMsg)
+		done := make(chan struct{})
+		go step.logPullProgress(progress, done, pullProgressOutput(StdoutIsTerminal()))
+		defer close(done)
+	}
+
+	auth, registry, err := getRegistryAuth(step.Image)
+	if err != nil {
+		step.logger().Warn(err)
+	}
+
+	var out io.ReadCloser
+	err = retry(ctx, step.logger(), fmt.Sprintf("pull image %s", step.Image), func() (err error) {
+		out, err = cli.ImagePull(ctx, step.Image, types.ImagePullOptions{Platform: step.Platform, RegistryAuth: auth})
+		return err
+	})
+	if err != nil {
+		step.logger().Debug(err)
+		if isAuthError(err) {
+			if auth == "" {
+				return fmt.Errorf(`docker: failed to pull image %s: no credentials found for registry %s`, step.Image, registry)
+			}
+			return fmt.Errorf(`docker: failed to pull image %s: credentials for registry %s were rejected`, step.Image, registry)
+		}
+		if step.Platform != "" && strings.Contains(err.Error(), "no matching manifest") {
+			return fmt.Errorf(`docker: image %s is not available for platform %s`, step.Image, step.Platform)
+		}
+		step.logger().Infoln("Failed to fetch docker image from Docker Hub, checking in the host...")
+		if check, _ := CheckImageExist(ctx, cli, step.Image, true); !check {
+			return fmt.Errorf(`docker: failed to pull image %s: %s`, step.Image, err.Error())
+		}
+		return nil
+	}
+	defer out.Close()
+
+	if verbose {
+		termFd, isTerm := term.GetFdInfo(os.Stderr)
+		if err := jsonmessage.DisplayJSONMessagesStream(out, os.Stderr, termFd, isTerm, nil); err != nil {
 			return err
 		}
+		if !preexisting {
+			recordPulled(step.Image)
+		}
+		return nil
+	}
+	layers, size, err := summarizePull(out, progress)
+	if err != nil {
+		return err
 	}
+	if !preexisting {
+		recordPulled(step.Image)
+	}
+	step.logger().Infof("Pulled %d layers (%s) of image '%s'", layers, units.HumanSize(float64(size)), step.Image)
+	events.Emit(events.Event{Type: events.ImagePulled, Task: step.Task, Step: step.Name, Image: step.Image, Layers: layers, Size: size})
 	return nil
 }
 
-func runCmd(ctx context.Context, cli *client.Client, containerID string, command []string) (*Result, error) {
+// summarizePull reads the JSON progress messages of an image pull, adding them to `progress` as they come, and
+// returns the number of layers pulled and their total download size.
+func summarizePull(in io.Reader, progress *pullProgress) (int, int64, error) {
+	dec := json.NewDecoder(in)
+	for {
+		var msg jsonmessage.JSONMessage
+		if err := dec.Decode(&msg); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return progress.layers, 0, err
+		}
+		if msg.Error != nil {
+			return progress.layers, 0, msg.Error
+		}
+		progress.update(msg)
+	}
+	_, size := progress.downloaded()
+	return progress.layers, size, nil
+}
+
+// isAuthError checks if the error returned by the registry is due to missing or invalid credentials
+func isAuthError(err error) bool {
+	if client.IsErrUnauthorized(err) {
+		return true
+	}
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "unauthorized") || strings.Contains(msg, "authentication required") ||
+		strings.Contains(msg, "denied")
+}
+
+// imageExistsLocally checks whether the exact image reference is present on the host machine.
+// If a platform is given, the image present on the host must also be built for that platform.
+func imageExistsLocally(ctx context.Context, cli *client.Client, image string, platform string) bool {
+	inspect, _, err := cli.ImageInspectWithRaw(ctx, image)
+	if err != nil {
+		if !client.IsErrNotFound(err) {
+			log.Debug(err)
+		}
+		return false
+	}
+	if platform != "" {
+		p := strings.Split(platform, "/")
+		if inspect.Os != p[0] || (len(p) > 1 && inspect.Architecture != p[1]) {
+			log.Debugf("docker: image '%s' on the host is for platform %s/%s", image, inspect.Os, inspect.Architecture)
+			return false
+		}
+	}
+	return true
+}
+
+func runCmd(
+	ctx context.Context,
+	cli *client.Client,
+	containerID string,
+	execConfig types.ExecConfig,
+	command []string,
+	tty bool,
+	concurrent bool,
+	prefix string,
+	tee io.Writer,
+	logs *events.Logs,
+) (result *Result, err error) {
 	if len(command) == 0 {
 		return nil, fmt.Errorf(`config: Command cannot be empty`)
 	}
 
-	exec, err := cli.ContainerExecCreate(ctx, containerID, types.ExecConfig{
-		Cmd:          command,
-		AttachStdout: true,
-		AttachStderr: true,
-	})
+	execConfig.Cmd = command
+	execConfig.AttachStdout, execConfig.AttachStderr, execConfig.Tty = true, true, tty
+	exec, err := cli.ContainerExecCreate(ctx, containerID, execConfig)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
-	resp, err := cli.ContainerExecAttach(ctx, exec.ID, types.ExecStartCheck{})
+	resp, err := cli.ContainerExecAttach(ctx, exec.ID, types.ExecStartCheck{Tty: tty})
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 	defer resp.Close()
+	defer closeOnCancel(ctx, resp.Conn)()
+	if tty {
+		defer followTerminalSize(ctx, os.Stdout, cli.ContainerExecResize, exec.ID)()
+	}
 
-	result := ExtractResult(resp.Reader, command)
+	limit := NewOutputLimit()
+	defer func() { limit.Finish(err != nil) }()
+	result, err = extractResult(resp.Reader, tty, concurrent, prefix, tee, limit, logs)
+	if ctx.Err() != nil {
+		return result, ctx.Err()
+	}
+	if err != nil {
+		return result, err
+	}
 
 	info, err := cli.ContainerExecInspect(ctx, exec.ID)
 	if err != nil {
-		log.Fatal(err)
+		return result, err
 	}
+	result.ExitCode = info.ExitCode
 	if info.ExitCode != 0 {
 		return result, fmt.Errorf("docker: command execution failed with exit code %d", info.ExitCode)
 	}
@@ -263,25 +884,117 @@ func runCmd(ctx context.Context, cli *client.Client, containerID string, command
 	return result, nil
 }
 
-// ExtractResult can parse output and/or error corresponding to the command passed as an argument,
-// from an io.Reader and convert to an object of strings.
-func ExtractResult(reader io.Reader, command []string) *Result {
-	if viper.GetBool("Async") {
+// closeOnCancel closes the connection once ctx is cancelled, as reads of hijacked connections are not cancelled with
+// the context of their request. The returned function is to be called once the connection is no longer read.
+func closeOnCancel(ctx context.Context, conn io.Closer) func() {
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+	return func() { close(done) }
+}
+
+// ExtractResult streams output and/or error of a command from an io.Reader as it is produced.
+// Every line is prefixed with `prefix` so that the output of steps can be told apart, and when output is concurrent
+// the output is also captured into an object of strings. When output is captured, it is only captured and not
+// displayed. Output and error are also written as they are, without prefix, to `tee`.
+func ExtractResult(reader io.Reader, prefix string, tee io.Writer) (*Result, error) {
+	return extractResult(reader, false, ConcurrentOutput(), prefix, tee, nil, nil)
+}
+
+// extractResult is ExtractResult for a stream of output and error multiplexed as Docker does, or for the output of
+// a terminal if `tty` is set, in which case all of it is treated as standard output. Output is treated as concurrent
+// if `concurrent` is set. The displayed output is limited by `limit`, which is to be finished once the command exits.
+// Captured output is emitted as `logs` events.
+func extractResult(reader io.Reader, tty bool, concurrent bool, prefix string, tee io.Writer, limit *OutputLimit, logs *events.Logs) (*Result, error) {
+	copyOutput := stdcopy.StdCopy
+	if tty {
+		copyOutput = func(stdout io.Writer, _ io.Writer, src io.Reader) (int64, error) {
+			return io.Copy(stdout, src)
+		}
+	}
+	if CaptureOutput() {
+		var out, errOut bytes.Buffer
+		_, err := copyOutput(io.MultiWriter(&out, logs.Stdout(), tee), io.MultiWriter(&errOut, logs.Stderr(), tee), reader)
+		logs.Flush()
+		return &Result{Output: out.String(), Error: errOut.String()}, err
+	}
+	if concurrent {
 		var out, errOut bytes.Buffer
-		if _, err := stdcopy.StdCopy(&out, &errOut, reader); err != nil {
-			log.Fatal(err)
+		outWriter := logger.NewPrefixWriter(limit.Wrap(os.Stdout), prefix)
+		errWriter := logger.NewPrefixWriter(limit.Wrap(os.Stderr), prefix)
+		_, err := copyOutput(io.MultiWriter(&out, outWriter, tee), io.MultiWriter(&errOut, errWriter, tee), reader)
+		if flushErr := outWriter.Flush(); err == nil {
+			err = flushErr
+		}
+		if flushErr := errWriter.Flush(); err == nil {
+			err = flushErr
 		}
 		var result = Result{
 			Output: out.String(),
 			Error:  errOut.String(),
 		}
-		return &result
+		return &result, err
 	}
 
-	if _, err := stdcopy.StdCopy(os.Stdout, logger.NewErrWriter(), reader); err != nil {
-		log.Fatal(err)
+	if prefix != "" || limit != nil {
+		outWriter := logger.NewPrefixWriter(limit.Wrap(os.Stdout), prefix)
+		errWriter := logger.NewErrPrefixWriter(limit.Wrap(os.Stderr), prefix)
+		_, err := copyOutput(io.MultiWriter(outWriter, tee), io.MultiWriter(errWriter, tee), reader)
+		if flushErr := outWriter.Flush(); err == nil {
+			err = flushErr
+		}
+		if flushErr := errWriter.Flush(); err == nil {
+			err = flushErr
+		}
+		return &Result{}, err
 	}
-	return nil
+
+	_, err := copyOutput(io.MultiWriter(os.Stdout, tee), io.MultiWriter(logger.NewErrWriter(), tee), reader)
+	return &Result{}, err
+}
+
+// OpenOutputFile creates the `OutputFile` and `LogFile` of the step along with their parent directories, and returns
+// a writer to both with a function to close them. The output is discarded if the step has neither. Failing to write a
+// file does not fail the step, it is logged as a warning when closing.
+func (step Step) OpenOutputFile() (io.Writer, func(), error) {
+	if viper.GetBool("Dry-run") {
+		return ioutil.Discard, func() {}, nil
+	}
+	var (
+		writers []io.Writer
+		closers []func()
+	)
+	closeAll := func() {
+		for _, close := range closers {
+			close()
+		}
+	}
+	for _, filename := range []string{step.OutputFile, step.LogFile} {
+		if filename == "" {
+			continue
+		}
+		file, err := logger.NewFileWriter(filename)
+		if err != nil {
+			closeAll()
+			return nil, nil, fmt.Errorf("dunner: failed to create output file of step '%s': %s", step.Name, err.Error())
+		}
+		filename := filename
+		writers = append(writers, file)
+		closers = append(closers, func() {
+			if err := file.Close(); err != nil {
+				step.logger().Warnf("Failed to save output of step '%s' of '%s' task to %s: %s", step.Name, step.Task, filename, err.Error())
+			}
+		})
+	}
+	if len(writers) == 0 {
+		return ioutil.Discard, func() {}, nil
+	}
+	return io.MultiWriter(writers...), closeAll, nil
 }
 
 // CheckImageExist checks for the image whether it is present on the host machine or not.
@@ -1,13 +1,25 @@
 package docker
 
 import (
+	"bytes"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
 	"testing"
+	"time"
 
 	"context"
 
+	"github.com/docker/docker/api/types/mount"
 	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/fatih/color"
 	"github.com/leopardslab/dunner/internal/settings"
+	G "github.com/leopardslab/dunner/pkg/global"
 	"github.com/spf13/viper"
 )
 
@@ -15,7 +27,7 @@ func TestExecWithInvalidImageName(t *testing.T) {
 	imageName := "^&^(^(*_invalid"
 	step := Step{Image: imageName}
 
-	err := step.Exec()
+	_, err := step.Exec(context.Background())
 
 	expectedErr := fmt.Sprintf("docker: failed to pull image %s: invalid reference format", imageName)
 	if err == nil || err.Error() != expectedErr {
@@ -35,7 +47,7 @@ func ExampleStep_Exec() {
 		Volumes:  nil,
 	}
 
-	err := step.Exec()
+	_, err := step.Exec(context.Background())
 	if err != nil {
 		panic(err)
 	}
@@ -63,6 +75,15 @@ func Example_workingDirRel() {
 	// Output: /dunner
 }
 
+func Example_workingDirUnset() {
+	var testNodeVersion = "10.15.0"
+	err := runCommand([]string{"pwd"}, "", testNodeVersion)
+	if err != nil {
+		panic(err)
+	}
+	// Output: /dunner
+}
+
 func runCommand(command []string, dir string, nodeVer string) error {
 	settings.Init()
 	step := &Step{
@@ -75,7 +96,8 @@ func runCommand(command []string, dir string, nodeVer string) error {
 		WorkDir: dir,
 	}
 
-	return step.Exec()
+	_, err := step.Exec(context.Background())
+	return err
 }
 
 func TestStep_execWithErr(t *testing.T) {
@@ -92,6 +114,30 @@ func TestStep_execWithErr(t *testing.T) {
 	}
 }
 
+func TestStepExecResultWithErr(t *testing.T) {
+	settings.Init()
+	step := &Step{
+		Task:    "test",
+		Image:   "node:10.15.0",
+		Command: []string{"ls", "/invalid_dir"},
+	}
+
+	result, err := step.Exec(context.Background())
+
+	if err == nil {
+		t.Fatalf("expected error, got none")
+	}
+	if result == nil {
+		t.Fatalf("expected result, got nil")
+	}
+	if result.ExitCode != 2 {
+		t.Errorf("expected exit code: 2, got: %d", result.ExitCode)
+	}
+	if result.ContainerID == "" {
+		t.Errorf("expected container ID to be set")
+	}
+}
+
 func TestStepExecSuccess(t *testing.T) {
 	var testNodeVersion = "10.15.0"
 
@@ -102,6 +148,74 @@ func TestStepExecSuccess(t *testing.T) {
 	}
 }
 
+func TestStepExecContainerPerCommand(t *testing.T) {
+	async := viper.GetBool("Async")
+	viper.Set("Async", true)
+	defer viper.Set("Async", async)
+
+	step := &Step{
+		Task:                "test",
+		Name:                "per-command",
+		Image:               "alpine",
+		Commands:            [][]string{{"touch", "/tmp/state"}, {"ls", "/tmp/state"}},
+		ContainerPerCommand: true,
+	}
+
+	result, err := step.Exec(context.Background())
+
+	expectedErr := "docker: command execution failed with exit code 1"
+	if err == nil || err.Error() != expectedErr {
+		t.Fatalf("expected error: %s, got: %v", expectedErr, err)
+	}
+	if !reflect.DeepEqual(result.ExitCodes, []int{0, 1}) {
+		t.Fatalf("expected state not to be shared between commands, got exit codes: %v", result.ExitCodes)
+	}
+}
+
+func TestStepExecPassesEnv(t *testing.T) {
+	async := viper.GetBool("Async")
+	viper.Set("Async", true)
+	defer viper.Set("Async", async)
+
+	envs := []string{"OPTS=--level=debug --name=x", "GREETING=hello world", "MULTILINE=line 1\nline 2"}
+	step := &Step{
+		Task:     "test",
+		Name:     "env",
+		Image:    "alpine",
+		Commands: [][]string{{"env"}},
+		Env:      envs,
+	}
+
+	result, err := step.Exec(context.Background())
+
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	for _, env := range envs {
+		if !strings.Contains(result.Output, env+"\n") {
+			t.Errorf("expected env '%s' in container, got: %s", env, result.Output)
+		}
+	}
+}
+
+func TestStepExecWithClearedEntrypoint(t *testing.T) {
+	settings.Init()
+	// The entrypoint of the image would run the command keeping the container alive as `docker-compose` arguments
+	step := &Step{
+		Task:       "test",
+		Name:       "compose",
+		Image:      "docker/compose:1.24.0",
+		Entrypoint: []string{},
+		Command:    []string{"docker-compose", "version"},
+	}
+
+	_, err := step.Exec(context.Background())
+
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+}
+
 func ExampleStep_execDryRun() {
 	dryRun := viper.GetBool("Dry-run")
 	viper.Set("Dry-run", true)
@@ -148,6 +262,19 @@ func TestCheckImageExist_invalid(t *testing.T) {
 	}
 }
 
+func TestImageExistsLocally_notPresent(t *testing.T) {
+	ctx := context.Background()
+	cli, err := client.NewClientWithOpts(client.FromEnv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cli.NegotiateAPIVersion(ctx)
+
+	if imageExistsLocally(ctx, cli, "random-image:nonexistent-tag", "") {
+		t.Fatal("Wrong identification, result is false positive")
+	}
+}
+
 func checkImage(img string, notag bool) (bool, error) {
 	ctx := context.Background()
 	cli, err := client.NewClientWithOpts(client.FromEnv)
@@ -157,3 +284,357 @@ func checkImage(img string, notag bool) (bool, error) {
 	cli.NegotiateAPIVersion(ctx)
 	return CheckImageExist(ctx, cli, img, notag)
 }
+
+func TestTrackContainer(t *testing.T) {
+	trackContainer("foo", 0)
+	if _, ok := running.ids["foo"]; !ok {
+		t.Fatalf("expected container to be tracked")
+	}
+
+	untrackContainer("foo")
+	if _, ok := running.ids["foo"]; ok {
+		t.Fatalf("expected container to be untracked")
+	}
+}
+
+func TestRunningResources(t *testing.T) {
+	trackContainer("foo", 0)
+	defer untrackContainer("foo")
+	trackNetwork("bar")
+	defer untrackNetwork("bar")
+
+	ids, networks := runningResources()
+
+	if !reflect.DeepEqual(ids, []string{"foo"}) || !reflect.DeepEqual(networks, []string{"bar"}) {
+		t.Fatalf("expected container foo and network bar, got: %v, %v", ids, networks)
+	}
+}
+
+func TestStopTimeout(t *testing.T) {
+	defer viper.Set("Stop-timeout", viper.Get("Stop-timeout"))
+
+	viper.Set("Stop-timeout", "")
+	if timeout := stopTimeout(); timeout != defaultStopTimeout {
+		t.Errorf("expected default stop timeout %s, got: %s", defaultStopTimeout, timeout)
+	}
+
+	viper.Set("Stop-timeout", "1m")
+	if timeout := stopTimeout(); timeout != time.Minute {
+		t.Errorf("expected stop timeout 1m, got: %s", timeout)
+	}
+}
+
+func TestContainerStopTimeout(t *testing.T) {
+	defer viper.Set("Stop-timeout", viper.Get("Stop-timeout"))
+	viper.Set("Stop-timeout", "1m")
+	trackContainer("default", 0)
+	defer untrackContainer("default")
+	trackContainer("own", 5*time.Second)
+	defer untrackContainer("own")
+
+	if timeout := containerStopTimeout("default"); timeout != time.Minute {
+		t.Errorf("expected stop timeout of the run 1m, got: %s", timeout)
+	}
+	if timeout := containerStopTimeout("own"); timeout != 5*time.Second {
+		t.Errorf("expected own stop timeout 5s, got: %s", timeout)
+	}
+}
+
+func TestSummarizePull(t *testing.T) {
+	stream := `{"status":"Pulling from library/busybox","id":"latest"}
+{"status":"Downloading","progressDetail":{"current":100,"total":2000},"id":"a1"}
+{"status":"Downloading","progressDetail":{"current":1000,"total":2000},"id":"a1"}
+{"status":"Downloading","progressDetail":{"current":10,"total":500},"id":"b2"}
+{"status":"Pull complete","id":"a1"}
+{"status":"Pull complete","id":"b2"}
+{"status":"Status: Downloaded newer image for busybox:latest"}
+`
+
+	layers, size, err := summarizePull(strings.NewReader(stream), newPullProgress())
+
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if layers != 2 {
+		t.Errorf("expected 2 layers, got: %d", layers)
+	}
+	if size != 2500 {
+		t.Errorf("expected size 2500, got: %d", size)
+	}
+}
+
+func TestSummarizePullWithError(t *testing.T) {
+	stream := `{"errorDetail":{"message":"manifest unknown"},"error":"manifest unknown"}`
+
+	_, _, err := summarizePull(strings.NewReader(stream), newPullProgress())
+
+	if err == nil || err.Error() != "manifest unknown" {
+		t.Fatalf("expected error: manifest unknown, got: %s", err)
+	}
+}
+
+func TestExtractResultOfTerminal(t *testing.T) {
+	defer viper.Set("Summary-only", false)
+	viper.Set("Summary-only", true)
+	output := "\x1b[32mpassed\x1b[0m\r\n"
+	var tee bytes.Buffer
+
+	result, err := extractResult(strings.NewReader(output), true, false, "", &tee, nil, nil)
+
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if result.Output != output || result.Error != "" {
+		t.Errorf("expected output: %q and no error output, got: %q, %q", output, result.Output, result.Error)
+	}
+	if tee.String() != output {
+		t.Errorf("expected output to be written to tee: %q, got: %q", output, tee.String())
+	}
+}
+
+func TestExtractResultDemultiplexesStreams(t *testing.T) {
+	defer viper.Set("Summary-only", false)
+	viper.Set("Summary-only", true)
+	var output bytes.Buffer
+	stdcopy.NewStdWriter(&output, stdcopy.Stdout).Write([]byte("passed\n"))
+	stdcopy.NewStdWriter(&output, stdcopy.Stderr).Write([]byte("warning\n"))
+
+	result, err := extractResult(&output, false, false, "", ioutil.Discard, nil, nil)
+
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if result.Output != "passed\n" || result.Error != "warning\n" {
+		t.Errorf("expected output: %q and error output: %q, got: %q, %q", "passed\n", "warning\n", result.Output, result.Error)
+	}
+}
+
+func TestNewOutputLimit(t *testing.T) {
+	defer viper.Set("Max-log-lines", 0)
+
+	viper.Set("Max-log-lines", 0)
+	if limit := NewOutputLimit(); limit != nil {
+		t.Errorf("expected no limit, got: %v", limit)
+	}
+	var out bytes.Buffer
+	if w := NewOutputLimit().Wrap(&out); w != &out {
+		t.Errorf("expected output not to be limited")
+	}
+
+	viper.Set("Max-log-lines", 10)
+	if limit := NewOutputLimit(); limit == nil || limit.max != 10 {
+		t.Errorf("expected limit of 10 lines, got: %v", limit)
+	}
+
+	defer viper.Set("Summary-only", false)
+	viper.Set("Summary-only", true)
+	if limit := NewOutputLimit(); limit != nil {
+		t.Errorf("expected no limit of captured output, got: %v", limit)
+	}
+}
+
+func TestStepOutputPrefix(t *testing.T) {
+	defer viper.Set("Output-prefix", viper.GetString("Output-prefix"))
+	defer func(noColor bool) { color.NoColor = noColor }(color.NoColor)
+	color.NoColor = true
+	step := Step{Task: "build", Name: "test"}
+
+	viper.Set("Output-prefix", "[{task}/{step}] ")
+	if prefix := step.OutputPrefix(); prefix != "[build/test] " {
+		t.Errorf("expected prefix: %q, got: %q", "[build/test] ", prefix)
+	}
+
+	viper.Set("Output-prefix", "")
+	if prefix := step.OutputPrefix(); prefix != "" {
+		t.Errorf("expected no prefix, got: %q", prefix)
+	}
+}
+
+func TestStepLabels(t *testing.T) {
+	defer viper.Set("DunnerTaskFile", viper.GetString("DunnerTaskFile"))
+	viper.Set("DunnerTaskFile", "/project/.dunner.yaml")
+	step := Step{Task: "build", Name: "compile", Index: 2}
+
+	labels := step.labels()
+
+	expected := map[string]string{
+		LabelTask:      "build",
+		LabelStep:      "compile",
+		LabelStepIndex: "2",
+		LabelRunID:     RunID,
+		LabelVersion:   G.VERSION,
+		LabelTaskFile:  "41bea752c860",
+	}
+	if !reflect.DeepEqual(expected, labels) {
+		t.Fatalf("expected labels: %v, got: %v", expected, labels)
+	}
+}
+
+func TestNewRunID(t *testing.T) {
+	uuid := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	if !uuid.MatchString(RunID) {
+		t.Fatalf("expected run ID to be a UUID, got: %s", RunID)
+	}
+	if id := newRunID(); id == RunID || !uuid.MatchString(id) {
+		t.Fatalf("expected a new UUID, got: %s", id)
+	}
+}
+
+func TestStepProjectDir(t *testing.T) {
+	if dir := (Step{}).projectDir(); dir != DefaultProjectDir {
+		t.Errorf("expected default project directory %s, got: %s", DefaultProjectDir, dir)
+	}
+	if dir := (Step{ProjectDir: "/go/src/github.com/leopardslab/dunner/"}).projectDir(); dir != "/go/src/github.com/leopardslab/dunner" {
+		t.Errorf("expected project directory /go/src/github.com/leopardslab/dunner, got: %s", dir)
+	}
+}
+
+func TestResolveWorkDir(t *testing.T) {
+	cases := map[string]string{
+		"/usr/src/app": "/usr/src/app",
+		"/tmp/../opt/": "/opt",
+		"app":          "/dunner/app",
+		"./app/../web": "/dunner/web",
+		".":            "/dunner",
+	}
+	for workDir, expected := range cases {
+		if got := resolveWorkDir(workDir, "/dunner"); got != expected {
+			t.Errorf("expected working directory of '%s': %s, got: %s", workDir, expected, got)
+		}
+	}
+}
+
+func TestCreateHostWorkDir(t *testing.T) {
+	hostDir, err := ioutil.TempDir("", "dunner-workdir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(hostDir)
+
+	if err := createHostWorkDir(hostDir, "/dunner", "/dunner/build/out"); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(filepath.Join(hostDir, "build", "out")); err != nil || !info.IsDir() {
+		t.Fatalf("expected directory to be created in project directory, got: %v", err)
+	}
+
+	if err := createHostWorkDir(hostDir, "/dunner", "/opt/app"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(hostDir, "opt")); !os.IsNotExist(err) {
+		t.Fatalf("expected directory outside of mount target not to be created on host, got: %v", err)
+	}
+}
+
+func TestStepMounts(t *testing.T) {
+	step := Step{ExtMounts: []mount.Mount{{Type: mount.TypeBind, Source: "/tmp", Target: "/app", ReadOnly: true}}}
+
+	mounts := step.mounts("/project", "/dunner")
+
+	expected := []mount.Mount{
+		{Type: mount.TypeBind, Source: "/tmp", Target: "/app", ReadOnly: true},
+		{Type: mount.TypeBind, Source: "/project", Target: "/dunner"},
+	}
+	if !reflect.DeepEqual(mounts, expected) {
+		t.Fatalf("expected mounts: %v, got: %v", expected, mounts)
+	}
+}
+
+func TestStepMountsWithRemappedProjectDirectory(t *testing.T) {
+	step := Step{ExtMounts: []mount.Mount{{Type: mount.TypeBind, Source: "/src", Target: "/dunner/", ReadOnly: true}}}
+
+	mounts := step.mounts("/project", "/dunner")
+
+	if !reflect.DeepEqual(mounts, step.ExtMounts) {
+		t.Fatalf("expected only user mounts: %v, got: %v", step.ExtMounts, mounts)
+	}
+}
+
+func TestStepMountsWithoutProject(t *testing.T) {
+	step := Step{SkipProjectMount: true, ExtMounts: []mount.Mount{{Type: mount.TypeVolume, Source: "cache", Target: "/cache"}}}
+
+	mounts := step.mounts("/project", "/dunner")
+
+	if !reflect.DeepEqual(mounts, step.ExtMounts) {
+		t.Fatalf("expected only user mounts: %v, got: %v", step.ExtMounts, mounts)
+	}
+}
+
+func TestStepMountsWithGitMetadata(t *testing.T) {
+	project, err := ioutil.TempDir("", "dunner-git")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(project)
+	if err := os.Mkdir(filepath.Join(project, GitDir), 0755); err != nil {
+		t.Fatal(err)
+	}
+	defer viper.Set("Mount-git", viper.GetString("Mount-git"))
+	projectMount := mount.Mount{Type: mount.TypeBind, Source: project, Target: "/dunner"}
+
+	tests := []struct {
+		mode     string
+		step     Step
+		expected []mount.Mount
+	}{
+		{MountGitReadOnly, Step{}, []mount.Mount{
+			projectMount, {Type: mount.TypeBind, Source: filepath.Join(project, GitDir), Target: "/dunner/.git", ReadOnly: true},
+		}},
+		{MountGitNone, Step{}, []mount.Mount{projectMount, {Type: mount.TypeTmpfs, Target: "/dunner/.git"}}},
+		{MountGitWritable, Step{}, []mount.Mount{projectMount}},
+		{MountGitNone, Step{ExtMounts: []mount.Mount{{Type: mount.TypeBind, Source: "/git", Target: "/dunner/.git/"}}}, []mount.Mount{
+			{Type: mount.TypeBind, Source: "/git", Target: "/dunner/.git/"}, projectMount,
+		}},
+	}
+	for _, test := range tests {
+		viper.Set("Mount-git", test.mode)
+
+		mounts := test.step.mounts(project, "/dunner")
+
+		if !reflect.DeepEqual(mounts, test.expected) {
+			t.Errorf("expected mounts with '%s' git metadata: %v, got: %v", test.mode, test.expected, mounts)
+		}
+	}
+}
+
+func TestOffendingMount(t *testing.T) {
+	mounts := []mount.Mount{{Source: "/home/user", Target: "/home"}, {Source: "/home/user/missing", Target: "/data"}}
+	err := fmt.Errorf(`invalid mount config for type "bind": bind source path does not exist: /home/user/missing`)
+
+	if m := offendingMount(err, mounts); m == nil || m.Target != "/data" {
+		t.Fatalf("expected mount on /data to be offending, got: %v", m)
+	}
+	if m := offendingMount(fmt.Errorf("no such image: /home/user"), mounts); m != nil {
+		t.Fatalf("expected no offending mount for other errors, got: %v", m)
+	}
+}
+
+func TestIsPortInUse(t *testing.T) {
+	inUse := []error{
+		fmt.Errorf("driver failed programming external connectivity on endpoint x: Bind for 0.0.0.0:8080 failed: port is already allocated"),
+		fmt.Errorf("Error starting userland proxy: listen tcp 0.0.0.0:8080: bind: address already in use"),
+	}
+	for _, err := range inUse {
+		if !isPortInUse(err) {
+			t.Errorf("expected port to be in use for error: %s", err)
+		}
+	}
+	if isPortInUse(fmt.Errorf("no such container")) {
+		t.Errorf("expected port not to be in use for other errors")
+	}
+}
+
+func TestStepLimitsError(t *testing.T) {
+	step := Step{Name: "test", Memory: 512 * 1024 * 1024, NanoCPUs: 1500000000}
+	err := fmt.Errorf("Range of CPUs is from 0.01 to 1.00, as there are only 1 CPUs available")
+
+	limitsErr := step.limitsError(err)
+
+	expected := "docker: failed to apply limits of step 'test' (memory: 512MiB, cpus: 1.5): " + err.Error()
+	if limitsErr == nil || limitsErr.Error() != expected {
+		t.Fatalf("expected error: %s, got: %v", expected, limitsErr)
+	}
+	if (Step{Name: "test"}).limitsError(err) != nil {
+		t.Fatalf("expected no limits error for step without limits")
+	}
+}
@@ -0,0 +1,82 @@
+package docker
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// hostOnlyEnvs are the environment variables describing the host rather than the project, like its search path
+// or the home directory of its user, which would break the container if InheritEnv passed them. They are passed
+// only if named by PassEnv.
+var hostOnlyEnvs = map[string]struct{}{
+	"PATH":     {},
+	"HOME":     {},
+	"HOSTNAME": {},
+	"PWD":      {},
+	"OLDPWD":   {},
+	"SHLVL":    {},
+	"TMPDIR":   {},
+	"USER":     {},
+	"SHELL":    {},
+	"_":        {},
+}
+
+// Environment returns the environment variables of the step, its explicit variables followed by the variables of
+// the host named by PassEnv with their current values, then those inherited from the host with InheritEnv. Explicit
+// variables win over passed ones of the same name, which win over inherited ones. A passed variable not set on the
+// host is skipped, unless its name ends with `!`, in which case it is an error.
+func (step Step) Environment() ([]string, error) {
+	if len(step.PassEnv) == 0 && !step.InheritEnv {
+		return step.Env, nil
+	}
+
+	names := make(map[string]struct{})
+	for _, env := range step.Env {
+		names[strings.SplitN(env, "=", 2)[0]] = struct{}{}
+	}
+	host := make(map[string]string)
+	for _, env := range os.Environ() {
+		kv := strings.SplitN(env, "=", 2)
+		if len(kv) == 2 && kv[0] != "" {
+			host[kv[0]] = kv[1]
+		}
+	}
+
+	var passed []string
+	for _, pattern := range step.PassEnv {
+		required := strings.HasSuffix(pattern, "!")
+		pattern = strings.TrimSuffix(pattern, "!")
+		matched := false
+		for name, value := range host {
+			if ok, _ := path.Match(pattern, name); !ok {
+				continue
+			}
+			matched = true
+			if _, present := names[name]; !present {
+				names[name] = struct{}{}
+				passed = append(passed, name+"="+value)
+			}
+		}
+		if required && !matched {
+			return nil, fmt.Errorf("docker: environment variable '%s' passed to step '%s' of '%s' task is not set on the host", pattern, step.Name, step.Task)
+		}
+	}
+	sort.Strings(passed)
+
+	var inherited []string
+	if step.InheritEnv {
+		for name, value := range host {
+			if _, hostOnly := hostOnlyEnvs[name]; hostOnly {
+				continue
+			}
+			if _, present := names[name]; !present {
+				inherited = append(inherited, name+"="+value)
+			}
+		}
+		sort.Strings(inherited)
+	}
+	return append(append(append([]string{}, step.Env...), passed...), inherited...), nil
+}
@@ -0,0 +1,75 @@
+package docker
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestStepEnvironment(t *testing.T) {
+	for name, value := range map[string]string{"DUNNER_TEST_AWS_KEY": "key=with=equals", "DUNNER_TEST_AWS_REGION": "eu-west-1", "DUNNER_TEST_HOME": "/home/dunner"} {
+		os.Setenv(name, value)
+		defer os.Unsetenv(name)
+	}
+	step := Step{
+		Name:    "deploy",
+		Task:    "release",
+		Env:     []string{"DUNNER_TEST_AWS_REGION=us-east-1"},
+		PassEnv: []string{"DUNNER_TEST_AWS_*", "DUNNER_TEST_HOME!", "DUNNER_TEST_UNSET"},
+	}
+
+	env, err := step.Environment()
+
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	expected := []string{"DUNNER_TEST_AWS_REGION=us-east-1", "DUNNER_TEST_AWS_KEY=key=with=equals", "DUNNER_TEST_HOME=/home/dunner"}
+	if !reflect.DeepEqual(env, expected) {
+		t.Fatalf("expected environment: %v, got: %v", expected, env)
+	}
+}
+
+func TestStepEnvironmentWithMissingRequiredVariable(t *testing.T) {
+	os.Unsetenv("DUNNER_TEST_TOKEN")
+	step := Step{Name: "deploy", Task: "release", PassEnv: []string{"DUNNER_TEST_TOKEN!"}}
+
+	_, err := step.Environment()
+
+	expectedErr := "docker: environment variable 'DUNNER_TEST_TOKEN' passed to step 'deploy' of 'release' task is not set on the host"
+	if err == nil || err.Error() != expectedErr {
+		t.Fatalf("expected error: %s, got: %v", expectedErr, err)
+	}
+}
+
+func TestStepEnvironmentWithInheritEnv(t *testing.T) {
+	for name, value := range map[string]string{"DUNNER_TEST_REGION": "eu-west-1", "DUNNER_TEST_STAGE": "prod"} {
+		os.Setenv(name, value)
+		defer os.Unsetenv(name)
+	}
+	step := Step{Name: "deploy", Task: "release", Env: []string{"DUNNER_TEST_STAGE=dev"}, PassEnv: []string{"PATH"}, InheritEnv: true}
+
+	env, err := step.Environment()
+
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if env[0] != "DUNNER_TEST_STAGE=dev" || env[1] != "PATH="+os.Getenv("PATH") {
+		t.Fatalf("expected explicit then passed variables first, got: %v", env)
+	}
+	counts := make(map[string]int)
+	for _, e := range env {
+		counts[e]++
+	}
+	if counts["DUNNER_TEST_REGION=eu-west-1"] != 1 {
+		t.Errorf("expected DUNNER_TEST_REGION to be inherited, got: %v", env)
+	}
+	if counts["DUNNER_TEST_STAGE=prod"] != 0 {
+		t.Errorf("expected DUNNER_TEST_STAGE of the host to be overridden, got: %v", env)
+	}
+	if counts["PATH="+os.Getenv("PATH")] != 1 {
+		t.Errorf("expected PATH to be passed once, got: %v", env)
+	}
+	if counts["HOME="+os.Getenv("HOME")] != 0 && os.Getenv("HOME") != "" {
+		t.Errorf("expected HOME of the host not to be inherited, got: %v", env)
+	}
+}
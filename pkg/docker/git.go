@@ -0,0 +1,39 @@
+package docker
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/docker/docker/api/types/mount"
+	"github.com/spf13/viper"
+)
+
+// GitDir is the directory of the project holding the git metadata
+const GitDir = ".git"
+
+// Values of `Mount-git` setting, how the git metadata of the project is mounted on containers along with it
+const (
+	MountGitReadOnly = "ro"
+	MountGitWritable = "rw"
+	MountGitNone     = "none"
+)
+
+// gitMount returns the mount protecting the git metadata of the project mounted from `hostMountPath` on
+// `mountTarget`, read-only or hidden by an empty tmpfs as per `Mount-git` setting. It returns nil if the git
+// metadata is mounted writable, or if the project has no `.git` directory, like a worktree having a `.git` file.
+func gitMount(hostMountPath string, mountTarget string) *mount.Mount {
+	mode := viper.GetString("Mount-git")
+	if mode == MountGitWritable {
+		return nil
+	}
+	source := filepath.Join(hostMountPath, GitDir)
+	if info, err := os.Stat(source); err != nil || !info.IsDir() {
+		return nil
+	}
+	target := path.Join(mountTarget, GitDir)
+	if mode == MountGitNone {
+		return &mount.Mount{Type: mount.TypeTmpfs, Target: target}
+	}
+	return &mount.Mount{Type: mount.TypeBind, Source: source, Target: target, ReadOnly: true}
+}
@@ -0,0 +1,33 @@
+package docker
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/versions"
+	"github.com/docker/docker/client"
+)
+
+// minGPUAPIVersion is the first version of the Docker API supporting requests of devices like GPUs. Older daemons
+// ignore them, running the container without GPUs.
+const minGPUAPIVersion = "1.40"
+
+// deviceRequests returns the requests of devices of the container, the GPUs of the step if any. It fails if the
+// daemon is too old to honor them.
+func (step Step) deviceRequests(cli *client.Client) ([]container.DeviceRequest, error) {
+	if step.GPUs == nil {
+		return nil, nil
+	}
+	if version := cli.ClientVersion(); versions.LessThan(version, minGPUAPIVersion) {
+		return nil, fmt.Errorf("docker: step '%s' of '%s' task requests GPUs but the daemon does not support GPU "+
+			"requests, they need API version %s and the daemon supports %s", step.Name, step.Task, minGPUAPIVersion, version)
+	}
+	return []container.DeviceRequest{*step.GPUs}, nil
+}
+
+// isGPUUnsupported returns true if the container failed to start as the daemon has no driver for GPUs, like the
+// NVIDIA container runtime
+func isGPUUnsupported(err error) bool {
+	return strings.Contains(err.Error(), "could not select device driver")
+}
@@ -0,0 +1,43 @@
+package docker
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+)
+
+func TestStepDeviceRequests(t *testing.T) {
+	gpus := &container.DeviceRequest{Driver: "nvidia", Count: -1, Capabilities: [][]string{{"gpu"}}}
+	step := Step{Task: "ml", Name: "train", GPUs: gpus}
+
+	cli, err := client.NewClientWithOpts(client.WithVersion("1.40"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if requests, err := step.deviceRequests(cli); err != nil || !reflect.DeepEqual(requests, []container.DeviceRequest{*gpus}) {
+		t.Errorf("expected request of GPUs, got: %v (%v)", requests, err)
+	}
+
+	cli, err = client.NewClientWithOpts(client.WithVersion("1.39"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = step.deviceRequests(cli)
+	expectedErr := "docker: step 'train' of 'ml' task requests GPUs but the daemon does not support GPU requests, they need API version 1.40 and the daemon supports 1.39"
+	if err == nil || err.Error() != expectedErr {
+		t.Errorf("expected error: %s, got: %v", expectedErr, err)
+	}
+}
+
+func TestIsGPUUnsupported(t *testing.T) {
+	err := errors.New(`Error response from daemon: could not select device driver "nvidia" with capabilities: [[gpu]]`)
+	if !isGPUUnsupported(err) {
+		t.Errorf("expected missing GPU driver for: %s", err)
+	}
+	if isGPUUnsupported(errors.New("no such image")) {
+		t.Errorf("expected other errors not to be about GPUs")
+	}
+}
@@ -0,0 +1,55 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/versions"
+	"github.com/docker/docker/client"
+)
+
+// HostGateway is the IP of an extra host of a step standing for the IP of the host, to reach services running on it
+const HostGateway = "host-gateway"
+
+// hostGatewayAPIVersion is the first version of the Docker API whose daemon resolves HostGateway itself
+const hostGatewayAPIVersion = "1.41"
+
+// extraHosts returns the extra hosts of the step as `<name>:<ip>`. HostGateway is kept for daemons resolving it,
+// for older daemons it is replaced with the gateway of the default bridge network, which is the IP of the host.
+func (step Step) extraHosts(ctx context.Context, cli *client.Client) ([]string, error) {
+	usesGateway := false
+	for _, host := range step.ExtraHosts {
+		if strings.HasSuffix(host, ":"+HostGateway) {
+			usesGateway = true
+		}
+	}
+	if !usesGateway || !versions.LessThan(cli.ClientVersion(), hostGatewayAPIVersion) {
+		return step.ExtraHosts, nil
+	}
+
+	network, err := cli.NetworkInspect(ctx, "bridge", types.NetworkInspectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("docker: failed to find IP of the host for extra hosts of step '%s': %s", step.Name, err.Error())
+	}
+	var gateway string
+	for _, config := range network.IPAM.Config {
+		if config.Gateway != "" {
+			gateway = config.Gateway
+			break
+		}
+	}
+	if gateway == "" {
+		return nil, fmt.Errorf("docker: failed to find IP of the host for extra hosts of step '%s': bridge network has no gateway", step.Name)
+	}
+
+	hosts := make([]string, len(step.ExtraHosts))
+	for i, host := range step.ExtraHosts {
+		hosts[i] = strings.TrimSuffix(host, ":"+HostGateway)
+		if hosts[i] != host {
+			hosts[i] += ":" + gateway
+		}
+	}
+	return hosts, nil
+}
@@ -0,0 +1,99 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+)
+
+// pulledImages records the images pulled during the run which were not on the host before, to be removed once the
+// run ends with the `Rm-images` setting
+var pulledImages = struct {
+	sync.Mutex
+	images map[string]struct{}
+}{images: make(map[string]struct{})}
+
+// recordPulled records the image as pulled during the run
+func recordPulled(image string) {
+	pulledImages.Lock()
+	defer pulledImages.Unlock()
+	pulledImages.images[image] = struct{}{}
+}
+
+// PulledImages returns the images pulled during the run which were not on the host before, sorted
+func PulledImages() []string {
+	pulledImages.Lock()
+	defer pulledImages.Unlock()
+	images := make([]string, 0, len(pulledImages.images))
+	for image := range pulledImages.images {
+		images = append(images, image)
+	}
+	sort.Strings(images)
+	return images
+}
+
+// imageTagged returns true if the image reference is present on the host, for any platform
+func imageTagged(ctx context.Context, cli client.APIClient, image string) bool {
+	_, _, err := cli.ImageInspectWithRaw(ctx, image)
+	return err == nil
+}
+
+// RemoveImages removes the given images, along with their parent images left untagged, and returns how many were
+// deleted along with the disk space reclaimed. Images used by the containers kept from the run are skipped. Images
+// failing to be removed, like those used by other containers, are only warned about.
+func RemoveImages(ctx context.Context, cli client.APIClient, images []string) (int, int64) {
+	kept, err := cli.ContainerList(ctx, types.ContainerListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("label", fmt.Sprintf("%s=%s", LabelRunID, RunID))),
+	})
+	if err != nil {
+		log.Warnf("Not removing pulled images, as the containers kept from the run could not be listed: %s", err.Error())
+		return 0, 0
+	}
+
+	var removed int
+	var reclaimed int64
+	for _, image := range images {
+		inspect, _, err := cli.ImageInspectWithRaw(ctx, image)
+		if err != nil {
+			if !client.IsErrNotFound(err) {
+				log.Warnf("Failed to remove image '%s': %s", image, err.Error())
+			}
+			continue
+		}
+		if id := containerUsing(kept, image, inspect.ID); id != "" {
+			log.Infof("Keeping image '%s', as it is used by the kept container %.12s", image, id)
+			continue
+		}
+
+		deleted, err := cli.ImageRemove(ctx, image, types.ImageRemoveOptions{PruneChildren: true})
+		if err != nil {
+			log.Warnf("Failed to remove image '%s': %s", image, err.Error())
+			continue
+		}
+		// An image also tagged by another reference is only untagged, reclaiming no space
+		for _, item := range deleted {
+			if item.Deleted == inspect.ID {
+				removed++
+				reclaimed += inspect.Size
+				log.Debugf("Removed image '%s'", image)
+			}
+		}
+	}
+	return removed, reclaimed
+}
+
+// containerUsing returns the ID of the first of the containers running the image, given by reference and ID
+func containerUsing(containers []types.Container, image string, imageID string) string {
+	for _, c := range containers {
+		if c.Image == image || c.ImageID == imageID {
+			return c.ID
+		}
+	}
+	return ""
+}
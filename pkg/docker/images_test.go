@@ -0,0 +1,62 @@
+package docker
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+)
+
+func TestPulledImages(t *testing.T) {
+	defer func() { pulledImages.images = make(map[string]struct{}) }()
+
+	recordPulled("node:10")
+	recordPulled("alpine")
+	recordPulled("node:10")
+
+	expected := []string{"alpine", "node:10"}
+	if images := PulledImages(); !reflect.DeepEqual(images, expected) {
+		t.Fatalf("expected pulled images: %v, got: %v", expected, images)
+	}
+}
+
+func TestRemoveImages(t *testing.T) {
+	cli := &fakeClient{
+		containers: []types.Container{{ID: "kept", ImageID: "sha256:node"}},
+		images: map[string]types.ImageInspect{
+			"alpine":  {ID: "sha256:alpine", Size: 5 << 20},
+			"node:10": {ID: "sha256:node", Size: 300 << 20},
+			"golang":  {ID: "sha256:golang", Size: 800 << 20},
+		},
+	}
+
+	removed, reclaimed := RemoveImages(context.Background(), cli, []string{"alpine", "gone", "golang", "node:10"})
+
+	if removed != 2 || reclaimed != 805<<20 {
+		t.Fatalf("expected 2 images removed reclaiming %d bytes, got: %d reclaiming %d bytes", 805<<20, removed, reclaimed)
+	}
+	if expected := []string{"alpine", "golang"}; !reflect.DeepEqual(cli.removed, expected) {
+		t.Fatalf("expected removed images: %v, got: %v", expected, cli.removed)
+	}
+	if !cli.containerFilters.ExactMatch("label", LabelRunID+"="+RunID) {
+		t.Fatalf("expected containers to be filtered by run, got: %+v", cli.containerFilters)
+	}
+}
+
+func TestRemoveImagesWarnsOnFailure(t *testing.T) {
+	cli := &fakeClient{
+		images:    map[string]types.ImageInspect{"alpine": {ID: "sha256:alpine", Size: 5 << 20}},
+		removeErr: errors.New("image is being used by stopped container"),
+	}
+
+	removed, reclaimed := RemoveImages(context.Background(), cli, []string{"alpine"})
+
+	if removed != 0 || reclaimed != 0 {
+		t.Fatalf("expected no image removed, got: %d reclaiming %d bytes", removed, reclaimed)
+	}
+	if len(cli.removed) != 1 {
+		t.Fatalf("expected removal of image to be attempted, got: %v", cli.removed)
+	}
+}
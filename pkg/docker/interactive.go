@@ -0,0 +1,100 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/term"
+)
+
+// rawTerminal holds the state of the terminal of the host while it is in raw mode for an interactive command, so
+// that it can be restored if Dunner is interrupted
+var rawTerminal = struct {
+	sync.Mutex
+	fd    uintptr
+	state *term.State
+}{}
+
+// StdinIsTerminal returns true if the standard input of Dunner is a terminal, which interactive steps need
+func StdinIsTerminal() bool {
+	_, isTerm := term.GetFdInfo(os.Stdin)
+	return isTerm
+}
+
+// RestoreTerminal restores the terminal of the host if it was put in raw mode for an interactive command. It is
+// called when a run is interrupted, as deferred functions do not run then.
+func RestoreTerminal() {
+	rawTerminal.Lock()
+	defer rawTerminal.Unlock()
+	if rawTerminal.state == nil {
+		return
+	}
+	if err := term.RestoreTerminal(rawTerminal.fd, rawTerminal.state); err != nil {
+		log.Errorf("docker: failed to restore terminal: %s", err.Error())
+	}
+	rawTerminal.state = nil
+}
+
+// setRawTerminal puts the terminal of the host in raw mode, so that keys like Ctrl-C are sent to the command
+func setRawTerminal(fd uintptr) error {
+	state, err := term.SetRawTerminal(fd)
+	if err != nil {
+		return err
+	}
+	rawTerminal.Lock()
+	defer rawTerminal.Unlock()
+	rawTerminal.fd, rawTerminal.state = fd, state
+	return nil
+}
+
+// runInteractive runs the command on the container on a terminal, with the standard input of the host attached
+// to it. The terminal of the host is in raw mode while the command runs, and is restored once it exits.
+func runInteractive(ctx context.Context, cli *client.Client, containerID string, execConfig types.ExecConfig, command []string, tee io.Writer) (*Result, error) {
+	if len(command) == 0 {
+		return nil, fmt.Errorf(`config: Command cannot be empty`)
+	}
+
+	execConfig.Cmd = command
+	execConfig.AttachStdin, execConfig.AttachStdout, execConfig.AttachStderr, execConfig.Tty = true, true, true, true
+	exec, err := cli.ContainerExecCreate(ctx, containerID, execConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := cli.ContainerExecAttach(ctx, exec.ID, types.ExecStartCheck{Tty: true})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Close()
+
+	inFd, _ := term.GetFdInfo(os.Stdin)
+	if err := setRawTerminal(inFd); err != nil {
+		return nil, fmt.Errorf("docker: failed to set terminal in raw mode: %s", err.Error())
+	}
+	defer RestoreTerminal()
+	defer followTerminalSize(ctx, os.Stdin, cli.ContainerExecResize, exec.ID)()
+
+	go func() {
+		io.Copy(resp.Conn, os.Stdin)
+		resp.CloseWrite()
+	}()
+	// Output of a terminal is not multiplexed, standard output and error are read as one
+	if _, err := io.Copy(io.MultiWriter(os.Stdout, tee), resp.Reader); err != nil {
+		return &Result{}, err
+	}
+
+	info, err := cli.ContainerExecInspect(ctx, exec.ID)
+	if err != nil {
+		return &Result{}, err
+	}
+	result := &Result{ExitCode: info.ExitCode}
+	if info.ExitCode != 0 {
+		return result, fmt.Errorf("docker: command execution failed with exit code %d", info.ExitCode)
+	}
+	return result, nil
+}
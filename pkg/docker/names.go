@@ -0,0 +1,90 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+	"github.com/spf13/viper"
+)
+
+// maxNameSuffix is the largest suffix appended to the name of a container when the name is already in use
+const maxNameSuffix = 100
+
+// containerName returns the name of the containers of the step from the `Container-name` template, with {task},
+// {step} and {pid} replaced by the names of the task and step and the process ID of Dunner. Characters not allowed
+// in container names are replaced. Empty if no template is set, for Docker to generate a random name.
+func (step Step) containerName() string {
+	template := viper.GetString("Container-name")
+	if template == "" {
+		return ""
+	}
+	name := strings.NewReplacer("{task}", step.Task, "{step}", step.Name, "{pid}", strconv.Itoa(os.Getpid())).Replace(template)
+	return strings.TrimLeft(invalidNameChars.ReplaceAllString(name, "-"), "_.-")
+}
+
+// createContainer creates the container of the step, named from the `Container-name` template. If the name is
+// already in use, like by a kept container of an earlier command of the step, a suffix `-2`, `-3`... is appended.
+func (step Step) createContainer(ctx context.Context, cli *client.Client, config *container.Config, hostConfig *container.HostConfig) (container.ContainerCreateCreatedBody, error) {
+	template := step.containerName()
+	name := template
+	resp, err := step.createOnce(ctx, cli, config, hostConfig, name)
+	for suffix := 2; err != nil && name != "" && isNameConflict(err) && suffix <= maxNameSuffix; suffix++ {
+		name = fmt.Sprintf("%s-%d", template, suffix)
+		resp, err = step.createOnce(ctx, cli, config, hostConfig, name)
+	}
+	if err == nil && name != "" {
+		step.logger().Infof("Created container %s of step '%s' of '%s' task", name, step.Name, step.Task)
+	}
+	return resp, err
+}
+
+// createOnce creates the container of the step with the name, retrying on connection errors. The container is
+// labelled with a unique LabelCreateID, so that a container created by a request whose response was lost is found
+// and used instead of creating another one.
+func (step Step) createOnce(ctx context.Context, cli *client.Client, config *container.Config, hostConfig *container.HostConfig, name string) (container.ContainerCreateCreatedBody, error) {
+	labelled := *config
+	labelled.Labels = map[string]string{LabelCreateID: newRunID()}
+	for k, v := range config.Labels {
+		labelled.Labels[k] = v
+	}
+
+	var resp container.ContainerCreateCreatedBody
+	attempted := false
+	err := retryRequest(ctx, step.logger(), fmt.Sprintf("create container of step '%s'", step.Name), func() (err error) {
+		if attempted {
+			id, err := createdContainer(ctx, cli, labelled.Labels[LabelCreateID])
+			if err != nil || id != "" {
+				resp = container.ContainerCreateCreatedBody{ID: id}
+				return err
+			}
+		}
+		attempted = true
+		resp, err = cli.ContainerCreate(ctx, &labelled, hostConfig, nil, name)
+		return err
+	})
+	return resp, err
+}
+
+// createdContainer returns the ID of the container labelled with the create ID, or an empty ID if there is none
+func createdContainer(ctx context.Context, cli *client.Client, createID string) (string, error) {
+	containers, err := cli.ContainerList(ctx, types.ContainerListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("label", LabelCreateID+"="+createID)),
+	})
+	if err != nil || len(containers) == 0 {
+		return "", err
+	}
+	return containers[0].ID, nil
+}
+
+// isNameConflict returns true if the container could not be created as its name is used by another container
+func isNameConflict(err error) bool {
+	return strings.Contains(err.Error(), "is already in use")
+}
@@ -0,0 +1,38 @@
+package docker
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestStepContainerName(t *testing.T) {
+	defer viper.Set("Container-name", viper.GetString("Container-name"))
+	step := Step{Task: "build:web", Name: "npm install"}
+
+	for template, expected := range map[string]string{
+		"":                           "",
+		"dunner-{task}-{step}-{pid}": fmt.Sprintf("dunner-build-web-npm-install-%d", os.Getpid()),
+		"{step}":                     "npm-install",
+		"_{task}":                    "build-web",
+	} {
+		viper.Set("Container-name", template)
+		if name := step.containerName(); name != expected {
+			t.Errorf("%q: expected container name: %q, got: %q", template, expected, name)
+		}
+	}
+}
+
+func TestIsNameConflict(t *testing.T) {
+	err := errors.New(`Error response from daemon: Conflict. The container name "/dunner-build" is already in use by container "0123". You have to remove (or rename) that container to be able to reuse that name.`)
+
+	if !isNameConflict(err) {
+		t.Fatalf("expected name conflict for error: %s", err)
+	}
+	if isNameConflict(errors.New("Error response from daemon: No such image: busybox:latest")) {
+		t.Fatal("expected no name conflict for missing image")
+	}
+}
@@ -0,0 +1,94 @@
+package docker
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/pkg/jsonmessage"
+	units "github.com/docker/go-units"
+	"github.com/leopardslab/dunner/internal/logger"
+)
+
+// pullProgressInterval is the interval of the lines showing the progress of a pull when a spinner cannot be shown, as
+// the output is not a terminal or the output of steps is interleaved. It is replaced in tests
+var pullProgressInterval = 10 * time.Second
+
+// pullProgressOutput returns where the lines showing the progress of a pull are logged: along with the other logs on
+// a terminal, and to stderr otherwise, so that the output piped from stdout is kept free of them
+func pullProgressOutput(stdoutIsTerminal bool) io.Writer {
+	if stdoutIsTerminal {
+		return logger.Log.Out
+	}
+	return os.Stderr
+}
+
+// pullProgress aggregates the progress messages of the layers of an image pull. It is safe for concurrent use, so
+// that the progress is displayed while the pull goes on.
+type pullProgress struct {
+	sync.Mutex
+	current map[string]int64 // Bytes downloaded of each layer
+	total   map[string]int64 // Download size of each layer
+	layers  int              // Number of layers pulled
+}
+
+// newPullProgress returns a pointer to new pullProgress object with no layers downloaded
+func newPullProgress() *pullProgress {
+	return &pullProgress{current: make(map[string]int64), total: make(map[string]int64)}
+}
+
+// update adds the progress message of a layer to the progress of the pull
+func (p *pullProgress) update(msg jsonmessage.JSONMessage) {
+	p.Lock()
+	defer p.Unlock()
+	switch msg.Status {
+	case "Downloading":
+		if msg.Progress != nil {
+			p.current[msg.ID], p.total[msg.ID] = msg.Progress.Current, msg.Progress.Total
+		}
+	case "Download complete":
+		p.current[msg.ID] = p.total[msg.ID]
+	case "Pull complete":
+		p.layers++
+	}
+}
+
+// downloaded returns the bytes downloaded and the total download size of the layers whose download started
+func (p *pullProgress) downloaded() (current int64, total int64) {
+	p.Lock()
+	defer p.Unlock()
+	for id, size := range p.total {
+		current += p.current[id]
+		total += size
+	}
+	return current, total
+}
+
+// String returns the bytes downloaded out of the download size, with the percentage. Empty until a download starts.
+func (p *pullProgress) String() string {
+	current, total := p.downloaded()
+	if total == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%s / %s (%d%%)", units.HumanSize(float64(current)), units.HumanSize(float64(total)), current*100/total)
+}
+
+// logPullProgress logs the progress of the pull of the image of the step to out every pullProgressInterval, until
+// done is closed. Whole lines are logged, so that they do not interleave with the output of other steps.
+func (step Step) logPullProgress(progress *pullProgress, done <-chan struct{}, out io.Writer) {
+	progressLogger := logger.WithStepTo(out, step.Task, step.Name)
+	ticker := time.NewTicker(pullProgressInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if status := progress.String(); status != "" {
+				progressLogger.Infof("Pulling image '%s': %s downloaded", step.Image, status)
+			}
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package docker
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/pkg/jsonmessage"
+	"github.com/leopardslab/dunner/internal/logger"
+)
+
+func TestPullProgress(t *testing.T) {
+	progress := newPullProgress()
+	if status := progress.String(); status != "" {
+		t.Fatalf("expected no status before downloads start, got: %q", status)
+	}
+
+	for _, msg := range []jsonmessage.JSONMessage{
+		{ID: "a", Status: "Downloading", Progress: &jsonmessage.JSONProgress{Current: 100e6, Total: 400e6}},
+		{ID: "b", Status: "Downloading", Progress: &jsonmessage.JSONProgress{Current: 50e6, Total: 100e6}},
+		{ID: "b", Status: "Download complete"},
+		{ID: "b", Status: "Pull complete"},
+	} {
+		progress.update(msg)
+	}
+
+	if expected := "200MB / 500MB (40%)"; progress.String() != expected {
+		t.Fatalf("expected status: %q, got: %q", expected, progress.String())
+	}
+	if progress.layers != 1 {
+		t.Fatalf("expected 1 layer pulled, got: %d", progress.layers)
+	}
+}
+
+func TestPullProgressOutput(t *testing.T) {
+	if out := pullProgressOutput(true); out != logger.Log.Out {
+		t.Errorf("expected progress lines along with the logs on a terminal, got: %v", out)
+	}
+	if out := pullProgressOutput(false); out != os.Stderr {
+		t.Errorf("expected progress lines on stderr when stdout is not a terminal, got: %v", out)
+	}
+}
+
+// syncBuffer is a buffer safe for concurrent use
+type syncBuffer struct {
+	sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.Lock()
+	defer b.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.Lock()
+	defer b.Unlock()
+	return b.buf.String()
+}
+
+func TestLogPullProgress(t *testing.T) {
+	defer func(interval time.Duration) { pullProgressInterval = interval }(pullProgressInterval)
+	pullProgressInterval = 10 * time.Millisecond
+	var logs, out syncBuffer
+	defer logger.Log.SetOutput(logger.Log.Out)
+	logger.Log.SetOutput(&logs)
+	progress := newPullProgress()
+	progress.update(jsonmessage.JSONMessage{ID: "a", Status: "Downloading", Progress: &jsonmessage.JSONProgress{Current: 100e6, Total: 400e6}})
+	done := make(chan struct{})
+
+	go Step{Task: "build", Name: "compile", Image: "golang"}.logPullProgress(progress, done, &out)
+	time.Sleep(50 * time.Millisecond)
+	close(done)
+
+	if expected := "Pulling image 'golang': 100MB / 400MB (25%) downloaded"; !strings.Contains(out.String(), expected) {
+		t.Errorf("expected progress line: %q, got: %q", expected, out.String())
+	}
+	if logs.String() != "" {
+		t.Errorf("expected no progress line along with the logs, got: %q", logs.String())
+	}
+}
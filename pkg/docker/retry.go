@@ -0,0 +1,133 @@
+package docker
+
+import (
+	"context"
+	"io"
+	"math/rand"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/client"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// retryBaseDelay is the wait before the first retry of a failed request, doubled before each of the next retries
+var retryBaseDelay = time.Second
+
+// requestAttempts is how many times a request to the Docker daemon failing with a connection error is made, and
+// requestBackoffMax the longest wait between two attempts
+const (
+	requestAttempts   = 3
+	requestBackoffMax = 5 * time.Second
+)
+
+// connectionErrors are parts of the messages of errors of requests that did not reach the Docker daemon, or whose
+// response was lost, as when the daemon is under load
+var connectionErrors = []string{"eof", "connection reset", "connection refused", "broken pipe"}
+
+// transientErrors are parts of the messages of errors of requests to the Docker daemon or registries that may
+// succeed if made again
+var transientErrors = []string{
+	"500 internal server error", "502 bad gateway", "503 service unavailable", "504 gateway timeout",
+	"internal server error", "bad gateway", "service unavailable", "gateway timeout", "too many requests",
+	"timeout", "timed out", "connection reset", "connection refused", "no such host", "temporary failure",
+	"unexpected eof", "broken pipe", "network is unreachable",
+}
+
+// retry calls fn until it succeeds, at most `Pull-attempts` times. It waits between attempts for a delay doubling
+// each time, from retryBaseDelay up to `Pull-backoff-max`, with random jitter. Errors that are not transient, like
+// missing credentials or images, are returned right away. Each retry is logged with the attempt and the wait.
+func retry(ctx context.Context, logger *logrus.Entry, action string, fn func() error) error {
+	return retryOn(ctx, logger, action, viper.GetInt("Pull-attempts"), viper.GetDuration("Pull-backoff-max"), isTransient, fn)
+}
+
+// retryRequest calls fn, making a request to the Docker daemon, until it succeeds or fails with an error other than
+// a connection error, at most requestAttempts times. Errors reported by the daemon itself are returned right away,
+// so fn must only be safe to call again when the request may not have reached the daemon.
+func retryRequest(ctx context.Context, logger *logrus.Entry, action string, fn func() error) error {
+	return retryOn(ctx, logger, action, requestAttempts, requestBackoffMax, isConnectionError, fn)
+}
+
+// retryOn calls fn until it succeeds or fails with an error retryable does not accept, at most attempts times,
+// waiting between attempts for a backoff up to max
+func retryOn(ctx context.Context, logger *logrus.Entry, action string, attempts int, max time.Duration, retryable func(error) bool, fn func() error) error {
+	if attempts < 1 {
+		attempts = 1
+	}
+	err := fn()
+	for attempt := 2; attempt <= attempts && retryable(err); attempt++ {
+		wait := backoff(attempt-1, max)
+		logger.Warnf("Failed to %s: %s. Retrying in %s, attempt %d of %d", action, err.Error(), wait.Round(time.Millisecond), attempt, attempts)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+		err = fn()
+	}
+	return err
+}
+
+// backoff returns the wait before the given retry, doubling from retryBaseDelay up to max if positive. Half of the
+// wait is random, so that concurrent retries spread out.
+func backoff(retry int, max time.Duration) time.Duration {
+	delay := retryBaseDelay
+	for i := 1; i < retry && (max <= 0 || delay < max); i++ {
+		delay *= 2
+	}
+	if max > 0 && delay > max {
+		delay = max
+	}
+	half := delay / 2
+	if half <= 0 {
+		return delay
+	}
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// isTransient returns true if the request that failed with the error may succeed if made again, as for network
+// errors, timeouts and server errors. Errors due to credentials or to missing images or manifests are not transient.
+func isTransient(err error) bool {
+	if err == nil || err == context.Canceled {
+		return false
+	}
+	if isAuthError(err) || client.IsErrNotFound(err) {
+		return false
+	}
+	msg := strings.ToLower(err.Error())
+	if strings.Contains(msg, "manifest unknown") || strings.Contains(msg, "not found") || strings.Contains(msg, "no matching manifest") {
+		return false
+	}
+	if netErr, ok := err.(net.Error); ok && (netErr.Timeout() || netErr.Temporary()) {
+		return true
+	}
+	for _, transient := range transientErrors {
+		if strings.Contains(msg, transient) {
+			return true
+		}
+	}
+	return false
+}
+
+// isConnectionError returns true if the request failed as the connection to the Docker daemon was lost, rather than
+// with an error reported by the daemon, which is never a connection error
+func isConnectionError(err error) bool {
+	if err == nil || err == context.Canceled || err == context.DeadlineExceeded {
+		return false
+	}
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return true
+	}
+	msg := strings.ToLower(err.Error())
+	if strings.Contains(msg, "error response from daemon") {
+		return false
+	}
+	for _, connection := range connectionErrors {
+		if strings.Contains(msg, connection) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,126 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+	"github.com/leopardslab/dunner/internal/logger"
+	"github.com/spf13/viper"
+)
+
+func TestRetry(t *testing.T) {
+	defer func(delay time.Duration) { retryBaseDelay = delay }(retryBaseDelay)
+	retryBaseDelay = time.Millisecond
+	defer viper.Set("Pull-attempts", viper.GetInt("Pull-attempts"))
+	viper.Set("Pull-attempts", 3)
+
+	for _, tc := range []struct {
+		name     string
+		errs     []error
+		attempts int
+		err      string
+	}{
+		{name: "succeeds", errs: []error{nil}, attempts: 1},
+		{name: "succeeds after transient error", errs: []error{errors.New("received unexpected HTTP status: 503 Service Unavailable"), nil}, attempts: 2},
+		{name: "fails after all attempts", errs: []error{errors.New("net/http: TLS handshake timeout")}, attempts: 3, err: "net/http: TLS handshake timeout"},
+		{name: "fails on missing image", errs: []error{errors.New("manifest unknown: manifest unknown")}, attempts: 1, err: "manifest unknown: manifest unknown"},
+		{name: "fails on denied access", errs: []error{errors.New("unauthorized: authentication required")}, attempts: 1, err: "unauthorized: authentication required"},
+	} {
+		attempts := 0
+		err := retry(context.Background(), logger.WithStep("test", "pull"), "pull image busybox", func() error {
+			attempts++
+			if attempts <= len(tc.errs) {
+				return tc.errs[attempts-1]
+			}
+			return tc.errs[len(tc.errs)-1]
+		})
+
+		if attempts != tc.attempts {
+			t.Errorf("%s: expected %d attempts, got: %d", tc.name, tc.attempts, attempts)
+		}
+		if (err == nil && tc.err != "") || (err != nil && err.Error() != tc.err) {
+			t.Errorf("%s: expected error: %q, got: %v", tc.name, tc.err, err)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	defer func(delay time.Duration) { retryBaseDelay = delay }(retryBaseDelay)
+	retryBaseDelay = time.Second
+
+	for retry, max := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 10: 30 * time.Second} {
+		if wait := backoff(retry, 30*time.Second); wait < max/2 || wait > max {
+			t.Errorf("retry %d: expected wait between %s and %s, got: %s", retry, max/2, max, wait)
+		}
+	}
+}
+
+func TestIsConnectionError(t *testing.T) {
+	for err, expected := range map[error]bool{
+		nil:              false,
+		context.Canceled: false,
+		io.EOF:           true,
+		errors.New("Post http://docker/v1.40/containers/create: EOF"):                                               true,
+		errors.New("read unix @->/var/run/docker.sock: read: connection reset by peer"):                             true,
+		errors.New("Error response from daemon: conflict: unable to remove repository reference, connection reset"): false,
+		errors.New("Error response from daemon: No such image: busybox:latest"):                                     false,
+	} {
+		if actual := isConnectionError(err); actual != expected {
+			t.Errorf("expected isConnectionError(%v) to be %t", err, expected)
+		}
+	}
+}
+
+func TestCreateOnceFindsContainerOfLostResponse(t *testing.T) {
+	defer func(delay time.Duration) { retryBaseDelay = delay }(retryBaseDelay)
+	retryBaseDelay = time.Millisecond
+	var creates int32
+	var createID atomic.Value
+	daemon := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch apiVersionPrefix.ReplaceAllString(r.URL.Path, "") {
+		case "/containers/create":
+			atomic.AddInt32(&creates, 1)
+			var config container.Config
+			json.NewDecoder(r.Body).Decode(&config)
+			createID.Store(config.Labels[LabelCreateID])
+			// The container is created, but the response is lost
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+		case "/containers/json":
+			args, _ := filters.FromJSON(r.URL.Query().Get("filters"))
+			if id, _ := createID.Load().(string); id != "" && args.ExactMatch("label", LabelCreateID+"="+id) {
+				json.NewEncoder(w).Encode([]types.Container{{ID: "created"}})
+				return
+			}
+			json.NewEncoder(w).Encode([]types.Container{})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer daemon.Close()
+	cli, err := client.NewClientWithOpts(client.WithHost("tcp://"+daemon.Listener.Addr().String()), client.WithVersion("1.40"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	step := Step{Task: "test", Name: "build"}
+
+	resp, err := step.createOnce(context.Background(), cli, &container.Config{Image: "busybox", Labels: step.labels()}, &container.HostConfig{}, "")
+
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if resp.ID != "created" || creates != 1 {
+		t.Errorf("expected container created once to be found, got: %q after %d creates", resp.ID, creates)
+	}
+}
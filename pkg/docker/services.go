@@ -0,0 +1,224 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+	"github.com/docker/go-connections/nat"
+	"github.com/leopardslab/dunner/internal/logger"
+)
+
+// LabelService is the label set on the containers of services, with the name of the service
+const LabelService = "dunner.service"
+
+// healthcheckInterval is the time to wait between two runs of the healthcheck of a service
+const healthcheckInterval = time.Second
+
+// Service describes a container started before the steps of a task and running alongside them, reachable from the
+// steps with its name as hostname
+type Service struct {
+	Task          string        // The name of the task the service runs for
+	Name          string        // Name of the service, which is its hostname on the network of the task
+	Image         string        // Image the container of the service is created from
+	Env           []string      // The list of environment variables to be exported inside the container
+	Ports         []string      // Ports of the container published on the host
+	Healthcheck   []string      // Command run on the container until it succeeds, not run if empty
+	HealthTimeout time.Duration // Time to wait for the healthcheck to succeed
+	StopTimeout   time.Duration // Time given to the container to stop gracefully, the stop timeout of the run if 0
+}
+
+// StartServices creates a network for the task, isolating its containers from those of other tasks and runs, and
+// starts the containers of the services on it. It waits for the healthcheck of every service to succeed, reporting
+// the services that are not healthy in time. The returned function stops and removes the containers and the
+// network, it is to be called once the task ends, even if starting the services failed.
+func StartServices(task string, services []Service) (networkName string, stop func(), err error) {
+	ctx := runCtx
+	cli, err := NewClient(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var ids []string
+	networkName = fmt.Sprintf("dunner-%s-%s", invalidNameChars.ReplaceAllString(task, "-"), RunID)
+	stop = func() {
+		for _, id := range ids {
+			removeContainer(cli, id)
+		}
+		if err := cli.NetworkRemove(context.Background(), networkName); err != nil && !client.IsErrNotFound(err) {
+			log.Errorf("docker: failed to remove network %s: %s", networkName, err.Error())
+		}
+		untrackNetwork(networkName)
+	}
+
+	if err = createNetwork(ctx, cli, networkName, task); err != nil {
+		return "", func() {}, fmt.Errorf("docker: failed to create network of '%s' task: %s", task, err.Error())
+	}
+	trackNetwork(networkName)
+
+	for _, service := range services {
+		id, err := service.start(ctx, cli, networkName)
+		if id != "" {
+			ids = append(ids, id)
+		}
+		if err != nil {
+			return networkName, stop, err
+		}
+	}
+	for i, service := range services {
+		if err := service.waitHealthy(ctx, cli, ids[i]); err != nil {
+			return networkName, stop, err
+		}
+	}
+	return networkName, stop, nil
+}
+
+// createNetwork creates the network of the task. A network of the same name left by a run that crashed is removed
+// and created again, or reused if containers are still connected to it. A network of the same name not created by
+// Dunner is an error.
+func createNetwork(ctx context.Context, cli *client.Client, networkName string, task string) error {
+	create := func() error {
+		_, err := cli.NetworkCreate(ctx, networkName, types.NetworkCreate{
+			CheckDuplicate: true,
+			Labels:         networkLabels(task),
+		})
+		return err
+	}
+	err := create()
+	if err == nil || !strings.Contains(err.Error(), "already exists") {
+		return err
+	}
+
+	existing, inspectErr := cli.NetworkInspect(ctx, networkName, types.NetworkInspectOptions{})
+	if inspectErr != nil {
+		return err
+	}
+	if existing.Labels[LabelTask] != task {
+		return fmt.Errorf("network %s already exists and was not created by Dunner for this task", networkName)
+	}
+	if len(existing.Containers) != 0 {
+		log.Warnf("Reusing network %s left by an earlier run, as containers are still connected to it", networkName)
+		return nil
+	}
+	log.Warnf("Removing network %s left by an earlier run", networkName)
+	if err := cli.NetworkRemove(ctx, existing.ID); err != nil && !client.IsErrNotFound(err) {
+		return err
+	}
+	return create()
+}
+
+// labels returns the labels identifying the container of the service
+func (service Service) labels() map[string]string {
+	labels := runLabels()
+	labels[LabelTask] = service.Task
+	labels[LabelService] = service.Name
+	return labels
+}
+
+// networkLabels returns the labels identifying the network of the services of the task
+func networkLabels(task string) map[string]string {
+	labels := runLabels()
+	labels[LabelTask] = task
+	return labels
+}
+
+// start pulls the image of the service and starts its container on the network, returning the container ID
+func (service Service) start(ctx context.Context, cli *client.Client, networkName string) (string, error) {
+	step := Step{Task: service.Task, Name: service.Name, Image: service.Image}
+	if err := step.pullImage(ctx, cli, false); err != nil {
+		return "", err
+	}
+
+	exposedPorts, portBindings, err := nat.ParsePortSpecs(service.Ports)
+	if err != nil {
+		return "", fmt.Errorf("docker: invalid ports %v of service '%s': %s", service.Ports, service.Name, err.Error())
+	}
+	resp, err := cli.ContainerCreate(
+		ctx,
+		&container.Config{
+			Image:        service.Image,
+			Env:          service.Env,
+			ExposedPorts: exposedPorts,
+			Labels:       service.labels(),
+		},
+		&container.HostConfig{
+			NetworkMode:  container.NetworkMode(networkName),
+			PortBindings: portBindings,
+		},
+		&network.NetworkingConfig{
+			EndpointsConfig: map[string]*network.EndpointSettings{
+				networkName: {Aliases: []string{service.Name}},
+			},
+		},
+		"")
+	if err != nil {
+		return "", fmt.Errorf("docker: failed to create container of service '%s' of '%s' task: %s", service.Name, service.Task, err.Error())
+	}
+	trackContainer(resp.ID, service.StopTimeout)
+
+	logger.WithTask(service.Task).Infof("Starting service '%s' of '%s' task from '%s' image", service.Name, service.Task, service.Image)
+	if err = cli.ContainerStart(ctx, resp.ID, types.ContainerStartOptions{}); err != nil {
+		return resp.ID, fmt.Errorf("docker: failed to start service '%s' of '%s' task: %s", service.Name, service.Task, err.Error())
+	}
+	return resp.ID, nil
+}
+
+// waitHealthy runs the healthcheck of the service on its container until it succeeds, the timeout of the service
+// expires or ctx is cancelled. Services without healthcheck are not waited for.
+func (service Service) waitHealthy(ctx context.Context, cli *client.Client, containerID string) error {
+	if len(service.Healthcheck) == 0 {
+		return nil
+	}
+
+	logger.WithTask(service.Task).Infof("Waiting for service '%s' of '%s' task to be healthy", service.Name, service.Task)
+	deadline := time.Now().Add(service.HealthTimeout)
+	for {
+		exitCode, err := runSilently(ctx, cli, containerID, service.Healthcheck)
+		if err == nil && exitCode == 0 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			if err == nil {
+				err = fmt.Errorf("healthcheck exited with code %d", exitCode)
+			}
+			return fmt.Errorf("docker: service '%s' of '%s' task is not healthy after %s: %s", service.Name, service.Task, service.HealthTimeout, err.Error())
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(healthcheckInterval):
+		}
+	}
+}
+
+// runSilently runs the command on the container discarding its output, and returns its exit code
+func runSilently(ctx context.Context, cli *client.Client, containerID string, command []string) (int, error) {
+	exec, err := cli.ContainerExecCreate(ctx, containerID, types.ExecConfig{
+		Cmd:          command,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return 0, err
+	}
+	resp, err := cli.ContainerExecAttach(ctx, exec.ID, types.ExecStartCheck{})
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Close()
+	if _, err = io.Copy(ioutil.Discard, resp.Reader); err != nil {
+		return 0, err
+	}
+	info, err := cli.ContainerExecInspect(ctx, exec.ID)
+	if err != nil {
+		return 0, err
+	}
+	return info.ExitCode, nil
+}
@@ -0,0 +1,115 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+)
+
+// leftNetworkDaemon serves the requests to create a network whose name is used by a network labelled for the task,
+// recording the requests made
+func leftNetworkDaemon(task string, containers int, requests *[]string) *httptest.Server {
+	created := false
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := apiVersionPrefix.ReplaceAllString(r.URL.Path, "")
+		*requests = append(*requests, r.Method+" "+path)
+		switch {
+		case r.Method == http.MethodPost && path == "/networks/create":
+			if created {
+				w.WriteHeader(http.StatusCreated)
+				json.NewEncoder(w).Encode(types.NetworkCreateResponse{ID: "new"})
+				return
+			}
+			created = true
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(map[string]string{"message": "network with name dunner-build already exists"})
+		case r.Method == http.MethodGet && strings.HasPrefix(path, "/networks/"):
+			resource := types.NetworkResource{ID: "left", Labels: map[string]string{LabelTask: task}, Containers: map[string]types.EndpointResource{}}
+			for i := 0; i < containers; i++ {
+				resource.Containers[string(rune('a'+i))] = types.EndpointResource{}
+			}
+			json.NewEncoder(w).Encode(resource)
+		case r.Method == http.MethodDelete && path == "/networks/left":
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestCreateNetworkLeftByEarlierRun(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		task       string
+		containers int
+		requests   []string
+		err        string
+	}{
+		{
+			name:     "recreated",
+			task:     "build",
+			requests: []string{"POST /networks/create", "GET /networks/dunner-build", "DELETE /networks/left", "POST /networks/create"},
+		},
+		{
+			name:       "reused",
+			task:       "build",
+			containers: 1,
+			requests:   []string{"POST /networks/create", "GET /networks/dunner-build"},
+		},
+		{
+			name:     "not created by dunner",
+			requests: []string{"POST /networks/create", "GET /networks/dunner-build"},
+			err:      "network dunner-build already exists and was not created by Dunner for this task",
+		},
+	} {
+		var requests []string
+		daemon := leftNetworkDaemon(tc.task, tc.containers, &requests)
+		cli, err := client.NewClientWithOpts(client.WithHost("tcp://"+daemon.Listener.Addr().String()), client.WithVersion("1.40"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = createNetwork(context.Background(), cli, "dunner-build", "build")
+		daemon.Close()
+
+		if (err == nil && tc.err != "") || (err != nil && err.Error() != tc.err) {
+			t.Errorf("%s: expected error: %q, got: %v", tc.name, tc.err, err)
+		}
+		if strings.Join(requests, ", ") != strings.Join(tc.requests, ", ") {
+			t.Errorf("%s: expected requests: %v, got: %v", tc.name, tc.requests, requests)
+		}
+	}
+}
+
+func TestWaitHealthyStopsOnceCancelled(t *testing.T) {
+	daemon := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer daemon.Close()
+	cli, err := client.NewClientWithOpts(client.WithHost("tcp://"+daemon.Listener.Addr().String()), client.WithVersion("1.40"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	service := Service{Task: "test", Name: "db", Healthcheck: []string{"pg_isready"}, HealthTimeout: time.Minute}
+
+	done := make(chan error, 1)
+	go func() { done <- service.waitHealthy(ctx, cli, "db") }()
+
+	select {
+	case err := <-done:
+		if err != context.Canceled {
+			t.Fatalf("expected error: %s, got: %v", context.Canceled, err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected waiting for the service to stop once cancelled")
+	}
+}
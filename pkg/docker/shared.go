@@ -0,0 +1,52 @@
+package docker
+
+import (
+	"sync"
+
+	"github.com/docker/docker/client"
+	"github.com/spf13/viper"
+)
+
+// SharedContainer is a container kept running for all the steps of a task, which run their commands in it instead
+// of in containers of their own, sharing its filesystem and environment. It is started by the first step run, with
+// the settings of that step, and removed by Remove once the task ends.
+type SharedContainer struct {
+	sync.Mutex
+	id    string
+	cli   *client.Client
+	owner Step
+}
+
+// container returns the ID of the shared container, started by the step with start if it is not running yet. A
+// container failing to start is released right away, so that the next step starts a new one.
+func (shared *SharedContainer) container(cli *client.Client, step Step, start func() (string, error)) (string, error) {
+	shared.Lock()
+	defer shared.Unlock()
+	if shared.id != "" {
+		return shared.id, nil
+	}
+	id, err := start()
+	if err != nil {
+		if id != "" {
+			step.releaseContainer(cli, id, viper.GetString("Keep-containers"), true)
+		}
+		return id, err
+	}
+	shared.id, shared.cli, shared.owner = id, cli, step
+	return id, nil
+}
+
+// Remove stops and removes the shared container once the task ends, unless it is kept for debugging as per the
+// `Keep-containers` setting, failed tells if the task failed. It does nothing if no step started the container.
+func (shared *SharedContainer) Remove(failed bool) {
+	if shared == nil {
+		return
+	}
+	shared.Lock()
+	defer shared.Unlock()
+	if shared.id == "" {
+		return
+	}
+	shared.owner.releaseContainer(shared.cli, shared.id, viper.GetString("Keep-containers"), failed)
+	shared.id = ""
+}
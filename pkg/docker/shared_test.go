@@ -0,0 +1,47 @@
+package docker
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSharedContainerStartsOnce(t *testing.T) {
+	shared := &SharedContainer{}
+	starts := 0
+	start := func() (string, error) {
+		starts++
+		return "container-id", nil
+	}
+
+	for i := 0; i < 3; i++ {
+		id, err := shared.container(nil, Step{Name: "build"}, start)
+		if err != nil {
+			t.Fatalf("expected no error, got: %s", err)
+		}
+		if id != "container-id" {
+			t.Errorf("expected container-id, got: %s", id)
+		}
+	}
+	if starts != 1 {
+		t.Errorf("expected container to be started once, started %d times", starts)
+	}
+}
+
+func TestSharedContainerRestartsAfterFailure(t *testing.T) {
+	shared := &SharedContainer{}
+	failure := errors.New("image not found")
+
+	if _, err := shared.container(nil, Step{}, func() (string, error) { return "", failure }); err != failure {
+		t.Fatalf("expected error: %s, got: %v", failure, err)
+	}
+	id, err := shared.container(nil, Step{}, func() (string, error) { return "container-id", nil })
+	if err != nil || id != "container-id" {
+		t.Errorf("expected container-id to be started, got: %s, %v", id, err)
+	}
+}
+
+func TestSharedContainerRemoveWithoutContainer(t *testing.T) {
+	var shared *SharedContainer
+	shared.Remove(true)
+	(&SharedContainer{}).Remove(false)
+}
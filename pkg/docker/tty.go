@@ -0,0 +1,58 @@
+package docker
+
+import (
+	"context"
+	"os"
+	"os/signal"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/pkg/term"
+)
+
+// StdoutIsTerminal returns true if the standard output of Dunner is a terminal, steps are then run on a terminal
+// unless they set otherwise
+func StdoutIsTerminal() bool {
+	_, isTerm := term.GetFdInfo(os.Stdout)
+	return isTerm
+}
+
+// resizeFunc resizes the terminal of a container or of a command run on it, like `ContainerResize` of the client
+type resizeFunc func(ctx context.Context, id string, options types.ResizeOptions) error
+
+// followTerminalSize resizes the terminal of the container or command `id` to the size of the terminal `file` of
+// the host, once and then whenever the terminal of the host is resized, until the returned function is called.
+// Nothing is done if `file` is not a terminal.
+func followTerminalSize(ctx context.Context, file *os.File, resize resizeFunc, id string) func() {
+	fd, isTerm := term.GetFdInfo(file)
+	if !isTerm {
+		return func() {}
+	}
+	resizeToHost := func() {
+		size, err := term.GetWinsize(fd)
+		if err != nil || (size.Height == 0 && size.Width == 0) {
+			return
+		}
+		if err := resize(ctx, id, types.ResizeOptions{Height: uint(size.Height), Width: uint(size.Width)}); err != nil {
+			log.Debugf("docker: failed to resize terminal of %s: %s", id, err.Error())
+		}
+	}
+	resizeToHost()
+
+	sigs := make(chan os.Signal, 1)
+	notifyResize(sigs)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-sigs:
+				resizeToHost()
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(sigs)
+		close(done)
+	}
+}
@@ -0,0 +1,15 @@
+//go:build !windows
+// +build !windows
+
+package docker
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// notifyResize relays to the channel the signals sent when the terminal of the host is resized
+func notifyResize(sigs chan os.Signal) {
+	signal.Notify(sigs, syscall.SIGWINCH)
+}
@@ -0,0 +1,7 @@
+package docker
+
+import "os"
+
+// notifyResize does nothing, as there is no signal of the terminal being resized on Windows. The terminal of a
+// command keeps the size it started with.
+func notifyResize(sigs chan os.Signal) {}
@@ -0,0 +1,70 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	volumetypes "github.com/docker/docker/api/types/volume"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
+)
+
+// LabelProject is set on the named volumes created by Dunner, with the name of the project directory they belong to
+const LabelProject = "dunner.project"
+
+// EnsureVolume creates the named volume with the given labels, which are to include LabelCache, unless it exists.
+// An existing volume is reused only if it was created by Dunner and its labels do not differ from the given ones,
+// so that data of another project, cache or tool is never mounted by mistake.
+func EnsureVolume(ctx context.Context, cli client.APIClient, name string, labels map[string]string) error {
+	// Creating a volume that already exists returns the existing volume, along with its labels
+	volume, err := cli.VolumeCreate(ctx, volumetypes.VolumeCreateBody{Name: name, Labels: labels})
+	if err != nil {
+		if errdefs.IsConflict(err) {
+			return fmt.Errorf("docker: volume %s already exists with another driver and was not created by Dunner, remove it with `docker volume rm %s` or use another cache key", name, name)
+		}
+		return fmt.Errorf("docker: failed to create volume %s: %s", name, err.Error())
+	}
+	if _, ok := volume.Labels[LabelCache]; !ok {
+		return fmt.Errorf("docker: volume %s already exists and was not created by Dunner, remove it with `docker volume rm %s` or use another cache key", name, name)
+	}
+
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if value, ok := volume.Labels[key]; ok && value != labels[key] {
+			return fmt.Errorf("docker: volume %s already exists with label %s=%q instead of %q, remove it with `dunner clean` or `docker volume rm %s`", name, key, value, labels[key], name)
+		}
+	}
+	return nil
+}
+
+// ListDunnerVolumes lists the named volumes created by Dunner, of all projects
+func ListDunnerVolumes(ctx context.Context, cli client.APIClient) ([]*types.Volume, error) {
+	volumes, err := cli.VolumeList(ctx, filters.NewArgs(filters.Arg("label", LabelCache)))
+	if err != nil {
+		return nil, fmt.Errorf("docker: failed to list volumes: %s", err.Error())
+	}
+	return volumes.Volumes, nil
+}
+
+// volumeSizes returns the disk space used by each volume, by name. Docker computes it only for the disk usage
+// request, which walks all volumes, so it is requested only when needed.
+func volumeSizes(ctx context.Context, cli client.APIClient) (map[string]int64, error) {
+	usage, err := cli.DiskUsage(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("docker: failed to get disk usage of volumes: %s", err.Error())
+	}
+	sizes := make(map[string]int64, len(usage.Volumes))
+	for _, v := range usage.Volumes {
+		if v.UsageData != nil {
+			sizes[v.Name] = v.UsageData.Size
+		}
+	}
+	return sizes, nil
+}
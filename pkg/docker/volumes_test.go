@@ -0,0 +1,77 @@
+package docker
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/errdefs"
+)
+
+func TestEnsureVolume(t *testing.T) {
+	labels := map[string]string{LabelCache: "npm", LabelProject: "webapp"}
+	for _, tc := range []struct {
+		name     string
+		existing *types.Volume
+		err      string
+	}{
+		{name: "created"},
+		{
+			name:     "reused",
+			existing: &types.Volume{Name: "dunner-cache-webapp-npm", Labels: labels},
+		},
+		{
+			name:     "reused without project label",
+			existing: &types.Volume{Name: "dunner-cache-webapp-npm", Labels: map[string]string{LabelCache: "npm"}},
+		},
+		{
+			name:     "not created by dunner",
+			existing: &types.Volume{Name: "dunner-cache-webapp-npm"},
+			err:      "docker: volume dunner-cache-webapp-npm already exists and was not created by Dunner, remove it with `docker volume rm dunner-cache-webapp-npm` or use another cache key",
+		},
+		{
+			name:     "of another project",
+			existing: &types.Volume{Name: "dunner-cache-webapp-npm", Labels: map[string]string{LabelCache: "npm", LabelProject: "api"}},
+			err:      "docker: volume dunner-cache-webapp-npm already exists with label dunner.project=\"api\" instead of \"webapp\", remove it with `dunner clean` or `docker volume rm dunner-cache-webapp-npm`",
+		},
+	} {
+		cli := &fakeClient{}
+		if tc.existing != nil {
+			cli.volumes = []*types.Volume{tc.existing}
+		}
+
+		err := EnsureVolume(context.Background(), cli, "dunner-cache-webapp-npm", labels)
+
+		if (err == nil && tc.err != "") || (err != nil && err.Error() != tc.err) {
+			t.Errorf("%s: expected error: %q, got: %v", tc.name, tc.err, err)
+		}
+		if len(cli.volumes) != 1 {
+			t.Errorf("%s: expected one volume, got: %+v", tc.name, cli.volumes)
+		}
+	}
+}
+
+func TestEnsureVolumeWithAnotherDriver(t *testing.T) {
+	cli := &fakeClient{createErr: errdefs.Conflict(errors.New("volume name must be unique"))}
+
+	err := EnsureVolume(context.Background(), cli, "dunner-cache-webapp-npm", map[string]string{LabelCache: "npm"})
+
+	expected := "docker: volume dunner-cache-webapp-npm already exists with another driver and was not created by Dunner, remove it with `docker volume rm dunner-cache-webapp-npm` or use another cache key"
+	if err == nil || err.Error() != expected {
+		t.Fatalf("expected error: %s, got: %v", expected, err)
+	}
+}
+
+func TestListDunnerVolumes(t *testing.T) {
+	cli := newFakeClient()
+
+	volumes, err := ListDunnerVolumes(context.Background(), cli)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(volumes) != 2 {
+		t.Fatalf("expected all volumes, got: %+v", volumes)
+	}
+}
@@ -4,39 +4,168 @@ Package dunner consists of the main executing functions for the Dunner applicati
 package dunner
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
+	"os/signal"
 	os_user "os/user"
+	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
 	"sync"
+	"syscall"
+	"time"
 
+	"github.com/docker/distribution/reference"
+	units "github.com/docker/go-units"
 	"github.com/leopardslab/dunner/internal/logger"
 	"github.com/leopardslab/dunner/pkg/config"
 	"github.com/leopardslab/dunner/pkg/docker"
+	"github.com/leopardslab/dunner/pkg/events"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	yaml "gopkg.in/yaml.v2"
 )
 
 var log = logger.Log
 
+// errValidationFailed is returned when the task file is invalid, the validation errors are printed already
+var errValidationFailed = errors.New("dunner: validation of task file failed")
+
+// ExitError is returned when a step fails with a non-zero exit code
+type ExitError struct {
+	ExitCode int
+	Err      error
+}
+
+func (e *ExitError) Error() string {
+	return e.Err.Error()
+}
+
 // Do method is invoked for command-line use
 func Do(_ *cobra.Command, args []string) {
 	logger.InitColorOutput()
 
 	var async = viper.GetBool("Async")
+	var parallelTasks = viper.GetBool("Parallel-tasks")
 
-	if verbose := viper.GetBool("Verbose"); async && verbose {
+	if verbose := viper.GetBool("Verbose"); (async || parallelTasks) && verbose {
 		log.Warn("Silencing verbose in asynchronous mode")
 		viper.Set("Verbose", false)
 	}
+	if parallelTasks && (len(viper.GetStringSlice("Only")) != 0 || len(viper.GetStringSlice("Skip")) != 0 || viper.GetString("From") != "") {
+		log.Fatal("dunner: step filters cannot be used when running tasks in parallel")
+	}
+
+	switch keep := viper.GetString("Keep-containers"); keep {
+	case "", docker.KeepFailedContainers, docker.KeepAllContainers:
+	default:
+		log.Fatalf("dunner: invalid value '%s' to keep containers, must be '%s' or '%s'", keep, docker.KeepFailedContainers, docker.KeepAllContainers)
+	}
+
+	switch mountGit := viper.GetString("Mount-git"); mountGit {
+	case "", docker.MountGitReadOnly, docker.MountGitWritable, docker.MountGitNone:
+	default:
+		log.Fatalf("dunner: invalid value '%s' to mount git metadata, must be '%s', '%s' or '%s'", mountGit, docker.MountGitReadOnly, docker.MountGitWritable, docker.MountGitNone)
+	}
+
+	if platform := viper.GetString("Platform"); platform != "" && !config.IsValidPlatform(platform) {
+		log.Fatalf("dunner: invalid platform '%s', valid platforms are: %s", platform, strings.Join(config.ValidPlatforms(), ", "))
+	}
+
+	if events.Enabled() {
+		if viper.GetBool("Summary-only") || viper.GetBool("Print-digests") {
+			log.Fatal("dunner: events cannot be emitted along with --summary-only or --print-digests")
+		}
+		// Standard output is for events only
+		logger.Log.Out = os.Stderr
+		emitStepEvents()
+	}
 
+	root, err := config.ProjectRoot(viper.GetString("DunnerTaskFile"), viper.GetString("WorkingDirectory"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	viper.Set("WorkingDirectory", root)
+
+	handleInterrupt()
+	log.Infof("Run ID: %s", docker.RunID)
+	log.Infof("Project directory: %s", root)
+	if viper.GetBool("Watch") {
+		if err := Watch(args); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	var results *stepResults
+	if viper.GetBool("Summary-only") {
+		results = collectStepResults()
+	}
+	failedLogs := collectFailedLogFiles()
+	start := time.Now()
+	err = runAndNotify(args)
+	waitIfInterrupted()
+	emitRunFinished(start, err)
+	var removedImages string
+	if viper.GetBool("Rm-images") {
+		removedImages = removePulledImages()
+	}
+	if results != nil {
+		results.print()
+		if removedImages != "" {
+			fmt.Println(removedImages)
+		}
+	} else if removedImages != "" {
+		log.Info(removedImages)
+	}
+	failedLogs.print()
+	if viper.GetBool("Print-digests") {
+		printDigests()
+	}
+	if err != nil {
+		exitWithError(err)
+	}
+}
+
+// removePulledImages removes the images pulled during the run which were not on the host before, and returns the
+// report of the disk space reclaimed, empty if no image was pulled
+func removePulledImages() string {
+	images := docker.PulledImages()
+	if len(images) == 0 {
+		return ""
+	}
+	ctx := context.Background()
+	cli, err := docker.NewClient(ctx)
+	if err != nil {
+		log.Warnf("Not removing pulled images: %s", err.Error())
+		return ""
+	}
+	removed, reclaimed := docker.RemoveImages(ctx, cli, images)
+	return fmt.Sprintf("Removed %d of %d pulled image(s), reclaiming %s", removed, len(images), units.HumanSize(float64(reclaimed)))
+}
+
+// printDigests prints the digests of the images run as `locked_digests` of the task file, to pin the images
+func printDigests() {
+	out, err := yaml.Marshal(map[string]map[string]string{"locked_digests": docker.ResolvedDigests()})
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	fmt.Print(string(out))
+}
+
+// run loads the dunner task file and runs the task given as the first of args, with the rest as its arguments.
+// When running tasks in parallel, all of args are names of tasks to be run. A task name may be a glob pattern, to
+// run all the tasks matching it one after another, see ExpandTaskPatterns. With `Since-commit` set, tasks whose
+// inputs did not change since that commit are skipped.
+func run(args []string) error {
 	var dunnerFile = viper.GetString("DunnerTaskFile")
 
 	configs, err := config.GetConfigs(dunnerFile)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 	errs := configs.Validate()
 	if len(errs) != 0 {
@@ -44,90 +173,566 @@ func Do(_ *cobra.Command, args []string) {
 		for _, err := range errs {
 			logger.ErrorOutput(err.Error())
 		}
-		os.Exit(1)
+		return errValidationFailed
+	}
+	for _, warning := range configs.Warnings() {
+		log.Warn(warning)
+	}
+
+	if err := ApplyImageOverrides(configs, viper.GetStringSlice("Image-override")); err != nil {
+		return err
+	}
+	if needsDocker(configs) {
+		if err := checkDaemon().Explain(); err != nil {
+			return err
+		}
+	}
+
+	var parallelTasks = viper.GetBool("Parallel-tasks")
+	var taskNames = args[:1]
+	if parallelTasks {
+		taskNames = args
+	}
+	if taskNames, err = ExpandTaskPatterns(configs, taskNames); err != nil {
+		return err
+	}
+	if ref := viper.GetString("Since-commit"); ref != "" {
+		if taskNames, err = SelectChangedTasks(configs, taskNames, ref); err != nil {
+			return err
+		}
+		if len(taskNames) == 0 {
+			return nil
+		}
+	}
+
+	if parallelTasks {
+		for _, taskName := range taskNames {
+			explain(ExplainSteps(configs, taskName, configs.Tasks[taskName].Steps, "", nil, nil))
+		}
+		return ExecTasksInParallel(docker.RunContext(), configs, taskNames, viper.GetInt("Max-parallel"))
 	}
 
-	if err = ExecTask(configs, args[0], args[1:], nil); err != nil {
+	for _, taskName := range taskNames {
+		if task, exists := configs.Tasks[taskName]; exists {
+			steps := task.Steps
+			if task.Steps, err = StepsFrom(task.Steps, viper.GetString("From")); err != nil {
+				return err
+			}
+			task.Steps, err = FilterSteps(task.Steps, viper.GetStringSlice("Only"), viper.GetStringSlice("Skip"))
+			if err != nil {
+				return err
+			}
+			configs.Tasks[taskName] = task
+			explain(ExplainSteps(configs, taskName, steps, viper.GetString("From"), viper.GetStringSlice("Only"), viper.GetStringSlice("Skip")))
+		}
+		if err := ExecTask(docker.RunContext(), configs, taskName, args[1:], nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// explain logs the decisions on the steps to be run along with their reasons, if asked with the `Explain` setting
+func explain(decisions []Decision) {
+	if !viper.GetBool("Explain") {
+		return
+	}
+	for _, decision := range decisions {
+		log.Info(decision)
+	}
+}
+
+// checkDaemon checks that the Docker daemon is reachable, it is replaced in tests
+var checkDaemon = docker.CheckDaemon
+
+// needsDocker returns true if any of the tasks has a step or service run on a container
+func needsDocker(configs *config.Configs) bool {
+	for _, task := range configs.Tasks {
+		if runsContainers(task) {
+			return true
+		}
+	}
+	return false
+}
+
+// runsContainers returns true if the task has a step or service run on a container
+func runsContainers(task config.Task) bool {
+	if len(task.Services) != 0 {
+		return true
+	}
+	for _, step := range task.Steps {
+		if !step.Local && step.Follow == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// exitWithError exits with the exit code of the failed step, or 1 for any other error
+func exitWithError(err error) {
+	switch err := err.(type) {
+	case *ExitError:
+		log.Error(err)
+		log.Exit(err.ExitCode)
+	default:
+		if err == errValidationFailed {
+			os.Exit(1)
+		}
 		log.Fatal(err)
 	}
 }
 
-// ExecTask processes the parsed tasks from the dunner task file
-func ExecTask(configs *config.Configs, taskName string, args []string, parentStep *config.Step) error {
+// interrupted is closed when Dunner is interrupted or terminated
+var interrupted = make(chan struct{})
+
+// handleInterrupt stops and removes the running containers before exiting, when Dunner is interrupted
+// or terminated, so that no containers are left behind. Requests of running steps to the Docker daemon are
+// cancelled, and containers are given the stop timeout to stop gracefully. If interrupted again meanwhile, the
+// containers are killed right away. Dunner then exits with the code of the signal, 130 for SIGINT.
+func handleInterrupt() {
+	sig := make(chan os.Signal, 2)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		s := <-sig
+		close(interrupted)
+		docker.RestoreTerminal()
+		docker.CancelRun()
+		log.Warnf("Received %s signal, stopping running containers. Interrupt again to kill them...", s)
+		go func() {
+			<-sig
+			log.Warn("Received signal again, killing running containers...")
+			docker.KillContainers()
+		}()
+		docker.StopContainers()
+		log.Error("dunner: run interrupted")
+		log.Exit(signalExitCode(s))
+	}()
+}
+
+// signalExitCode returns the exit code of a process terminated by the signal, as shells report it
+func signalExitCode(s os.Signal) int {
+	if s == syscall.SIGTERM {
+		return 128 + int(syscall.SIGTERM)
+	}
+	return 128 + int(syscall.SIGINT)
+}
+
+// waitIfInterrupted blocks if Dunner was interrupted, so that it exits once containers are stopped and not with the
+// errors of the steps cancelled by the interruption
+func waitIfInterrupted() {
+	select {
+	case <-interrupted:
+		select {}
+	default:
+	}
+}
+
+// FilterSteps returns the steps to be run, after applying the `only` and `skip` filters on step names.
+// Steps not named in the task file are filtered by the default name they are given when it is loaded, like `step-2`.
+// It is an error if any of the given names does not match a step.
+func FilterSteps(steps []config.Step, only []string, skip []string) ([]config.Step, error) {
+	if len(only) == 0 && len(skip) == 0 {
+		return steps, nil
+	}
+
+	names := make(map[string]struct{})
+	for _, step := range steps {
+		if step.Name != "" {
+			names[step.Name] = struct{}{}
+		}
+	}
+	for _, name := range append(append([]string{}, only...), skip...) {
+		if _, exists := names[name]; !exists {
+			return nil, fmt.Errorf("dunner: step filter '%s' does not match any named step of the task", name)
+		}
+	}
+
+	var filtered []config.Step
+	for _, step := range steps {
+		if len(only) != 0 && !contains(only, step.Name) {
+			continue
+		}
+		if contains(skip, step.Name) {
+			continue
+		}
+		filtered = append(filtered, step)
+	}
+	return filtered, nil
+}
+
+// StepsFrom returns the steps of the task starting from the step named `from`, to resume a task from that step.
+// Unnamed steps can be given by their default name, which the steps keep. It is an error if no step has that name.
+// All steps are returned if `from` is empty.
+func StepsFrom(steps []config.Step, from string) ([]config.Step, error) {
+	if from == "" {
+		return steps, nil
+	}
+	for i, step := range steps {
+		if step.Name != from && (step.Name != "" || config.DefaultStepName(i) != from) {
+			continue
+		}
+		if i > 0 {
+			log.Warnf("Skipping %d step(s) before step '%s', their side effects like built artifacts may be missing", i, from)
+		}
+		resumed := make([]config.Step, len(steps)-i)
+		copy(resumed, steps[i:])
+		for j := range resumed {
+			if resumed[j].Name == "" {
+				resumed[j].Name = config.DefaultStepName(i + j)
+			}
+		}
+		return resumed, nil
+	}
+	return nil, fmt.Errorf("dunner: step '%s' to run the task from does not match any step of the task", from)
+}
+
+// ApplyImageOverrides replaces the images of steps as given by overrides of the form `name=image`, where name is the
+// name of a step, or the image of a step with or without its tag. Steps built from a Dockerfile use the image instead.
+// It is an error if an override does not match any step of the task file.
+func ApplyImageOverrides(configs *config.Configs, overrides []string) error {
+	for _, override := range overrides {
+		kv := strings.SplitN(override, "=", 2)
+		if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+			return fmt.Errorf("dunner: invalid image override '%s', must be of the form 'name=image'", override)
+		}
+		matched := false
+		for _, task := range configs.Tasks {
+			for i, step := range task.Steps {
+				if step.Local || (step.Name != kv[0] && !matchesImage(step.Image, kv[0])) {
+					continue
+				}
+				task.Steps[i].Image = kv[1]
+				task.Steps[i].Build = nil
+				matched = true
+			}
+		}
+		if !matched {
+			return fmt.Errorf("dunner: image override '%s' does not match the name or image of any step", override)
+		}
+	}
+	return nil
+}
+
+// matchesImage returns true if the image is the given one, or if the given one is the image without its tag
+func matchesImage(image string, name string) bool {
+	if image == "" {
+		return false
+	}
+	if image == name {
+		return true
+	}
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return false
+	}
+	return reference.FamiliarName(named) == name || named.Name() == name
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// checkPrivileges verifies that none of the steps of the task runs in privileged mode or adds capabilities, unless
+// allowed by the `AllowPrivileged` setting. This is checked before running any step of the task.
+func checkPrivileges(task config.Task, taskName string) error {
+	if viper.GetBool("AllowPrivileged") {
+		return nil
+	}
+	for i, step := range task.Steps {
+		if step.NeedsPrivileges() {
+			name := step.Name
+			if name == "" {
+				name = config.DefaultStepName(i)
+			}
+			return fmt.Errorf(
+				"dunner: step '%s' of '%s' task needs `privileged` mode or `cap_add` capabilities, which give it "+
+					"elevated access to the host. Pass --allow-privileged or enable the `AllowPrivileged` setting to allow it",
+				name, taskName)
+		}
+	}
+	return nil
+}
+
+// checkInteractive verifies that the interactive steps of the task, if any, can attach to the terminal of Dunner.
+// They cannot be run if the standard input is not a terminal, like on CI, nor when the output of steps is concurrent
+// or captured. This is checked before running any step of the task.
+func checkInteractive(task config.Task, taskName string) error {
+	for i, step := range task.Steps {
+		if !step.Interactive {
+			continue
+		}
+		name := step.Name
+		if name == "" {
+			name = config.DefaultStepName(i)
+		}
+		if docker.ConcurrentOutput() || docker.CaptureOutput() {
+			return fmt.Errorf("dunner: step '%s' of '%s' task is interactive, which cannot be run in asynchronous mode, "+
+				"when running tasks in parallel or with --summary-only or --events", name, taskName)
+		}
+		if !stdinIsTerminal() {
+			return fmt.Errorf("dunner: step '%s' of '%s' task is interactive, which needs Dunner to be run from a terminal", name, taskName)
+		}
+	}
+	return nil
+}
+
+// stdinIsTerminal and stdoutIsTerminal report whether the standard input and output of Dunner are terminals, they
+// are replaced in tests
+var (
+	stdinIsTerminal  = docker.StdinIsTerminal
+	stdoutIsTerminal = docker.StdoutIsTerminal
+)
+
+// useTTY returns true if the commands of the step are to be run on a terminal, as set by its `tty` field. Otherwise
+// a terminal is used if the output of Dunner is a terminal and is neither concurrent nor captured.
+func useTTY(step config.Step) bool {
+	if step.TTY != nil {
+		return *step.TTY
+	}
+	return !step.Parallel && !docker.ConcurrentOutput() && !docker.CaptureOutput() && stdoutIsTerminal()
+}
+
+// ExecTask processes the parsed tasks from the dunner task file. It returns the error of the first step that fails,
+// in asynchronous mode the rest of the steps still run to completion. Consecutive steps marked `parallel` run
+// concurrently, see execParallelSteps. Steps are run with contexts derived from ctx, cancelling it stops them. The
+// services of the task are started before its steps, which join their network unless given one, and are stopped
+// once the task ends. The steps of a task with `shared_container` run their commands in one container, removed once
+// the task ends.
+func ExecTask(ctx context.Context, configs *config.Configs, taskName string, args []string, parentStep *config.Step) (err error) {
 	var async = viper.GetBool("Async")
 	var wg sync.WaitGroup
+	var errOnce sync.Once
+	var firstErr error
+	var group []parallelStep
 
 	if _, exists := configs.Tasks[taskName]; !exists {
 		return fmt.Errorf("dunner: task '%s' does not exist", taskName)
 	}
-	for _, stepDefinition := range configs.Tasks[taskName].Steps {
+	if err := checkPrivileges(configs.Tasks[taskName], taskName); err != nil {
+		return err
+	}
+	if err := checkInteractive(configs.Tasks[taskName], taskName); err != nil {
+		return err
+	}
+	servicesNetwork, stopServices, err := startServices(configs.Tasks[taskName], taskName)
+	defer stopServices()
+	if err != nil {
+		return err
+	}
+	var shared *docker.SharedContainer
+	if configs.Tasks[taskName].SharedContainer {
+		shared = &docker.SharedContainer{}
+		defer func() { shared.Remove(err != nil) }()
+	}
+	for i, stepDefinition := range configs.Tasks[taskName].Steps {
+		if stepDefinition.User == "" && !stepDefinition.RunAsHostUser {
+			stepDefinition.User = defaultUser(configs, taskName)
+		}
 		err := stepDefinition.ParseStepEnv()
 		if err != nil {
 			return err
 		}
-		if async {
-			wg.Add(1)
+		if stepDefinition.Name == "" {
+			stepDefinition.Name = config.DefaultStepName(i)
+		}
+		if stepDefinition.Index == 0 {
+			stepDefinition.Index = i + 1
 		}
 		step := docker.Step{
 			Task:     taskName,
 			Name:     stepDefinition.Name,
+			Index:    stepDefinition.Index,
 			Image:    stepDefinition.Image,
 			Command:  stepDefinition.Command,
 			Commands: stepDefinition.Commands,
 			Env:      stepDefinition.Envs,
+			PassEnv:  stepDefinition.PassEnv,
 			WorkDir:  stepDefinition.Dir,
 			Follow:   stepDefinition.Follow,
 			Args:     stepDefinition.Args,
 			User:     getDunnerUser(stepDefinition),
+
+			AllowFailure: stepDefinition.AllowFailure,
+			InheritEnv:   stepDefinition.InheritEnv,
+			ForcePull:    stepDefinition.ForcePull,
+			Platform:     stepDefinition.Platform,
+			CreateDir:    stepDefinition.CreateDir,
+			Local:        stepDefinition.Local,
+			Entrypoint:   stepDefinition.Entrypoint,
+			Ports:        stepDefinition.Ports,
+			Network:      stepDefinition.Network,
+			ExtraHosts:   stepDefinition.ExtraHosts,
+			Retries:      stepDefinition.Retries,
+
+			MountDockerSock: stepDefinition.MountsDockerSock(),
+			Privileged:      stepDefinition.Privileged,
+			CapAdd:          stepDefinition.CapAdd,
+			CapDrop:         stepDefinition.CapDrop,
+			BeforePull:      beforePull,
+
+			ContainerPerCommand: stepDefinition.ContainerPerCommand,
+			Interactive:         stepDefinition.Interactive,
+			TTY:                 useTTY(stepDefinition),
+			SkipProjectMount:    !configs.Tasks[taskName].MountsProject(stepDefinition),
+			ProjectDir:          projectDir(configs, taskName),
+			Caches:              stepDefinition.Caches,
+			Shared:              shared,
+			HostDir:             configs.Tasks[taskName].Root(viper.GetString("WorkingDirectory")),
+		}
+		if step.Platform == "" {
+			step.Platform = viper.GetString("Platform")
+		}
+		if step.Digest = docker.ImageDigest(step.Image); step.Digest == "" {
+			step.Digest = configs.LockedDigests[step.Image]
+		}
+
+		if step.Memory, err = stepDefinition.MemoryBytes(); err != nil {
+			return err
+		}
+		step.NanoCPUs = stepDefinition.NanoCPUs()
+		if step.GPUs, err = stepDefinition.GPURequest(); err != nil {
+			return err
+		}
+		if stepDefinition.OutputFile != "" {
+			step.OutputFile = stepDefinition.OutputFile
+			if !filepath.IsAbs(step.OutputFile) {
+				step.OutputFile = filepath.Join(step.HostDir, step.OutputFile)
+			}
+		}
+		step.LogFile = logFile(taskName, step.Name)
+		if stepDefinition.Build != nil {
+			step.Build = &docker.Build{
+				Context:    stepDefinition.Build.Context,
+				Dockerfile: stepDefinition.Build.Dockerfile,
+				Args:       stepDefinition.Build.Args,
+			}
+			if !filepath.IsAbs(step.Build.Context) {
+				step.Build.Context = filepath.Join(step.HostDir, step.Build.Context)
+			}
+		}
+		if stepDefinition.RetryDelay != "" {
+			if step.RetryDelay, err = time.ParseDuration(stepDefinition.RetryDelay); err != nil {
+				return err
+			}
+		}
+		if stepDefinition.StopTimeout != "" {
+			if step.StopTimeout, err = time.ParseDuration(stepDefinition.StopTimeout); err != nil {
+				return err
+			}
 		}
 
 		if err := PassGlobals(&step, configs, &stepDefinition, parentStep); err != nil {
-			log.Fatal(err)
+			return err
+		}
+		if step.Network == "" {
+			step.Network = servicesNetwork
 		}
 
 		if async {
-			go Process(configs, &step, &wg, args, &stepDefinition)
+			wg.Add(1)
+			go func(step docker.Step, stepDefinition config.Step) {
+				defer wg.Done()
+				if err := Process(ctx, configs, &step, args, &stepDefinition); err != nil {
+					errOnce.Do(func() { firstErr = err })
+				}
+			}(step, stepDefinition)
+		} else if stepDefinition.Parallel {
+			group = append(group, parallelStep{step: step, definition: stepDefinition})
 		} else {
-			Process(configs, &step, &wg, args, &stepDefinition)
+			if err := execParallelSteps(ctx, configs, group, args); err != nil {
+				return err
+			}
+			group = nil
+			if err := Process(ctx, configs, &step, args, &stepDefinition); err != nil {
+				return err
+			}
 		}
 	}
+	if err := execParallelSteps(ctx, configs, group, args); err != nil {
+		return err
+	}
 
 	wg.Wait()
-	return nil
+	return firstErr
 }
 
-// Process executes a single step of the task.
-func Process(configs *config.Configs, s *docker.Step, wg *sync.WaitGroup, args []string, dunnerStep *config.Step) {
-	var async = viper.GetBool("Async")
-	if async {
-		defer wg.Done()
+// projectDir returns the directory of the containers the project directory is mounted on for the steps of the task,
+// the `project_dir` of the task or the global one
+func projectDir(configs *config.Configs, taskName string) string {
+	if dir := configs.Tasks[taskName].ProjectDir; dir != "" {
+		return dir
 	}
+	return configs.ProjectDir
+}
 
+// Process executes a single step of the task, running it again as many times as its retries if it fails. A step
+// with `images` is run on each of them, see processMatrix.
+// A failure of the step is returned as `ExitError`, unless the step is allowed to fail. The step is run with a
+// context derived from ctx, it is not retried once ctx is cancelled, even while waiting to be retried.
+func Process(ctx context.Context, configs *config.Configs, s *docker.Step, args []string, dunnerStep *config.Step) error {
 	if s.Follow != "" {
-		if async {
-			wg.Add(1)
-			go func(wg *sync.WaitGroup) {
-				ExecTask(configs, s.Follow, s.Args, dunnerStep)
-				wg.Done()
-			}(wg)
-		} else {
-			ExecTask(configs, s.Follow, s.Args, dunnerStep)
-		}
-		return
+		return ExecTask(ctx, configs, s.Follow, s.Args, dunnerStep)
+	}
+	if s.Image == "" && len(dunnerStep.Images) != 0 {
+		return processMatrix(ctx, configs, s, args, dunnerStep)
 	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 
 	if err := PassArgs(s, &args); err != nil {
-		log.Fatal(err)
+		return err
 	}
 
-	if s.Image == "" {
-		log.Fatalf(`dunner: image repository name cannot be empty`)
+	if !s.Local && s.Image == "" && s.Build == nil {
+		return fmt.Errorf(`dunner: image repository name cannot be empty`)
 	}
 
-	err := (*s).Exec()
+	beforeStep(*s)
+	result, err := execStep(ctx, s)
+	for attempt := 1; err != nil && attempt <= s.Retries && ctx.Err() == nil; attempt++ {
+		logger.WithStep(s.Task, s.Name).Warnf(
+			"Step '%s' of '%s' task failed: %s. Retrying in %s, attempt %d of %d",
+			s.Name, s.Task, err.Error(), s.RetryDelay, attempt, s.Retries,
+		)
+		select {
+		case <-ctx.Done():
+			afterStep(*s, result, ctx.Err())
+			return ctx.Err()
+		case <-time.After(s.RetryDelay):
+		}
+		result, err = execStep(ctx, s)
+	}
+	afterStep(*s, result, err)
 	if err != nil {
-		log.Fatal(err)
+		if result == nil || result.ExitCode == 0 {
+			return err
+		}
+		if s.AllowFailure {
+			logger.WithStep(s.Task, s.Name).Warnf("Ignoring failure of step '%s' of '%s' task: %s", s.Name, s.Task, err.Error())
+			return nil
+		}
+		return &ExitError{ExitCode: result.ExitCode, Err: err}
 	}
+	return nil
+}
+
+// execStep runs the step once, on the host for local steps or on a new container otherwise. A step run on a
+// container waits for a slot of the `Concurrency` setting.
+func execStep(ctx context.Context, s *docker.Step) (*docker.Result, error) {
+	if s.Local {
+		return execLocal(ctx, s)
+	}
+	release, err := acquireContainerSlot(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return (*s).Exec(ctx)
 }
 
 // PassArgs replaces argument variables,of the form '`$d`', where d is a number, with dth argument.
@@ -166,10 +771,28 @@ func PassArgs(s *docker.Step, args *[]string) error {
 	return gErr
 }
 
+// HostUser is the value of `user` to run the commands as the user and group of the host user
+const HostUser = "host"
+
+// defaultUser returns the user of the task if set, or the global user
+func defaultUser(configs *config.Configs, taskName string) string {
+	if user := configs.Tasks[taskName].User; user != "" {
+		return user
+	}
+	return configs.User
+}
+
 // getDunnerUser returns the user value from step, if empty returns first found value in order:
-// UID env variable, current user ID, current user name.
+// host user ID and group ID if step is to be run as host user, UID env variable, current user ID, current user name.
+// If the user is `host`, the host user ID and group ID are returned.
 func getDunnerUser(step config.Step) string {
-	if step.User != "" {
+	if step.User == HostUser || (step.User == "" && step.RunAsHostUser) {
+		// User and group IDs are -1 on platforms where they do not apply
+		if uid, gid := os.Getuid(), os.Getgid(); uid != -1 && gid != -1 {
+			return fmt.Sprintf("%d:%d", uid, gid)
+		}
+		log.Warnf("Unable to find host user and group IDs on this platform, ignoring host user of step '%s'", step.Name)
+	} else if step.User != "" {
 		return step.User
 	}
 	dunnerUser := os.Getenv("UID")
@@ -195,6 +818,8 @@ func getDunnerUser(step config.Step) string {
 // from different scopes have
 // the same destination (target) path.
 //
+// Extra hosts of the upper scopes are added as well, unless a lower scope maps the same name.
+//
 // Since both of these parings are independent of each other, they are carried out
 // concurrently on two different goroutines to increase the execution speed.
 func PassGlobals(step *docker.Step, configs *config.Configs, stepDefinition *config.Step, parentStep *config.Step) error {
@@ -226,6 +851,11 @@ func PassGlobals(step *docker.Step, configs *config.Configs, stepDefinition *con
 				step.Env = append(step.Env, env)
 			}
 		}
+		if parentStep != nil {
+			step.PassEnv = append(step.PassEnv, parentStep.PassEnv...)
+		}
+		step.PassEnv = append(step.PassEnv, (*configs).Tasks[step.Task].PassEnv...)
+		step.InheritEnv = step.InheritEnv || (*configs).Tasks[step.Task].InheritEnv || (parentStep != nil && parentStep.InheritEnv)
 		wg.Done()
 	}()
 
@@ -262,5 +892,29 @@ func PassGlobals(step *docker.Step, configs *config.Configs, stepDefinition *con
 	}()
 
 	wg.Wait()
+
+	// Extra hosts are inherited from the parent step and the task file, unless the step maps the same name
+	var extraHosts []string
+	if parentStep != nil {
+		extraHosts = append(extraHosts, parentStep.ExtraHosts...)
+	}
+	step.ExtraHosts = mergeExtraHosts(step.ExtraHosts, append(extraHosts, (*configs).ExtraHosts...))
 	return nil
 }
+
+// mergeExtraHosts appends the inherited hosts to the hosts of the step, except those of a name already mapped
+func mergeExtraHosts(hosts []string, inherited []string) []string {
+	merged := append([]string(nil), hosts...)
+	names := make(map[string]struct{})
+	for _, host := range hosts {
+		names[strings.SplitN(host, ":", 2)[0]] = struct{}{}
+	}
+	for _, host := range inherited {
+		name := strings.SplitN(host, ":", 2)[0]
+		if _, present := names[name]; !present {
+			merged = append(merged, host)
+			names[name] = struct{}{}
+		}
+	}
+	return merged
+}
@@ -1,11 +1,15 @@
 package dunner
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
 	os_user "os/user"
 	"reflect"
+	"strings"
+	"syscall"
 	"testing"
 
 	"github.com/docker/docker/api/types/mount"
@@ -117,7 +121,7 @@ func TestExecTask(t *testing.T) {
 		Tasks: tasks,
 	}
 
-	if err := ExecTask(&configs, "test", []string{"/dunner"}, nil); err != nil {
+	if err := ExecTask(context.Background(), &configs, "test", []string{"/dunner"}, nil); err != nil {
 		t.Fatal(err)
 	}
 }
@@ -141,7 +145,7 @@ func ExampleExecTask_taskWithFollowStep() {
 		Tasks: tasks,
 	}
 
-	if err := ExecTask(&configs, "test", []string{"/dunner"}, nil); err != nil {
+	if err := ExecTask(context.Background(), &configs, "test", []string{"/dunner"}, nil); err != nil {
 		panic(err)
 	}
 	// OUTPUT: build
@@ -157,7 +161,7 @@ func TestExecTaskWithParseError(t *testing.T) {
 	tasks["test"] = config.Task{Steps: []config.Step{step}}
 	configs := config.Configs{Tasks: tasks}
 
-	err := ExecTask(&configs, "test", []string{}, nil)
+	err := ExecTask(context.Background(), &configs, "test", []string{}, nil)
 
 	expectedErr := "could not find environment variable 'INVALID_USER_NONEXISTING'"
 	if err == nil || err.Error() != expectedErr {
@@ -165,6 +169,84 @@ func TestExecTaskWithParseError(t *testing.T) {
 	}
 }
 
+func TestExecTaskWithPrivilegedStepNotAllowed(t *testing.T) {
+	steps := []config.Step{
+		{Name: "greet", Local: true, Command: []string{"false"}},
+		{Name: "mount", Image: "busybox", Command: []string{"mount"}, CapAdd: []string{"SYS_ADMIN"}},
+	}
+	configs := config.Configs{Tasks: map[string]config.Task{"test": {Steps: steps}}}
+
+	err := ExecTask(context.Background(), &configs, "test", []string{}, nil)
+
+	expectedErr := "dunner: step 'mount' of 'test' task needs `privileged` mode or `cap_add` capabilities, which give it " +
+		"elevated access to the host. Pass --allow-privileged or enable the `AllowPrivileged` setting to allow it"
+	if err == nil || err.Error() != expectedErr {
+		t.Fatalf("expected error: %s, got %v", expectedErr, err)
+	}
+}
+
+func TestCheckPrivilegesAllowed(t *testing.T) {
+	defer viper.Set("AllowPrivileged", viper.GetBool("AllowPrivileged"))
+	viper.Set("AllowPrivileged", true)
+	task := config.Task{Steps: []config.Step{{Image: "docker:dind", Privileged: true}}}
+
+	if err := checkPrivileges(task, "test"); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+}
+
+func TestCheckInteractive(t *testing.T) {
+	defer func(isTerminal func() bool) { stdinIsTerminal = isTerminal }(stdinIsTerminal)
+	defer viper.Set("Async", viper.GetBool("Async"))
+	task := config.Task{Steps: []config.Step{{Name: "greet", Local: true, Command: []string{"true"}}, {Image: "node", Interactive: true}}}
+
+	stdinIsTerminal = func() bool { return false }
+	expectedErr := "dunner: step 'step-2' of 'test' task is interactive, which needs Dunner to be run from a terminal"
+	if err := checkInteractive(task, "test"); err == nil || err.Error() != expectedErr {
+		t.Errorf("expected error: %s, got %v", expectedErr, err)
+	}
+
+	stdinIsTerminal = func() bool { return true }
+	if err := checkInteractive(task, "test"); err != nil {
+		t.Errorf("expected no error, got: %s", err)
+	}
+
+	viper.Set("Async", true)
+	expectedErr = "dunner: step 'step-2' of 'test' task is interactive, which cannot be run in asynchronous mode, " +
+		"when running tasks in parallel or with --summary-only or --events"
+	if err := checkInteractive(task, "test"); err == nil || err.Error() != expectedErr {
+		t.Errorf("expected error: %s, got %v", expectedErr, err)
+	}
+}
+
+func TestUseTTY(t *testing.T) {
+	defer func(isTerminal func() bool) { stdoutIsTerminal = isTerminal }(stdoutIsTerminal)
+	defer viper.Set("Async", viper.GetBool("Async"))
+	enabled, disabled := true, false
+
+	stdoutIsTerminal = func() bool { return true }
+	if !useTTY(config.Step{}) {
+		t.Error("expected terminal to be used when output is a terminal")
+	}
+	if useTTY(config.Step{TTY: &disabled}) {
+		t.Error("expected terminal not to be used when disabled by the step")
+	}
+
+	viper.Set("Async", true)
+	if useTTY(config.Step{}) {
+		t.Error("expected terminal not to be used in asynchronous mode")
+	}
+	viper.Set("Async", false)
+
+	stdoutIsTerminal = func() bool { return false }
+	if useTTY(config.Step{}) {
+		t.Error("expected terminal not to be used when output is not a terminal")
+	}
+	if !useTTY(config.Step{TTY: &enabled}) {
+		t.Error("expected terminal to be used when enabled by the step")
+	}
+}
+
 func TestExecTaskAsync(t *testing.T) {
 	async := viper.GetBool("Async")
 	viper.Set("Async", true)
@@ -195,6 +277,53 @@ func TestGetDunnerUserFromUserEnv(t *testing.T) {
 	}
 }
 
+func TestGetDunnerUserAsHostUser(t *testing.T) {
+	want := fmt.Sprintf("%d:%d", os.Getuid(), os.Getgid())
+
+	got := getDunnerUser(config.Step{RunAsHostUser: true})
+
+	if got != want {
+		t.Errorf("got: %s, want: %s", got, want)
+	}
+}
+
+func TestGetDunnerUserFromStepOverridesHostUser(t *testing.T) {
+	want := "test_user"
+
+	got := getDunnerUser(config.Step{User: want, RunAsHostUser: true})
+
+	if got != want {
+		t.Errorf("got: %s, want: %s", got, want)
+	}
+}
+
+func TestGetDunnerUserHost(t *testing.T) {
+	want := fmt.Sprintf("%d:%d", os.Getuid(), os.Getgid())
+
+	got := getDunnerUser(config.Step{User: HostUser})
+
+	if got != want {
+		t.Fatalf("expected user: %s, got: %s", want, got)
+	}
+}
+
+func TestDefaultUser(t *testing.T) {
+	configs := &config.Configs{
+		User: "global",
+		Tasks: map[string]config.Task{
+			"withUser":    {User: "task"},
+			"withoutUser": {},
+		},
+	}
+
+	if got := defaultUser(configs, "withUser"); got != "task" {
+		t.Errorf("expected user of task, got: %s", got)
+	}
+	if got := defaultUser(configs, "withoutUser"); got != "global" {
+		t.Errorf("expected global user, got: %s", got)
+	}
+}
+
 func TestPassArgs_MultipleCommands(t *testing.T) {
 	step := docker.Step{
 		Commands: [][]string{{"ls", "$1"}, {"ls", "$2"}},
@@ -219,6 +348,23 @@ func TestPassArgs_SingleCommand(t *testing.T) {
 	}
 }
 
+func TestPassGlobalsWithExtraHosts(t *testing.T) {
+	step := config.Step{Image: busyBoxImage, ExtraHosts: []string{"db:10.0.0.2"}}
+	dockerStep := &docker.Step{Task: "build", ExtraHosts: step.ExtraHosts}
+	followStep := config.Step{Follow: "build", ExtraHosts: []string{"cache:10.0.0.3", "db:10.0.0.4"}}
+	configs := &config.Configs{
+		Tasks:      map[string]config.Task{"build": {Steps: []config.Step{step}}},
+		ExtraHosts: []string{"host.docker.internal:host-gateway", "cache:10.0.0.5"},
+	}
+
+	PassGlobals(dockerStep, configs, &step, &followStep)
+
+	expected := []string{"db:10.0.0.2", "cache:10.0.0.3", "host.docker.internal:host-gateway"}
+	if !reflect.DeepEqual(dockerStep.ExtraHosts, expected) {
+		t.Errorf("expected extra hosts: %v, got: %v", expected, dockerStep.ExtraHosts)
+	}
+}
+
 func TestPassGlobalsToOverrideGlobalLevelValuesFromFollowTask(t *testing.T) {
 	dockerStep := &docker.Step{Task: "build"}
 	tasks := make(map[string]config.Task, 0)
@@ -309,3 +455,180 @@ func TestPassGlobalsToOverrideTaskLevelValuesFromFollowTask(t *testing.T) {
 		t.Errorf("expected: %v, got: %v", expectedMounts, dockerStep.ExtMounts)
 	}
 }
+
+func TestFilterSteps(t *testing.T) {
+	steps := []config.Step{{Name: "lint"}, {Name: "test"}, {}, {Name: "build"}}
+
+	var tests = []struct {
+		name     string
+		only     []string
+		skip     []string
+		expected []config.Step
+	}{
+		{"no filters", nil, nil, steps},
+		{"only", []string{"test", "build"}, nil, []config.Step{{Name: "test"}, {Name: "build"}}},
+		{"skip", nil, []string{"lint"}, []config.Step{{Name: "test"}, {}, {Name: "build"}}},
+		{"only and skip", []string{"test", "build"}, []string{"build"}, []config.Step{{Name: "test"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := FilterSteps(steps, tt.only, tt.skip)
+			if err != nil {
+				t.Fatalf("expected no error, got %s", err)
+			}
+			if !reflect.DeepEqual(tt.expected, got) {
+				t.Errorf("expected: %v, got: %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestFilterStepsWithUnmatchedFilter(t *testing.T) {
+	steps := []config.Step{{Name: "lint"}}
+
+	_, err := FilterSteps(steps, nil, []string{"deploy"})
+
+	expected := "dunner: step filter 'deploy' does not match any named step of the task"
+	if err == nil || err.Error() != expected {
+		t.Fatalf("expected error: %s, got: %s", expected, err)
+	}
+}
+
+func TestRunWithUnreachableDaemon(t *testing.T) {
+	defer func(check func() *docker.DaemonStatus) { checkDaemon = check }(checkDaemon)
+	defer viper.Set("DunnerTaskFile", viper.GetString("DunnerTaskFile"))
+	checkDaemon = func() *docker.DaemonStatus {
+		return &docker.DaemonStatus{Host: "unix://" + docker.Socket, Err: errors.New("connection refused")}
+	}
+	var content = []byte(`
+tasks:
+  test:
+    steps:
+      - image: busybox
+        command: ["true"]
+`)
+	tmpFile := createDunnerTaskFile(t, content, ".dunner.yaml")
+	defer os.Remove(tmpFile.Name())
+
+	err := run([]string{"test"})
+
+	expected := "docker: cannot connect to the Docker daemon at unix://" + docker.Socket + ": connection refused"
+	if err == nil || !strings.HasPrefix(err.Error(), expected) {
+		t.Fatalf("expected error: %s, got: %v", expected, err)
+	}
+}
+
+func TestSignalExitCode(t *testing.T) {
+	if code := signalExitCode(os.Interrupt); code != 130 {
+		t.Errorf("expected exit code 130 for SIGINT, got: %d", code)
+	}
+	if code := signalExitCode(syscall.SIGTERM); code != 143 {
+		t.Errorf("expected exit code 143 for SIGTERM, got: %d", code)
+	}
+}
+
+func TestNeedsDocker(t *testing.T) {
+	local := config.Task{Steps: []config.Step{{Local: true, Command: []string{"true"}}, {Follow: "other"}}}
+	if needsDocker(&config.Configs{Tasks: map[string]config.Task{"local": local}}) {
+		t.Error("expected local steps not to need docker")
+	}
+	onContainer := config.Task{Steps: []config.Step{{Image: "busybox"}}}
+	if !needsDocker(&config.Configs{Tasks: map[string]config.Task{"local": local, "container": onContainer}}) {
+		t.Error("expected steps on containers to need docker")
+	}
+}
+
+func TestStepsFrom(t *testing.T) {
+	steps := []config.Step{{Name: "lint"}, {}, {Name: "test"}, {}}
+
+	var tests = []struct {
+		from     string
+		expected []config.Step
+	}{
+		{"", steps},
+		{"lint", []config.Step{{Name: "lint"}, {Name: "step-2"}, {Name: "test"}, {Name: "step-4"}}},
+		{"test", []config.Step{{Name: "test"}, {Name: "step-4"}}},
+		{"step-2", []config.Step{{Name: "step-2"}, {Name: "test"}, {Name: "step-4"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.from, func(t *testing.T) {
+			got, err := StepsFrom(steps, tt.from)
+			if err != nil {
+				t.Fatalf("expected no error, got %s", err)
+			}
+			if !reflect.DeepEqual(tt.expected, got) {
+				t.Errorf("expected: %v, got: %v", tt.expected, got)
+			}
+		})
+	}
+	if steps[1].Name != "" {
+		t.Errorf("expected steps of the task not to be modified, got: %v", steps)
+	}
+}
+
+func TestStepsFromUnmatchedStep(t *testing.T) {
+	_, err := StepsFrom([]config.Step{{Name: "lint"}}, "step-1")
+
+	expected := "dunner: step 'step-1' to run the task from does not match any step of the task"
+	if err == nil || err.Error() != expected {
+		t.Fatalf("expected error: %s, got: %s", expected, err)
+	}
+}
+
+func TestApplyImageOverrides(t *testing.T) {
+	configs := &config.Configs{Tasks: map[string]config.Task{
+		"build": {Steps: []config.Step{
+			{Name: "install", Image: "node:10.15.0"},
+			{Name: "lint", Image: "golangci/golangci-lint:v1.21"},
+			{Name: "test", Build: &config.Build{Context: "."}},
+		}},
+		"deploy": {Steps: []config.Step{{Name: "push", Image: "docker.io/library/node"}}},
+	}}
+
+	err := ApplyImageOverrides(configs, []string{"node=node:18", "test=golang:1.13"})
+
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	steps := configs.Tasks["build"].Steps
+	if steps[0].Image != "node:18" || configs.Tasks["deploy"].Steps[0].Image != "node:18" {
+		t.Errorf("expected node images to be overridden, got: %s and %s", steps[0].Image, configs.Tasks["deploy"].Steps[0].Image)
+	}
+	if steps[1].Image != "golangci/golangci-lint:v1.21" {
+		t.Errorf("expected image of unmatched step not to change, got: %s", steps[1].Image)
+	}
+	if steps[2].Image != "golang:1.13" || steps[2].Build != nil {
+		t.Errorf("expected build of step 'test' to be replaced by image, got: %s, %+v", steps[2].Image, steps[2].Build)
+	}
+}
+
+func TestApplyImageOverridesWithUnmatchedOverride(t *testing.T) {
+	configs := &config.Configs{Tasks: map[string]config.Task{"build": {Steps: []config.Step{{Name: "install", Image: "node"}}}}}
+
+	err := ApplyImageOverrides(configs, []string{"python=python:3"})
+
+	expected := "dunner: image override 'python=python:3' does not match the name or image of any step"
+	if err == nil || err.Error() != expected {
+		t.Fatalf("expected error: %s, got: %v", expected, err)
+	}
+}
+
+func TestApplyImageOverridesWithInvalidOverride(t *testing.T) {
+	err := ApplyImageOverrides(&config.Configs{}, []string{"node:18"})
+
+	expected := "dunner: invalid image override 'node:18', must be of the form 'name=image'"
+	if err == nil || err.Error() != expected {
+		t.Fatalf("expected error: %s, got: %v", expected, err)
+	}
+}
+
+func TestProcessWithEmptyImage(t *testing.T) {
+	step := &docker.Step{Task: "test", Name: "step-1", Command: []string{"ls"}}
+
+	err := Process(context.Background(), &config.Configs{}, step, nil, &config.Step{})
+
+	expectedErr := "dunner: image repository name cannot be empty"
+	if err == nil || err.Error() != expectedErr {
+		t.Fatalf("expected error: %s, got: %v", expectedErr, err)
+	}
+}
@@ -0,0 +1,38 @@
+package dunner
+
+import (
+	"time"
+
+	"github.com/leopardslab/dunner/pkg/docker"
+	"github.com/leopardslab/dunner/pkg/events"
+)
+
+// emitStepEvents registers hooks emitting an event when each step run afterwards starts and finishes
+func emitStepEvents() {
+	RegisterHooks(Hooks{
+		BeforeStep: func(step docker.Step) {
+			events.Emit(events.Event{Type: events.StepStarted, Task: step.Task, Step: step.Name, Image: step.Image})
+		},
+		AfterStep: func(step docker.Step, result *docker.Result, err error) {
+			event := events.Event{Type: events.StepFinished, Task: step.Task, Step: step.Name, Image: step.Image}
+			if result != nil {
+				exitCode := result.ExitCode
+				event.ExitCode = &exitCode
+				event.Duration = result.Duration.Seconds()
+			}
+			if err != nil {
+				event.Error = err.Error()
+			}
+			events.Emit(event)
+		},
+	})
+}
+
+// emitRunFinished emits the event of the end of a run started at `start`, with the error it failed with if any
+func emitRunFinished(start time.Time, err error) {
+	event := events.Event{Type: events.RunFinished, Duration: time.Since(start).Seconds()}
+	if err != nil {
+		event.Error = err.Error()
+	}
+	events.Emit(event)
+}
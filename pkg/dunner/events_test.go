@@ -0,0 +1,54 @@
+package dunner
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/leopardslab/dunner/pkg/config"
+	"github.com/leopardslab/dunner/pkg/docker"
+	"github.com/leopardslab/dunner/pkg/events"
+	"github.com/spf13/viper"
+)
+
+func TestEmitStepEvents(t *testing.T) {
+	defer ClearHooks()
+	var buf bytes.Buffer
+	events.SetOutput(&buf)
+	defer events.SetOutput(os.Stdout)
+	viper.Set("Events", true)
+	defer viper.Set("Events", false)
+	emitStepEvents()
+	step := &docker.Step{Task: "test", Name: "fail", Local: true, Command: []string{"sh", "-c", "echo failing; exit 3"}}
+
+	Process(context.Background(), &config.Configs{}, step, nil, &config.Step{})
+
+	var types []string
+	var finished events.Event
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var event events.Event
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			t.Fatalf("expected a JSON event per line, got: %q: %s", line, err)
+		}
+		if event.Task != "test" || event.Step != "fail" {
+			t.Errorf("expected event of the step, got: %+v", event)
+		}
+		if event.Type == events.Log && (event.Line != "failing" || event.Stream != events.Stdout) {
+			t.Errorf("expected log of standard output, got: %+v", event)
+		}
+		if event.Type == events.StepFinished {
+			finished = event
+		}
+		types = append(types, event.Type)
+	}
+	expected := []string{events.StepStarted, events.Log, events.StepFinished}
+	if strings.Join(types, ",") != strings.Join(expected, ",") {
+		t.Fatalf("expected events: %v, got: %v", expected, types)
+	}
+	if finished.ExitCode == nil || *finished.ExitCode != 3 || finished.Error == "" {
+		t.Errorf("expected step to finish with exit code 3 and error, got: %+v", finished)
+	}
+}
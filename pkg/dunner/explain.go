@@ -0,0 +1,88 @@
+package dunner
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/leopardslab/dunner/pkg/config"
+)
+
+// Decision tells whether a step of a task is run, and why
+type Decision struct {
+	Task   string
+	Step   string
+	Run    bool
+	Reason string
+}
+
+func (d Decision) String() string {
+	verdict := "skipped"
+	if d.Run {
+		verdict = "run"
+	}
+	return fmt.Sprintf("Task '%s', step '%s': %s, %s", d.Task, d.Step, verdict, d.Reason)
+}
+
+// ExplainSteps returns the decisions on the given steps of the task, as taken by StepsFrom and FilterSteps with the
+// given `from`, `only` and `skip`, in the order of the steps. The steps of the tasks followed by steps run are
+// explained after them, as they are run in their place.
+func ExplainSteps(configs *config.Configs, taskName string, steps []config.Step, from string, only []string, skip []string) []Decision {
+	return explainSteps(configs, taskName, steps, from, only, skip, map[string]struct{}{taskName: {}})
+}
+
+func explainSteps(configs *config.Configs, taskName string, steps []config.Step, from string, only []string, skip []string, explained map[string]struct{}) []Decision {
+	resumed := from == ""
+	var decisions []Decision
+	for i, step := range steps {
+		name := step.Name
+		if name == "" {
+			name = config.DefaultStepName(i)
+		}
+		decision := Decision{Task: taskName, Step: name}
+		if !resumed && name == from {
+			resumed = true
+		}
+		switch {
+		case !resumed:
+			decision.Reason = fmt.Sprintf("it comes before step '%s' given with --from", from)
+		case len(only) != 0 && !contains(only, name):
+			decision.Reason = "it is not given with --only"
+		case contains(skip, name):
+			decision.Reason = "it is given with --skip"
+		default:
+			decision.Run = true
+			decision.Reason = runReason(step, name == from, len(only) != 0)
+		}
+		decisions = append(decisions, decision)
+
+		if _, seen := explained[step.Follow]; decision.Run && step.Follow != "" && !seen {
+			explained[step.Follow] = struct{}{}
+			decisions = append(decisions, explainSteps(configs, step.Follow, configs.Tasks[step.Follow].Steps, "", nil, nil, explained)...)
+		}
+	}
+	return decisions
+}
+
+// runReason returns why a step is run, selected by the step filters or run by default, along with where it runs
+func runReason(step config.Step, from bool, only bool) string {
+	reason := "no step filter excludes it"
+	switch {
+	case only:
+		reason = "it is given with --only"
+	case from:
+		reason = "the task resumes from it with --from"
+	}
+
+	switch {
+	case step.Follow != "":
+		return fmt.Sprintf("%s, running the steps of task '%s'", reason, step.Follow)
+	case step.Local:
+		return fmt.Sprintf("%s, on the host", reason)
+	case len(step.Images) != 0:
+		return fmt.Sprintf("%s, on a container of each of images '%s'", reason, strings.Join(step.Images, "', '"))
+	case step.Build != nil:
+		return fmt.Sprintf("%s, on a container of the image built from its Dockerfile", reason)
+	default:
+		return fmt.Sprintf("%s, on a container of image '%s'", reason, step.Image)
+	}
+}
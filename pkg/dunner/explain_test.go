@@ -0,0 +1,79 @@
+package dunner
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/leopardslab/dunner/pkg/config"
+)
+
+func TestExplainSteps(t *testing.T) {
+	configs := &config.Configs{Tasks: map[string]config.Task{
+		"build": {Steps: []config.Step{
+			{Name: "lint", Image: "golang"},
+			{Name: "test", Local: true},
+			{Name: "setup", Follow: "setup"},
+			{Name: "package", Build: &config.Build{}},
+		}},
+		"setup": {Steps: []config.Step{{Name: "deps", Image: "alpine"}}},
+	}}
+	steps := configs.Tasks["build"].Steps
+
+	var tests = []struct {
+		name     string
+		from     string
+		only     []string
+		skip     []string
+		expected []Decision
+	}{
+		{
+			name: "no filters",
+			expected: []Decision{
+				{"build", "lint", true, "no step filter excludes it, on a container of image 'golang'"},
+				{"build", "test", true, "no step filter excludes it, on the host"},
+				{"build", "setup", true, "no step filter excludes it, running the steps of task 'setup'"},
+				{"setup", "deps", true, "no step filter excludes it, on a container of image 'alpine'"},
+				{"build", "package", true, "no step filter excludes it, on a container of the image built from its Dockerfile"},
+			},
+		},
+		{
+			name: "from, only and skip",
+			from: "test",
+			only: []string{"test", "package"},
+			skip: []string{"package"},
+			expected: []Decision{
+				{"build", "lint", false, "it comes before step 'test' given with --from"},
+				{"build", "test", true, "it is given with --only, on the host"},
+				{"build", "setup", false, "it is not given with --only"},
+				{"build", "package", false, "it is given with --skip"},
+			},
+		},
+		{
+			name: "from",
+			from: "package",
+			expected: []Decision{
+				{"build", "lint", false, "it comes before step 'package' given with --from"},
+				{"build", "test", false, "it comes before step 'package' given with --from"},
+				{"build", "setup", false, "it comes before step 'package' given with --from"},
+				{"build", "package", true, "the task resumes from it with --from, on a container of the image built from its Dockerfile"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ExplainSteps(configs, "build", steps, tt.from, tt.only, tt.skip)
+			if !reflect.DeepEqual(tt.expected, got) {
+				t.Errorf("expected: %v, got: %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestDecisionString(t *testing.T) {
+	decision := Decision{Task: "build", Step: "lint", Reason: "it is given with --skip"}
+
+	expected := "Task 'build', step 'lint': skipped, it is given with --skip"
+	if decision.String() != expected {
+		t.Fatalf("expected: %s, got: %s", expected, decision.String())
+	}
+}
@@ -0,0 +1,79 @@
+package dunner
+
+import (
+	"sync"
+
+	"github.com/leopardslab/dunner/pkg/docker"
+)
+
+// Hooks are functions called on events of the lifecycle of steps, letting programs using dunner as a library add
+// metrics or notifications. Any of them can be nil. Steps of asynchronous mode and parallel tasks run concurrently,
+// so hooks must be safe to be called concurrently.
+type Hooks struct {
+	// BeforePull is called before the image of a step is pulled, it is not called if the image is already present
+	BeforePull func(step docker.Step)
+	// BeforeStep is called before a step is run, after its arguments are replaced
+	BeforeStep func(step docker.Step)
+	// AfterStep is called after a step has run, with its result and the error it failed with, if any. Result is nil
+	// if the step could not be run at all.
+	AfterStep func(step docker.Step, result *docker.Result, err error)
+	// OnFailure is called when a step fails after all its retries, even if its failure is allowed
+	OnFailure func(step docker.Step, err error)
+}
+
+var registeredHooks struct {
+	sync.RWMutex
+	list []Hooks
+}
+
+// RegisterHooks adds hooks to be called on the lifecycle events of every step run afterwards. Hooks registered
+// earlier are called first.
+func RegisterHooks(hooks Hooks) {
+	registeredHooks.Lock()
+	defer registeredHooks.Unlock()
+	registeredHooks.list = append(registeredHooks.list, hooks)
+}
+
+// ClearHooks removes all the registered hooks
+func ClearHooks() {
+	registeredHooks.Lock()
+	defer registeredHooks.Unlock()
+	registeredHooks.list = nil
+}
+
+// callHooks calls the function with each of the registered hooks, in order of registration
+func callHooks(fn func(hooks Hooks)) {
+	registeredHooks.RLock()
+	list := registeredHooks.list
+	registeredHooks.RUnlock()
+	for _, hooks := range list {
+		fn(hooks)
+	}
+}
+
+func beforePull(step docker.Step) {
+	callHooks(func(hooks Hooks) {
+		if hooks.BeforePull != nil {
+			hooks.BeforePull(step)
+		}
+	})
+}
+
+func beforeStep(step docker.Step) {
+	callHooks(func(hooks Hooks) {
+		if hooks.BeforeStep != nil {
+			hooks.BeforeStep(step)
+		}
+	})
+}
+
+func afterStep(step docker.Step, result *docker.Result, err error) {
+	callHooks(func(hooks Hooks) {
+		if hooks.AfterStep != nil {
+			hooks.AfterStep(step, result, err)
+		}
+		if err != nil && hooks.OnFailure != nil {
+			hooks.OnFailure(step, err)
+		}
+	})
+}
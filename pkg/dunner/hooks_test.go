@@ -0,0 +1,44 @@
+package dunner
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/leopardslab/dunner/pkg/config"
+	"github.com/leopardslab/dunner/pkg/docker"
+)
+
+func TestProcessCallsHooks(t *testing.T) {
+	defer ClearHooks()
+	var events []string
+	RegisterHooks(Hooks{
+		BeforeStep: func(step docker.Step) { events = append(events, "before "+step.Name) },
+		AfterStep: func(step docker.Step, result *docker.Result, err error) {
+			events = append(events, "after "+step.Name)
+			if result == nil || result.ExitCode != 3 || err == nil {
+				t.Errorf("expected result with exit code 3 and error, got: %+v, %v", result, err)
+			}
+		},
+		OnFailure: func(step docker.Step, err error) { events = append(events, "failure "+step.Name) },
+	})
+	RegisterHooks(Hooks{OnFailure: func(step docker.Step, err error) { events = append(events, "notify "+step.Name) }})
+	step := &docker.Step{Task: "test", Name: "fail", Local: true, Command: []string{"sh", "-c", "exit 3"}}
+
+	Process(context.Background(), &config.Configs{}, step, nil, &config.Step{})
+
+	expected := []string{"before fail", "after fail", "failure fail", "notify fail"}
+	if !reflect.DeepEqual(events, expected) {
+		t.Fatalf("expected hooks to be called: %v, got: %v", expected, events)
+	}
+}
+
+func TestProcessCallsNoFailureHookOnSuccess(t *testing.T) {
+	defer ClearHooks()
+	RegisterHooks(Hooks{OnFailure: func(step docker.Step, err error) { t.Errorf("unexpected failure of step: %s", err) }})
+	step := &docker.Step{Task: "test", Name: "pass", Local: true, Command: []string{"true"}}
+
+	if err := Process(context.Background(), &config.Configs{}, step, nil, &config.Step{}); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+}
@@ -0,0 +1,117 @@
+package dunner
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/leopardslab/dunner/internal/logger"
+	"github.com/leopardslab/dunner/pkg/docker"
+	"github.com/leopardslab/dunner/pkg/events"
+	"github.com/spf13/viper"
+)
+
+// execLocal runs the commands of a `local` step directly on the host, in the project directory or the `dir` of the
+// step relative to it. The step's environment variables are added to those of the host. The outcome is reported the
+// same way as for steps run on containers. The commands are killed once ctx is cancelled.
+func execLocal(ctx context.Context, step *docker.Step) (*docker.Result, error) {
+	var (
+		async   = docker.ConcurrentOutput() || step.Concurrent
+		capture = docker.CaptureOutput()
+		dryRun  = viper.GetBool("Dry-run")
+	)
+
+	var result = docker.Result{}
+	start := time.Now()
+	defer func() { result.Duration = time.Since(start) }()
+
+	dir := step.HostDir
+	if step.WorkDir != "" {
+		if filepath.IsAbs(step.WorkDir) {
+			dir = step.WorkDir
+		} else {
+			dir = filepath.Join(dir, step.WorkDir)
+		}
+	}
+
+	outputFile, closeOutputFile, err := step.OpenOutputFile()
+	if err != nil {
+		return &result, err
+	}
+	defer closeOutputFile()
+
+	env, err := step.Environment()
+	if err != nil {
+		return &result, err
+	}
+	commands := step.Commands
+	if len(commands) == 0 {
+		commands = append(commands, step.Command)
+	}
+
+	for _, command := range commands {
+		if dryRun {
+			continue
+		}
+		if len(command) == 0 {
+			return &result, fmt.Errorf(`config: Command cannot be empty`)
+		}
+
+		logger.WithStep(step.Task, step.Name).Infof("Running command '%s' of step '%s' of '%s' task on the host", strings.Join(command, " "), step.Name, step.Task)
+
+		var out, errOut bytes.Buffer
+		cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), env...)
+		if step.Interactive {
+			cmd.Stdin = os.Stdin
+		}
+		cmd.Stdout = io.MultiWriter(os.Stdout, outputFile)
+		cmd.Stderr = io.MultiWriter(logger.NewErrWriter(), outputFile)
+		var outWriter, errWriter *logger.PrefixWriter
+		prefix := step.OutputPrefix()
+		limit := docker.NewOutputLimit()
+		logs := events.NewLogs(step.Task, step.Name)
+		if capture {
+			cmd.Stdout = io.MultiWriter(&out, logs.Stdout(), outputFile)
+			cmd.Stderr = io.MultiWriter(&errOut, logs.Stderr(), outputFile)
+		} else if async {
+			outWriter = logger.NewPrefixWriter(limit.Wrap(os.Stdout), prefix)
+			errWriter = logger.NewPrefixWriter(limit.Wrap(os.Stderr), prefix)
+			cmd.Stdout = io.MultiWriter(&out, outWriter, outputFile)
+			cmd.Stderr = io.MultiWriter(&errOut, errWriter, outputFile)
+		} else if prefix != "" || limit != nil {
+			outWriter = logger.NewPrefixWriter(limit.Wrap(os.Stdout), prefix)
+			errWriter = logger.NewErrPrefixWriter(limit.Wrap(os.Stderr), prefix)
+			cmd.Stdout = io.MultiWriter(outWriter, outputFile)
+			cmd.Stderr = io.MultiWriter(errWriter, outputFile)
+		}
+
+		err := cmd.Run()
+		if outWriter != nil {
+			outWriter.Flush()
+			errWriter.Flush()
+		}
+		limit.Finish(err != nil)
+		logs.Flush()
+		if cmd.ProcessState != nil {
+			result.ExitCodes = append(result.ExitCodes, cmd.ProcessState.ExitCode())
+		}
+		result.Output += out.String()
+		result.Error += errOut.String()
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			result.ExitCode = exitErr.ExitCode()
+			return &result, fmt.Errorf("dunner: command execution failed with exit code %d", result.ExitCode)
+		}
+		if err != nil {
+			return &result, fmt.Errorf("dunner: failed to run command '%s' on the host: %s", strings.Join(command, " "), err.Error())
+		}
+	}
+	return &result, nil
+}
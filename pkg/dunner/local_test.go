@@ -0,0 +1,190 @@
+package dunner
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/leopardslab/dunner/pkg/config"
+	"github.com/leopardslab/dunner/pkg/docker"
+	"github.com/spf13/viper"
+)
+
+func TestExecLocal(t *testing.T) {
+	async := viper.GetBool("Async")
+	viper.Set("Async", true)
+	defer viper.Set("Async", async)
+
+	step := &docker.Step{
+		Task:     "test",
+		Name:     "greet",
+		Local:    true,
+		Commands: [][]string{{"sh", "-c", "echo $GREETING"}, {"pwd"}},
+		Env:      []string{"GREETING=hello world"},
+		WorkDir:  "/",
+	}
+
+	result, err := execLocal(context.Background(), step)
+
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if expected := "hello world\n/\n"; result.Output != expected {
+		t.Fatalf("expected output: %q, got: %q", expected, result.Output)
+	}
+}
+
+func TestExecLocalInteractive(t *testing.T) {
+	async := viper.GetBool("Async")
+	viper.Set("Async", true)
+	defer viper.Set("Async", async)
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(stdin *os.File) { os.Stdin = stdin }(os.Stdin)
+	os.Stdin = r
+	w.WriteString("hello from stdin\n")
+	w.Close()
+
+	step := &docker.Step{Task: "test", Name: "read", Local: true, Interactive: true, Command: []string{"cat"}}
+	result, err := execLocal(context.Background(), step)
+
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if expected := "hello from stdin\n"; result.Output != expected {
+		t.Fatalf("expected output: %q, got: %q", expected, result.Output)
+	}
+}
+
+func TestExecLocalWithFailingCommand(t *testing.T) {
+	step := &docker.Step{Task: "test", Name: "fail", Local: true, Command: []string{"sh", "-c", "exit 3"}}
+
+	result, err := execLocal(context.Background(), step)
+
+	expectedErr := "dunner: command execution failed with exit code 3"
+	if err == nil || err.Error() != expectedErr {
+		t.Fatalf("expected error: %s, got: %v", expectedErr, err)
+	}
+	if result.ExitCode != 3 {
+		t.Fatalf("expected exit code 3, got: %d", result.ExitCode)
+	}
+	if !reflect.DeepEqual(result.ExitCodes, []int{3}) {
+		t.Fatalf("expected exit codes [3], got: %v", result.ExitCodes)
+	}
+}
+
+func TestProcessLocalStepFailure(t *testing.T) {
+	step := &docker.Step{Task: "test", Name: "fail", Local: true, Command: []string{"sh", "-c", "exit 3"}}
+
+	err := Process(context.Background(), &config.Configs{}, step, nil, &config.Step{})
+
+	exitErr, ok := err.(*ExitError)
+	if !ok || exitErr.ExitCode != 3 {
+		t.Fatalf("expected exit error with code 3, got: %v", err)
+	}
+}
+
+func TestProcessRetriesFailedStep(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dunner-retry")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	marker := filepath.Join(dir, "attempted")
+	// Fails on the first attempt only
+	step := &docker.Step{
+		Task:    "test",
+		Name:    "flaky",
+		Local:   true,
+		Command: []string{"sh", "-c", "test -f " + marker + " || { touch " + marker + "; exit 1; }"},
+		Retries: 2,
+	}
+
+	if err := Process(context.Background(), &config.Configs{}, step, nil, &config.Step{}); err != nil {
+		t.Fatalf("expected step to succeed on retry, got: %s", err)
+	}
+}
+
+func TestProcessFailsAfterRetries(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dunner-retry")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	attempts := filepath.Join(dir, "attempts")
+	step := &docker.Step{
+		Task:    "test",
+		Name:    "failing",
+		Local:   true,
+		Command: []string{"sh", "-c", "echo >> " + attempts + "; exit 2"},
+		Retries: 2,
+	}
+
+	err = Process(context.Background(), &config.Configs{}, step, nil, &config.Step{})
+
+	if exitErr, ok := err.(*ExitError); !ok || exitErr.ExitCode != 2 {
+		t.Fatalf("expected exit error with code 2, got: %v", err)
+	}
+	if content, _ := ioutil.ReadFile(attempts); len(content) != 3 {
+		t.Fatalf("expected 3 attempts, got: %d", len(content))
+	}
+}
+
+func TestExecLocalSavesOutputFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dunner-output")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	outputFile := filepath.Join(dir, "logs", "greet.log")
+	step := &docker.Step{
+		Task:       "test",
+		Name:       "greet",
+		Local:      true,
+		Commands:   [][]string{{"echo", "hello"}, {"sh", "-c", "echo oops >&2"}},
+		OutputFile: outputFile,
+	}
+
+	if _, err := execLocal(context.Background(), step); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+
+	content, err := ioutil.ReadFile(outputFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "hello\noops\n"; string(content) != expected {
+		t.Fatalf("expected output file content: %q, got: %q", expected, string(content))
+	}
+}
+
+func TestProcessStopsWaitingToRetryOnceCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	step := &docker.Step{
+		Task:       "test",
+		Name:       "failing",
+		Local:      true,
+		Command:    []string{"sh", "-c", "exit 2"},
+		Retries:    2,
+		RetryDelay: time.Minute,
+	}
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	done := make(chan error, 1)
+	go func() { done <- Process(ctx, &config.Configs{}, step, nil, &config.Step{}) }()
+
+	select {
+	case err := <-done:
+		if err != context.Canceled {
+			t.Fatalf("expected error: %s, got: %v", context.Canceled, err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected step to stop waiting to be retried once cancelled")
+	}
+}
@@ -0,0 +1,60 @@
+package dunner
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/leopardslab/dunner/pkg/config"
+	"github.com/leopardslab/dunner/pkg/docker"
+)
+
+// matrixStepName returns the name of the run of the step on one of its `images`, which labels its output
+func matrixStepName(name string, image string) string {
+	return fmt.Sprintf("%s[%s]", name, image)
+}
+
+// imagePathReplacer replaces the characters of image references not allowed in file names on all platforms
+var imagePathReplacer = strings.NewReplacer("/", "_", ":", "_", "@", "_")
+
+// processMatrix runs the step once on each of its `images`, one after another, as steps named after the image.
+// All the images are run even if some fail, and the step fails if any of them does. The failure is an `ExitError`
+// with the exit code of the first image failing, unless an image failed to run at all.
+func processMatrix(ctx context.Context, configs *config.Configs, s *docker.Step, args []string, dunnerStep *config.Step) error {
+	var failures []string
+	var exitErr *ExitError
+	ran := true
+	for _, image := range dunnerStep.Images {
+		run := *s
+		run.Name = matrixStepName(s.Name, image)
+		run.Image = image
+		if run.Digest = docker.ImageDigest(image); run.Digest == "" {
+			run.Digest = configs.LockedDigests[image]
+		}
+		run.LogFile = logFile(s.Task, fmt.Sprintf("%s-%s", s.Name, imagePathReplacer.Replace(image)))
+
+		err := Process(ctx, configs, &run, args, dunnerStep)
+		if err == nil {
+			continue
+		}
+		failures = append(failures, fmt.Sprintf("%s (%s)", image, err.Error()))
+		if e, ok := err.(*ExitError); !ok {
+			ran = false
+		} else if exitErr == nil {
+			exitErr = e
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	if len(failures) == 0 {
+		return nil
+	}
+
+	err := fmt.Errorf("dunner: step '%s' of '%s' task failed on %d of %d images: %s",
+		s.Name, s.Task, len(failures), len(dunnerStep.Images), strings.Join(failures, ", "))
+	if !ran {
+		return err
+	}
+	return &ExitError{ExitCode: exitErr.ExitCode, Err: err}
+}
@@ -0,0 +1,28 @@
+package dunner
+
+import (
+	"context"
+	"testing"
+
+	"github.com/leopardslab/dunner/pkg/config"
+	"github.com/leopardslab/dunner/pkg/docker"
+)
+
+func TestProcessMatrixRunsAllImages(t *testing.T) {
+	step := &docker.Step{Task: "test", Name: "unit", Command: []string{"npm", "test", "$1"}}
+	definition := &config.Step{Name: "unit", Images: []string{"node:16", "node:18"}}
+
+	err := Process(context.Background(), &config.Configs{}, step, nil, definition)
+
+	expected := "dunner: step 'unit' of 'test' task failed on 2 of 2 images: " +
+		"node:16 (dunner: insufficient number of arguments passed), node:18 (dunner: insufficient number of arguments passed)"
+	if err == nil || err.Error() != expected {
+		t.Fatalf("expected error: %s, got: %v", expected, err)
+	}
+}
+
+func TestMatrixStepName(t *testing.T) {
+	if name := matrixStepName("unit", "node:16"); name != "unit[node:16]" {
+		t.Fatalf("expected name: unit[node:16], got: %s", name)
+	}
+}
@@ -0,0 +1,47 @@
+package dunner
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/leopardslab/dunner/pkg/docker"
+	"github.com/leopardslab/dunner/pkg/notify"
+	"github.com/spf13/viper"
+)
+
+// runAndNotify runs the task as `run` does, and posts a notification of its completion to the webhook URL of the
+// `Notify` setting, if set. Failing to send the notification is logged and does not fail the run.
+func runAndNotify(args []string) error {
+	url := viper.GetString("Notify")
+	if url == "" {
+		return run(args)
+	}
+
+	var mu sync.Mutex
+	var failedSteps []notify.FailedStep
+	RegisterHooks(Hooks{
+		OnFailure: func(step docker.Step, err error) {
+			if step.AllowFailure {
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			failedSteps = append(failedSteps, notify.FailedStep{Task: step.Task, Step: step.Name, Error: err.Error()})
+		},
+	})
+
+	start := time.Now()
+	err := run(args)
+	task := args[0]
+	if viper.GetBool("Parallel-tasks") {
+		task = strings.Join(args, ", ")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if notifyErr := notify.Send(url, notify.New(task, err, time.Since(start), failedSteps)); notifyErr != nil {
+		log.Warn(notifyErr)
+	}
+	return err
+}
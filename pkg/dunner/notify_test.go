@@ -0,0 +1,54 @@
+package dunner
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/leopardslab/dunner/pkg/notify"
+	"github.com/spf13/viper"
+)
+
+func TestRunAndNotify(t *testing.T) {
+	var received notify.Notification
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer server.Close()
+	defer ClearHooks()
+	defer viper.Set("DunnerTaskFile", viper.GetString("DunnerTaskFile"))
+	defer viper.Set("Notify", "")
+	viper.Set("Notify", server.URL)
+	var content = []byte(`
+tasks:
+  check:
+    steps:
+      - name: lint
+        local: true
+        command: ["false"]
+        allow_failure: true
+      - name: test
+        local: true
+        command: ["sh", "-c", "exit 2"]
+`)
+	tmpFile := createDunnerTaskFile(t, content, ".dunner.yaml")
+	defer os.Remove(tmpFile.Name())
+
+	err := runAndNotify([]string{"check"})
+
+	if exitErr, ok := err.(*ExitError); !ok || exitErr.ExitCode != 2 {
+		t.Fatalf("expected exit error with code 2, got: %v", err)
+	}
+	if received.Task != "check" || received.Status != notify.StatusFailure {
+		t.Fatalf("expected failure notification of task 'check', got: %+v", received)
+	}
+	expected := []notify.FailedStep{{Task: "check", Step: "test", Error: "dunner: command execution failed with exit code 2"}}
+	if !reflect.DeepEqual(received.FailedSteps, expected) {
+		t.Fatalf("expected failed steps: %+v, got: %+v", expected, received.FailedSteps)
+	}
+}
@@ -0,0 +1,189 @@
+package dunner
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"runtime"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/leopardslab/dunner/internal/logger"
+	"github.com/leopardslab/dunner/pkg/config"
+	"github.com/leopardslab/dunner/pkg/docker"
+	"github.com/spf13/viper"
+)
+
+// TaskResult is the outcome of a task run along with other tasks
+type TaskResult struct {
+	Task     string
+	Duration time.Duration
+	Err      error
+}
+
+// ExecTasksInParallel runs the given tasks concurrently, at most `limit` of them at a time, or all at once if `limit`
+// is not positive. All tasks are run to completion even if some fail, then a summary of the results is printed
+// and the error of the first failed task, in the given order, is returned.
+func ExecTasksInParallel(ctx context.Context, configs *config.Configs, taskNames []string, limit int) error {
+	for _, taskName := range taskNames {
+		if _, exists := configs.Tasks[taskName]; !exists {
+			return fmt.Errorf("dunner: task '%s' does not exist", taskName)
+		}
+	}
+	if limit <= 0 || limit > len(taskNames) {
+		limit = len(taskNames)
+	}
+
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, limit)
+	results := make([]TaskResult, len(taskNames))
+	for i, taskName := range taskNames {
+		wg.Add(1)
+		go func(i int, taskName string) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			start := time.Now()
+			err := ExecTask(ctx, configs, taskName, nil, nil)
+			results[i] = TaskResult{Task: taskName, Duration: time.Since(start), Err: err}
+		}(i, taskName)
+	}
+	wg.Wait()
+
+	printSummary(results)
+	for _, result := range results {
+		if result.Err != nil {
+			return result.Err
+		}
+	}
+	return nil
+}
+
+// printSummary prints a table of the results of the tasks, followed by the ID of the run labelling its containers
+func printSummary(results []TaskResult) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "\nTASK\tSTATUS\tDURATION\tERROR")
+	for _, result := range results {
+		status, errMsg := "succeeded", ""
+		if result.Err != nil {
+			status, errMsg = "failed", result.Err.Error()
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", result.Task, status, result.Duration.Round(time.Millisecond), errMsg)
+	}
+	w.Flush()
+	fmt.Printf("Run ID: %s\n", docker.RunID)
+}
+
+// parallelStep is a step of a group of consecutive steps marked `parallel`, along with its definition
+type parallelStep struct {
+	step       docker.Step
+	definition config.Step
+}
+
+// semaphore holds slots taken by goroutines while they run, limiting how many of them run at a time
+type semaphore struct {
+	sync.Mutex
+	limit int
+	slots chan struct{}
+}
+
+// withLimit returns the slots of the semaphore, as many as limit. They are replaced if the limit changed.
+func (s *semaphore) withLimit(limit int) chan struct{} {
+	s.Lock()
+	defer s.Unlock()
+	if s.slots == nil || s.limit != limit {
+		s.limit, s.slots = limit, make(chan struct{}, limit)
+	}
+	return s.slots
+}
+
+// stepSlots limits the number of steps marked `parallel` running at a time, across the groups of all tasks
+var stepSlots semaphore
+
+// containerSlots limits the number of containers of steps running at a time, across all tasks and steps
+var containerSlots semaphore
+
+// parallelStepSlots returns the slots of steps marked `parallel`, `Max-parallel-steps` of them or as many as CPUs if
+// not positive
+func parallelStepSlots() chan struct{} {
+	limit := viper.GetInt("Max-parallel-steps")
+	if limit <= 0 {
+		limit = runtime.NumCPU()
+	}
+	return stepSlots.withLimit(limit)
+}
+
+// acquireContainerSlot waits for one of the `Concurrency` slots of containers, as many as GOMAXPROCS if not
+// positive, and returns the function releasing it. Parallel tasks, parallel steps and asynchronous steps all share
+// these slots, so that they do not overwhelm the Docker daemon. It fails if ctx is cancelled meanwhile.
+func acquireContainerSlot(ctx context.Context) (func(), error) {
+	limit := viper.GetInt("Concurrency")
+	if limit <= 0 {
+		limit = runtime.GOMAXPROCS(0)
+	}
+	slots := containerSlots.withLimit(limit)
+	select {
+	case slots <- struct{}{}:
+		return func() { <-slots }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// execParallelSteps runs the group of steps concurrently, with their output line buffered and prefixed. Once a step
+// fails, the rest of the group is cancelled. The error of the first failed step in the order of the group is
+// returned, leaving out the steps failed as they were cancelled.
+func execParallelSteps(ctx context.Context, configs *config.Configs, group []parallelStep, args []string) error {
+	if len(group) == 0 {
+		return nil
+	}
+	groupCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	slots := parallelStepSlots()
+	errs := make([]error, len(group))
+	for i := range group {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			step, definition := group[i].step, group[i].definition
+			step.Concurrent = true
+			// Steps following a task do not take a slot, the steps of the task take theirs
+			if step.Follow == "" {
+				select {
+				case slots <- struct{}{}:
+					defer func() { <-slots }()
+				case <-groupCtx.Done():
+					if ctx.Err() == nil {
+						logger.WithStep(step.Task, step.Name).Warnf("Step '%s' of '%s' task is cancelled as another step failed", step.Name, step.Task)
+					}
+					return
+				}
+			}
+
+			err := Process(groupCtx, configs, &step, args, &definition)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil && groupCtx.Err() != nil && ctx.Err() == nil {
+				logger.WithStep(step.Task, step.Name).Warnf("Step '%s' of '%s' task is cancelled as another step failed", step.Name, step.Task)
+				return
+			}
+			if err != nil {
+				errs[i] = err
+				cancel()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
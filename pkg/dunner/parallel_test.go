@@ -0,0 +1,133 @@
+package dunner
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/leopardslab/dunner/pkg/config"
+	"github.com/spf13/viper"
+)
+
+func localTask(command ...string) config.Task {
+	return config.Task{Steps: []config.Step{{Name: "run", Local: true, Command: command}}}
+}
+
+func TestExecTasksInParallel(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dunner-parallel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	configs := &config.Configs{Tasks: map[string]config.Task{
+		"first":  localTask("touch", filepath.Join(dir, "first")),
+		"second": localTask("touch", filepath.Join(dir, "second")),
+	}}
+
+	if err := ExecTasksInParallel(context.Background(), configs, []string{"first", "second"}, 1); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	for _, name := range []string{"first", "second"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("expected task '%s' to run, got: %s", name, err)
+		}
+	}
+}
+
+func TestExecTasksInParallelWithFailures(t *testing.T) {
+	configs := &config.Configs{Tasks: map[string]config.Task{
+		"ok":     localTask("true"),
+		"exit-3": localTask("sh", "-c", "exit 3"),
+		"exit-4": localTask("sh", "-c", "exit 4"),
+	}}
+
+	err := ExecTasksInParallel(context.Background(), configs, []string{"ok", "exit-3", "exit-4"}, 0)
+
+	exitErr, ok := err.(*ExitError)
+	if !ok || exitErr.ExitCode != 3 {
+		t.Fatalf("expected exit error of first failed task with code 3, got: %v", err)
+	}
+}
+
+func TestExecTasksInParallelWithMissingTask(t *testing.T) {
+	configs := &config.Configs{Tasks: map[string]config.Task{"ok": localTask("true")}}
+
+	err := ExecTasksInParallel(context.Background(), configs, []string{"ok", "missing"}, 0)
+
+	expectedErr := "dunner: task 'missing' does not exist"
+	if err == nil || err.Error() != expectedErr {
+		t.Fatalf("expected error: %s, got: %v", expectedErr, err)
+	}
+}
+
+func localParallelStep(name string, command ...string) config.Step {
+	return config.Step{Name: name, Local: true, Parallel: true, Command: command}
+}
+
+func TestExecTaskRunsParallelStepsConcurrently(t *testing.T) {
+	defer viper.Set("Max-parallel-steps", viper.GetInt("Max-parallel-steps"))
+	viper.Set("Max-parallel-steps", 2)
+	dir, err := ioutil.TempDir("", "dunner-parallel-steps")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// Each step waits for the other one to start
+	waitFor := func(created string, awaited string) []string {
+		return []string{"sh", "-c", "touch " + created + "; for i in $(seq 50); do [ -f " + awaited + " ] && exit 0; sleep 0.1; done; exit 1"}
+	}
+	first, second := filepath.Join(dir, "first"), filepath.Join(dir, "second")
+	configs := &config.Configs{Tasks: map[string]config.Task{"test": {Steps: []config.Step{
+		localParallelStep("first", waitFor(first, second)...),
+		localParallelStep("second", waitFor(second, first)...),
+		{Name: "after", Local: true, Command: []string{"test", "-f", first, "-a", "-f", second}},
+	}}}}
+
+	if err := ExecTask(context.Background(), configs, "test", nil, nil); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+}
+
+func TestExecTaskCancelsParallelStepsOnFailure(t *testing.T) {
+	defer viper.Set("Max-parallel-steps", viper.GetInt("Max-parallel-steps"))
+	viper.Set("Max-parallel-steps", 2)
+	configs := &config.Configs{Tasks: map[string]config.Task{"test": {Steps: []config.Step{
+		localParallelStep("slow", "sleep", "10"),
+		localParallelStep("fail", "sh", "-c", "exit 3"),
+		{Name: "after", Local: true, Command: []string{"true"}},
+	}}}}
+
+	start := time.Now()
+	err := ExecTask(context.Background(), configs, "test", nil, nil)
+
+	exitErr, ok := err.(*ExitError)
+	if !ok || exitErr.ExitCode != 3 {
+		t.Fatalf("expected exit error of failed step with code 3, got: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("expected slow step to be cancelled, task took %s", elapsed)
+	}
+}
+
+func TestAcquireContainerSlot(t *testing.T) {
+	defer viper.Set("Concurrency", viper.GetInt("Concurrency"))
+	viper.Set("Concurrency", 1)
+
+	release, err := acquireContainerSlot(context.Background())
+	if err != nil {
+		t.Fatalf("expected a slot, got error: %s", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := acquireContainerSlot(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("expected to wait for the only slot, got: %v", err)
+	}
+	release()
+	if release, err = acquireContainerSlot(context.Background()); err != nil {
+		t.Fatalf("expected released slot to be acquired, got error: %s", err)
+	}
+	release()
+}
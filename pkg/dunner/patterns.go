@@ -0,0 +1,56 @@
+package dunner
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/leopardslab/dunner/pkg/config"
+)
+
+// ExpandTaskPatterns replaces the glob patterns among the given task names, like `test:*`, with the names of the
+// tasks matching them in sorted order. Names without glob characters are kept as they are, and a task matched more
+// than once is run once. It fails if a pattern is invalid or matches no task.
+func ExpandTaskPatterns(configs *config.Configs, names []string) ([]string, error) {
+	var all []string
+	for name := range configs.Tasks {
+		all = append(all, name)
+	}
+	sort.Strings(all)
+
+	var expanded []string
+	seen := make(map[string]bool)
+	add := func(name string) {
+		if !seen[name] {
+			seen[name] = true
+			expanded = append(expanded, name)
+		}
+	}
+	for _, name := range names {
+		if !isTaskPattern(name) {
+			add(name)
+			continue
+		}
+		matched := false
+		for _, task := range all {
+			ok, err := path.Match(name, task)
+			if err != nil {
+				return nil, fmt.Errorf("dunner: invalid task pattern '%s': %s", name, err.Error())
+			}
+			if ok {
+				matched = true
+				add(task)
+			}
+		}
+		if !matched {
+			return nil, fmt.Errorf("dunner: no task matches pattern '%s'", name)
+		}
+	}
+	return expanded, nil
+}
+
+// isTaskPattern returns true if the task name has glob characters
+func isTaskPattern(name string) bool {
+	return strings.ContainsAny(name, "*?[")
+}
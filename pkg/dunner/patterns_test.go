@@ -0,0 +1,47 @@
+package dunner
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/leopardslab/dunner/pkg/config"
+)
+
+func TestExpandTaskPatterns(t *testing.T) {
+	configs := &config.Configs{Tasks: map[string]config.Task{
+		"test:unit":        {},
+		"test:integration": {},
+		"build":            {},
+	}}
+
+	names, err := ExpandTaskPatterns(configs, []string{"build", "test:*", "test:unit"})
+
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if expected := []string{"build", "test:integration", "test:unit"}; !reflect.DeepEqual(names, expected) {
+		t.Fatalf("expected tasks: %v, got: %v", expected, names)
+	}
+}
+
+func TestExpandTaskPatternsWithoutMatch(t *testing.T) {
+	configs := &config.Configs{Tasks: map[string]config.Task{"build": {}}}
+
+	_, err := ExpandTaskPatterns(configs, []string{"test:*"})
+
+	expectedErr := "dunner: no task matches pattern 'test:*'"
+	if err == nil || err.Error() != expectedErr {
+		t.Fatalf("expected error: %s, got: %v", expectedErr, err)
+	}
+}
+
+func TestExpandTaskPatternsWithInvalidPattern(t *testing.T) {
+	configs := &config.Configs{Tasks: map[string]config.Task{"build": {}}}
+
+	_, err := ExpandTaskPatterns(configs, []string{"test:[*"})
+
+	expectedErr := "dunner: invalid task pattern 'test:[*': syntax error in pattern"
+	if err == nil || err.Error() != expectedErr {
+		t.Fatalf("expected error: %s, got: %v", expectedErr, err)
+	}
+}
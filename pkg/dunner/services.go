@@ -0,0 +1,57 @@
+package dunner
+
+import (
+	"sort"
+	"time"
+
+	"github.com/leopardslab/dunner/pkg/config"
+	"github.com/leopardslab/dunner/pkg/docker"
+)
+
+// defaultHealthTimeout is the time to wait for the healthcheck of a service to succeed, unless given by the service
+const defaultHealthTimeout = time.Minute
+
+// startServices creates the network of the task and starts its services on it, and returns the network the steps
+// join, to reach the services and each other, along with the function stopping the services and removing the
+// network. The network is empty if the task runs no containers.
+func startServices(task config.Task, taskName string) (string, func(), error) {
+	if !runsContainers(task) {
+		return "", func() {}, nil
+	}
+
+	var names []string
+	for name := range task.Services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var services []docker.Service
+	for _, name := range names {
+		definition := task.Services[name]
+		service := docker.Service{
+			Task:          taskName,
+			Name:          name,
+			Image:         definition.Image,
+			Env:           definition.Envs,
+			Ports:         definition.Ports,
+			Healthcheck:   definition.Healthcheck,
+			HealthTimeout: defaultHealthTimeout,
+		}
+		if definition.HealthTimeout != "" {
+			timeout, err := time.ParseDuration(definition.HealthTimeout)
+			if err != nil {
+				return "", func() {}, err
+			}
+			service.HealthTimeout = timeout
+		}
+		if definition.StopTimeout != "" {
+			timeout, err := time.ParseDuration(definition.StopTimeout)
+			if err != nil {
+				return "", func() {}, err
+			}
+			service.StopTimeout = timeout
+		}
+		services = append(services, service)
+	}
+	return docker.StartServices(taskName, services)
+}
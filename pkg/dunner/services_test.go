@@ -0,0 +1,35 @@
+package dunner
+
+import (
+	"testing"
+
+	"github.com/leopardslab/dunner/pkg/config"
+)
+
+func TestStartServicesWithoutServices(t *testing.T) {
+	network, stop, err := startServices(config.Task{}, "test")
+
+	if err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if network != "" {
+		t.Fatalf("expected no network for a task without services, got: %s", network)
+	}
+	stop()
+}
+
+func TestRunsContainers(t *testing.T) {
+	for _, tc := range []struct {
+		task     config.Task
+		expected bool
+	}{
+		{task: config.Task{}, expected: false},
+		{task: config.Task{Steps: []config.Step{{Local: true}, {Follow: "build"}}}, expected: false},
+		{task: config.Task{Steps: []config.Step{{Image: "golang"}}}, expected: true},
+		{task: config.Task{Services: map[string]config.Service{"db": {Image: "postgres"}}}, expected: true},
+	} {
+		if runs := runsContainers(tc.task); runs != tc.expected {
+			t.Errorf("expected task %+v to run containers: %t, got: %t", tc.task, tc.expected, runs)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package dunner
+
+import (
+	"github.com/leopardslab/dunner/internal/git"
+	"github.com/leopardslab/dunner/pkg/config"
+	"github.com/spf13/viper"
+)
+
+// SelectChangedTasks returns the tasks among the given ones whose inputs match any of the files changed in git since
+// the given ref, in the same order. Tasks without inputs are always selected. If the project is not in a git
+// repository, all the tasks are selected.
+func SelectChangedTasks(configs *config.Configs, taskNames []string, ref string) ([]string, error) {
+	files, err := git.ChangedFiles(viper.GetString("WorkingDirectory"), ref)
+	if err == git.ErrNotRepository {
+		log.Warnf("Running all tasks, as changed files could not be found: %s", err.Error())
+		return taskNames, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var selected []string
+	for _, taskName := range taskNames {
+		inputs := configs.Tasks[taskName].Inputs
+		if len(inputs) == 0 || anyFileMatches(files, inputs) {
+			if viper.GetBool("Explain") && len(inputs) == 0 {
+				log.Infof("Running task '%s', as it has no inputs to check for changes since '%s'", taskName, ref)
+			} else if viper.GetBool("Explain") {
+				log.Infof("Running task '%s', as some of its inputs changed since '%s'", taskName, ref)
+			}
+			selected = append(selected, taskName)
+			continue
+		}
+		log.Infof("Skipping task '%s', none of its inputs changed since '%s'", taskName, ref)
+	}
+	return selected, nil
+}
+
+func anyFileMatches(files []string, patterns []string) bool {
+	for _, file := range files {
+		if matchesPathOrParent(file, patterns) {
+			return true
+		}
+	}
+	return false
+}
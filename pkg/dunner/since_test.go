@@ -0,0 +1,77 @@
+package dunner
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/leopardslab/dunner/pkg/config"
+	"github.com/spf13/viper"
+)
+
+func TestSelectChangedTasks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dunner-since")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"-c", "user.name=dunner", "-c", "user.email=dunner@example.com", "commit", "-q", "--allow-empty", "-m", "initial"},
+	} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %s: %s", args, err, out)
+		}
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "web", "src"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "web", "src", "app.js"), []byte("app"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	workingDir := viper.GetString("WorkingDirectory")
+	viper.Set("WorkingDirectory", dir)
+	defer viper.Set("WorkingDirectory", workingDir)
+	configs := &config.Configs{Tasks: map[string]config.Task{
+		"api":   {Inputs: []string{"api", "*.go"}},
+		"web":   {Inputs: []string{"web"}},
+		"lint":  {Inputs: []string{"*.js"}},
+		"setup": {},
+	}}
+
+	selected, err := SelectChangedTasks(configs, []string{"api", "web", "lint", "setup"}, "HEAD")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"web", "lint", "setup"}
+	if !reflect.DeepEqual(selected, expected) {
+		t.Fatalf("expected tasks: %v, got: %v", expected, selected)
+	}
+}
+
+func TestSelectChangedTasksNotInRepository(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dunner-since")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	workingDir := viper.GetString("WorkingDirectory")
+	viper.Set("WorkingDirectory", dir)
+	defer viper.Set("WorkingDirectory", workingDir)
+	configs := &config.Configs{Tasks: map[string]config.Task{"api": {Inputs: []string{"api"}}}}
+
+	selected, err := SelectChangedTasks(configs, []string{"api"}, "HEAD")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(selected, []string{"api"}) {
+		t.Fatalf("expected all tasks to be selected, got: %v", selected)
+	}
+}
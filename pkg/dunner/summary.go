@@ -0,0 +1,141 @@
+package dunner
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/leopardslab/dunner/internal/logger"
+	"github.com/leopardslab/dunner/pkg/docker"
+	"github.com/spf13/viper"
+)
+
+// StepResult is the outcome of a step, as reported in the summary of a run
+type StepResult struct {
+	Task     string
+	Step     string
+	Duration time.Duration
+	Err      error
+	// AllowedFailure is true if the step failed but is allowed to
+	AllowedFailure bool
+}
+
+// stepResults collects the results of the steps of a run, in the order they end
+type stepResults struct {
+	sync.Mutex
+	list []StepResult
+}
+
+// collectStepResults registers hooks collecting the result of every step run afterwards. As their output is
+// captured with the `Summary-only` setting, the output of failed steps is displayed as soon as they fail.
+func collectStepResults() *stepResults {
+	results := &stepResults{}
+	RegisterHooks(Hooks{
+		AfterStep: func(step docker.Step, result *docker.Result, err error) {
+			results.Lock()
+			defer results.Unlock()
+			stepResult := StepResult{Task: step.Task, Step: step.Name, Err: err, AllowedFailure: err != nil && step.AllowFailure}
+			if result != nil {
+				stepResult.Duration = result.Duration
+			}
+			results.list = append(results.list, stepResult)
+
+			if err != nil && result != nil && (result.Output != "" || result.Error != "") {
+				fmt.Printf("Output of step '%s' of '%s' task:\n", step.Name, step.Task)
+				fmt.Print(result.Output)
+				if result.Error != "" {
+					logger.ErrorOutput("%s", result.Error)
+				}
+			}
+		},
+	})
+	return results
+}
+
+// print prints a table of the results of the steps, followed by the ID of the run labelling its containers
+func (results *stepResults) print() {
+	results.Lock()
+	defer results.Unlock()
+	printStepSummary(os.Stdout, results.list)
+	fmt.Printf("Run ID: %s\n", docker.RunID)
+}
+
+// printStepSummary writes a table of the results of the steps to w, with columns as wide as their content
+func printStepSummary(w io.Writer, results []StepResult) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TASK\tSTEP\tSTATUS\tDURATION\tERROR")
+	for _, result := range results {
+		status, errMsg := "succeeded", ""
+		if result.Err != nil {
+			status, errMsg = "failed", result.Err.Error()
+			if result.AllowedFailure {
+				status = "failed (allowed)"
+			}
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", result.Task, result.Step, status, result.Duration.Round(time.Millisecond), errMsg)
+	}
+	tw.Flush()
+}
+
+// logFile returns the file the output of the step is saved to, as `<task>/<step>.log` in the directory given by the
+// `Log-dir` setting, relative to the project directory. It returns an empty string if output is not to be saved.
+func logFile(task string, step string) string {
+	dir := logDir()
+	if dir == "" {
+		return ""
+	}
+	return filepath.Join(dir, task, step+".log")
+}
+
+// logDir returns the directory given by the `Log-dir` setting, relative to the project directory. It returns an empty
+// string if output is not to be saved.
+func logDir() string {
+	dir := viper.GetString("Log-dir")
+	if dir == "" || filepath.IsAbs(dir) {
+		return dir
+	}
+	return filepath.Join(viper.GetString("WorkingDirectory"), dir)
+}
+
+// failedLogFiles collects the log files of the steps failing in a run, to be printed at its end
+type failedLogFiles struct {
+	sync.Mutex
+	list []string
+}
+
+// collectFailedLogFiles registers hooks collecting the log file of every step failing afterwards
+func collectFailedLogFiles() *failedLogFiles {
+	files := &failedLogFiles{}
+	RegisterHooks(Hooks{
+		OnFailure: func(step docker.Step, err error) {
+			if step.LogFile == "" {
+				return
+			}
+			files.Lock()
+			defer files.Unlock()
+			files.list = append(files.list, step.LogFile)
+		},
+	})
+	return files
+}
+
+// print prints the log files of the failed steps, if any, along with the logs of the run
+func (files *failedLogFiles) print() {
+	files.Lock()
+	defer files.Unlock()
+	printFailedLogFiles(logger.Log.Out, files.list)
+}
+
+func printFailedLogFiles(w io.Writer, files []string) {
+	if len(files) == 0 {
+		return
+	}
+	fmt.Fprintln(w, "Output of failed steps is saved to:")
+	for _, file := range files {
+		fmt.Fprintf(w, "  %s\n", file)
+	}
+}
@@ -0,0 +1,131 @@
+package dunner
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/leopardslab/dunner/pkg/config"
+	"github.com/spf13/viper"
+)
+
+func TestCollectStepResults(t *testing.T) {
+	defer ClearHooks()
+	defer viper.Set("Summary-only", false)
+	viper.Set("Summary-only", true)
+	results := collectStepResults()
+	configs := &config.Configs{Tasks: map[string]config.Task{"test": {Steps: []config.Step{
+		{Name: "pass", Local: true, Command: []string{"echo", "hidden"}},
+		{Name: "allowed", Local: true, Command: []string{"sh", "-c", "exit 2"}, AllowFailure: true},
+		{Name: "fail", Local: true, Command: []string{"sh", "-c", "echo failing; exit 3"}},
+	}}}}
+
+	if err := ExecTask(context.Background(), configs, "test", nil, nil); err == nil {
+		t.Fatal("expected error of failed step, got nil")
+	}
+
+	if len(results.list) != 3 {
+		t.Fatalf("expected results of 3 steps, got: %+v", results.list)
+	}
+	for i, expected := range []struct {
+		step    string
+		failed  bool
+		allowed bool
+	}{{"pass", false, false}, {"allowed", true, true}, {"fail", true, false}} {
+		result := results.list[i]
+		if result.Task != "test" || result.Step != expected.step || (result.Err != nil) != expected.failed ||
+			result.AllowedFailure != expected.allowed {
+			t.Errorf("expected result of step '%s', failed: %t, allowed: %t, got: %+v",
+				expected.step, expected.failed, expected.allowed, result)
+		}
+	}
+}
+
+func TestPrintStepSummary(t *testing.T) {
+	var out bytes.Buffer
+	printStepSummary(&out, []StepResult{
+		{Task: "build", Step: "compile-everything", Duration: 1500 * time.Millisecond},
+		{Task: "build", Step: "lint", Err: errors.New("exit code 1"), AllowedFailure: true},
+		{Task: "build", Step: "test", Duration: 2 * time.Second, Err: errors.New("exit code 2")},
+	})
+
+	expected := "TASK   STEP                STATUS            DURATION  ERROR\n" +
+		"build  compile-everything  succeeded         1.5s      \n" +
+		"build  lint                failed (allowed)  0s        exit code 1\n" +
+		"build  test                failed            2s        exit code 2\n"
+	if out.String() != expected {
+		t.Fatalf("expected summary:\n%s\ngot:\n%s", expected, out.String())
+	}
+}
+
+func TestLogFile(t *testing.T) {
+	defer viper.Set("Log-dir", "")
+	defer viper.Set("WorkingDirectory", viper.GetString("WorkingDirectory"))
+	viper.Set("WorkingDirectory", "/project")
+
+	viper.Set("Log-dir", "")
+	if file := logFile("build", "test"); file != "" {
+		t.Errorf("expected no log file, got: %s", file)
+	}
+	viper.Set("Log-dir", ".dunner/logs")
+	if file := logFile("build", "test"); file != "/project/.dunner/logs/build/test.log" {
+		t.Errorf("expected log file relative to project directory, got: %s", file)
+	}
+	viper.Set("Log-dir", "/var/log/dunner")
+	if file := logFile("build", "test"); file != "/var/log/dunner/build/test.log" {
+		t.Errorf("expected log file in absolute directory, got: %s", file)
+	}
+}
+
+func TestCollectFailedLogFiles(t *testing.T) {
+	defer ClearHooks()
+	dir, err := ioutil.TempDir("", "dunner-logs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer viper.Set("Log-dir", "")
+	viper.Set("Log-dir", dir)
+	files := collectFailedLogFiles()
+	configs := &config.Configs{Tasks: map[string]config.Task{"test": {Steps: []config.Step{
+		{Name: "pass", Local: true, Command: []string{"echo", "passing"}},
+		{Name: "fail", Local: true, Command: []string{"sh", "-c", "echo failing; exit 3"}},
+	}}}}
+
+	if err := ExecTask(context.Background(), configs, "test", nil, nil); err == nil {
+		t.Fatal("expected error of failed step, got nil")
+	}
+
+	for step, expected := range map[string]string{"pass": "passing\n", "fail": "failing\n"} {
+		content, err := ioutil.ReadFile(filepath.Join(dir, "test", step+".log"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(content) != expected {
+			t.Errorf("expected log of step '%s': %q, got: %q", step, expected, string(content))
+		}
+	}
+	if expected := []string{filepath.Join(dir, "test", "fail.log")}; !reflect.DeepEqual(files.list, expected) {
+		t.Errorf("expected log files of failed steps: %v, got: %v", expected, files.list)
+	}
+}
+
+func TestPrintFailedLogFiles(t *testing.T) {
+	var out bytes.Buffer
+
+	printFailedLogFiles(&out, nil)
+	if out.Len() != 0 {
+		t.Fatalf("expected nothing printed without failed steps, got: %q", out.String())
+	}
+
+	printFailedLogFiles(&out, []string{".dunner/logs/build/test.log"})
+	if expected := "Output of failed steps is saved to:\n  .dunner/logs/build/test.log\n"; out.String() != expected {
+		t.Fatalf("expected: %q, got: %q", expected, out.String())
+	}
+}
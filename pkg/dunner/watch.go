@@ -0,0 +1,176 @@
+package dunner
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/viper"
+)
+
+// IgnoreFileName is the file listing the patterns of files whose changes do not re-run the task in watch mode
+const IgnoreFileName = ".dunnerignore"
+
+// watchDebounce is the time to wait for further changes before re-running the task, so that a burst of changes,
+// like saving many files at once, runs the task only once
+const watchDebounce = 300 * time.Millisecond
+
+// Watch runs the task given as the first of args, and runs it again whenever files of the project change, until
+// interrupted. Only changes to files matching `Watch-pattern` globs re-run the task if any are given, and files matching
+// the patterns in `.dunnerignore` are never watched. Failures of a run are logged and do not stop watching.
+func Watch(args []string) error {
+	root := viper.GetString("WorkingDirectory")
+	ignored, err := loadIgnorePatterns(filepath.Join(root, IgnoreFileName))
+	if err != nil {
+		return err
+	}
+	patterns := viper.GetStringSlice("Watch-pattern")
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("dunner: failed to watch files: %s", err.Error())
+	}
+	defer watcher.Close()
+	if err := watchDir(watcher, root, ignored); err != nil {
+		return err
+	}
+
+	runTask := func() {
+		start := time.Now()
+		err := run(args)
+		emitRunFinished(start, err)
+		if err != nil && err != errValidationFailed {
+			log.Error(err)
+		}
+		log.Infof("Watching for changes to re-run task '%s'...", args[0])
+	}
+	runTask()
+
+	var debounce <-chan time.Time
+	var changed string
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			rel, err := filepath.Rel(root, event.Name)
+			if err != nil || matchesPathOrParent(rel, ignored) {
+				continue
+			}
+			if event.Op&fsnotify.Create != 0 {
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+					if err := watchDir(watcher, event.Name, ignored); err != nil {
+						log.Error(err)
+					}
+					continue
+				}
+			}
+			if event.Op == fsnotify.Chmod || !matchesAny(rel, patterns) {
+				continue
+			}
+			changed = rel
+			debounce = time.After(watchDebounce)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			log.Errorf("dunner: error watching files: %s", err.Error())
+		case <-debounce:
+			debounce = nil
+			fmt.Printf("\n%s %s changed, re-running task '%s' %s\n\n", strings.Repeat("-", 10), changed, args[0], strings.Repeat("-", 10))
+			runTask()
+		}
+	}
+}
+
+// watchDir adds the directory and all its sub-directories, that are not ignored, to the watcher
+func watchDir(watcher *fsnotify.Watcher, dir string, ignored []string) error {
+	root := viper.GetString("WorkingDirectory")
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		if rel, err := filepath.Rel(root, path); err == nil && rel != "." && matchesPathOrParent(rel, ignored) {
+			return filepath.SkipDir
+		}
+		if err := watcher.Add(path); err != nil {
+			return fmt.Errorf("dunner: failed to watch directory %s: %s", path, err.Error())
+		}
+		return nil
+	})
+}
+
+// loadIgnorePatterns reads the glob patterns from the ignore file, one per line. Empty lines and lines starting
+// with '#' are skipped. The `.git` directory is always ignored, and so is the directory the output of steps is saved
+// to if it is in the project directory, as each run would otherwise trigger the next one.
+func loadIgnorePatterns(ignoreFile string) ([]string, error) {
+	patterns := []string{".git"}
+	if dir := logDir(); dir != "" {
+		rel, err := filepath.Rel(viper.GetString("WorkingDirectory"), dir)
+		if err == nil && rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			patterns = append(patterns, filepath.ToSlash(rel))
+		}
+	}
+	file, err := os.Open(ignoreFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return patterns, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		patterns = append(patterns, strings.Trim(line, "/"))
+	}
+	return patterns, scanner.Err()
+}
+
+// matchesPathOrParent returns true if the path relative to the project directory, or any of its parent directories,
+// matches one of the patterns
+func matchesPathOrParent(rel string, patterns []string) bool {
+	elements := strings.Split(filepath.ToSlash(rel), "/")
+	for i := range elements {
+		for _, pattern := range patterns {
+			if matchGlob(pattern, strings.Join(elements[:i+1], "/")) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matchesAny returns true if the path matches any of the glob patterns, or if there are no patterns
+func matchesAny(path string, patterns []string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if matchGlob(pattern, filepath.ToSlash(path)) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchGlob returns true if either the slash separated path, or its base name, matches the glob pattern
+func matchGlob(pattern string, path string) bool {
+	if ok, _ := filepath.Match(pattern, path); ok {
+		return true
+	}
+	ok, _ := filepath.Match(pattern, filepath.Base(path))
+	return ok
+}
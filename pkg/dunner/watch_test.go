@@ -0,0 +1,110 @@
+package dunner
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestLoadIgnorePatterns(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dunner-watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ignoreFile := filepath.Join(dir, IgnoreFileName)
+	content := []byte("# dependencies\nnode_modules/\n\n*.log\nbuild/out\n")
+	if err := ioutil.WriteFile(ignoreFile, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	patterns, err := loadIgnorePatterns(ignoreFile)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{".git", "node_modules", "*.log", "build/out"}
+	if !reflect.DeepEqual(patterns, expected) {
+		t.Fatalf("expected patterns: %v, got: %v", expected, patterns)
+	}
+}
+
+func TestLoadIgnorePatternsWithoutIgnoreFile(t *testing.T) {
+	patterns, err := loadIgnorePatterns(filepath.Join(os.TempDir(), "missing", IgnoreFileName))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(patterns, []string{".git"}) {
+		t.Fatalf("expected only .git to be ignored, got: %v", patterns)
+	}
+}
+
+func TestLoadIgnorePatternsIgnoresLogDir(t *testing.T) {
+	defer viper.Set("WorkingDirectory", viper.GetString("WorkingDirectory"))
+	defer viper.Set("Log-dir", viper.GetString("Log-dir"))
+	root := filepath.Join(os.TempDir(), "project")
+	viper.Set("WorkingDirectory", root)
+	missing := filepath.Join(root, IgnoreFileName)
+
+	cases := map[string][]string{
+		".dunner/logs":                         {".git", ".dunner/logs"},
+		filepath.Join(root, "logs"):            {".git", "logs"},
+		filepath.Join(os.TempDir(), "outside"): {".git"},
+	}
+	for logDir, expected := range cases {
+		viper.Set("Log-dir", logDir)
+
+		patterns, err := loadIgnorePatterns(missing)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(patterns, expected) {
+			t.Errorf("expected patterns with log dir %s: %v, got: %v", logDir, expected, patterns)
+		}
+	}
+
+	viper.Set("Log-dir", ".dunner/logs")
+	patterns, _ := loadIgnorePatterns(missing)
+	if !matchesPathOrParent(filepath.Join(".dunner", "logs", "build", "compile.log"), patterns) {
+		t.Errorf("expected log files of steps to be ignored with patterns: %v", patterns)
+	}
+}
+
+func TestMatchesPathOrParent(t *testing.T) {
+	ignored := []string{".git", "node_modules", "*.log", "build/out"}
+	cases := map[string]bool{
+		".git/HEAD":                   true,
+		"node_modules":                true,
+		"web/node_modules/react/a.js": true,
+		"logs/debug.log":              true,
+		"build/out/app":               true,
+		"build/main.go":               false,
+		"main.go":                     false,
+	}
+	for path, expected := range cases {
+		if matchesPathOrParent(path, ignored) != expected {
+			t.Errorf("expected ignored to be %v for %s", expected, path)
+		}
+	}
+}
+
+func TestMatchesAny(t *testing.T) {
+	if !matchesAny("pkg/main.go", nil) {
+		t.Error("expected every path to match when there are no patterns")
+	}
+	if !matchesAny("pkg/main.go", []string{"*.md", "*.go"}) {
+		t.Error("expected path to match by its base name")
+	}
+	if !matchesAny("pkg/main.go", []string{"pkg/*"}) {
+		t.Error("expected path to match by its relative path")
+	}
+	if matchesAny("pkg/main.go", []string{"*.md"}) {
+		t.Error("expected path not to match")
+	}
+}
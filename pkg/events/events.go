@@ -0,0 +1,163 @@
+// Package events emits the events of a run of Dunner as newline-delimited JSON, for tools like log aggregators to
+// follow a run. Each line is an Event, which names the task and step it is about, so that the events of steps run
+// concurrently can be told apart.
+package events
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// Types of events
+const (
+	StepStarted  = "step_started"  // A step starts, with its image
+	ImagePulled  = "image_pulled"  // The image of a step was pulled, with the number of layers and their size
+	Log          = "log"           // A line of output of a command of a step, with the stream it was written to
+	StepFinished = "step_finished" // A step ended, with its exit code, duration and error if it failed
+	RunFinished  = "run_finished"  // The run ended, with its duration and error if it failed
+)
+
+// Streams of log events
+const (
+	Stdout = "stdout"
+	Stderr = "stderr"
+)
+
+// Event is an event of a run, emitted as a line of JSON. Fields not relevant to the type of the event are omitted.
+type Event struct {
+	Type     string    `json:"type"`
+	Time     time.Time `json:"time"`
+	Task     string    `json:"task,omitempty"`
+	Step     string    `json:"step,omitempty"`
+	Image    string    `json:"image,omitempty"`
+	Layers   int       `json:"layers,omitempty"` // Number of layers pulled
+	Size     int64     `json:"size,omitempty"`   // Download size of the layers pulled, in bytes
+	Stream   string    `json:"stream,omitempty"` // Stream of the line of a log event, `stdout` or `stderr`
+	Line     string    `json:"line,omitempty"`   // Line of output without its line ending
+	ExitCode *int      `json:"exit_code,omitempty"`
+	Duration float64   `json:"duration,omitempty"` // Duration of the step or run, in seconds
+	Error    string    `json:"error,omitempty"`
+}
+
+var output = struct {
+	sync.Mutex
+	out io.Writer
+}{out: os.Stdout}
+
+// Enabled returns true if events are emitted, with the `Events` setting
+func Enabled() bool {
+	return viper.GetBool("Events")
+}
+
+// SetOutput sets the writer events are emitted to, the standard output by default
+func SetOutput(out io.Writer) {
+	output.Lock()
+	defer output.Unlock()
+	output.out = out
+}
+
+// Emit writes the event as a line of JSON if events are enabled. The time of the event is set to now if not set.
+func Emit(event Event) {
+	if !Enabled() {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	b, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	output.Lock()
+	defer output.Unlock()
+	output.out.Write(append(b, '\n'))
+}
+
+// LineWriter is an io.Writer emitting each line written to it as a log event of the step. A partial line is
+// buffered until it is completed or flushed.
+type LineWriter struct {
+	task   string
+	step   string
+	stream string
+	buf    []byte
+}
+
+// NewLineWriter returns a pointer to new LineWriter object emitting lines of the stream of the step
+func NewLineWriter(task string, step string, stream string) *LineWriter {
+	return &LineWriter{task: task, step: step, stream: stream}
+}
+
+// Write function to implement io.Writer interface
+func (w *LineWriter) Write(b []byte) (n int, err error) {
+	w.buf = append(w.buf, b...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		w.emit(w.buf[:i])
+		w.buf = w.buf[i+1:]
+	}
+	return len(b), nil
+}
+
+// Flush emits the buffered partial line, if any
+func (w *LineWriter) Flush() {
+	if len(w.buf) != 0 {
+		w.emit(w.buf)
+		w.buf = nil
+	}
+}
+
+func (w *LineWriter) emit(line []byte) {
+	if n := len(line); n != 0 && line[n-1] == '\r' {
+		line = line[:n-1]
+	}
+	Emit(Event{Type: Log, Task: w.task, Step: w.step, Stream: w.stream, Line: string(line)})
+}
+
+// Logs emits the standard output and error of the commands of a step as log events. A nil Logs emits nothing.
+type Logs struct {
+	stdout *LineWriter
+	stderr *LineWriter
+}
+
+// NewLogs returns the log events of the step, nil if events are not enabled
+func NewLogs(task string, step string) *Logs {
+	if !Enabled() {
+		return nil
+	}
+	return &Logs{stdout: NewLineWriter(task, step, Stdout), stderr: NewLineWriter(task, step, Stderr)}
+}
+
+// Stdout returns the writer emitting the lines of standard output
+func (l *Logs) Stdout() io.Writer {
+	if l == nil {
+		return ioutil.Discard
+	}
+	return l.stdout
+}
+
+// Stderr returns the writer emitting the lines of standard error
+func (l *Logs) Stderr() io.Writer {
+	if l == nil {
+		return ioutil.Discard
+	}
+	return l.stderr
+}
+
+// Flush emits the partial last lines of the streams, if any
+func (l *Logs) Flush() {
+	if l == nil {
+		return
+	}
+	l.stdout.Flush()
+	l.stderr.Flush()
+}
@@ -0,0 +1,106 @@
+package events
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func enableEvents(buf *bytes.Buffer) func() {
+	viper.Set("Events", true)
+	SetOutput(buf)
+	return func() {
+		viper.Set("Events", false)
+		SetOutput(os.Stdout)
+	}
+}
+
+func decodeEvents(t *testing.T, buf *bytes.Buffer) []Event {
+	var events []Event
+	for _, line := range strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n") {
+		var event Event
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			t.Fatalf("expected a JSON event per line, got: %q: %s", line, err)
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+func TestEmit(t *testing.T) {
+	var buf bytes.Buffer
+	defer enableEvents(&buf)()
+	exitCode := 0
+
+	Emit(Event{Type: StepFinished, Task: "build", Step: "test", ExitCode: &exitCode, Duration: 1.5})
+
+	events := decodeEvents(t, &buf)
+	if len(events) != 1 {
+		t.Fatalf("expected one event, got: %v", events)
+	}
+	event := events[0]
+	if event.Type != StepFinished || event.Task != "build" || event.Step != "test" || event.Duration != 1.5 {
+		t.Errorf("unexpected event: %+v", event)
+	}
+	if event.ExitCode == nil || *event.ExitCode != 0 || event.Time.IsZero() {
+		t.Errorf("expected exit code 0 and time of event, got: %+v", event)
+	}
+	if strings.Contains(buf.String(), `"line"`) {
+		t.Errorf("expected fields not set to be omitted, got: %s", buf.String())
+	}
+}
+
+func TestEmitDisabled(t *testing.T) {
+	var buf bytes.Buffer
+	SetOutput(&buf)
+	defer SetOutput(os.Stdout)
+
+	Emit(Event{Type: RunFinished})
+
+	if buf.Len() != 0 {
+		t.Fatalf("expected no event, got: %s", buf.String())
+	}
+}
+
+func TestLogs(t *testing.T) {
+	var buf bytes.Buffer
+	defer enableEvents(&buf)()
+	logs := NewLogs("build", "test")
+
+	fmt.Fprint(logs.Stdout(), "first\r\nsec")
+	fmt.Fprint(logs.Stderr(), "error\n")
+	fmt.Fprint(logs.Stdout(), "ond\nlast")
+	logs.Flush()
+
+	expected := []Event{
+		{Type: Log, Task: "build", Step: "test", Stream: Stdout, Line: "first"},
+		{Type: Log, Task: "build", Step: "test", Stream: Stderr, Line: "error"},
+		{Type: Log, Task: "build", Step: "test", Stream: Stdout, Line: "second"},
+		{Type: Log, Task: "build", Step: "test", Stream: Stdout, Line: "last"},
+	}
+	events := decodeEvents(t, &buf)
+	if len(events) != len(expected) {
+		t.Fatalf("expected events: %+v, got: %+v", expected, events)
+	}
+	for i, event := range events {
+		event.Time = expected[i].Time
+		if event != expected[i] {
+			t.Errorf("expected event: %+v, got: %+v", expected[i], event)
+		}
+	}
+}
+
+func TestLogsDisabled(t *testing.T) {
+	logs := NewLogs("build", "test")
+
+	if logs != nil {
+		t.Fatalf("expected no logs, got: %v", logs)
+	}
+	fmt.Fprint(logs.Stdout(), "discarded\n")
+	logs.Flush()
+}
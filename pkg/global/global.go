@@ -1,8 +1,10 @@
 package global
 
-// VERSION is to hold the Dunner version
+// VERSION is to hold the Dunner version, and COMMIT and DATE the git commit and date Dunner is built from and at
 var (
 	VERSION                  string
+	COMMIT                   string
+	DATE                     string
 	DunnerCookbookRecipesURL = "https://raw.githubusercontent.com/leopardslab/dunner-cookbook/master/recipes/"
 	DunnerCookbookListURL    = "https://raw.githubusercontent.com/leopardslab/dunner-cookbook/master/cookbook.yml"
 )
@@ -0,0 +1,83 @@
+/*
+Package notify sends notifications of the completion of tasks to webhooks, like the incoming webhooks of Slack.
+*/
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Status of the completed task
+const (
+	StatusSuccess = "success"
+	StatusFailure = "failure"
+)
+
+// timeout is the time given to the webhook to respond
+const timeout = 10 * time.Second
+
+// Notification is the JSON payload posted to the webhook when a task completes. `text` holds a summary of the
+// notification, for webhooks like the ones of Slack that display it as message.
+type Notification struct {
+	Text        string       `json:"text"`
+	Task        string       `json:"task"`
+	Status      string       `json:"status"`
+	Duration    float64      `json:"duration"` // Duration of the task in seconds
+	FailedSteps []FailedStep `json:"failed_steps"`
+}
+
+// FailedStep is a step that failed the task
+type FailedStep struct {
+	Task  string `json:"task"`
+	Step  string `json:"step"`
+	Error string `json:"error"`
+}
+
+// New returns the notification of the completion of the task, which failed with `err` if not nil
+func New(task string, err error, duration time.Duration, failedSteps []FailedStep) Notification {
+	n := Notification{
+		Task:        task,
+		Status:      StatusSuccess,
+		Duration:    duration.Seconds(),
+		FailedSteps: failedSteps,
+	}
+	duration = duration.Round(time.Millisecond)
+	if err == nil {
+		n.Text = fmt.Sprintf("Task '%s' succeeded in %s", task, duration)
+		return n
+	}
+
+	n.Status = StatusFailure
+	n.Text = fmt.Sprintf("Task '%s' failed in %s: %s", task, duration, err.Error())
+	if len(failedSteps) != 0 {
+		var steps []string
+		for _, s := range failedSteps {
+			steps = append(steps, fmt.Sprintf("'%s' of '%s'", s.Step, s.Task))
+		}
+		n.Text += fmt.Sprintf(". Failed steps: %s", strings.Join(steps, ", "))
+	}
+	return n
+}
+
+// Send posts the notification as JSON to the webhook URL. A response status other than 2xx is an error.
+func Send(url string, n Notification) error {
+	body, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	client := http.Client{Timeout: timeout}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("notify: failed to send notification: %s", err.Error())
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("notify: webhook responded to notification with status %s", resp.Status)
+	}
+	return nil
+}
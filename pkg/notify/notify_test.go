@@ -0,0 +1,69 @@
+package notify
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNewOnSuccess(t *testing.T) {
+	n := New("build", nil, 1500*time.Millisecond, nil)
+
+	expected := Notification{Text: "Task 'build' succeeded in 1.5s", Task: "build", Status: StatusSuccess, Duration: 1.5}
+	if !reflect.DeepEqual(n, expected) {
+		t.Fatalf("expected: %+v, got: %+v", expected, n)
+	}
+}
+
+func TestNewOnFailure(t *testing.T) {
+	failed := []FailedStep{{Task: "build", Step: "test", Error: "exit code 1"}}
+
+	n := New("build", errors.New("exit code 1"), 2*time.Second, failed)
+
+	if n.Status != StatusFailure {
+		t.Fatalf("expected status %s, got: %s", StatusFailure, n.Status)
+	}
+	expected := "Task 'build' failed in 2s: exit code 1. Failed steps: 'test' of 'build'"
+	if n.Text != expected {
+		t.Fatalf("expected text: %s, got: %s", expected, n.Text)
+	}
+}
+
+func TestSend(t *testing.T) {
+	var received Notification
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("expected JSON content type, got: %s", r.Header.Get("Content-Type"))
+		}
+		if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer server.Close()
+	n := New("build", nil, time.Second, nil)
+
+	if err := Send(server.URL, n); err != nil {
+		t.Fatalf("expected no error, got: %s", err)
+	}
+	if !reflect.DeepEqual(received, n) {
+		t.Fatalf("expected webhook to receive: %+v, got: %+v", n, received)
+	}
+}
+
+func TestSendWithErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	err := Send(server.URL, New("build", nil, time.Second, nil))
+
+	expected := "notify: webhook responded to notification with status 403 Forbidden"
+	if err == nil || err.Error() != expected {
+		t.Fatalf("expected error: %s, got: %v", expected, err)
+	}
+}